@@ -1,12 +1,11 @@
 package main
 
 import (
+	"avantai/pkg/marketdata"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
 	"sort"
 	"strings"
@@ -17,20 +16,19 @@ import (
 
 // Configuration
 const (
-	BaseURL           = "https://api.marketstack.com/v2"
 	ConfigFilePath    = "pkg/ep/config.csv"
 	MinMarketCap      = 300_000_000.0 // $300M
 	MinDollarVolume   = 5_000_000.0   // $5M
 	MinReturnPct      = 100.0         // 100%
 	MinDurationDays   = 21
-	MaxDurationDays   = 315                    // ~15 months
-	LiquidityWindow   = 21                     // Days for liquidity calculation
-	MinTradingDaysIPO = 126                    // ~6 months before high
-	RateLimitDelay    = 220 * time.Millisecond // ~4.5 requests/sec
-	MaxRetries        = 3                      // Maximum retry attempts for rate limit errors
-	RetryBaseDelay    = 5 * time.Second        // Base delay for exponential backoff
+	MaxDurationDays   = 315 // ~15 months
+	LiquidityWindow   = 21  // Days for liquidity calculation
+	MinTradingDaysIPO = 126 // ~6 months before high
 )
 
+// HistoryStartDate is the earliest date requested from the data provider.
+var HistoryStartDate = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
 // API Response structures
 type TickersResponse struct {
 	Data []struct {
@@ -86,15 +84,11 @@ type QualifyingMove struct {
 }
 
 type Scanner struct {
-	apiKey string
-	client *http.Client
+	provider marketdata.Provider
 }
 
-func NewScanner(apiKey string) *Scanner {
-	return &Scanner{
-		apiKey: apiKey,
-		client: &http.Client{Timeout: 60 * time.Second},
-	}
+func NewScanner(provider marketdata.Provider) *Scanner {
+	return &Scanner{provider: provider}
 }
 
 // Load tickers from config CSV file
@@ -149,77 +143,49 @@ func (s *Scanner) LoadTickersFromCSV(filepath string) ([]string, error) {
 	return tickers, nil
 }
 
-// Fetch all historical EOD data for a ticker with retry logic
+// Fetch all historical EOD data for a ticker. Bars are requested fully
+// adjusted, so AdjClose and Volume are consistent across splits.
 func (s *Scanner) GetEODData(ticker string) ([]EODData, error) {
 	fmt.Printf("    Fetching EOD data for %s...\n", ticker)
-	allData := []EODData{}
-	offset := 0
-	limit := 100
-
-	for {
-		var eodResp EODResponse
-		var err error
-
-		// Retry logic for rate limiting
-		for attempt := 0; attempt <= MaxRetries; attempt++ {
-			// Wait for rate limiter
-			time.Sleep(RateLimitDelay)
-
-			url := fmt.Sprintf("%s/eod?access_key=%s&symbols=%s&limit=%d&offset=%d",
-				BaseURL, s.apiKey, ticker, limit, offset)
-
-			resp, httpErr := s.client.Get(url)
-			if httpErr != nil {
-				err = httpErr
-				break
-			}
-
-			body, readErr := io.ReadAll(resp.Body)
-			resp.Body.Close()
-			if readErr != nil {
-				err = readErr
-				break
-			}
 
-			// Check for rate limit error
-			if resp.StatusCode == 429 {
-				if attempt < MaxRetries {
-					// Exponential backoff
-					backoffDelay := RetryBaseDelay * time.Duration(1<<uint(attempt))
-					fmt.Printf("    Rate limit hit for %s (attempt %d/%d), waiting %v...\n",
-						ticker, attempt+1, MaxRetries+1, backoffDelay)
-					time.Sleep(backoffDelay)
-					continue
-				}
-				return nil, fmt.Errorf("rate limit exceeded after %d retries for %s", MaxRetries, ticker)
-			}
-
-			if resp.StatusCode != 200 {
-				fmt.Printf("    ERROR: API returned status %s for %s\n", resp.Status, ticker)
-				return nil, fmt.Errorf("API error for %s: %s", ticker, resp.Status)
-			}
-
-			if unmarshalErr := json.Unmarshal(body, &eodResp); unmarshalErr != nil {
-				return nil, fmt.Errorf("failed to parse EOD response: %w", unmarshalErr)
-			}
-
-			// Success - break retry loop
-			err = nil
-			break
-		}
+	end := time.Now()
+	bars, err := s.provider.DailyBars(ticker, HistoryStartDate, end, marketdata.AdjustmentAll)
+	if err != nil {
+		fmt.Printf("    ERROR: %s request failed for %s: %v\n", s.provider.Name(), ticker, err)
+		return nil, fmt.Errorf("API error for %s: %w", ticker, err)
+	}
 
-		if err != nil {
-			return nil, err
+	// Raw (unadjusted) bars are a second request; the Adj* fields drive the
+	// analysis, the raw fields are kept so reports show traded prices.
+	rawBars, err := s.provider.DailyBars(ticker, HistoryStartDate, end, marketdata.AdjustmentRaw)
+	if err != nil {
+		fmt.Printf("    ERROR: %s raw request failed for %s: %v\n", s.provider.Name(), ticker, err)
+		return nil, fmt.Errorf("API error for %s: %w", ticker, err)
+	}
+	rawByDay := make(map[string]marketdata.Bar, len(rawBars))
+	for _, bar := range rawBars {
+		rawByDay[bar.Time.UTC().Format("2006-01-02")] = bar
+	}
+
+	allData := make([]EODData, 0, len(bars))
+	for _, bar := range bars {
+		row := EODData{
+			Date:      bar.Time.Format("2006-01-02T15:04:05-0700"),
+			AdjOpen:   bar.Open,
+			AdjHigh:   bar.High,
+			AdjLow:    bar.Low,
+			AdjClose:  bar.Close,
+			AdjVolume: bar.Volume,
+			Symbol:    ticker,
 		}
-
-		fmt.Printf("    Received %d data points (offset=%d, total=%d)\n", len(eodResp.Data), offset, len(allData)+len(eodResp.Data))
-		allData = append(allData, eodResp.Data...)
-
-		if len(eodResp.Data) < limit {
-			break
+		if raw, ok := rawByDay[bar.Time.UTC().Format("2006-01-02")]; ok {
+			row.Open = raw.Open
+			row.High = raw.High
+			row.Low = raw.Low
+			row.Close = raw.Close
+			row.Volume = raw.Volume
 		}
-
-		offset += limit
+		allData = append(allData, row)
 	}
 
 	fmt.Printf("    Total data points for %s: %d\n", ticker, len(allData))
@@ -588,21 +554,22 @@ func main() {
 		log.Println("Error loading .env file, checking for environment variable")
 	}
 
-	apiKey := os.Getenv("MARKETSTACK_TOKEN")
-	if apiKey == "" {
-		log.Fatal("ERROR: Please set MARKETSTACK_TOKEN environment variable")
+	// Marketstack remains the default; set MARKET_DATA_PROVIDER to switch vendors.
+	providerName := os.Getenv("MARKET_DATA_PROVIDER")
+	if providerName == "" {
+		providerName = marketdata.ProviderMarketstack
+	}
+	provider, err := marketdata.NewProvider(providerName)
+	if err != nil {
+		log.Fatalf("ERROR: %v", err)
 	}
-	fmt.Printf("✓ API Key loaded: %s...%s\n", apiKey[:8], apiKey[len(apiKey)-4:])
+	fmt.Printf("✓ Market data provider: %s\n", provider.Name())
 
-	scanner := NewScanner(apiKey)
+	scanner := NewScanner(provider)
 
 	fmt.Println("\nConfiguration:")
 	fmt.Printf("  Config File: %s\n", ConfigFilePath)
-	fmt.Printf("  API Version: v2 (https://api.marketstack.com/v2)\n")
-	fmt.Printf("  Rate Limit: ~4.5 requests/sec (API limit: 5 req/sec)\n")
-	fmt.Printf("  Rate Limit Delay: %v\n", RateLimitDelay)
-	fmt.Printf("  Max Retries: %d\n", MaxRetries)
-	fmt.Printf("  Retry Base Delay: %v\n", RetryBaseDelay)
+	fmt.Printf("  Data Provider: %s\n", provider.Name())
 	fmt.Printf("  Min Return: %.0f%%\n", MinReturnPct)
 	fmt.Printf("  Min Duration: %d days\n", MinDurationDays)
 	fmt.Printf("  Max Duration: %d days (~15 months)\n", MaxDurationDays)
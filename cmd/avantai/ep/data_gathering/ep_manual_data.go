@@ -20,7 +20,7 @@ type BacktestReport struct {
 	BacktestConfig   BacktestConfig   `json:"backtest_config"`
 	BacktestDate     string           `json:"backtest_date"`
 	BacktestSummary  BacktestSummary  `json:"backtest_summary"`
-	FilterCriteria   FilterCriteria   `json:"filter_criteria"`
+	FilterCriteria   ep.FilterParams  `json:"filter_criteria"`
 	GeneratedAt      string           `json:"generated_at"`
 	QualifyingStocks []BacktestResult `json:"qualifying_stocks"`
 }
@@ -37,14 +37,6 @@ type BacktestSummary struct {
 	TotalCandidates         int            `json:"total_candidates"`
 }
 
-type FilterCriteria struct {
-	MaxExtensionAdr         float64 `json:"max_extension_adr"`
-	MinDollarVolume         int64   `json:"min_dollar_volume"`
-	MinGapUpPercent         float64 `json:"min_gap_up_percent"`
-	MinMarketCap            int64   `json:"min_market_cap"`
-	MinPremarketVolumeRatio float64 `json:"min_premarket_volume_ratio"`
-}
-
 type BacktestResult struct {
 	FilteredStock
 	BacktestDate    string   `json:"backtest_date"`
@@ -104,8 +96,13 @@ func main() {
 	// ep.FilterStocks(apiKey)
 	// Simple backtest for one date
 	backtestDatePtr := flag.String("date", "", "a string for the date")
+	resolveFilters := ep.FilterFlags(flag.CommandLine)
 	flag.Parse()
 	backtestDate := *backtestDatePtr  // Now dereference after parsing
+	filters, err := resolveFilters()
+	if err != nil {
+		log.Fatalf("Error loading filter params: %v", err)
+	}
 
 	// Advanced backtest with custom config
 	// config := ep.BacktestConfig{
@@ -132,6 +129,7 @@ func main() {
 		Date:           backtestDate,
 		SimulateAtTime: "09:10",  // must be between 04:00–09:30
 		LookbackDays:   1000,
+		Filters:        filters,
 	})
 
 	// resp, err := http.Get(url)
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"avantai/pkg/ep"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+// Replays the manager-agent inputs ep_main recorded under responses/
+// against one or more versions of an agent and compares them on realised
+// forward returns and Sapien eval verdicts.  "default" in -versions is the
+// version Sapien serves when none is given.
+func main() {
+	agentPtr := flag.String("agent", ep.EvalAgentManager, "agent to evaluate: manager, news or earnings")
+	versionsPtr := flag.String("versions", "default", "comma-separated agent versions to compare")
+	inputsPtr := flag.String("inputs", "responses", "directory of recorded <date>/<symbol>/minute_N_input.json files")
+	rawPtr := flag.String("raw", "data", "directory of raw news/earnings files for -agent news or earnings")
+	startPtr := flag.String("start", "", "first session date to replay, YYYY-MM-DD")
+	endPtr := flag.String("end", "", "last session date to replay, YYYY-MM-DD")
+	horizonPtr := flag.Int("horizon", 1, "forward return horizon, sessions")
+	limitPtr := flag.Int("limit", 0, "replay at most this many inputs, most recent first (0 = all)")
+	noEvalPtr := flag.Bool("no-eval", false, "score on forward returns only, without Sapien eval verdicts")
+	outPtr := flag.String("out", "data/backtests/agent_eval", "output directory")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Fatal("Error loading .env file")
+	}
+
+	var versions []string
+	for _, v := range strings.Split(*versionsPtr, ",") {
+		v = strings.TrimSpace(v)
+		if v == "default" {
+			v = ""
+		}
+		versions = append(versions, v)
+	}
+
+	report, err := ep.RunAgentEval(ep.AgentEvalConfig{
+		AlpacaKey:    os.Getenv("ALPACA_API_KEY"),
+		AlpacaSecret: os.Getenv("ALPACA_SECRET_KEY"),
+		Agent:        *agentPtr,
+		Versions:     versions,
+		InputsDir:    *inputsPtr,
+		RawDir:       *rawPtr,
+		StartDate:    *startPtr,
+		EndDate:      *endPtr,
+		Horizon:      *horizonPtr,
+		MaxInputs:    *limitPtr,
+		SkipEval:     *noEvalPtr,
+		OutputDir:    *outPtr,
+	})
+	if err != nil {
+		log.Fatalf("Evaluation failed: %v", err)
+	}
+
+	fmt.Printf("\n%s (%s): %d inputs, %d-session forward returns\n\n",
+		report.Agent, report.AgentName, report.Inputs, report.Horizon)
+	ep.PrintAgentEvalTable(os.Stdout, report.Summary)
+	fmt.Printf("\nRows and summary written to %s\n", *outPtr)
+}
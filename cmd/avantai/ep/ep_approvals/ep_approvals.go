@@ -0,0 +1,106 @@
+package main
+
+import (
+	"avantai/pkg/ep"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Lists, approves and rejects the entries parked in the approval queue, or
+// serves the queue over HTTP with -serve.  An approved entry is placed with
+// PlaceEntryWithStop and followed to its fill, which goes on the watchlist;
+// run this from the directory ep_main writes its watchlist.csv in.  The
+// broker comes from BROKER (pkg/ep loads .env).
+func main() {
+	allPtr := flag.Bool("all", false, "list every approval, not just pending ones")
+	approvePtr := flag.String("approve", "", "approve the approval with this ID")
+	rejectPtr := flag.String("reject", "", "reject the approval with this ID")
+	pricePtr := flag.Float64("price", 0, "with -approve: entry price instead of the proposed one")
+	sharesPtr := flag.Float64("shares", 0, "with -approve: shares instead of the proposed size")
+	upsizePtr := flag.Bool("upsize", false, "with -shares: allow more shares than the proposed size")
+	notePtr := flag.String("note", "", "comment recorded with -approve or -reject")
+	servePtr := flag.String("serve", "", "serve the queue over HTTP on this address, e.g. :8090 (loopback only without APPROVAL_TOKEN)")
+	watchlistPtr := flag.String("watchlist", ep.DEFAULT_WATCHLIST, "watchlist CSV that filled approvals are added to")
+	flag.Parse()
+
+	switch {
+	case *servePtr != "":
+		serve(*servePtr, *watchlistPtr)
+
+	case *approvePtr != "":
+		a, order, err := ep.ApproveApproval(*approvePtr, ep.ApprovalEdit{EntryPrice: *pricePtr, Shares: *sharesPtr, AllowUpsize: *upsizePtr}, *notePtr)
+		if err != nil {
+			log.Fatalf("Approve failed: %v", err)
+		}
+		fmt.Printf("✅ %s approved: %.0f %s at $%.2f, stop $%.2f (order %s)\n",
+			a.ID, a.Shares, a.Symbol, a.EntryPrice, a.StopLoss, order.ID)
+		result, err := ep.CompleteApproval(a, order, *watchlistPtr)
+		if err != nil {
+			log.Fatalf("Entry for %s: %v", a.Symbol, err)
+		}
+		fmt.Printf("✅ Filled %.0f at $%.2f (%s) — added to %s\n",
+			result.FilledQty, result.FilledAvgPrice, result.Outcome, *watchlistPtr)
+
+	case *rejectPtr != "":
+		a, err := ep.RejectApproval(*rejectPtr, *notePtr)
+		if err != nil {
+			log.Fatalf("Reject failed: %v", err)
+		}
+		fmt.Printf("🚫 %s rejected (%s)\n", a.ID, a.Symbol)
+
+	default:
+		status := ep.ApprovalPending
+		if *allPtr {
+			status = ""
+		}
+		q, err := ep.ListApprovals(status)
+		if err != nil {
+			log.Fatalf("List failed: %v", err)
+		}
+		if len(q) == 0 {
+			fmt.Printf("No approvals in %s\n", ep.ApprovalQueuePath())
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tSYMBOL\tSTATUS\tSHARES\tENTRY\tSTOP\tSOURCE\tEXPIRES\tREASON")
+		for _, a := range q {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%.0f\t%.2f\t%.2f\t%s\t%s\t%s\n",
+				a.ID, a.Symbol, a.Status, a.Shares, a.EntryPrice, a.StopLoss, a.Source,
+				a.ExpiresAt.Local().Format("01-02 15:04"), a.Reason)
+		}
+		w.Flush()
+	}
+}
+
+// serve runs ep.ApprovalHandler and expires stale approvals every minute
+// so they drop off the list even when nobody asks.  Without APPROVAL_TOKEN
+// anyone who can reach the port can place orders, so it only listens on
+// 127.0.0.1 then.
+func serve(addr, watchlist string) {
+	if strings.TrimSpace(os.Getenv("APPROVAL_TOKEN")) == "" {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			log.Fatalf("Bad -serve address %q: %v", addr, err)
+		}
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			log.Printf("⚠️  APPROVAL_TOKEN is not set; listening on 127.0.0.1:%s instead of %s", port, addr)
+			addr = net.JoinHostPort("127.0.0.1", port)
+		}
+	}
+	go func() {
+		for range time.Tick(time.Minute) {
+			if _, err := ep.ExpireApprovals(); err != nil {
+				log.Printf("⚠️  %v", err)
+			}
+		}
+	}()
+	fmt.Printf("Serving approvals from %s on %s\n", ep.ApprovalQueuePath(), addr)
+	log.Fatal(http.ListenAndServe(addr, ep.ApprovalHandler(watchlist)))
+}
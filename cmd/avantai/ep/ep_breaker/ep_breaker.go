@@ -0,0 +1,37 @@
+package main
+
+import (
+	"avantai/pkg/ep"
+	"flag"
+	"fmt"
+	"log"
+)
+
+// Shows the circuit breaker (and re-checks it against the account) or resets
+// a trip.  The broker comes from BROKER (pkg/ep loads .env).
+func main() {
+	resetPtr := flag.Bool("reset", false, "clear a trip and restart the losing-streak count")
+	flag.Parse()
+
+	if *resetPtr {
+		if err := ep.ResetBreaker(); err != nil {
+			log.Fatalf("Reset failed: %v", err)
+		}
+		fmt.Printf("✅ Circuit breaker reset (%s)\n", ep.BreakerStatePath())
+	}
+
+	s, err := ep.CheckBreaker()
+	if err != nil {
+		log.Fatalf("Breaker check failed: %v", err)
+	}
+	fmt.Printf("\nEquity $%.2f | Today $%+.2f | Week peak $%.2f | Losing streak %d\n",
+		s.Equity, s.DayPL, s.WeekPeak, s.ConsecutiveLosses)
+	if !s.Tripped {
+		fmt.Println("✅ Not tripped")
+		return
+	}
+	fmt.Printf("🛑 TRIPPED at %s (%s): %s\n", s.TrippedAt.Format("2006-01-02 15:04"), s.Rule, s.Detail)
+	if s.Flattened {
+		fmt.Println("   Account was flattened")
+	}
+}
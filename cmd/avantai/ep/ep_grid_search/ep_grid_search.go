@@ -0,0 +1,135 @@
+package main
+
+import (
+	"avantai/pkg/ep"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+// Grid search over the EP scanner thresholds: every date in -dates is scanned
+// once, then each gap % × premarket ratio × pass threshold combination is
+// scored by candidate count and forward returns.
+//
+// Ranges are "start:end:step" or a comma list, e.g. -gap 5:12:1 -passed 7,6,5.
+func main() {
+	datesPtr := flag.String("dates", "dates.txt", "file with one scan date (YYYY-MM-DD) per line")
+	scanPtr := flag.String("scan-time", "09:00", "premarket scan time, HH:MM EST")
+	gapPtr := flag.String("gap", "5:12:1", "min gap up percent values")
+	ratioPtr := flag.String("pm-ratio", "2:5:0.5", "min premarket volume ratio values")
+	passedPtr := flag.String("passed", "7,6,5", "Stage 4 criteria (of 7) needed to qualify")
+	horizonsPtr := flag.String("horizons", "1,5,20", "forward return horizons, sessions")
+	concurrencyPtr := flag.Int("concurrency", 2, "dates scanned at once")
+	resolveFilters := ep.FilterFlags(flag.CommandLine)
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Fatal("Error loading .env file")
+	}
+	filters, err := resolveFilters()
+	if err != nil {
+		log.Fatalf("Failed to load filter params: %v", err)
+	}
+
+	dates, err := ep.ReadDateList(*datesPtr)
+	if err != nil {
+		log.Fatalf("Failed to read dates: %v", err)
+	}
+	gaps, err := parseFloatRange(*gapPtr)
+	if err != nil {
+		log.Fatalf("Invalid -gap: %v", err)
+	}
+	ratios, err := parseFloatRange(*ratioPtr)
+	if err != nil {
+		log.Fatalf("Invalid -pm-ratio: %v", err)
+	}
+	passed, err := parseIntList(*passedPtr)
+	if err != nil {
+		log.Fatalf("Invalid -passed: %v", err)
+	}
+	horizons, err := parseIntList(*horizonsPtr)
+	if err != nil {
+		log.Fatalf("Invalid -horizons: %v", err)
+	}
+
+	report, err := ep.RunGridSearch(ep.GridSearchConfig{
+		AlpacaKey:          os.Getenv("ALPACA_API_KEY"),
+		AlpacaSecret:       os.Getenv("ALPACA_SECRET_KEY"),
+		FinnhubKey:         os.Getenv("FINNHUB_KEY"),
+		Dates:              dates,
+		ScanTime:           *scanPtr,
+		Base:               filters,
+		GapUpPercents:      gaps,
+		PremarketVolRatios: ratios,
+		MinCriteriaPassed:  passed,
+		Horizons:           horizons,
+		Concurrency:        *concurrencyPtr,
+	})
+	if err != nil {
+		log.Fatalf("Grid search failed: %v", err)
+	}
+
+	fmt.Printf("%-6s %-6s %-6s %-6s", "gap", "ratio", "pass", "cands")
+	for _, h := range report.Horizons {
+		fmt.Printf("  %-16s", fmt.Sprintf("%dd mean/win", h))
+	}
+	fmt.Println()
+	for _, r := range report.Results {
+		fmt.Printf("%-6.1f %-6.1f %-6d %-6d", r.Params.MinGapUpPercent, r.Params.MinPremarketVolRatio,
+			r.Params.MinCriteriaPassed, r.Candidates)
+		for _, s := range r.Returns {
+			fmt.Printf("  %-16s", fmt.Sprintf("%+.2f%% / %.0f%%", s.Mean*100, s.WinRate*100))
+		}
+		fmt.Println()
+	}
+}
+
+// parseFloatRange parses "start:end:step" (inclusive) or "a,b,c".
+func parseFloatRange(s string) ([]float64, error) {
+	if parts := strings.Split(s, ":"); len(parts) == 3 {
+		var bounds [3]float64
+		for i, p := range parts {
+			v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+			if err != nil {
+				return nil, err
+			}
+			bounds[i] = v
+		}
+		start, end, step := bounds[0], bounds[1], bounds[2]
+		if step <= 0 || end < start {
+			return nil, fmt.Errorf("range %q must have start <= end and a positive step", s)
+		}
+		var values []float64
+		for i := 0; start+float64(i)*step <= end+step/1e6; i++ {
+			values = append(values, start+float64(i)*step)
+		}
+		return values, nil
+	}
+
+	var values []float64
+	for _, p := range strings.Split(s, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func parseIntList(s string) ([]int, error) {
+	var values []int
+	for _, p := range strings.Split(s, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
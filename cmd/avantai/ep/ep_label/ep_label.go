@@ -0,0 +1,77 @@
+package main
+
+import (
+	"avantai/pkg/ep"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+// Labels past scan/backtest reports with what each candidate did next.
+// Arguments are report files or glob patterns; with none, every
+// data/backtests/backtest_*_results.json is labelled.
+func main() {
+	horizonsPtr := flag.String("horizons", "1,3,5,10,20", "forward return horizons, sessions")
+	orPtr := flag.Int("or-minutes", 5, "opening range length, minutes after 9:30 EST")
+	outPtr := flag.String("out", "data/backtests/labels", "output directory")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Fatal("Error loading .env file")
+	}
+
+	patterns := flag.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"data/backtests/backtest_*_results.json"}
+	}
+	var reports []string
+	for _, p := range patterns {
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			log.Fatalf("Invalid pattern %q: %v", p, err)
+		}
+		reports = append(reports, matches...)
+	}
+	if len(reports) == 0 {
+		log.Fatalf("No reports match %v", patterns)
+	}
+
+	var horizons []int
+	for _, h := range strings.Split(*horizonsPtr, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(h))
+		if err != nil {
+			log.Fatalf("Invalid -horizons: %v", err)
+		}
+		horizons = append(horizons, v)
+	}
+
+	report, err := ep.LabelScanReports(ep.LabelConfig{
+		AlpacaKey:           os.Getenv("ALPACA_API_KEY"),
+		AlpacaSecret:        os.Getenv("ALPACA_SECRET_KEY"),
+		Reports:             reports,
+		Horizons:            horizons,
+		OpeningRangeMinutes: *orPtr,
+		OutputDir:           *outPtr,
+	})
+	if err != nil {
+		log.Fatalf("Labelling failed: %v", err)
+	}
+
+	fmt.Printf("Labelled %d candidates from %d reports\n", len(report.Labels), len(reports))
+	for _, g := range report.Summary {
+		if g.Group != "status" {
+			continue
+		}
+		fmt.Printf("  %-13s n=%-4d", g.Value, g.Count)
+		for _, s := range g.Returns {
+			fmt.Printf("  %dd %+.2f%%", s.Days, s.Mean*100)
+		}
+		fmt.Printf("  ORH broke %.0f%%\n", g.ORHighBreakRate*100)
+	}
+}
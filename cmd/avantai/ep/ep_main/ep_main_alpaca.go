@@ -1,9 +1,14 @@
 package main
 
 import (
+	"avantai/pkg/broker"
 	"avantai/pkg/ep"
+	"avantai/pkg/exits"
+	"avantai/pkg/marketdata"
+	"avantai/pkg/replay"
 	"avantai/pkg/sapien"
-	"encoding/csv"
+	"avantai/pkg/spec"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -12,7 +17,6 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
 	"sync"
@@ -47,19 +51,11 @@ type StrategyState struct {
 }
 
 type RealtimeScanResponse struct {
-	ScanTime         string                `json:"scan_time"`
-	MarketStatus     string                `json:"market_status"`
-	FilterCriteria   FilterCriteriaDetails `json:"filter_criteria"`
-	QualifyingStocks []ep.RealtimeResult   `json:"qualifying_stocks"`
-	Summary          ScanSummary           `json:"summary"`
-}
-
-type FilterCriteriaDetails struct {
-	MinGapUpPercent      float64 `json:"min_gap_up_percent"`
-	MinDollarVolume      float64 `json:"min_dollar_volume"`
-	MinMarketCap         float64 `json:"min_market_cap"`
-	MinPremarketVolRatio float64 `json:"min_premarket_volume_ratio"`
-	MaxExtensionADR      float64 `json:"max_extension_adr"`
+	ScanTime         string              `json:"scan_time"`
+	MarketStatus     string              `json:"market_status"`
+	FilterCriteria   ep.FilterParams     `json:"filter_criteria"`
+	QualifyingStocks []ep.RealtimeResult `json:"qualifying_stocks"`
+	Summary          ScanSummary         `json:"summary"`
 }
 
 type ScanSummary struct {
@@ -223,11 +219,29 @@ func main() {
 	if err := godotenv.Load(); err != nil {
 		log.Fatal("Error loading .env file")
 	}
+	session, err := replay.InstallFromEnv()
+	if err != nil {
+		log.Fatalf("replay: %v", err)
+	}
+	if session != nil {
+		defer session.Close()
+	}
 	alpacaKey := os.Getenv("ALPACA_API_KEY")
 	alpacaSecret := os.Getenv("ALPACA_SECRET_KEY")
-	if alpacaKey == "" || alpacaSecret == "" {
+	// A replayed session is served from the archive and needs no keys.
+	replaying := session != nil && session.Mode == replay.ModeReplay
+	if (alpacaKey == "" || alpacaSecret == "") && !replaying {
 		log.Fatal("ALPACA_API_KEY or ALPACA_SECRET_KEY not found in .env")
 	}
+
+	// A tripped circuit breaker would refuse every entry anyway.
+	if state, err := ep.CheckBreaker(); err != nil {
+		log.Printf("⚠️  circuit breaker: %v — entries will be refused until it can be checked", err)
+	} else if state.Tripped {
+		log.Fatalf("circuit breaker tripped at %s (%s): %s — reset with ep_breaker -reset",
+			state.TrippedAt.Format("2006-01-02 15:04"), state.Rule, state.Detail)
+	}
+
 	filePath := "data/stockdata/filtered_stocks_latest.json"
 	raw, err := os.ReadFile(filePath)
 	if err != nil {
@@ -244,12 +258,15 @@ func main() {
 		stocks[i] = r
 	}
 	fmt.Printf("Loaded %d filtered symbols\n", len(stocks))
+	profiles, err := exits.LoadProfilesFromEnv()
+	if err != nil {
+		log.Fatalf("exit profiles: %v", err)
+	}
 	var symbols []string
 	var dates []string
 	var sentiment []string
+	var exitProfiles []string
 	for _, s := range stocks {
-		symbols = append(symbols, s.Symbol)
-		dates = append(dates, s.StockInfo.Timestamp[0:10])
 		sentimentData := map[string]interface{}{
 			"Stock_name":   s.Symbol,
 			"Stock_info":   s.StockInfo,
@@ -260,22 +277,99 @@ func main() {
 			log.Printf("Error marshaling sentiment for %s: %v", s.Symbol, err)
 			continue
 		}
+		ep.RecordSector(s.Symbol, s.StockInfo.Sector)
+		scanStats[s.Symbol] = s.StockInfo
+		symbols = append(symbols, s.Symbol)
+		dates = append(dates, s.StockInfo.Timestamp[0:10])
 		sentiment = append(sentiment, string(sentimentJSON))
+		exitProfiles = append(exitProfiles, profiles.NameForStatus(s.Status))
 	}
+
+	// Live runs share one websocket for every symbol's bars.  Recorded and
+	// replayed runs keep polling REST, since only HTTP goes into the archive.
+	var barStream *marketdata.BarStream
+	if session == nil || session.Mode == replay.ModeOff {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		barStream, err = marketdata.ConnectBarStream(ctx, marketdata.BarStreamConfig{APIKey: alpacaKey, APISecret: alpacaSecret})
+		if err != nil {
+			log.Printf("⚠️  %v — falling back to REST polling", err)
+			barStream = nil
+		}
+	}
+
 	var wg sync.WaitGroup
 	fmt.Printf("Starting %d intraday workers…\n", len(symbols))
 	for i, symbol := range symbols {
 		wg.Add(1)
-		go func(idx int, sym, date string, sent string) {
+		go func(idx int, sym, date string, sent, profile string) {
 			defer wg.Done()
-			intradayWorker(alpacaKey, alpacaSecret, sym, date, sent, idx+1)
-		}(i, symbol, dates[i], sentiment[i])
+			if barStream != nil {
+				streamWorker(barStream, sym, date, sent, profile, idx+1)
+				return
+			}
+			intradayWorker(alpacaKey, alpacaSecret, sym, date, sent, profile, idx+1)
+		}(i, symbol, dates[i], sentiment[i], exitProfiles[i])
 	}
 	wg.Wait()
+	if ep.CurrentSimBroker() != nil {
+		settleSimSessions(alpacaKey, alpacaSecret, symbols, dates)
+	}
 	fmt.Println("All workers finished. Done.")
 }
 
-func intradayWorker(apiKey, apiSecret, symbol, date string, sentiment string, goroutineId int) {
+// settleSimSessions plays each symbol's session so far through the
+// simulated broker (BROKER=sim), so the entries the workers placed and
+// their stop legs fill.  The bars come through fetchAlpacaIntraday, so a
+// replayed run reads them from the archive.
+func settleSimSessions(apiKey, apiSecret string, symbols, dates []string) {
+	for i, symbol := range symbols {
+		openNY, closeNY, err := sessionWindow(dates[i])
+		if err != nil {
+			log.Printf("[sim:%s] sessionWindow error: %v", symbol, err)
+			continue
+		}
+		end := closeNY
+		if now := replay.Now(); now.Before(end) {
+			end = now
+		}
+		alpacaBars, err := fetchAlpacaIntraday(apiKey, apiSecret, symbol, toRFC3339(openNY), toRFC3339(end))
+		if err != nil {
+			log.Printf("[sim:%s] fetchAlpacaIntraday error: %v", symbol, err)
+			continue
+		}
+		bars := make([]marketdata.Bar, 0, len(alpacaBars))
+		for _, d := range alpacaBars {
+			t, err := parseAlpacaTime(d.T)
+			if err != nil {
+				continue
+			}
+			bars = append(bars, marketdata.Bar{Time: t, Open: d.O, High: d.H, Low: d.L, Close: d.C, Volume: float64(d.V)})
+		}
+		fills := ep.FeedSimBars(symbol, bars)
+		fmt.Printf("[sim:%s] %d fills over %d bars\n", symbol, len(fills), len(bars))
+	}
+	if acct, err := ep.GetAccountInfo(); err == nil {
+		fmt.Printf("Sim account: cash $%s, portfolio $%s\n", acct.Cash, acct.PortfolioValue)
+	}
+}
+
+// entryWindow is how long after the open the intraday worker looks for an
+// entry.
+const entryWindow = 15 * time.Minute
+
+// entryWindowEnd is when date's entry window closes; approvals queued that
+// day expire then.  Zero (the queue's default expiry) if date is not a
+// session.
+func entryWindowEnd(date string) time.Time {
+	openNY, _, err := sessionWindow(date)
+	if err != nil {
+		return time.Time{}
+	}
+	return openNY.Add(entryWindow)
+}
+
+func intradayWorker(apiKey, apiSecret, symbol, date string, sentiment, exitProfile string, goroutineId int) {
 	fmt.Printf("[#%d:%s] worker started for %s\n", goroutineId, symbol, date)
 	openNY, closeNY, err := sessionWindow(date)
 	if err != nil {
@@ -284,21 +378,24 @@ func intradayWorker(apiKey, apiSecret, symbol, date string, sentiment string, go
 	}
 
 	// Calculate 15-minute cutoff from market open
-	fifteenMinCutoff := openNY.Add(15 * time.Minute)
+	fifteenMinCutoff := openNY.Add(entryWindow)
 
 	state := StrategyState{}
 	var bars []MinuteBar
-	var epBars []ep.StockData
-	ticker := time.NewTicker(1 * time.Minute)
-	defer ticker.Stop()
-	immediate := make(chan struct{}, 1)
-	immediate <- struct{}{}
-	for {
-		select {
-		case <-immediate:
-		case <-ticker.C:
+
+	// The clock is virtual when replaying a recorded session, so the
+	// minute-by-minute polling below runs without real waits.
+	clock := replay.NewClock()
+	nextTick := clock.Now()
+	for first := true; ; first = false {
+		if !first {
+			nextTick = nextTick.Add(1 * time.Minute)
+			for !nextTick.After(clock.Now()) {
+				nextTick = nextTick.Add(1 * time.Minute) // skip ticks missed while busy
+			}
+			clock.Sleep(nextTick.Sub(clock.Now()))
 		}
-		nowNY := time.Now().In(locNY)
+		nowNY := clock.Now().In(locNY)
 
 		// Check if we've exceeded 15 minutes from market open
 		if nowNY.After(fifteenMinCutoff) {
@@ -311,10 +408,10 @@ func intradayWorker(apiKey, apiSecret, symbol, date string, sentiment string, go
 			return
 		}
 		if nowNY.Before(openNY) {
-			wait := time.Until(openNY)
+			wait := openNY.Sub(nowNY)
 			if wait > 0 {
 				fmt.Printf("[#%d:%s] waiting until open (in %s)\n", goroutineId, symbol, wait.Truncate(time.Second))
-				time.Sleep(wait)
+				clock.Sleep(wait)
 			}
 		}
 		startTime := toRFC3339(openNY)
@@ -348,22 +445,117 @@ func intradayWorker(apiKey, apiSecret, symbol, date string, sentiment string, go
 
 		sortMinuteBarsAsc(newBars)
 		bars = mergeBars(bars, newBars)
-		state.Recompute(bars)
-		epBars = convertToEP(symbol, bars)
-		fmt.Printf("[#%d:%s] t=%s  OR5[H/L]=[%.2f/%.2f]  OR15[H/L]=[%.2f/%.2f]  VWAP=%.3f  Tight5=%t Tight10=%t  bars=%d\n",
-			goroutineId, symbol, state.LastUpdate.Format("15:04"),
-			state.OR5High, state.OR5Low, state.OR15High, state.OR15Low, state.VWAP, state.IsTight5, state.IsTight10, len(bars),
-		)
-
-		// Run manager agent and check if we should stop
-		shouldStop := runManagerAgent(epBars, symbol, sentiment, goroutineId)
-		if shouldStop {
-			fmt.Printf("[#%d:%s] 🛑 Buy recommendation received — stopping worker\n", goroutineId, symbol)
+		if evaluateBars(&state, bars, symbol, sentiment, exitProfile, goroutineId) {
+			return
+		}
+	}
+}
+
+// streamWorker is intradayWorker fed by the shared bar stream: the stream
+// backfills the session so far, then pushes each bar as it completes.
+func streamWorker(bs *marketdata.BarStream, symbol, date string, sentiment, exitProfile string, goroutineId int) {
+	fmt.Printf("[#%d:%s] stream worker started for %s\n", goroutineId, symbol, date)
+	openNY, closeNY, err := sessionWindow(date)
+	if err != nil {
+		log.Printf("[#%d:%s] sessionWindow error: %v", goroutineId, symbol, err)
+		return
+	}
+
+	// Calculate 15-minute cutoff from market open
+	fifteenMinCutoff := openNY.Add(entryWindow)
+	if !time.Now().Before(fifteenMinCutoff) {
+		fmt.Printf("[#%d:%s] ⏱️ 15 minutes elapsed from market open — exiting\n", goroutineId, symbol)
+		return
+	}
+	cutoff := time.NewTimer(time.Until(fifteenMinCutoff))
+	defer cutoff.Stop()
+
+	sub, err := bs.SubscribeBars(symbol, openNY)
+	if err != nil {
+		log.Printf("[#%d:%s] %v", goroutineId, symbol, err)
+		return
+	}
+	defer sub.Close()
+
+	state := StrategyState{}
+	var bars []MinuteBar
+	for {
+		var incoming []marketdata.Bar
+		select {
+		case <-cutoff.C:
+			fmt.Printf("[#%d:%s] ⏱️ 15 minutes elapsed from market open — exiting\n", goroutineId, symbol)
+			return
+		case b := <-sub.C:
+			incoming = append(incoming, b)
+		}
+		// Evaluate a backfill burst once, not bar by bar.
+		for drained := false; !drained; {
+			select {
+			case b := <-sub.C:
+				incoming = append(incoming, b)
+			default:
+				drained = true
+			}
+		}
+
+		newBars := make([]MinuteBar, 0, len(incoming))
+		for _, b := range incoming {
+			tNY := b.Time.In(locNY)
+			if tNY.Before(openNY) || tNY.After(closeNY) {
+				continue
+			}
+			newBars = append(newBars, MinuteBar{
+				T: tNY, O: b.Open, H: b.High, L: b.Low, C: b.Close, V: int64(b.Volume),
+			})
+		}
+		if len(newBars) == 0 {
+			continue
+		}
+		bars = mergeBars(bars, newBars)
+		if evaluateBars(&state, bars, symbol, sentiment, exitProfile, goroutineId) {
 			return
 		}
 	}
 }
 
+// evaluateBars recomputes the strategy state over bars and runs the manager
+// agent.  It reports whether the worker should stop.
+func evaluateBars(state *StrategyState, bars []MinuteBar, symbol, sentiment, exitProfile string, goroutineId int) bool {
+	state.Recompute(bars)
+	epBars := convertToEP(symbol, bars)
+	fmt.Printf("[#%d:%s] t=%s  OR5[H/L]=[%.2f/%.2f]  OR15[H/L]=[%.2f/%.2f]  VWAP=%.3f  Tight5=%t Tight10=%t  bars=%d\n",
+		goroutineId, symbol, state.LastUpdate.Format("15:04"),
+		state.OR5High, state.OR5Low, state.OR15High, state.OR15Low, state.VWAP, state.IsTight5, state.IsTight10, len(bars),
+	)
+
+	// Run manager agent and check if we should stop
+	shouldStop := runManagerAgent(epBars, symbol, sentiment, exitProfile, goroutineId)
+	if shouldStop {
+		fmt.Printf("[#%d:%s] 🛑 Buy recommendation received — stopping worker\n", goroutineId, symbol)
+	}
+	return shouldStop
+}
+
+// placeEntry places the entry with the EP_* entry options.  A stop_limit
+// entry triggers a cent above the 5-minute opening-range high.
+func placeEntry(symbol string, stockdata []ep.StockData, stopLoss float64, shares int) (*broker.Order, error) {
+	opts, err := ep.EntryOptionsFromEnv("EP")
+	if err != nil {
+		return nil, err
+	}
+	if opts.Type == broker.StopLimit {
+		orHigh := 0.0
+		for i, d := range stockdata {
+			if i == 5 {
+				break
+			}
+			orHigh = math.Max(orHigh, d.High)
+		}
+		opts.Trigger = orHigh + 0.01
+	}
+	return ep.PlaceEntry(symbol, stopLoss, shares, opts)
+}
+
 func sortMinuteBarsAsc(b []MinuteBar) {
 	for i := 1; i < len(b); i++ {
 		j := i
@@ -421,38 +613,10 @@ func getMinute(timestampStr string) (int, error) {
 	return t.Minute(), nil
 }
 
-type ManagerResponse struct {
-	Recommendation string `json:"Recommendation"`
-	EntryTime      string `json:"Entry Time,omitempty"`
-	EntryPrice     string `json:"Entry Price,omitempty"`
-	StopLoss       string `json:"Stop-Loss,omitempty"`
-	RiskPercent    string `json:"Risk %,omitempty"`
-	Reasoning      string `json:"Reasoning"`
-}
-
-type WatchlistEntry struct {
-	StockSymbol string
-	EntryPrice  string
-	StopLoss    string
-	Shares      string
-	InitialRisk string
-}
+// WatchlistEntry is one row of watchlist.csv.
+type WatchlistEntry = ep.WatchlistEntry
 
-func extractJSON(response string) (*ManagerResponse, error) {
-	jsonPattern := regexp.MustCompile(`\{[^{}]*"Recommendation"[^{}]*\}`)
-	match := jsonPattern.FindString(response)
-	if match == "" {
-		return nil, fmt.Errorf("no JSON found in response")
-	}
-	var managerResp ManagerResponse
-	err := json.Unmarshal([]byte(match), &managerResp)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal JSON: %w", err)
-	}
-	return &managerResp, nil
-}
-
-func saveJSONResponse(symbol string, minute int, response *ManagerResponse) error {
+func saveJSONResponse(symbol string, minute int, response *sapien.ManagerDecision) error {
 	dir := filepath.Join("responses", symbol)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
@@ -466,64 +630,46 @@ func saveJSONResponse(symbol string, minute int, response *ManagerResponse) erro
 	return os.WriteFile(filename, prettified, 0644)
 }
 
-func addToWatchlist(entry WatchlistEntry) error {
-	filename := "watchlist.csv"
-	existingEntries := make(map[string]WatchlistEntry)
-	if file, err := os.Open(filename); err == nil {
-		defer file.Close()
-		reader := csv.NewReader(file)
-		records, err := reader.ReadAll()
-		if err != nil {
-			return fmt.Errorf("failed to read existing watchlist: %w", err)
-		}
-		startIdx := 0
-		if len(records) > 0 && records[0][0] == "stock_symbol" {
-			startIdx = 1
-		}
-		for i := startIdx; i < len(records); i++ {
-			if len(records[i]) >= 4 {
-				key := fmt.Sprintf("%s|%s|%s|%s", records[i][0], records[i][1], records[i][2], records[i][3])
-				existingEntries[key] = WatchlistEntry{
-					StockSymbol: records[i][0],
-					EntryPrice:  records[i][1],
-					StopLoss:    records[i][2],
-					Shares:      records[i][3],
-				}
-			}
-		}
-	}
-	entryKey := fmt.Sprintf("%s|%s|%s|%s", entry.StockSymbol, entry.EntryPrice, entry.StopLoss, entry.Shares)
-	if _, exists := existingEntries[entryKey]; exists {
-		return fmt.Errorf("duplicate entry: %s with entry price %s and stop loss %s already exists in watchlist",
-			entry.StockSymbol, entry.EntryPrice, entry.StopLoss)
-	}
-	fileExists := true
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		fileExists = false
+// saveManagerInput records what the manager agent was asked for ep_agent_eval
+// to replay.  Inputs are kept per session date so later runs never overwrite
+// earlier days.
+func saveManagerInput(symbol string, minute int, in sapien.ManagerInput) error {
+	dir := filepath.Join("responses", in.Date, symbol)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
 	}
-	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	filename := filepath.Join(dir, fmt.Sprintf("minute_%d_input.json", minute-29))
+	data, err := json.Marshal(in)
 	if err != nil {
-		return fmt.Errorf("failed to open watchlist file: %w", err)
+		return fmt.Errorf("failed to marshal input: %w", err)
 	}
-	defer file.Close()
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-	if !fileExists {
-		if err := writer.Write([]string{"stock_symbol", "entry_price", "stop_loss_price", "shares"}); err != nil {
-			return fmt.Errorf("failed to write CSV header: %w", err)
-		}
+	return os.WriteFile(filename, pretty.Pretty(data), 0644)
+}
+
+// saveGuardrailVerdict writes the verdict next to that minute's response.
+func saveGuardrailVerdict(symbol string, minute int, verdict *sapien.GuardrailVerdict) error {
+	dir := filepath.Join("responses", symbol)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
 	}
-	record := []string{entry.StockSymbol, entry.EntryPrice, entry.StopLoss, entry.Shares}
-	if err := writer.Write(record); err != nil {
-		return fmt.Errorf("failed to write CSV record: %w", err)
+	filename := filepath.Join(dir, fmt.Sprintf("minute_%d_guardrail.json", minute-29))
+	data, err := json.Marshal(verdict)
+	if err != nil {
+		return fmt.Errorf("failed to marshal verdict: %w", err)
 	}
-	return nil
+	return os.WriteFile(filename, pretty.Pretty(data), 0644)
+}
+
+func addToWatchlist(entry WatchlistEntry) error {
+	return ep.AddToWatchlist(ep.DEFAULT_WATCHLIST, entry)
 }
 
-var riskPerTrade = 0.01
+// scanStats holds each symbol's scan statistics (ADR, dollar volume) for
+// position sizing.  Filled by main before the workers start.
+var scanStats = make(map[string]ep.StockStats)
 
 // Modified runManagerAgent to return bool indicating whether to stop the worker
-func runManagerAgent(stockdata []ep.StockData, symbol string, sentiment string, goroutineId int) bool {
+func runManagerAgent(stockdata []ep.StockData, symbol string, sentiment, exitProfile string, goroutineId int) bool {
 	fmt.Printf("\n[Goroutine %d] --- Starting runManagerAgent for %s (Sentiment: %s) ---\n", goroutineId, symbol, sentiment)
 	defer fmt.Printf("[Goroutine %d] ✓ runManagerAgent completed for %s\n", goroutineId, symbol)
 	fmt.Printf("[Goroutine %d] Processing %d stock data points for %s\n", goroutineId, len(stockdata), symbol)
@@ -576,12 +722,7 @@ func runManagerAgent(stockdata []ep.StockData, symbol string, sentiment string,
 			fmt.Printf("[Goroutine %d] ✓ Earnings report read (%d bytes)\n", goroutineId, len(earnings))
 		}
 	}
-	fmt.Printf("[Goroutine %d] Calling ManagerAgentReqInfo for %s (Sentiment: %s)...\n", goroutineId, symbol, sentiment)
-	resp, err := sapien.ManagerAgentReqInfo(stock_data, string(news), string(earnings), sentiment)
-	if err != nil {
-		fmt.Printf("[Goroutine %d] ❌ ManagerAgentReqInfo error: %v\n", goroutineId, err)
-		return false
-	}
+	fmt.Printf("[Goroutine %d] Calling ManagerAgentDecision for %s (Sentiment: %s)...\n", goroutineId, symbol, sentiment)
 	min, err := getMinute(stockdata[len(stockdata)-1].Timestamp)
 	if err != nil {
 		fmt.Printf("[Goroutine %d] ❌ Failed to parse minute from timestamp %s: %v\n",
@@ -589,13 +730,28 @@ func runManagerAgent(stockdata []ep.StockData, symbol string, sentiment string,
 		return false
 	}
 	currentMinute := min
-	managerResp, err := extractJSON(resp)
+	if err := saveManagerInput(symbol, currentMinute, sapien.ManagerInput{
+		Symbol:         symbol,
+		Date:           latest_stock_instance.Timestamp[0:10],
+		BarTime:        latest_stock_instance.Timestamp,
+		LastPrice:      latest_stock_instance.Close,
+		StockData:      stock_data,
+		News:           string(news),
+		EarningsReport: string(earnings),
+		Sentiment:      sentiment,
+	}); err != nil {
+		fmt.Printf("[Goroutine %d] ❌ Failed to save agent input (minute %d): %v\n",
+			goroutineId, currentMinute, err)
+	}
+	// Only a decision that validates against the schema can reach the
+	// order path; anything else skips this minute.
+	decision, err := sapien.ManagerAgentDecision(context.Background(), stock_data, string(news), string(earnings), sentiment)
 	if err != nil {
-		fmt.Printf("[Goroutine %d] ❌ Failed to extract JSON from response (minute %d): %v\n",
+		fmt.Printf("[Goroutine %d] ❌ No valid manager decision (minute %d): %v\n",
 			goroutineId, currentMinute, err)
 		return false
 	}
-	if err := saveJSONResponse(symbol, currentMinute, managerResp); err != nil {
+	if err := saveJSONResponse(symbol, currentMinute, decision); err != nil {
 		fmt.Printf("[Goroutine %d] ❌ Failed to save JSON response (minute %d): %v\n",
 			goroutineId, currentMinute, err)
 	} else {
@@ -606,7 +762,7 @@ func runManagerAgent(stockdata []ep.StockData, symbol string, sentiment string,
 	}
 
 	// Save JSON response to file
-	if err := saveJSONResponse(symbol, currentMinute, managerResp); err != nil {
+	if err := saveJSONResponse(symbol, currentMinute, decision); err != nil {
 		fmt.Printf("[Goroutine %d] ❌ Failed to save JSON response (minute %d): %v\n",
 			goroutineId, currentMinute, err)
 	} else {
@@ -615,46 +771,16 @@ func runManagerAgent(stockdata []ep.StockData, symbol string, sentiment string,
 
 	// Check if recommendation is "Buy" and add to watchlist
 
-	if strings.ToLower(strings.TrimSpace(managerResp.Recommendation)) != "buy" {
-		fmt.Printf("[Goroutine %d] 📊 Recommendation for %s at minute %d: %s\n",
-			goroutineId, symbol, currentMinute, managerResp.Recommendation)
+	if decision.Action != sapien.ActionBuy {
+		fmt.Printf("[Goroutine %d] 📊 Recommendation for %s at minute %d: %s (confidence %.2f)\n",
+			goroutineId, symbol, currentMinute, decision.Action, decision.Confidence)
 		return false
 	}
 
-	stringPercent := strings.TrimSpace(strings.TrimSuffix(managerResp.RiskPercent, "%"))
-	riskPercent, err := strconv.ParseFloat(stringPercent, 64)
-	if err != nil {
-		fmt.Printf("[Goroutine %d] ❌ Failed to parse risk percent '%s': %v\n",
-			goroutineId, stringPercent, err)
-		return false
-	}
-
-	accSize, err := strconv.ParseFloat(os.Getenv("ACCOUNT_SIZE"), 64)
-	if err != nil {
-		fmt.Printf("[Goroutine %d] ❌ Failed to parse account size: %v\n", goroutineId, err)
-		return false
-	}
-
-	riskPerTrade, err := strconv.ParseFloat(os.Getenv("RISK_PER_TRADE"), 64)
-	if err != nil {
-		fmt.Printf("[Goroutine %d] ❌ Failed to parse risk per trade: %v\n", goroutineId, err)
-		return false
-	}
-
-	entryPrice, err := strconv.ParseFloat(strings.ReplaceAll(managerResp.EntryPrice, "$", ""), 64)
-	if err != nil {
-		fmt.Printf("[Goroutine %d] ❌ Failed to parse entry price '%s': %v\n",
-			goroutineId, managerResp.EntryPrice, err)
-		return false
-	}
-
-	// stopLoss, err := strconv.ParseFloat(strings.ReplaceAll(managerResp.StopLoss, "$", ""), 64)
-	// if err != nil {
-	// 	fmt.Printf("[Goroutine %d] ❌ Failed to parse stop loss '%s': %v\n",
-	// 		goroutineId, managerResp.StopLoss, err)
-	// 	return false
-	// }
+	entryPrice := decision.EntryPrice
 
+	// The agent's stop_loss is validated but not used; the stop is the
+	// latest bar's low.
 	stopLoss := latest_stock_instance.Low
 
 	// Validate the risk calculation
@@ -665,58 +791,116 @@ func runManagerAgent(stockdata []ep.StockData, symbol string, sentiment string,
 		return false
 	}
 
-	// Calculate shares
-	totalRisk := riskPerTrade * accSize
-	shares := math.Round(totalRisk / riskPerShare)
+	// Size with the configured model; the agent's risk_fraction is not used.
+	sizing, err := ep.SizeEntry(symbol, entryPrice, stopLoss, scanStats[symbol])
+	if err != nil {
+		fmt.Printf("[Goroutine %d] ❌ Failed to size %s: %v\n", goroutineId, symbol, err)
+		return false
+	}
+	shares := sizing.Shares
 
 	if shares <= 0 {
-		fmt.Printf("[Goroutine %d] ❌ Invalid share calculation resulted in %.0f shares\n",
-			goroutineId, shares)
+		fmt.Printf("[Goroutine %d] ❌ Invalid share calculation resulted in %.0f shares (%s)\n",
+			goroutineId, shares, sizing)
 		return false
 	}
 
-	if strings.ToLower(strings.TrimSpace(managerResp.Recommendation)) == "buy" {
-		if managerResp.EntryPrice != "" && managerResp.StopLoss != "" {
-			shares := math.Round((((riskPercent) * (riskPerTrade * accSize)) * 1.0) / (entryPrice - stopLoss))
-			entry := WatchlistEntry{
-				StockSymbol: symbol,
-				EntryPrice:  managerResp.EntryPrice,
-				StopLoss:    managerResp.StopLoss,
-				Shares:      strconv.FormatFloat(float64(int(shares)), 'f', 2, 64),
-				InitialRisk: strconv.FormatFloat(riskPercent, 'f', 2, 64),
-			}
+	// Guardrail: BLOCK skips the trade, HUMAN_REVIEW parks it for approval.
+	// It judges the stop and size being ordered, not the agent's own.
+	plan := sapien.PlannedEntry{StopLoss: stopLoss, Shares: shares, RiskFraction: sizing.RiskFraction()}
+	verdict := sapien.ManagerGuardrail(context.Background(), decision, plan, sapien.StockData{
+		Symbol: symbol,
+		Open:   latest_stock_instance.Open,
+		High:   latest_stock_instance.High,
+		Low:    latest_stock_instance.Low,
+		Price:  latest_stock_instance.Close,
+	}, stock_data, string(news), string(earnings), sentiment)
+	if err := saveGuardrailVerdict(symbol, currentMinute, verdict); err != nil {
+		fmt.Printf("[Goroutine %d] ❌ Failed to save guardrail verdict (minute %d): %v\n",
+			goroutineId, currentMinute, err)
+	}
+	fmt.Printf("[Goroutine %d] 🛡️ Guardrail for %s (minute %d): %s\n", goroutineId, symbol, currentMinute, verdict)
+	if verdict.Decision == spec.DecisionBlock {
+		return false
+	}
+	source, reason := ep.ApprovalSourceGuardrail, verdict.Reason
+	if verdict.Decision == spec.DecisionAllow {
+		// A first-time symbol or a large position still needs a person.
+		source, reason = ep.ApprovalNeeded(symbol, shares, entryPrice)
+	}
+	if source != "" {
+		a, err := ep.QueueApproval(ep.Approval{
+			Symbol:       symbol,
+			EntryPrice:   entryPrice,
+			StopLoss:     stopLoss,
+			Shares:       shares,
+			PurchaseDate: latest_stock_instance.Timestamp[0:10],
+			ExitProfile:  exitProfile,
+			Source:       source,
+			Reason:       reason,
+			ExpiresAt:    entryWindowEnd(latest_stock_instance.Timestamp[0:10]),
+		})
+		if err != nil {
+			fmt.Printf("[Goroutine %d] ❌ Failed to queue %s for approval (minute %d): %v\n",
+				goroutineId, symbol, currentMinute, err)
+			return false
+		}
+		fmt.Printf("[Goroutine %d] ⏸️ %s queued for approval as %s, %s: %s (minute %d)\n",
+			goroutineId, symbol, a.ID, source, reason, currentMinute)
+		return true // Stop the worker - an operator decides now
+	}
 
-			order, err := ep.PlaceEntryWithStop(symbol, stopLoss, int(shares), nil)
+	order, err := placeEntry(symbol, stockdata, stopLoss, int(shares))
+	if err != nil {
+		fmt.Printf("[Goroutine %d] ❌ Failed to place entry order for %s (minute %d): %v\n",
+			goroutineId, symbol, currentMinute, err)
+		return false
+	}
+	fmt.Printf("[Goroutine %d] ✅ Placed entry order for %s (minute %d): %v\n",
+		goroutineId, symbol, currentMinute, order)
 
-			if err != nil {
-				fmt.Printf("[Goroutine %d] ❌ Failed to place entry order for %s (minute %d): %v\n",
-					goroutineId, symbol, currentMinute, err)
-			} else {
-				fmt.Printf("[Goroutine %d] ✅ Placed entry order for %s (minute %d): %v\n",
-					goroutineId, symbol, currentMinute, order)
-			}
+	// Only a confirmed fill goes on the watchlist, at the price and
+	// size actually bought.
+	policy, err := ep.EntryPolicyFromEnv("EP")
+	if err != nil {
+		fmt.Printf("[Goroutine %d] ⚠️ %v — using the default entry policy\n", goroutineId, err)
+		policy = ep.DefaultEntryPolicy()
+	}
+	result, err := ep.ManageEntry(order, policy)
+	if err != nil {
+		fmt.Printf("[Goroutine %d] ❌ Entry for %s not resolved (minute %d): %v\n",
+			goroutineId, symbol, currentMinute, err)
+	}
+	if result == nil || result.FilledQty <= 0 {
+		fmt.Printf("[Goroutine %d] ⚠️ Entry for %s not filled (minute %d) — not added to watchlist\n",
+			goroutineId, symbol, currentMinute)
+		return false
+	}
+	if result.Outcome != ep.EntryFilled {
+		fmt.Printf("[Goroutine %d] ⚠️ Entry for %s %s after a partial fill of %.0f/%.0f shares\n",
+			goroutineId, symbol, result.Outcome, result.FilledQty, shares)
+	}
 
-			if err := addToWatchlist(entry); err != nil {
-				if strings.Contains(err.Error(), "duplicate entry") {
-					fmt.Printf("[Goroutine %d] ⚠️ Duplicate watchlist entry for %s with entry price %s and stop loss %s (minute %d)\n",
-						goroutineId, symbol, entry.EntryPrice, entry.StopLoss, currentMinute)
-				} else {
-					fmt.Printf("[Goroutine %d] ❌ Failed to add %s to watchlist (minute %d): %v\n",
-						goroutineId, symbol, currentMinute, err)
-				}
-			} else {
-				fmt.Printf("[Goroutine %d] ✅ Added %s to watchlist with entry price %s and stop loss %s (minute %d)\n",
-					goroutineId, symbol, entry.EntryPrice, entry.StopLoss, currentMinute)
-			}
-			return true // Stop the worker - buy recommendation received
+	entry := WatchlistEntry{
+		StockSymbol:  symbol,
+		EntryPrice:   strconv.FormatFloat(result.FilledAvgPrice, 'f', 2, 64),
+		StopLoss:     strconv.FormatFloat(stopLoss, 'f', 2, 64),
+		Shares:       strconv.FormatFloat(result.FilledQty, 'f', 2, 64),
+		InitialRisk:  strconv.FormatFloat(result.FilledAvgPrice-stopLoss, 'f', 2, 64),
+		PurchaseDate: latest_stock_instance.Timestamp[0:10],
+		ExitProfile:  exitProfile,
+	}
+	if err := addToWatchlist(entry); err != nil {
+		if strings.Contains(err.Error(), "duplicate entry") {
+			fmt.Printf("[Goroutine %d] ⚠️ Duplicate watchlist entry for %s with entry price %s and stop loss %s (minute %d)\n",
+				goroutineId, symbol, entry.EntryPrice, entry.StopLoss, currentMinute)
 		} else {
-			fmt.Printf("[Goroutine %d] ⚠️ Buy recommendation for %s but missing entry price or stop loss (minute %d)\n",
-				goroutineId, symbol, currentMinute)
-			return false
+			fmt.Printf("[Goroutine %d] ❌ Failed to add %s to watchlist (minute %d): %v\n",
+				goroutineId, symbol, currentMinute, err)
 		}
 	} else {
-		fmt.Printf("[Goroutine %d] 📊 Recommendation for %s: %s (minute %d)\n",
-			goroutineId, symbol, managerResp.Recommendation, currentMinute)
-		return false
+		fmt.Printf("[Goroutine %d] ✅ Added %s to watchlist with entry price %s and stop loss %s (minute %d)\n",
+			goroutineId, symbol, entry.EntryPrice, entry.StopLoss, currentMinute)
 	}
+	return true // Stop the worker - entry filled
 }
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"avantai/pkg/ep"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Compares the order ledger with the broker's open orders and positions and
+// reports drift: orphaned stop legs, positions we don't track, and fills that
+// differ from what we logged.  The broker comes from BROKER (pkg/ep loads .env).
+func main() {
+	ledgerPtr := flag.String("ledger", ep.OrderLedgerPath(), "order ledger (JSONL)")
+	sincePtr := flag.Duration("since", 5*24*time.Hour, "re-fetch ledger orders placed within this window")
+	tolerancePtr := flag.Float64("tolerance", 0.01, "allowed fill price difference, dollars")
+	syncPtr := flag.Bool("sync", false, "append the broker's current state for changed orders to the ledger")
+	outPtr := flag.String("out", "data/ledger", "output directory")
+	flag.Parse()
+
+	report, err := ep.ReconcileOrders(ep.ReconcileConfig{
+		LedgerPath: *ledgerPtr,
+		Since:      *sincePtr,
+		Tolerance:  *tolerancePtr,
+		Sync:       *syncPtr,
+		OutputDir:  *outPtr,
+	})
+	if err != nil {
+		log.Fatalf("Reconciliation failed: %v", err)
+	}
+
+	fmt.Printf("\n%s: %d ledger orders, %d open orders, %d positions\n",
+		report.Broker, report.LedgerOrders, report.OpenOrders, report.Positions)
+	if len(report.Drifts) == 0 {
+		fmt.Println("✅ No drift")
+	}
+	for _, d := range report.Drifts {
+		fmt.Printf("  %-18s %-6s %s\n", d.Kind, d.Symbol, d.Detail)
+	}
+	if report.LedgerUpdates > 0 {
+		fmt.Printf("Appended %d updates to %s\n", report.LedgerUpdates, report.Ledger)
+	}
+}
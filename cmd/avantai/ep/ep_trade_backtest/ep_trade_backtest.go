@@ -0,0 +1,69 @@
+package main
+
+import (
+	"avantai/pkg/ep"
+	riskCalculator "avantai/pkg/riskmanagement"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/joho/godotenv"
+)
+
+// Trade-level EP backtest: scan → manager-agent entries → watcher exits over
+// a date range.  Sizing uses ACCOUNT_SIZE and the SIZING_* model from .env,
+// same as ep_main_alpaca.
+func main() {
+	startPtr := flag.String("start", "", "first trading date (YYYY-MM-DD)")
+	endPtr := flag.String("end", "", "last trading date (YYYY-MM-DD)")
+	scanPtr := flag.String("scan-time", "09:00", "premarket scan time, HH:MM EST")
+	resolveFilters := ep.FilterFlags(flag.CommandLine)
+	flag.Parse()
+
+	if *startPtr == "" || *endPtr == "" {
+		log.Fatal("-start and -end are required")
+	}
+	if err := godotenv.Load(); err != nil {
+		log.Fatal("Error loading .env file")
+	}
+	filters, err := resolveFilters()
+	if err != nil {
+		log.Fatalf("Failed to load filter params: %v", err)
+	}
+
+	accSize, err := strconv.ParseFloat(os.Getenv("ACCOUNT_SIZE"), 64)
+	if err != nil {
+		log.Fatalf("Failed to parse ACCOUNT_SIZE: %v", err)
+	}
+	riskPerTrade, err := strconv.ParseFloat(os.Getenv("RISK_PER_TRADE"), 64)
+	if err != nil {
+		log.Fatalf("Failed to parse RISK_PER_TRADE: %v", err)
+	}
+
+	sizing, err := riskCalculator.SizingFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load sizing config: %v", err)
+	}
+
+	report, err := ep.RunTradeBacktest(ep.TradeBacktestConfig{
+		StartDate:    *startPtr,
+		EndDate:      *endPtr,
+		AlpacaKey:    os.Getenv("ALPACA_API_KEY"),
+		AlpacaSecret: os.Getenv("ALPACA_SECRET_KEY"),
+		FinnhubKey:   os.Getenv("FINNHUB_KEY"),
+		ScanTime:     *scanPtr,
+		AccountSize:  accSize,
+		RiskPerTrade: riskPerTrade,
+		Sizing:       &sizing,
+		Filters:      filters,
+	})
+	if err != nil {
+		log.Fatalf("Trade backtest failed: %v", err)
+	}
+
+	s := report.Summary
+	fmt.Printf("Trades: %d  Win rate: %.1f%%  P/L: $%.2f  Avg R: %.2f  Return: %.2f%%  Max DD: %.2f%%\n",
+		s.Trades, s.WinRate*100, s.TotalPL, s.AvgR, s.ReturnPercent, s.MaxDrawdown*100)
+}
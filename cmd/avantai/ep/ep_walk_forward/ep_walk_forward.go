@@ -0,0 +1,72 @@
+package main
+
+import (
+	"avantai/pkg/ep"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+// Walk-forward premarket simulation: every trading date in [-start, -end] is
+// replayed at each -times snapshot, replacing the run_backtest_sequence.sh
+// loop over ep_manual_data.
+func main() {
+	startPtr := flag.String("start", "", "first date (YYYY-MM-DD)")
+	endPtr := flag.String("end", "", "last date (YYYY-MM-DD)")
+	calendarPtr := flag.String("calendar", "", "file with one trading date per line (default: SPY sessions)")
+	timesPtr := flag.String("times", "07:00,08:00,09:10", "snapshot times, HH:MM EST")
+	concurrencyPtr := flag.Int("concurrency", 2, "simulations at once")
+	lookbackPtr := flag.Int("lookback", 300, "days of history for technicals")
+	resolveFilters := ep.FilterFlags(flag.CommandLine)
+	flag.Parse()
+
+	if *startPtr == "" || *endPtr == "" {
+		log.Fatal("-start and -end are required")
+	}
+	if err := godotenv.Load(); err != nil {
+		log.Fatal("Error loading .env file")
+	}
+	filters, err := resolveFilters()
+	if err != nil {
+		log.Fatalf("Failed to load filter params: %v", err)
+	}
+
+	var calendar []string
+	if *calendarPtr != "" {
+		calendar, err = ep.ReadDateList(*calendarPtr)
+		if err != nil {
+			log.Fatalf("Failed to read calendar: %v", err)
+		}
+	}
+	var times []string
+	for _, t := range strings.Split(*timesPtr, ",") {
+		times = append(times, strings.TrimSpace(t))
+	}
+
+	report, err := ep.RunWalkForward(ep.WalkForwardConfig{
+		AlpacaKey:     os.Getenv("ALPACA_API_KEY"),
+		AlpacaSecret:  os.Getenv("ALPACA_SECRET_KEY"),
+		FinnhubKey:    os.Getenv("FINNHUB_KEY"),
+		StartDate:     *startPtr,
+		EndDate:       *endPtr,
+		Calendar:      calendar,
+		SnapshotTimes: times,
+		LookbackDays:  *lookbackPtr,
+		Filters:       filters,
+		Concurrency:   *concurrencyPtr,
+	})
+	if err != nil {
+		log.Fatalf("Walk-forward failed: %v", err)
+	}
+
+	fmt.Printf("%d dates\n", len(report.Days))
+	for _, s := range report.Summary {
+		fmt.Printf("  %s  avg %.1f candidates  (+%d / -%d)  %.0f%% still listed at %s\n",
+			s.Time, s.AvgCandidates, s.Added, s.Dropped, s.SurvivalRate*100,
+			report.SnapshotTimes[len(report.SnapshotTimes)-1])
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/csv"
 	"fmt"
 	"log"
@@ -13,11 +14,13 @@ import (
 
 	"path/filepath"
 
-	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
-	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
 	"github.com/joho/godotenv"
 
+	"avantai/pkg/broker"
 	ep "avantai/pkg/ep" // ← update to match your go.mod module path
+	"avantai/pkg/exits"
+	"avantai/pkg/marketdata"
+	"avantai/pkg/replay"
 )
 
 // ─────────────────────────────────────────────────────────────────────────────
@@ -31,25 +34,7 @@ const (
 	// How often to re-check market open/close status when sleeping
 	MARKET_CHECK_INTERVAL = 1 * time.Minute
 
-	// Exit / stop logic (mirrors backtest)
-	BREAKEVEN_TRIGGER_PERCENT = 0.02
-	BREAKEVEN_TRIGGER_DAYS    = 2
-
-	PROFIT_TAKE_1_RR      = 1.5
-	PROFIT_TAKE_1_PERCENT = 0.25
-	PROFIT_TAKE_2_RR      = 3.0
-	PROFIT_TAKE_2_PERCENT = 0.25
-	PROFIT_TAKE_3_RR      = 5.0
-	PROFIT_TAKE_3_PERCENT = 0.25
-
-	STRONG_EP_GAIN         = 0.15
-	STRONG_EP_DAYS         = 3
-	STRONG_EP_TAKE_PERCENT = 0.30
-
-	MAX_DAYS_NO_FOLLOWTHROUGH = 8
-
-	// Weak close: if close is more than 30% below session high, exit
-	WEAK_CLOSE_THRESHOLD = 0.30
+	// Exit / stop thresholds come from the exit profiles file (pkg/exits).
 
 	// Entry filters
 	MIN_PRICE = 2.0
@@ -67,38 +52,20 @@ const (
 // Data structures
 // ─────────────────────────────────────────────────────────────────────────────
 
-// RealtimePosition tracks a live position and all of its exit-rule state.
+// RealtimePosition tracks a live position.  All exit-rule state lives in the
+// embedded exits.Position.
 type RealtimePosition struct {
-	Symbol          string
-	EntryPrice      float64
-	StopLoss        float64
-	InitialStopLoss float64
-	InitialRisk     float64
-	Shares          float64 // decremented on partial exits
-	InitialShares   float64
-	PurchaseDate    time.Time
-	DaysHeld        int
-	LastCheckDate   time.Time // tracks last calendar date we incremented DaysHeld
-
-	// Profit-taking flags
-	ProfitTaken  bool
-	ProfitTaken2 bool
-	ProfitTaken3 bool
-
-	// Trailing / advanced stop state
-	TrailingStopMode bool
-	HighestPrice     float64 // highest intraday high seen since entry
-
-	// Running tally of realised profit from partial exits
-	CumulativeProfit float64
-
-	// Per-session daily OHLC — reset each morning at open
-	SessionHigh float64
-	SessionLow  float64
-	SessionOpen float64
-
-	// Set true on EP day if a weak close was detected
-	WeakCloseDetected bool
+	exits.Position
+
+	// Profile names the exit profile (watchlist column 7); empty means the
+	// default profile.
+	Profile string
+	engine  *exits.Engine
+
+	// brokerStop and brokerShares are what the broker-side stop was last
+	// synced to, so syncBrokerStop only amends it when they change.
+	brokerStop   float64
+	brokerShares float64
 
 	mu sync.Mutex
 }
@@ -126,16 +93,31 @@ var (
 	activePositions  = make(map[string]*RealtimePosition)
 	processedSymbols = make(map[string]bool)
 	lastWatchlistMod time.Time
+	breakerTripped   bool // last state reported by checkCircuitBreaker
 	watchlistPath    string
 
 	positionsMu    sync.RWMutex
 	processedMu    sync.Mutex
 	tradeResultsMu sync.Mutex
 
-	alpacaClient *alpaca.Client
-	mdClient     *marketdata.Client
+	// pendingExits maps the client order IDs of sell orders placed by
+	// executeSell to their exit reason, so their fills are not mistaken for
+	// bracket legs or manual closes on the trade-updates stream.  IDs are
+	// registered before the order is sent.  retiredStops holds the stops
+	// executeSell cancelled to free shares for a full exit.
+	pendingExits   = make(map[string]string)
+	retiredStops   = make(map[string]bool)
+	pendingExitsMu sync.Mutex
+
+	// barProvider serves the intraday bars; orders, positions and the
+	// account go through ep.CurrentBroker.
+	barProvider marketdata.Provider
 
 	easternLoc *time.Location
+
+	// exitProfiles holds the named exit rule sets; replaced at startup by
+	// the EXIT_PROFILES / exit_profiles.yaml file when one exists.
+	exitProfiles = exits.DefaultProfiles()
 )
 
 // ─────────────────────────────────────────────────────────────────────────────
@@ -143,46 +125,54 @@ var (
 // Tests swap these for fakes so no real network calls are made.
 // ─────────────────────────────────────────────────────────────────────────────
 
-// Bar is a single OHLCV bar.  Mirrors marketdata.Bar so tests need not import
-// the Alpaca SDK.
-type Bar struct {
-	Open, High, Low, Close float64
-}
+// Bar is a single OHLC bar.  An exits.Bar so tests need not import the
+// market-data packages.
+type Bar = exits.Bar
 
-// getAlpacaPositionFn returns the share quantity held in Alpaca for symbol,
-// or an error if the position does not exist.
+// getAlpacaPositionFn returns the share quantity the broker holds for
+// symbol, or an error if the position does not exist.
 var getAlpacaPositionFn = func(symbol string) (float64, error) {
-	pos, err := alpacaClient.GetPosition(symbol)
+	pos, err := brokerPosition(symbol)
 	if err != nil {
 		return 0, err
 	}
-	qty, _ := pos.Qty.Float64()
-	return qty, nil
+	if pos == nil {
+		return 0, fmt.Errorf("no open %s position", symbol)
+	}
+	return pos.Qty, nil
 }
 
-// getIntradayBarsFn returns 1-minute bars for symbol from sessionStart to now.
+// getIntradayBarsFn returns 1-minute bars for symbol from sessionStart to
+// now.  Against the simulated broker the bars are also fed to it, so its
+// working orders fill before the position is re-synced.
 var getIntradayBarsFn = func(symbol string, sessionStart, now time.Time) ([]Bar, error) {
-	raw, err := mdClient.GetBars(symbol, marketdata.GetBarsRequest{
-		TimeFrame: marketdata.OneMin,
-		Start:     sessionStart,
-		End:       now,
-		Feed:      marketdata.IEX,
-	})
+	raw, err := barProvider.MinuteBars(symbol, sessionStart, now, marketdata.AdjustmentRaw)
 	if err != nil {
 		return nil, err
 	}
+	ep.FeedSimBars(symbol, raw)
 	bars := make([]Bar, len(raw))
 	for i, b := range raw {
-		bars[i] = Bar{Open: b.Open, High: b.High, Low: b.Low, Close: b.Close}
+		bars[i] = Bar{Time: b.Time, Open: b.Open, High: b.High, Low: b.Low, Close: b.Close}
 	}
 	return bars, nil
 }
 
+// brokerPosition returns the broker's position in symbol, or nil if there
+// is none.
+func brokerPosition(symbol string) (*broker.Position, error) {
+	b, err := ep.CurrentBroker()
+	if err != nil {
+		return nil, err
+	}
+	return b.Position(symbol)
+}
+
 // openPositionFn is called by processWatchlist for each new symbol.
-// Tests replace it with a stub that skips the Alpaca API call.
+// Tests replace it with a stub that skips the broker call.
 var openPositionFn = tryOpenPosition
 
-// AccountSnapshot holds the key numbers we care about from Alpaca.
+// AccountSnapshot holds the key numbers we care about from the broker.
 type AccountSnapshot struct {
 	Equity      float64 // total account value (cash + positions)
 	Cash        float64 // settled cash available
@@ -190,24 +180,23 @@ type AccountSnapshot struct {
 	DayPL       float64 // today's P/L = equity minus yesterday's close equity
 }
 
-// getAccountFn fetches account figures from Alpaca.
+// getAccountFn fetches account figures from the broker.
 // Tests replace it with a stub.
 var getAccountFn = func() (*AccountSnapshot, error) {
-	acct, err := alpacaClient.GetAccount()
+	b, err := ep.CurrentBroker()
+	if err != nil {
+		return nil, err
+	}
+	acct, err := b.Account()
 	if err != nil {
 		return nil, err
 	}
-	equity, _ := acct.Equity.Float64()
-	cash, _ := acct.Cash.Float64()
-	bp, _ := acct.BuyingPower.Float64()
-	lastEquity, _ := acct.LastEquity.Float64()
 	// DayPL = how much equity has changed since yesterday's close.
-	dayPL := equity - lastEquity
 	return &AccountSnapshot{
-		Equity:      equity,
-		Cash:        cash,
-		BuyingPower: bp,
-		DayPL:       dayPL,
+		Equity:      acct.PortfolioValue,
+		Cash:        acct.Cash,
+		BuyingPower: acct.BuyingPower,
+		DayPL:       acct.PortfolioValue - acct.LastEquity,
 	}, nil
 }
 
@@ -246,33 +235,43 @@ func loadEnv() {
 func main() {
 	loadEnv()
 
-	apiKey := os.Getenv("ALPACA_API_KEY")
-	apiSecret := os.Getenv("ALPACA_SECRET_KEY")
-	baseURL := os.Getenv("ALPACA_PAPER_URL") // e.g. https://paper-api.alpaca.markets
-
-	if apiKey == "" || apiSecret == "" {
-		log.Fatal("ALPACA_API_KEY and ALPACA_SECRET_KEY must be set")
+	// REPLAY_MODE=replay serves every bar request from a recorded session,
+	// so with BROKER=sim the monitor runs with no network at all.
+	session, err := replay.InstallFromEnv()
+	if err != nil {
+		log.Fatalf("replay: %v", err)
+	}
+	if session != nil {
+		defer session.Close()
 	}
 
-	alpacaClient = alpaca.NewClient(alpaca.ClientOpts{
-		APIKey:    apiKey,
-		APISecret: apiSecret,
-		BaseURL:   baseURL,
-	})
-
-	mdClient = marketdata.NewClient(marketdata.ClientOpts{
-		APIKey:    apiKey,
-		APISecret: apiSecret,
-	})
+	// Orders, positions and the account go through the broker named by
+	// BROKER (see pkg/ep); bars come from MARKET_DATA_PROVIDER.
+	if _, err := ep.CurrentBroker(); err != nil {
+		log.Fatalf("Broker: %v", err)
+	}
+	barProvider, err = marketdata.NewProviderFromEnv()
+	if err != nil {
+		log.Fatalf("Market data provider: %v", err)
+	}
 
-	var err error
 	easternLoc, err = time.LoadLocation(EASTERN_TZ)
 	if err != nil {
 		log.Fatalf("Cannot load timezone %s: %v", EASTERN_TZ, err)
 	}
 
+	exitProfiles, err = exits.LoadProfilesFromEnv()
+	if err != nil {
+		log.Fatalf("Cannot load exit profiles: %v", err)
+	}
+	log.Printf("📐 Exit profiles: %s (default %q)", strings.Join(exitProfiles.Names(), ", "), exitProfiles.Default)
+
 	initTradeResultsFile()
 
+	// Fills, cancels and bracket-leg executions arrive on the trade-updates
+	// stream within seconds; the poll below remains the fallback.
+	go streamTradeUpdates()
+
 	// Print account status immediately so the operator knows the starting equity.
 	printAccountStatus("startup")
 
@@ -286,10 +285,12 @@ func main() {
 		if isMarketOpen() {
 			checkAndProcessWatchlist()
 			evaluatePositions()
+			syncOrderLedger()
+			checkCircuitBreaker()
 			time.Sleep(POLL_INTERVAL)
 		} else {
 			nextOpen := nextMarketOpen()
-			sleepDur := time.Until(nextOpen)
+			sleepDur := nextOpen.Sub(replay.Now())
 			if sleepDur < time.Minute {
 				sleepDur = MARKET_CHECK_INTERVAL
 			}
@@ -306,7 +307,7 @@ func main() {
 // ─────────────────────────────────────────────────────────────────────────────
 
 func isMarketOpen() bool {
-	now := time.Now().In(easternLoc)
+	now := replay.Now().In(easternLoc)
 	wd := now.Weekday()
 	if wd == time.Saturday || wd == time.Sunday {
 		return false
@@ -320,7 +321,7 @@ func isMarketOpen() bool {
 
 // nextMarketOpen returns the next weekday 09:30 ET after the current moment.
 func nextMarketOpen() time.Time {
-	now := time.Now().In(easternLoc)
+	now := replay.Now().In(easternLoc)
 	candidate := time.Date(now.Year(), now.Month(), now.Day(),
 		MARKET_OPEN_HOUR, MARKET_OPEN_MIN, 0, 0, easternLoc)
 
@@ -401,7 +402,7 @@ func processWatchlist(path string) {
 }
 
 // parsePosition parses a CSV row into a RealtimePosition.
-// Expected columns: Symbol, EntryPrice, StopLoss, Shares, InitialRisk, PurchaseDate
+// Expected columns: Symbol, EntryPrice, StopLoss, Shares, InitialRisk, PurchaseDate[, ExitProfile]
 func parsePosition(row []string) *RealtimePosition {
 	if len(row) < 6 {
 		return nil
@@ -426,16 +427,24 @@ func parsePosition(row []string) *RealtimePosition {
 		return nil
 	}
 
+	profile := ""
+	if len(row) > 6 {
+		profile = strings.TrimSpace(row[6])
+	}
+
 	return &RealtimePosition{
-		Symbol:        strings.TrimSpace(row[0]),
-		EntryPrice:    entryPrice,
-		StopLoss:      stopLoss,
-		InitialRisk:   initialRisk,
-		Shares:        shares,
-		InitialShares: shares,
-		PurchaseDate:  purchaseDate,
-		HighestPrice:  entryPrice,
-		LastCheckDate: purchaseDate,
+		Position: exits.Position{
+			Symbol:        strings.TrimSpace(row[0]),
+			EntryPrice:    entryPrice,
+			StopLoss:      stopLoss,
+			InitialRisk:   initialRisk,
+			Shares:        shares,
+			InitialShares: shares,
+			PurchaseDate:  purchaseDate,
+			HighestPrice:  entryPrice,
+			LastCheckDate: purchaseDate,
+		},
+		Profile: profile,
 	}
 }
 
@@ -443,7 +452,7 @@ func parsePosition(row []string) *RealtimePosition {
 // Opening / registering a position
 // ─────────────────────────────────────────────────────────────────────────────
 
-// tryOpenPosition validates the position, syncs share count from Alpaca,
+// tryOpenPosition validates the position, syncs share count from the broker,
 // and registers it for ongoing monitoring.
 func tryOpenPosition(pos *RealtimePosition) {
 	// Basic sanity filters
@@ -461,25 +470,25 @@ func tryOpenPosition(pos *RealtimePosition) {
 	pos.InitialStopLoss = pos.StopLoss
 	pos.InitialRisk = pos.EntryPrice - pos.StopLoss
 
-	// Try to sync actual share count from the live Alpaca position.
+	// Try to sync actual share count from the broker position.
 	// If the position doesn't exist yet (order pending), we keep the CSV shares
 	// and will re-sync on the first evaluation tick.
-	if alpacaPos, err := alpacaClient.GetPosition(pos.Symbol); err == nil {
-		qty, _ := alpacaPos.Qty.Float64()
+	if brokerPos, err := brokerPosition(pos.Symbol); err == nil && brokerPos != nil {
+		qty := brokerPos.Qty
 		if qty > 0 {
 			pos.Shares = qty
 			pos.InitialShares = qty
-			entryAvg, _ := alpacaPos.AvgEntryPrice.Float64()
-			// Trust Alpaca's avg entry price when available
+			entryAvg := brokerPos.AvgEntryPrice
+			// Trust the broker's avg entry price when available
 			if entryAvg > 0 {
 				pos.EntryPrice = entryAvg
 				pos.InitialRisk = pos.EntryPrice - pos.StopLoss
 			}
-			log.Printf("[%s] 🔄 Synced from Alpaca: %.0f shares @ avg $%.2f",
+			log.Printf("[%s] 🔄 Synced from broker: %.0f shares @ avg $%.2f",
 				pos.Symbol, qty, entryAvg)
 		}
 	} else {
-		log.Printf("[%s] ℹ️  No open Alpaca position yet (order may be pending). Monitoring with CSV values.", pos.Symbol)
+		log.Printf("[%s] ℹ️  No open broker position yet (order may be pending). Monitoring with CSV values.", pos.Symbol)
 	}
 
 	// Reset per-session OHLC — will be populated on first bar fetch
@@ -487,13 +496,24 @@ func tryOpenPosition(pos *RealtimePosition) {
 	pos.SessionLow = math.MaxFloat64
 	pos.SessionOpen = 0
 
+	rules, err := exitProfiles.Rules(pos.Profile)
+	if err != nil {
+		log.Printf("[%s] ⚠️  %v — using default profile %q", pos.Symbol, err, exitProfiles.Default)
+		pos.Profile = exitProfiles.Default
+		rules, _ = exitProfiles.Rules(pos.Profile)
+	}
+	if pos.Profile == "" {
+		pos.Profile = exitProfiles.Default
+	}
+	pos.engine = exits.NewEngine(rules, nil)
+
 	positionsMu.Lock()
 	activePositions[pos.Symbol] = pos
 	positionsMu.Unlock()
 
-	log.Printf("[%s] 🟢 MONITORING STARTED | Entry: $%.2f | Stop: $%.2f | Risk/share: $%.2f | Shares: %.0f | Since: %s",
+	log.Printf("[%s] 🟢 MONITORING STARTED | Entry: $%.2f | Stop: $%.2f | Risk/share: $%.2f | Shares: %.0f | Since: %s | Profile: %s",
 		pos.Symbol, pos.EntryPrice, pos.StopLoss, pos.InitialRisk,
-		pos.Shares, pos.PurchaseDate.Format("2006-01-02"))
+		pos.Shares, pos.PurchaseDate.Format("2006-01-02"), pos.Profile)
 }
 
 // ─────────────────────────────────────────────────────────────────────────────
@@ -553,32 +573,18 @@ func evaluatePositions() {
 }
 
 // ─────────────────────────────────────────────────────────────────────────────
-// Per-position evaluation — mirrors simulateNextDay() from the backtest
+// Per-position evaluation — the rules themselves live in pkg/exits
 // ─────────────────────────────────────────────────────────────────────────────
 
 func evaluatePosition(pos *RealtimePosition) bool {
 	pos.mu.Lock()
 	defer pos.mu.Unlock()
 
-	now := time.Now().In(easternLoc)
+	now := replay.Now().In(easternLoc)
 
-	// ── 1. Re-sync shares from Alpaca (handles partial fills, etc.) ──────────
-	qty, err := getAlpacaPositionFn(pos.Symbol)
-	if err != nil {
-		// Position no longer exists in Alpaca — stopped out by bracket leg or
-		// closed manually. Remove from monitoring.
-		log.Printf("[%s] ⚠️  Position no longer found in Alpaca — removing from monitor", pos.Symbol)
-		removeFromWatchlist(pos.Symbol)
-		return true
-	}
-	if qty != pos.Shares && qty > 0 {
-		log.Printf("[%s] 🔄 Share count updated %.0f → %.0f (Alpaca sync)",
-			pos.Symbol, pos.Shares, qty)
-		pos.Shares = qty
-	}
-
-	// ── 2. Fetch today's intraday bars to build session OHLC ─────────────────
-	today := now.Format("2006-01-02")
+	// ── 1. Fetch today's intraday bars to build session OHLC ─────────────────
+	// Fetched before the share re-sync so a simulated broker has already
+	// filled against them.
 	sessionStart := time.Date(now.Year(), now.Month(), now.Day(),
 		MARKET_OPEN_HOUR, MARKET_OPEN_MIN, 0, 0, easternLoc)
 
@@ -588,344 +594,314 @@ func evaluatePosition(pos *RealtimePosition) bool {
 		return false
 	}
 
-	// Build session OHLC from all bars since open
-	sessionHigh := 0.0
-	sessionLow := math.MaxFloat64
-	sessionOpen := bars[0].Open
-	latestClose := bars[len(bars)-1].Close
-
-	for _, b := range bars {
-		if b.High > sessionHigh {
-			sessionHigh = b.High
-		}
-		if b.Low < sessionLow {
-			sessionLow = b.Low
-		}
-	}
-
-	pos.SessionHigh = sessionHigh
-	pos.SessionLow = sessionLow
-	pos.SessionOpen = sessionOpen
-
-	if sessionHigh > pos.HighestPrice {
-		pos.HighestPrice = sessionHigh
+	// ── 2. Re-sync shares from the broker (handles partial fills, etc.) ──────
+	qty, err := getAlpacaPositionFn(pos.Symbol)
+	if err != nil {
+		// Position no longer exists at the broker and the trade-updates stream
+		// did not report the close (stream down, or closed before start).
+		// Remove from monitoring.
+		log.Printf("[%s] ⚠️  Position no longer found at the broker — removing from monitor", pos.Symbol)
+		removeFromWatchlist(pos.Symbol)
+		return true
 	}
-
-	// ── 3. Increment DaysHeld once per calendar day ───────────────────────────
-	if today != pos.LastCheckDate.Format("2006-01-02") {
-		pos.DaysHeld++
-		pos.LastCheckDate = now
-		// Reset session OHLC tracking at the start of a new day
-		pos.SessionHigh = 0
-		pos.SessionLow = math.MaxFloat64
+	if qty != pos.Shares && qty > 0 {
+		log.Printf("[%s] 🔄 Share count updated %.0f → %.0f (broker sync)",
+			pos.Symbol, pos.Shares, qty)
+		pos.Shares = qty
 	}
 
-	currentPrice := latestClose
-	currentGain := currentPrice - pos.EntryPrice
-	currentRR := 0.0
-	if pos.InitialRisk > 0 {
-		currentRR = currentGain / pos.InitialRisk
-	}
+	// ── 3. Run the exit rules ─────────────────────────────────────────────────
+	// before is restored if a sell is refused, so the tick is retried.
+	before := pos.Position
+	res := pos.engine.Evaluate(&pos.Position, bars)
 
 	log.Printf("[%s] Day %d (%s) | Close: $%.2f | SessionH: $%.2f | SessionL: $%.2f | Gain: $%.2f (%.1f%%) | R/R: %.2fR | Stop: $%.2f | Shares: %.0f",
-		pos.Symbol, pos.DaysHeld, today,
-		currentPrice, sessionHigh, sessionLow,
-		currentGain, (currentGain/pos.EntryPrice)*100,
-		currentRR, pos.StopLoss, pos.Shares)
-
-	// ── 4. Weak close detection (mirrors backtest checkWeakCloseIntraday) ─────
-	// On any day, if the session closes more than WEAK_CLOSE_THRESHOLD below
-	// the session high, exit immediately (same logic as the backtest).
-	if sessionHigh > 0 && !pos.WeakCloseDetected {
-		closeFromHigh := (sessionHigh - currentPrice) / sessionHigh
-		if closeFromHigh >= WEAK_CLOSE_THRESHOLD {
-			log.Printf("[%s] ⚠️  WEAK CLOSE: $%.2f is %.1f%% below session high $%.2f — exiting",
-				pos.Symbol, currentPrice, closeFromHigh*100, sessionHigh)
-			pos.WeakCloseDetected = true
-			return executeExit(pos, currentPrice, now, "Weak Close")
-		}
-	}
-
-	// ── 5. Stop loss ──────────────────────────────────────────────────────────
-	// Use session low (not just latest close) so intraday wicks are caught.
-	if sessionLow <= pos.StopLoss || currentPrice <= pos.StopLoss {
-		return executeStopOut(pos, pos.StopLoss, now)
-	}
-
-	// ── 6. Move to breakeven ──────────────────────────────────────────────────
-	if pos.DaysHeld >= BREAKEVEN_TRIGGER_DAYS && !pos.ProfitTaken {
-		pctGain := (sessionHigh - pos.EntryPrice) / pos.EntryPrice
-		if pctGain >= BREAKEVEN_TRIGGER_PERCENT && pos.StopLoss < pos.EntryPrice {
-			pos.StopLoss = pos.EntryPrice
-			log.Printf("[%s] 🔒 BREAKEVEN STOP SET — session touched +%.1f%% on day %d",
-				pos.Symbol, pctGain*100, pos.DaysHeld)
-		}
-	}
-
-	// ── 7. Tighten stop if no follow-through after N days ────────────────────
-	if pos.DaysHeld >= MAX_DAYS_NO_FOLLOWTHROUGH && currentRR < 0.5 && !pos.ProfitTaken {
-		tighter := math.Max(pos.EntryPrice-(pos.InitialRisk*0.3), pos.EntryPrice)
-		if tighter > pos.StopLoss {
-			pos.StopLoss = tighter
-			log.Printf("[%s] ⚠️  No follow-through after %d days — stop tightened to $%.2f",
-				pos.Symbol, MAX_DAYS_NO_FOLLOWTHROUGH, pos.StopLoss)
-		}
-	}
-
-	// ── 8. Strong EP — big gain in first few days ────────────────────────────
-	pctGain := (currentPrice - pos.EntryPrice) / pos.EntryPrice
-	if pos.DaysHeld <= STRONG_EP_DAYS && pctGain >= STRONG_EP_GAIN && !pos.ProfitTaken {
-		closed := executeStrongEPProfit(pos, currentPrice, now)
-		if closed {
-			return true
+		pos.Symbol, pos.DaysHeld, now.Format("2006-01-02"),
+		res.Price, res.SessionHigh, res.SessionLow,
+		res.Gain, (res.Gain/pos.EntryPrice)*100,
+		res.RR, pos.StopLoss, pos.Shares)
+
+	// ── 4. Carry out the decisions ────────────────────────────────────────────
+	for _, d := range res.Decisions {
+		switch d.Kind {
+		case exits.KindStopMoved:
+			log.Printf("[%s] 🔒 %s — stop $%.2f → $%.2f", pos.Symbol, d.Reason, d.OldStop, d.NewStop)
+		case exits.KindPartialExit, exits.KindExit:
+			label := "📤 EXIT"
+			if d.Kind == exits.KindPartialExit {
+				label = "🎯 PARTIAL"
+			}
+			if !executeSell(pos, d, before.Shares, label) {
+				pos.Position = before
+				restoreBrokerStop(pos)
+				log.Printf("[%s] ↩️  Sell not placed — %.0f shares still held, retrying next tick", pos.Symbol, pos.Shares)
+				return false
+			}
+			if d.Kind == exits.KindPartialExit {
+				log.Printf("[%s] ✅ %.0f shares remain | Cumulative P/L: $%.2f | Stop: $%.2f",
+					pos.Symbol, pos.Shares, pos.CumulativeProfit, pos.StopLoss)
+			}
 		}
-		return false
 	}
 
-	// ── 9. Graduated profit taking ────────────────────────────────────────────
-	if currentRR >= PROFIT_TAKE_1_RR && !pos.ProfitTaken {
-		executeProfitPartial(pos, currentPrice, now, PROFIT_TAKE_1_PERCENT, 1)
-		pos.TrailingStopMode = true
-		pos.ProfitTaken = true
-		if pos.DaysHeld >= BREAKEVEN_TRIGGER_DAYS {
-			pos.StopLoss = math.Max(pos.StopLoss, pos.EntryPrice)
-			log.Printf("[%s] 🔒 Stop locked at breakeven after Level 1 profit", pos.Symbol)
-		}
-		return pos.Shares <= 0
+	if res.Closed {
+		removeFromWatchlist(pos.Symbol)
+	} else {
+		syncBrokerStop(pos)
 	}
+	return res.Closed
+}
 
-	if currentRR >= PROFIT_TAKE_2_RR && pos.ProfitTaken && !pos.ProfitTaken2 {
-		executeProfitPartial(pos, currentPrice, now, PROFIT_TAKE_2_PERCENT, 2)
-		newStop := pos.EntryPrice + (pos.InitialRisk * 1.0)
-		pos.StopLoss = math.Max(pos.StopLoss, newStop)
-		pos.ProfitTaken2 = true
-		log.Printf("[%s] 🔒 Stop locked at +1R ($%.2f) after Level 2 profit", pos.Symbol, pos.StopLoss)
-		return pos.Shares <= 0
+// syncBrokerStop moves the broker-side stop to pos.StopLoss for the shares
+// still held.  Callers hold pos.mu, so it makes one attempt and a failure
+// is retried on the next tick rather than by sleeping here.
+func syncBrokerStop(pos *RealtimePosition) {
+	if pos.StopLoss == pos.brokerStop && pos.Shares == pos.brokerShares {
+		return
 	}
-
-	if currentRR >= PROFIT_TAKE_3_RR && pos.ProfitTaken2 && !pos.ProfitTaken3 {
-		executeProfitPartial(pos, currentPrice, now, PROFIT_TAKE_3_PERCENT, 3)
-		newStop := pos.EntryPrice + (pos.InitialRisk * 2.0)
-		pos.StopLoss = math.Max(pos.StopLoss, newStop)
-		pos.ProfitTaken3 = true
-		log.Printf("[%s] 🔒 Stop locked at +2R ($%.2f) after Level 3 profit", pos.Symbol, pos.StopLoss)
-		return pos.Shares <= 0
+	stop, err := ep.SyncStopOnce(pos.Symbol, pos.StopLoss, pos.Shares)
+	if err != nil {
+		log.Printf("[%s] ⚠️  Broker stop not synced to $%.2f: %v — retrying next tick", pos.Symbol, pos.StopLoss, err)
+		return
 	}
+	log.Printf("[%s] 🛡️  Broker stop at $%.2f for %g shares (order %s)", pos.Symbol, stop.StopPrice, stop.Qty-stop.FilledQty, stop.ID)
+	pos.brokerStop, pos.brokerShares = pos.StopLoss, pos.Shares
+}
 
-	// ── 10. Trailing stop (active after first profit taken) ───────────────────
-	if pos.TrailingStopMode {
-		pctFromEntry := (currentPrice - pos.EntryPrice) / pos.EntryPrice
-
-		var newStop float64
-		switch {
-		case pctFromEntry > 0.20:
-			// Wide trail — give big runners room
-			newStop = currentPrice * 0.94
-		case pctFromEntry > 0.10:
-			newStop = currentPrice * 0.95
-		case pctFromEntry > 0.05:
-			newStop = currentPrice * 0.96
-		default:
-			newStop = pos.EntryPrice // floor at breakeven
-		}
-
-		if newStop > pos.StopLoss {
-			pos.StopLoss = newStop
-			log.Printf("[%s] 📈 Trailing stop → $%.2f (%.1f%% from entry)",
-				pos.Symbol, pos.StopLoss, pctFromEntry*100)
-		}
-
-		// If price slips back below the session's 20-MA proxy (entry + 10% band),
-		// and we're not yet in meaningful profit, close the position.
-		if pctFromEntry < 0.05 && currentPrice < pos.EntryPrice*0.96 {
-			exitPrice := math.Max(pos.StopLoss, pos.EntryPrice)
-			return executeExit(pos, exitPrice, now, "Trailing — retreated below threshold")
-		}
+// restoreBrokerStop puts the broker-side stop back over every share still
+// held after a refused sell, placing a new one if executeSell cancelled it.
+// Callers hold pos.mu.
+func restoreBrokerStop(pos *RealtimePosition) {
+	stop, err := ep.EnsureStop(pos.Symbol, pos.StopLoss, pos.Shares)
+	if err != nil {
+		pos.brokerStop, pos.brokerShares = 0, 0
+		log.Printf("[%s] ⚠️  Broker stop not restored to $%.2f x %.0f: %v — retrying next tick",
+			pos.Symbol, pos.StopLoss, pos.Shares, err)
+		return
 	}
-
-	return false
+	log.Printf("[%s] 🛡️  Broker stop restored at $%.2f for %g shares (order %s)", pos.Symbol, stop.StopPrice, stop.Qty-stop.FilledQty, stop.ID)
+	pos.brokerStop, pos.brokerShares = pos.StopLoss, pos.Shares
 }
 
 // ─────────────────────────────────────────────────────────────────────────────
-// Exit execution helpers — each calls ep.PlaceSellOrder
+// Exit execution — ep.PlaceSellOrder plus trade_results.csv
 // ─────────────────────────────────────────────────────────────────────────────
 
-// executeStopOut sells all remaining shares at the stop price.
-func executeStopOut(pos *RealtimePosition, stopPrice float64, t time.Time) bool {
-	shares := int(math.Round(pos.Shares))
-	if shares < 1 {
-		return true
-	}
-
-	log.Printf("[%s] 🛑 STOP OUT @ $%.2f — selling %d shares", pos.Symbol, stopPrice, shares)
-
-	if _, err := ep.PlaceSellOrder(pos.Symbol, shares, &stopPrice); err != nil {
-		log.Printf("[%s] ❌ PlaceSellOrder error: %v — position removed from monitor anyway", pos.Symbol, err)
+// executeSell places the sell order for one engine decision out of held
+// shares and, once the broker accepts it, records it.  The broker stop
+// reserves every share it covers, so first it is shrunk to the shares that
+// stay or, for a full exit, cancelled.  It returns false if nothing was
+// sold; the caller then restores the position and its stop.  Callers hold
+// pos.mu.
+func executeSell(pos *RealtimePosition, d exits.Decision, held float64, label string) bool {
+	log.Printf("[%s] %s — %s | Selling %d shares @ $%.2f", pos.Symbol, label, d.Reason, d.Shares, d.Price)
+
+	if remaining := held - float64(d.Shares); remaining > 0 {
+		stop, err := ep.SyncStopOnce(pos.Symbol, pos.StopLoss, remaining)
+		if err != nil {
+			log.Printf("[%s] ❌ Broker stop not reduced to %.0f shares: %v", pos.Symbol, remaining, err)
+			return false
+		}
+		pos.brokerStop, pos.brokerShares = stop.StopPrice, remaining
+	} else {
+		stop, err := ep.CancelStop(pos.Symbol)
+		if err != nil {
+			log.Printf("[%s] ❌ Broker stop not cancelled: %v", pos.Symbol, err)
+			return false
+		}
+		if stop != nil {
+			pendingExitsMu.Lock()
+			retiredStops[stop.ID] = true
+			pendingExitsMu.Unlock()
+		}
+		pos.brokerStop, pos.brokerShares = 0, 0
 	}
 
-	pl := (stopPrice - pos.EntryPrice) * float64(shares)
-	totalPL := pl + pos.CumulativeProfit
-	rr := 0.0
-	if pos.InitialRisk > 0 {
-		rr = (stopPrice - pos.EntryPrice) / pos.InitialRisk
-	}
+	// Registered before the order goes out: its fill can arrive on the
+	// trade-updates stream before PlaceSellOrderAs returns.
+	clientID := fmt.Sprintf("ep-exit-%s-%d", pos.Symbol, time.Now().UnixNano())
+	pendingExitsMu.Lock()
+	pendingExits[clientID] = d.Reason
+	pendingExitsMu.Unlock()
 
-	reason := "Stop Loss Hit"
-	if pos.ProfitTaken {
-		reason = "Trailing Stop Hit (partial profit protected)"
-	}
-	if pos.CumulativeProfit > 0 {
-		reason = fmt.Sprintf("%s — cumulative P/L incl. partials: $%.2f", reason, totalPL)
+	price := d.Price
+	if _, err := ep.PlaceSellOrderAs(clientID, pos.Symbol, d.Shares, &price); err != nil {
+		pendingExitsMu.Lock()
+		delete(pendingExits, clientID)
+		pendingExitsMu.Unlock()
+		log.Printf("[%s] ❌ PlaceSellOrder error: %v", pos.Symbol, err)
+		return false
 	}
 
 	recordTrade(TradeRecord{
 		Symbol:      pos.Symbol,
 		EntryPrice:  pos.EntryPrice,
-		ExitPrice:   stopPrice,
-		Shares:      float64(shares),
+		ExitPrice:   d.Price,
+		Shares:      float64(d.Shares),
 		InitialRisk: pos.InitialRisk,
-		ProfitLoss:  pl,
-		RiskReward:  rr,
+		ProfitLoss:  d.ProfitLoss,
+		RiskReward:  d.RiskReward,
 		EntryDate:   pos.PurchaseDate.Format("2006-01-02"),
-		ExitDate:    t.Format("2006-01-02"),
-		ExitReason:  reason,
-		IsWinner:    totalPL > 0,
+		ExitDate:    d.Time.Format("2006-01-02"),
+		ExitReason:  d.Reason,
+		IsWinner:    d.IsWinner,
 	})
-
-	removeFromWatchlist(pos.Symbol)
-	pos.Shares = 0
 	return true
 }
 
-// executeStrongEPProfit sells STRONG_EP_TAKE_PERCENT of shares on a strong move.
-func executeStrongEPProfit(pos *RealtimePosition, currentPrice float64, t time.Time) bool {
-	sharesToSell := int(math.Floor(pos.Shares * STRONG_EP_TAKE_PERCENT))
-	if sharesToSell < 1 {
-		sharesToSell = 1
+// syncOrderLedger records status changes and actual fills for the orders
+// placed through pkg/ep, so the ledger holds real exit prices rather than the
+// assumed ones written to trade_results.csv.
+func syncOrderLedger() {
+	n, err := ep.SyncOrderLedger()
+	if err != nil {
+		log.Printf("⚠️  Order ledger sync failed: %v", err)
+		return
 	}
-	if sharesToSell > int(pos.Shares) {
-		sharesToSell = int(pos.Shares)
+	if n > 0 {
+		log.Printf("📒 Order ledger: %d order update(s) recorded", n)
 	}
+}
 
-	log.Printf("[%s] 🚀 STRONG EP! Selling %.0f%% (%d shares) @ $%.2f",
-		pos.Symbol, STRONG_EP_TAKE_PERCENT*100, sharesToSell, currentPrice)
-
-	if _, err := ep.PlaceSellOrder(pos.Symbol, sharesToSell, &currentPrice); err != nil {
-		log.Printf("[%s] ❌ PlaceSellOrder error: %v", pos.Symbol, err)
+// checkCircuitBreaker updates the circuit breaker from the account and the
+// ledger.  A trip blocks new entries in every process and, with
+// BREAKER_FLATTEN, closes everything; open positions keep being managed here
+// until their exits fill.
+func checkCircuitBreaker() {
+	s, err := ep.CheckBreaker()
+	if err != nil {
+		log.Printf("⚠️  Circuit breaker check failed: %v", err)
+		return
+	}
+	if s.Tripped != breakerTripped {
+		breakerTripped = s.Tripped
+		if s.Tripped {
+			log.Printf("🛑 CIRCUIT BREAKER TRIPPED (%s): %s — no new entries", s.Rule, s.Detail)
+		} else {
+			log.Println("✅ Circuit breaker cleared")
+		}
 	}
-
-	pl := (currentPrice - pos.EntryPrice) * float64(sharesToSell)
-	rr := (currentPrice - pos.EntryPrice) / pos.InitialRisk
-
-	recordTrade(TradeRecord{
-		Symbol:      pos.Symbol,
-		EntryPrice:  pos.EntryPrice,
-		ExitPrice:   currentPrice,
-		Shares:      float64(sharesToSell),
-		InitialRisk: pos.InitialRisk,
-		ProfitLoss:  pl,
-		RiskReward:  rr,
-		EntryDate:   pos.PurchaseDate.Format("2006-01-02"),
-		ExitDate:    t.Format("2006-01-02"),
-		ExitReason:  fmt.Sprintf("Strong EP — %.0f%% sold", STRONG_EP_TAKE_PERCENT*100),
-		IsWinner:    true,
-	})
-
-	pos.CumulativeProfit += pl
-	pos.Shares -= float64(sharesToSell)
-	pos.StopLoss = math.Max(pos.EntryPrice, pos.StopLoss)
-	pos.ProfitTaken = true
-	pos.TrailingStopMode = true
-
-	log.Printf("[%s] ✅ %.0f shares remain | Cumulative P/L: $%.2f | Stop moved to BE: $%.2f",
-		pos.Symbol, pos.Shares, pos.CumulativeProfit, pos.StopLoss)
-
-	return pos.Shares <= 0
 }
 
-// executeProfitPartial sells pct of remaining shares at a profit level.
-func executeProfitPartial(pos *RealtimePosition, currentPrice float64, t time.Time, pct float64, level int) {
-	sharesToSell := int(math.Floor(pos.Shares * pct))
-	if sharesToSell < 1 {
-		sharesToSell = 1
-	}
-	if sharesToSell > int(pos.Shares) {
-		sharesToSell = int(pos.Shares)
+// ─────────────────────────────────────────────────────────────────────────────
+// Trade updates — fills, cancels and bracket legs pushed by the broker
+// ─────────────────────────────────────────────────────────────────────────────
+
+// streamTradeUpdates runs for the life of the process.  If the broker cannot
+// stream, positions are still reconciled by the poll in evaluatePosition.
+func streamTradeUpdates() {
+	if err := ep.StreamTradeUpdates(context.Background(), handleTradeUpdate); err != nil {
+		log.Printf("⚠️  Trade updates unavailable (%v) — relying on %s polling", err, POLL_INTERVAL)
 	}
+}
 
-	rr := (currentPrice - pos.EntryPrice) / pos.InitialRisk
-	log.Printf("[%s] 🎯 PROFIT LEVEL %d (%.2fR) — selling %d shares @ $%.2f",
-		pos.Symbol, level, rr, sharesToSell, currentPrice)
+// handleTradeUpdate applies one order event to the monitored positions.
+func handleTradeUpdate(tu broker.TradeUpdate) {
+	o := tu.Order
 
-	if _, err := ep.PlaceSellOrder(pos.Symbol, sharesToSell, &currentPrice); err != nil {
-		log.Printf("[%s] ❌ PlaceSellOrder error: %v", pos.Symbol, err)
+	pendingExitsMu.Lock()
+	reason, ours := pendingExits[o.ClientOrderID]
+	if ours && !o.IsOpen() {
+		delete(pendingExits, o.ClientOrderID)
+	}
+	retired := retiredStops[o.ID]
+	if retired && !o.IsOpen() {
+		delete(retiredStops, o.ID)
 	}
+	pendingExitsMu.Unlock()
 
-	pl := (currentPrice - pos.EntryPrice) * float64(sharesToSell)
+	positionsMu.RLock()
+	pos := activePositions[o.Symbol]
+	positionsMu.RUnlock()
 
-	recordTrade(TradeRecord{
-		Symbol:      pos.Symbol,
-		EntryPrice:  pos.EntryPrice,
-		ExitPrice:   currentPrice,
-		Shares:      float64(sharesToSell),
-		InitialRisk: pos.InitialRisk,
-		ProfitLoss:  pl,
-		RiskReward:  rr,
-		EntryDate:   pos.PurchaseDate.Format("2006-01-02"),
-		ExitDate:    t.Format("2006-01-02"),
-		ExitReason:  fmt.Sprintf("Profit Level %d at %.2fR", level, rr),
-		IsWinner:    true,
-	})
+	switch {
+	case tu.IsFill() && o.Side == broker.Buy:
+		log.Printf("[%s] 📥 Entry %s: %g @ $%.2f (position %g)", o.Symbol, tu.Event, tu.Qty, tu.Price, tu.PositionQty)
+		if pos != nil {
+			pos.mu.Lock()
+			pos.Shares = tu.PositionQty
+			pos.mu.Unlock()
+		}
 
-	pos.CumulativeProfit += pl
-	pos.Shares -= float64(sharesToSell)
+	case tu.IsFill() && o.Side == broker.Sell:
+		if ours {
+			// executeSell records the decision once the order is accepted.
+			log.Printf("[%s] ✅ Exit %s (%s): %g @ $%.2f", o.Symbol, tu.Event, reason, tu.Qty, tu.Price)
+			return
+		}
+		if pos == nil {
+			log.Printf("[%s] ℹ️  Sell %s for unmonitored symbol: %g @ $%.2f", o.Symbol, tu.Event, tu.Qty, tu.Price)
+			return
+		}
+		closeFromTradeUpdate(pos, tu, fillReason(o))
 
-	log.Printf("[%s] ✅ %.0f shares remain | Cumulative P/L: $%.2f | Stop: $%.2f",
-		pos.Symbol, pos.Shares, pos.CumulativeProfit, pos.StopLoss)
+	case tu.Event == broker.EventCanceled || tu.Event == broker.EventExpired || tu.Event == broker.EventRejected:
+		switch {
+		case ours:
+			log.Printf("[%s] ⚠️  Exit order %s %s (%s) — shares still held, next poll resyncs", o.Symbol, o.ID, tu.Event, reason)
+		case retired:
+			log.Printf("[%s] Stop order %s %s for a full exit", o.Symbol, o.ID, tu.Event)
+		case pos != nil && isStopOrder(o) && o.FilledQty == 0:
+			log.Printf("[%s] ⚠️  Stop order %s %s — position may be unprotected", o.Symbol, o.ID, tu.Event)
+		}
+	}
 }
 
-// executeExit closes the full remaining position for a given reason.
-func executeExit(pos *RealtimePosition, exitPrice float64, t time.Time, reason string) bool {
-	shares := int(math.Round(pos.Shares))
-	if shares < 1 {
-		return true
+// fillReason attributes a sell fill that executeSell did not place.
+func fillReason(o broker.Order) string {
+	switch {
+	case isStopOrder(o):
+		return fmt.Sprintf("Stop-loss leg filled (stop $%.2f)", o.StopPrice)
+	case o.Type == broker.Limit && o.Class == broker.Bracket:
+		return fmt.Sprintf("Take-profit leg filled (limit $%.2f)", o.LimitPrice)
+	default:
+		return "Closed outside the monitor"
 	}
+}
 
-	log.Printf("[%s] 📤 EXIT — %s | Selling %d shares @ $%.2f", pos.Symbol, reason, shares, exitPrice)
-
-	if _, err := ep.PlaceSellOrder(pos.Symbol, shares, &exitPrice); err != nil {
-		log.Printf("[%s] ❌ PlaceSellOrder error: %v — removing from monitor anyway", pos.Symbol, err)
-	}
+func isStopOrder(o broker.Order) bool {
+	return o.Type == broker.Stop || o.Type == broker.StopLimit
+}
 
-	pl := (exitPrice - pos.EntryPrice) * float64(shares)
-	totalPL := pl + pos.CumulativeProfit
+// closeFromTradeUpdate books a sell fill the monitor did not initiate and
+// stops monitoring once the position is flat.
+func closeFromTradeUpdate(pos *RealtimePosition, tu broker.TradeUpdate, reason string) {
+	pos.mu.Lock()
+	pl := (tu.Price - pos.EntryPrice) * tu.Qty
 	rr := 0.0
 	if pos.InitialRisk > 0 {
-		rr = (exitPrice - pos.EntryPrice) / pos.InitialRisk
-	}
-
-	fullReason := reason
-	if pos.CumulativeProfit != 0 {
-		fullReason = fmt.Sprintf("%s (prev. partial P/L: $%.2f, total: $%.2f)", reason, pos.CumulativeProfit, totalPL)
+		rr = (tu.Price - pos.EntryPrice) / pos.InitialRisk
 	}
+	pos.CumulativeProfit += pl
+	pos.Shares = tu.PositionQty
+	flat := pos.Shares <= 0
+	log.Printf("[%s] 📤 %s — %g @ $%.2f | P/L: $%.2f | %g shares left",
+		pos.Symbol, reason, tu.Qty, tu.Price, pl, pos.Shares)
 
 	recordTrade(TradeRecord{
 		Symbol:      pos.Symbol,
 		EntryPrice:  pos.EntryPrice,
-		ExitPrice:   exitPrice,
-		Shares:      float64(shares),
+		ExitPrice:   tu.Price,
+		Shares:      tu.Qty,
 		InitialRisk: pos.InitialRisk,
 		ProfitLoss:  pl,
 		RiskReward:  rr,
 		EntryDate:   pos.PurchaseDate.Format("2006-01-02"),
-		ExitDate:    t.Format("2006-01-02"),
-		ExitReason:  fullReason,
-		IsWinner:    totalPL > 0,
+		ExitDate:    tu.Time.In(easternLoc).Format("2006-01-02"),
+		ExitReason:  reason,
+		IsWinner:    pos.CumulativeProfit > 0,
 	})
+	pos.mu.Unlock()
 
+	if !flat {
+		return
+	}
+	positionsMu.Lock()
+	delete(activePositions, pos.Symbol)
+	positionsMu.Unlock()
 	removeFromWatchlist(pos.Symbol)
-	pos.Shares = 0
-	return true
+	printCurrentStats()
+	printAccountStatus("after close")
 }
 
 // ─────────────────────────────────────────────────────────────────────────────
@@ -1034,7 +1010,7 @@ func recordTrade(r TradeRecord) {
 // Account status
 // ─────────────────────────────────────────────────────────────────────────────
 
-// printAccountStatus fetches live account figures from Alpaca and prints them.
+// printAccountStatus fetches live account figures from the broker and prints them.
 // Called at startup and after every position closes.
 func printAccountStatus(label string) {
 	snap, err := getAccountFn()
@@ -2,7 +2,9 @@ package main
 
 import (
 	"avantai/pkg/ep"
+	"avantai/pkg/replay"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"log"
@@ -14,20 +16,11 @@ import (
 
 // RealtimeScanResponse represents the complete JSON output from the real-time scanner
 type RealtimeScanResponse struct {
-	ScanTime       string                `json:"scan_time"`
-	MarketStatus   string                `json:"market_status"`
-	FilterCriteria FilterCriteriaDetails `json:"filter_criteria"`
+	ScanTime         string              `json:"scan_time"`
+	MarketStatus     string              `json:"market_status"`
+	FilterCriteria   ep.FilterParams     `json:"filter_criteria"`
 	QualifyingStocks []ep.RealtimeResult `json:"qualifying_stocks"`
-	Summary        ScanSummary           `json:"summary"`
-}
-
-// FilterCriteriaDetails contains all the filter thresholds used
-type FilterCriteriaDetails struct {
-	MinGapUpPercent        float64 `json:"min_gap_up_percent"`
-	MinDollarVolume        float64 `json:"min_dollar_volume"`
-	MinMarketCap           float64 `json:"min_market_cap"`
-	MinPremarketVolRatio   float64 `json:"min_premarket_volume_ratio"`
-	MaxExtensionADR        float64 `json:"max_extension_adr"`
+	Summary          ScanSummary         `json:"summary"`
 }
 
 // ScanSummary contains aggregate statistics from the scan
@@ -42,10 +35,27 @@ func main() {
 		log.Fatal("Error loading .env file")
 	}
 
+	session, err := replay.InstallFromEnv()
+	if err != nil {
+		log.Fatalf("replay: %v", err)
+	}
+	if session != nil {
+		defer session.Close()
+	}
+
 	alpacaKey := os.Getenv("ALPACA_API_KEY")
 	alpacaSecret := os.Getenv("ALPACA_SECRET_KEY")
 	finnhubKey := os.Getenv("FINNHUB_KEY")
 
+	// Filter thresholds: -filters file (or EP_FILTERS / ep_filters.yaml),
+	// then any threshold flags on top.
+	resolveFilters := ep.FilterFlags(flag.CommandLine)
+	flag.Parse()
+	filters, err := resolveFilters()
+	if err != nil {
+		log.Fatalf("Error loading filter params: %v", err)
+	}
+
 	// Run the real-time scanner
 	config := ep.AlpacaConfig{
 		APIKey:    alpacaKey,
@@ -54,6 +64,7 @@ func main() {
 		DataURL:   "https://data.alpaca.markets",
 		IsPaper:   true,
 		FinnhubKey: finnhubKey,
+		Filters:   filters,
 	}
 
 
@@ -2,6 +2,7 @@ package main
 
 import (
 	"avantai/pkg/ep"
+	"avantai/pkg/replay"
 	"avantai/pkg/sapien"
 	"encoding/json"
 	"io"
@@ -11,20 +12,11 @@ import (
 
 // RealtimeScanResponse represents the complete JSON output from the real-time scanner
 type RealtimeScanResponse struct {
-	ScanTime         string                `json:"scan_time"`
-	MarketStatus     string                `json:"market_status"`
-	FilterCriteria   FilterCriteriaDetails `json:"filter_criteria"`
-	QualifyingStocks []ep.RealtimeResult   `json:"qualifying_stocks"`
-	Summary          ScanSummary           `json:"summary"`
-}
-
-// FilterCriteriaDetails contains all the filter thresholds used
-type FilterCriteriaDetails struct {
-	MinGapUpPercent      float64 `json:"min_gap_up_percent"`
-	MinDollarVolume      float64 `json:"min_dollar_volume"`
-	MinMarketCap         float64 `json:"min_market_cap"`
-	MinPremarketVolRatio float64 `json:"min_premarket_volume_ratio"`
-	MaxExtensionADR      float64 `json:"max_extension_adr"`
+	ScanTime         string              `json:"scan_time"`
+	MarketStatus     string              `json:"market_status"`
+	FilterCriteria   ep.FilterParams     `json:"filter_criteria"`
+	QualifyingStocks []ep.RealtimeResult `json:"qualifying_stocks"`
+	Summary          ScanSummary         `json:"summary"`
 }
 
 // ScanSummary contains aggregate statistics from the scan
@@ -34,6 +26,13 @@ type ScanSummary struct {
 }
 
 func main() {
+	session, err := replay.InstallFromEnv()
+	if err != nil {
+		log.Fatalf("replay: %v", err)
+	}
+	if session != nil {
+		defer session.Close()
+	}
 
 	// Navigate to the directory and open the file
 	filePath := "data/stockdata/filtered_stocks_latest.json"
@@ -6,7 +6,7 @@ package main
 // This program runs throughout the trading day. It:
 //   1. Loads the watchlist produced by htf_scanner (htf_YYYYMMDD_results.json).
 //   2. Spawns one goroutine per candidate stock.
-//   3. Fetches 1-minute intraday bars from Alpaca for the session date.
+//   3. Fetches 1-minute intraday bars from the market-data provider for the session date.
 //   4. Replays bars minute-by-minute, calling the pattern recognition engine.
 //   5. When a breakout signal is detected, logs it and appends to htf_watchlist.csv.
 //
@@ -18,14 +18,15 @@ package main
 // of stopping after a Buy recommendation.
 
 import (
+	"avantai/pkg/ep"
 	"avantai/pkg/htf"
+	"avantai/pkg/marketdata"
+	riskCalculator "avantai/pkg/riskmanagement"
 	"encoding/csv"
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -38,7 +39,7 @@ import (
 
 // ===== Intraday bar types =====
 
-// MinuteBar is a single 1-minute OHLCV bar from the Alpaca API.
+// MinuteBar is a single 1-minute OHLCV bar from the market-data provider.
 type MinuteBar struct {
 	T time.Time
 	O float64
@@ -48,83 +49,35 @@ type MinuteBar struct {
 	V float64
 }
 
-// alpacaBar matches the Alpaca API bar JSON object.
-type alpacaBar struct {
-	T  string  `json:"t"`
-	O  float64 `json:"o"`
-	H  float64 `json:"h"`
-	L  float64 `json:"l"`
-	C  float64 `json:"c"`
-	V  float64 `json:"v"`
-	N  int     `json:"n"`
-	VW float64 `json:"vw"`
-}
-
-type alpacaBarsResponse struct {
-	Bars          []alpacaBar `json:"bars"`
-	Symbol        string      `json:"symbol"`
-	NextPageToken *string     `json:"next_page_token"`
-}
-
-// ===== Alpaca intraday fetcher =====
+// ===== Intraday fetcher =====
 
 var (
 	locNY, _ = time.LoadLocation("America/New_York")
 )
 
-// fetchAlpacaIntraday retrieves 1-minute bars for `symbol` on `dateStr`
-// (YYYY-MM-DD) from regular market open to close via the Alpaca API.
-// Matches the pattern in ep_main_alpaca_backtest.go.
-func fetchAlpacaIntraday(apiKey, apiSecret, symbol, dateStr string) ([]MinuteBar, error) {
-	startTime := fmt.Sprintf("%sT09:30:00-05:00", dateStr)
-	endTime := fmt.Sprintf("%sT16:00:00-05:00", dateStr)
-
-	url := fmt.Sprintf(
-		"https://data.alpaca.markets/v2/stocks/%s/bars?timeframe=1Min&start=%s&end=%s&limit=10000&adjustment=all&feed=sip",
-		symbol, startTime, endTime,
-	)
-
-	req, err := http.NewRequest("GET", url, nil)
+// fetchIntraday retrieves 1-minute bars for `symbol` on `dateStr`
+// (YYYY-MM-DD) from regular market open to close via the configured
+// market-data provider.
+func fetchIntraday(provider marketdata.Provider, symbol, dateStr string) ([]MinuteBar, error) {
+	openNY, closeNY, err := sessionWindow(dateStr)
 	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
+		return nil, fmt.Errorf("invalid date %q: %w", dateStr, err)
 	}
-	req.Header.Set("APCA-API-KEY-ID", apiKey)
-	req.Header.Set("APCA-API-SECRET-KEY", apiSecret)
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	raw, err := provider.MinuteBars(symbol, openNY, closeNY, marketdata.AdjustmentAll)
 	if err != nil {
-		return nil, fmt.Errorf("http request: %w", err)
+		return nil, err
 	}
 
-	body, err := io.ReadAll(resp.Body)
-	resp.Body.Close()
-	if err != nil {
-		return nil, fmt.Errorf("read body: %w", err)
-	}
-
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("Alpaca API error %d: %s", resp.StatusCode, string(body))
-	}
-
-	var alpacaResp alpacaBarsResponse
-	if err := json.Unmarshal(body, &alpacaResp); err != nil {
-		return nil, fmt.Errorf("unmarshal: %w", err)
-	}
-
-	var bars []MinuteBar
-	for _, bar := range alpacaResp.Bars {
-		t, err := time.Parse(time.RFC3339, bar.T)
-		if err != nil {
-			continue
-		}
+	bars := make([]MinuteBar, 0, len(raw))
+	for _, bar := range raw {
 		bars = append(bars, MinuteBar{
-			T: t.In(locNY),
-			O: bar.O,
-			H: bar.H,
-			L: bar.L,
-			C: bar.C,
-			V: bar.V,
+			T: bar.Time.In(locNY),
+			O: bar.Open,
+			H: bar.High,
+			L: bar.Low,
+			C: bar.Close,
+			V: bar.Volume,
 		})
 	}
 
@@ -278,7 +231,7 @@ var watchlistManager *WatchlistManager
 // intradayWorker runs the complete intraday monitoring loop for a single
 // HTF candidate. It replays bars minute-by-minute against the pattern
 // recognition engine and stops when triggered or invalidated.
-func intradayWorker(apiKey, apiSecret string, candidate htf.HTFCandidate, date string, goroutineID int) {
+func intradayWorker(provider marketdata.Provider, candidate htf.HTFCandidate, date string, goroutineID int) {
 	symbol := candidate.Symbol
 
 	fmt.Printf("\n[#%d:%s] ========================================\n", goroutineID, symbol)
@@ -295,8 +248,8 @@ func intradayWorker(apiKey, apiSecret string, candidate htf.HTFCandidate, date s
 		return
 	}
 
-	// Fetch intraday bars from Alpaca
-	allBars, err := fetchAlpacaIntraday(apiKey, apiSecret, symbol, date)
+	// Fetch intraday bars from the market-data provider
+	allBars, err := fetchIntraday(provider, symbol, date)
 	if err != nil {
 		log.Printf("[#%d:%s] Failed to fetch intraday data: %v", goroutineID, symbol, err)
 		return
@@ -316,7 +269,7 @@ func intradayWorker(apiKey, apiSecret string, candidate htf.HTFCandidate, date s
 		return
 	}
 
-	fmt.Printf("[#%d:%s] Got %d session bars from Alpaca\n", goroutineID, symbol, len(bars))
+	fmt.Printf("[#%d:%s] Got %d session bars from %s\n", goroutineID, symbol, len(bars), provider.Name())
 
 	// Initialise pattern recognition state
 	state := htf.NewIntradayState(candidate)
@@ -365,6 +318,10 @@ func handleBreakoutSignal(signal *htf.BreakoutSignal, date string, goroutineID i
 	fmt.Printf("[#%d:%s]   Flag Range      : %.1f%% | Pullback from Peak: %.1f%%\n",
 		goroutineID, signal.Symbol, signal.Flag.RangePct, signal.Flag.PullbackFromPeakPct)
 
+	if !passesRiskCheck(signal, goroutineID) {
+		return
+	}
+
 	entry := htf.HTFWatchlistEntry{
 		Symbol:          signal.Symbol,
 		BreakoutTime:    signal.BreakoutTime.Format("15:04"),
@@ -388,6 +345,35 @@ func handleBreakoutSignal(signal *htf.BreakoutSignal, date string, goroutineID i
 	fmt.Printf("[#%d:%s] Signal written to %s\n", goroutineID, signal.Symbol, htf.WatchlistCSVFilename)
 }
 
+// passesRiskCheck sizes the breakout like EP (ep.SizeEntry, stop at the
+// flag low) and runs it through the portfolio risk engine.  No orders are
+// placed here, so a signal is still emitted when the engine cannot be
+// reached.
+func passesRiskCheck(signal *htf.BreakoutSignal, goroutineID int) bool {
+	entry, stop := signal.BreakoutPrice, signal.Flag.FlagLow
+	sizing, err := ep.SizeEntry(signal.Symbol, entry, stop, ep.StockStats{})
+	if err != nil {
+		fmt.Printf("[#%d:%s] Risk check skipped: cannot size: %v\n", goroutineID, signal.Symbol, err)
+		return true
+	}
+	if sizing.Shares <= 0 {
+		fmt.Printf("[#%d:%s] Risk check skipped: %s\n", goroutineID, signal.Symbol, sizing)
+		return true
+	}
+	qty := sizing.Shares
+
+	decision, err := ep.CheckEntryRisk(riskCalculator.Proposal{Symbol: signal.Symbol, Qty: qty, Entry: entry, Stop: stop})
+	if err != nil {
+		fmt.Printf("[#%d:%s] Risk check unavailable: %v\n", goroutineID, signal.Symbol, err)
+		return true
+	}
+	if !decision.Allowed {
+		fmt.Printf("[#%d:%s] Signal dropped by risk engine (%.0f shares): %s\n", goroutineID, signal.Symbol, qty, decision)
+		return false
+	}
+	return true
+}
+
 // loadEnv walks up the directory tree from the current working directory until
 // it finds a .env file, loads it, and changes the working directory to that
 // root. This ensures all relative paths (CSV, output dirs, etc.) resolve
@@ -435,10 +421,9 @@ func main() {
 
 	loadEnv()
 
-	alpacaKey := os.Getenv("ALPACA_API_KEY")
-	alpacaSecret := os.Getenv("ALPACA_SECRET_KEY")
-	if alpacaKey == "" || alpacaSecret == "" {
-		log.Fatal("ALPACA_API_KEY or ALPACA_SECRET_KEY not set in environment")
+	provider, err := marketdata.NewProviderFromEnv()
+	if err != nil {
+		log.Fatalf("Market data provider: %v", err)
 	}
 
 	// Load the morning scan results (produced by htf_scanner)
@@ -480,7 +465,7 @@ func main() {
 		wg.Add(1)
 		go func(idx int, c htf.HTFCandidate) {
 			defer wg.Done()
-			intradayWorker(alpacaKey, alpacaSecret, c, tradingDate, idx+1)
+			intradayWorker(provider, c, tradingDate, idx+1)
 		}(i, candidate)
 	}
 
@@ -14,14 +14,15 @@ package main
 //   go run cmd/avantai/htf/htf_watchlist/htf_watchlist.go
 
 import (
+	"avantai/pkg/ep"
 	"avantai/pkg/htf"
+	"avantai/pkg/marketdata"
+	riskCalculator "avantai/pkg/riskmanagement"
 	"encoding/csv"
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
@@ -69,93 +70,36 @@ func loadEnv() {
 	}
 }
 
-// ===== Daily bar types (scanner) =====
+// ===== Daily bars (scanner) =====
 
-type alpacaDailyBar struct {
-	T string  `json:"t"`
-	O float64 `json:"o"`
-	H float64 `json:"h"`
-	L float64 `json:"l"`
-	C float64 `json:"c"`
-	V float64 `json:"v"`
-}
-
-type alpacaDailyBarsResponse struct {
-	Bars          []alpacaDailyBar `json:"bars"`
-	Symbol        string           `json:"symbol"`
-	NextPageToken *string          `json:"next_page_token"`
-}
-
-// fetchDailyBars retrieves historical 1-Day bars from Alpaca for a single symbol.
-// Bars are returned sorted oldest-to-newest.
-func fetchDailyBars(apiKey, apiSecret, symbol, startDate, endDate string) ([]htf.DailyBar, error) {
-	const baseURL = "https://data.alpaca.markets/v2"
-
-	var allBars []htf.DailyBar
-	var pageToken *string
-
-	for {
-		url := fmt.Sprintf(
-			"%s/stocks/%s/bars?timeframe=1Day&start=%s&end=%s&limit=1000&adjustment=all&feed=sip",
-			baseURL, symbol, startDate, endDate,
-		)
-		if pageToken != nil {
-			url = fmt.Sprintf("%s&page_token=%s", url, *pageToken)
-		}
-
-		req, err := http.NewRequest("GET", url, nil)
-		if err != nil {
-			return nil, fmt.Errorf("create request: %w", err)
-		}
-		req.Header.Set("APCA-API-KEY-ID", apiKey)
-		req.Header.Set("APCA-API-SECRET-KEY", apiSecret)
-
-		client := &http.Client{Timeout: 30 * time.Second}
-		resp, err := client.Do(req)
-		if err != nil {
-			return nil, fmt.Errorf("http request: %w", err)
-		}
-
-		body, err := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		if err != nil {
-			return nil, fmt.Errorf("read body: %w", err)
-		}
-
-		if resp.StatusCode != 200 {
-			return nil, fmt.Errorf("Alpaca API error %d for %s: %s", resp.StatusCode, symbol, string(body))
-		}
-
-		var alpacaResp alpacaDailyBarsResponse
-		if err := json.Unmarshal(body, &alpacaResp); err != nil {
-			return nil, fmt.Errorf("unmarshal response for %s: %w", symbol, err)
-		}
-
-		for _, bar := range alpacaResp.Bars {
-			t, err := time.Parse(time.RFC3339, bar.T)
-			if err != nil {
-				continue
-			}
-			allBars = append(allBars, htf.DailyBar{
-				Date:   t,
-				Open:   bar.O,
-				High:   bar.H,
-				Low:    bar.L,
-				Close:  bar.C,
-				Volume: bar.V,
-			})
-		}
-
-		if alpacaResp.NextPageToken == nil {
-			break
-		}
-		pageToken = alpacaResp.NextPageToken
+// fetchDailyBars retrieves historical 1-Day bars for a single symbol from the
+// configured market-data provider. Bars are returned sorted oldest-to-newest.
+func fetchDailyBars(provider marketdata.Provider, symbol, startDate, endDate string) ([]htf.DailyBar, error) {
+	start, err := time.Parse("2006-01-02", startDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start date %q: %w", startDate, err)
+	}
+	end, err := time.Parse("2006-01-02", endDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid end date %q: %w", endDate, err)
 	}
 
-	sort.Slice(allBars, func(i, j int) bool {
-		return allBars[i].Date.Before(allBars[j].Date)
-	})
-
+	bars, err := provider.DailyBars(symbol, start, end, marketdata.AdjustmentAll)
+	if err != nil {
+		return nil, err
+	}
+
+	allBars := make([]htf.DailyBar, 0, len(bars))
+	for _, bar := range bars {
+		allBars = append(allBars, htf.DailyBar{
+			Date:   bar.Time,
+			Open:   bar.Open,
+			High:   bar.High,
+			Low:    bar.Low,
+			Close:  bar.Close,
+			Volume: bar.Volume,
+		})
+	}
 	return allBars, nil
 }
 
@@ -201,7 +145,7 @@ type scanResult struct {
 
 // runScanner runs the morning pre-market scan and saves results to JSON.
 // Returns the qualifying candidates for the intraday monitor.
-func runScanner(apiKey, apiSecret, scanDate string) ([]htf.HTFCandidate, error) {
+func runScanner(provider marketdata.Provider, scanDate string) ([]htf.HTFCandidate, error) {
 	fmt.Printf("\n=== HTF Morning Scanner — %s ===\n\n", scanDate)
 
 	symbols, err := loadSymbolsFromCSV(htf.StockUniverseCSVPath)
@@ -236,7 +180,7 @@ func runScanner(apiKey, apiSecret, scanDate string) ([]htf.HTFCandidate, error)
 			semaphore <- struct{}{}
 			defer func() { <-semaphore }()
 
-			bars, err := fetchDailyBars(apiKey, apiSecret, symbol, startDate, endDate)
+			bars, err := fetchDailyBars(provider, symbol, startDate, endDate)
 			if err != nil {
 				resultsCh <- scanResult{symbol: symbol, err: err}
 				return
@@ -345,77 +289,25 @@ type MinuteBar struct {
 	V float64
 }
 
-type alpacaMinuteBar struct {
-	T  string  `json:"t"`
-	O  float64 `json:"o"`
-	H  float64 `json:"h"`
-	L  float64 `json:"l"`
-	C  float64 `json:"c"`
-	V  float64 `json:"v"`
-	N  int     `json:"n"`
-	VW float64 `json:"vw"`
-}
-
-type alpacaMinuteBarsResponse struct {
-	Bars          []alpacaMinuteBar `json:"bars"`
-	Symbol        string            `json:"symbol"`
-	NextPageToken *string           `json:"next_page_token"`
-}
-
-// fetchIntraday retrieves 1-minute bars for a symbol on a given date.
-func fetchIntraday(apiKey, apiSecret, symbol, dateStr string) ([]MinuteBar, error) {
-	startTime := fmt.Sprintf("%sT09:30:00-05:00", dateStr)
-	endTime := fmt.Sprintf("%sT16:00:00-05:00", dateStr)
-
-	url := fmt.Sprintf(
-		"https://data.alpaca.markets/v2/stocks/%s/bars?timeframe=1Min&start=%s&end=%s&limit=10000&adjustment=all&feed=sip",
-		symbol, startTime, endTime,
-	)
-
-	req, err := http.NewRequest("GET", url, nil)
+// fetchIntraday retrieves regular-session 1-minute bars for a symbol on a given date.
+func fetchIntraday(provider marketdata.Provider, symbol, dateStr string) ([]MinuteBar, error) {
+	openNY, closeNY, err := sessionWindow(dateStr)
 	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
+		return nil, fmt.Errorf("invalid date %q: %w", dateStr, err)
 	}
-	req.Header.Set("APCA-API-KEY-ID", apiKey)
-	req.Header.Set("APCA-API-SECRET-KEY", apiSecret)
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	raw, err := provider.MinuteBars(symbol, openNY, closeNY, marketdata.AdjustmentAll)
 	if err != nil {
-		return nil, fmt.Errorf("http request: %w", err)
+		return nil, err
 	}
 
-	body, err := io.ReadAll(resp.Body)
-	resp.Body.Close()
-	if err != nil {
-		return nil, fmt.Errorf("read body: %w", err)
-	}
-
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("Alpaca API error %d: %s", resp.StatusCode, string(body))
-	}
-
-	var alpacaResp alpacaMinuteBarsResponse
-	if err := json.Unmarshal(body, &alpacaResp); err != nil {
-		return nil, fmt.Errorf("unmarshal: %w", err)
-	}
-
-	var bars []MinuteBar
-	for _, bar := range alpacaResp.Bars {
-		t, err := time.Parse(time.RFC3339, bar.T)
-		if err != nil {
-			continue
-		}
+	bars := make([]MinuteBar, 0, len(raw))
+	for _, bar := range raw {
 		bars = append(bars, MinuteBar{
-			T: t.In(locNY),
-			O: bar.O, H: bar.H, L: bar.L, C: bar.C, V: bar.V,
+			T: bar.Time.In(locNY),
+			O: bar.Open, H: bar.High, L: bar.Low, C: bar.Close, V: bar.Volume,
 		})
 	}
-
-	sort.Slice(bars, func(i, j int) bool {
-		return bars[i].T.Before(bars[j].T)
-	})
-
 	return bars, nil
 }
 
@@ -556,6 +448,10 @@ func handleBreakoutSignal(signal *htf.BreakoutSignal, date string, goroutineID i
 	fmt.Printf("[#%d:%s]   Flag Range      : %.1f%% | Pullback from Peak: %.1f%%\n",
 		goroutineID, signal.Symbol, signal.Flag.RangePct, signal.Flag.PullbackFromPeakPct)
 
+	if !passesRiskCheck(signal, goroutineID) {
+		return
+	}
+
 	entry := htf.HTFWatchlistEntry{
 		Symbol:          signal.Symbol,
 		BreakoutTime:    signal.BreakoutTime.Format("15:04"),
@@ -579,7 +475,36 @@ func handleBreakoutSignal(signal *htf.BreakoutSignal, date string, goroutineID i
 	fmt.Printf("[#%d:%s] Signal written to %s\n", goroutineID, signal.Symbol, htf.WatchlistCSVFilename)
 }
 
-func intradayWorker(apiKey, apiSecret string, candidate htf.HTFCandidate, date string, goroutineID int) {
+// passesRiskCheck sizes the breakout like EP (ep.SizeEntry, stop at the
+// flag low) and runs it through the portfolio risk engine.  No orders are
+// placed here, so a signal is still emitted when the engine cannot be
+// reached.
+func passesRiskCheck(signal *htf.BreakoutSignal, goroutineID int) bool {
+	entry, stop := signal.BreakoutPrice, signal.Flag.FlagLow
+	sizing, err := ep.SizeEntry(signal.Symbol, entry, stop, ep.StockStats{})
+	if err != nil {
+		fmt.Printf("[#%d:%s] Risk check skipped: cannot size: %v\n", goroutineID, signal.Symbol, err)
+		return true
+	}
+	if sizing.Shares <= 0 {
+		fmt.Printf("[#%d:%s] Risk check skipped: %s\n", goroutineID, signal.Symbol, sizing)
+		return true
+	}
+	qty := sizing.Shares
+
+	decision, err := ep.CheckEntryRisk(riskCalculator.Proposal{Symbol: signal.Symbol, Qty: qty, Entry: entry, Stop: stop})
+	if err != nil {
+		fmt.Printf("[#%d:%s] Risk check unavailable: %v\n", goroutineID, signal.Symbol, err)
+		return true
+	}
+	if !decision.Allowed {
+		fmt.Printf("[#%d:%s] Signal dropped by risk engine (%.0f shares): %s\n", goroutineID, signal.Symbol, qty, decision)
+		return false
+	}
+	return true
+}
+
+func intradayWorker(provider marketdata.Provider, candidate htf.HTFCandidate, date string, goroutineID int) {
 	symbol := candidate.Symbol
 
 	fmt.Printf("\n[#%d:%s] ========================================\n", goroutineID, symbol)
@@ -596,7 +521,7 @@ func intradayWorker(apiKey, apiSecret string, candidate htf.HTFCandidate, date s
 		return
 	}
 
-	allBars, err := fetchIntraday(apiKey, apiSecret, symbol, date)
+	allBars, err := fetchIntraday(provider, symbol, date)
 	if err != nil {
 		log.Printf("[#%d:%s] Failed to fetch intraday data: %v", goroutineID, symbol, err)
 		return
@@ -615,7 +540,7 @@ func intradayWorker(apiKey, apiSecret string, candidate htf.HTFCandidate, date s
 		return
 	}
 
-	fmt.Printf("[#%d:%s] Got %d session bars from Alpaca\n", goroutineID, symbol, len(bars))
+	fmt.Printf("[#%d:%s] Got %d session bars from %s\n", goroutineID, symbol, len(bars), provider.Name())
 
 	state := htf.NewIntradayState(candidate)
 
@@ -647,7 +572,7 @@ func intradayWorker(apiKey, apiSecret string, candidate htf.HTFCandidate, date s
 }
 
 // runMonitor runs the intraday monitor for all qualifying candidates.
-func runMonitor(apiKey, apiSecret string, candidates []htf.HTFCandidate, date string) {
+func runMonitor(provider marketdata.Provider, candidates []htf.HTFCandidate, date string) {
 	fmt.Printf("\n=== HTF Intraday Monitor — %s ===\n", date)
 	fmt.Printf("=== Confirmation bars: %d | First half only: %v ===\n\n",
 		htf.BreakoutConfirmationBars, htf.BreakoutFirstHalfOnly)
@@ -667,7 +592,7 @@ func runMonitor(apiKey, apiSecret string, candidates []htf.HTFCandidate, date st
 		wg.Add(1)
 		go func(idx int, c htf.HTFCandidate) {
 			defer wg.Done()
-			intradayWorker(apiKey, apiSecret, c, date, idx+1)
+			intradayWorker(provider, c, date, idx+1)
 		}(i, candidate)
 	}
 
@@ -686,14 +611,16 @@ func main() {
 
 	loadEnv()
 
-	apiKey := os.Getenv("ALPACA_API_KEY")
-	apiSecret := os.Getenv("ALPACA_SECRET_KEY")
-	if apiKey == "" || apiSecret == "" {
-		log.Fatal("ALPACA_API_KEY or ALPACA_SECRET_KEY not set in environment")
+	provider, err := marketdata.NewProviderFromEnv()
+	if err != nil {
+		log.Fatalf("Market data provider: %v", err)
 	}
+	// Daily history is served from the on-disk bar cache; only dates not
+	// fetched on a previous run hit the API.
+	provider = marketdata.NewCachedProvider(provider, marketdata.CacheDirFromEnv())
 
 	// Step 1: Morning scan
-	candidates, err := runScanner(apiKey, apiSecret, date)
+	candidates, err := runScanner(provider, date)
 	if err != nil {
 		log.Fatalf("Scanner failed: %v", err)
 	}
@@ -704,5 +631,5 @@ func main() {
 	}
 
 	// Step 2: Intraday monitor
-	runMonitor(apiKey, apiSecret, candidates, date)
+	runMonitor(provider, candidates, date)
 }
@@ -5,7 +5,7 @@ package main
 // This program runs once at the start of each trading day (or pre-market) to
 // build the HTF watchlist. It:
 //   1. Loads the stock universe from the shared config CSV.
-//   2. Fetches historical daily bars from Alpaca for each ticker.
+//   2. Fetches historical daily bars from the market-data provider for each ticker.
 //   3. Applies all HTF filter criteria (flagpole, flag, volume, MAs).
 //   4. Saves qualifying candidates to data/htf/htf_YYYYMMDD_results.json.
 //
@@ -16,13 +16,12 @@ package main
 
 import (
 	"avantai/pkg/htf"
+	"avantai/pkg/marketdata"
 	"encoding/csv"
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
@@ -33,7 +32,7 @@ import (
 	"github.com/joho/godotenv"
 )
 
-// maxConcurrent limits simultaneous Alpaca API requests to avoid rate-limiting.
+// maxConcurrent limits simultaneous market-data API requests to avoid rate-limiting.
 const maxConcurrent = 5
 
 // loadEnv walks up the directory tree from the current working directory until
@@ -66,97 +65,37 @@ func loadEnv() {
 	}
 }
 
-// ===== Alpaca API client (daily bars) =====
+// ===== Daily bars =====
 
-// alpacaDailyBar matches the Alpaca API bar object for any timeframe.
-type alpacaDailyBar struct {
-	T string  `json:"t"` // RFC3339 timestamp
-	O float64 `json:"o"` // Open
-	H float64 `json:"h"` // High
-	L float64 `json:"l"` // Low
-	C float64 `json:"c"` // Close
-	V float64 `json:"v"` // Volume
-}
-
-type alpacaBarsResponse struct {
-	Bars          []alpacaDailyBar `json:"bars"`
-	Symbol        string           `json:"symbol"`
-	NextPageToken *string          `json:"next_page_token"`
-}
-
-// fetchAlpacaDailyBars retrieves historical 1-Day bars from Alpaca for a
-// single symbol between startDate and endDate (inclusive, YYYY-MM-DD format).
-// It follows pagination to return all available bars in the window.
-// Bars are returned sorted oldest-to-newest.
-func fetchAlpacaDailyBars(apiKey, apiSecret, symbol, startDate, endDate string) ([]htf.DailyBar, error) {
-	const baseURL = "https://data.alpaca.markets/v2"
-
-	var allBars []htf.DailyBar
-	var pageToken *string
-
-	for {
-		url := fmt.Sprintf(
-			"%s/stocks/%s/bars?timeframe=1Day&start=%s&end=%s&limit=1000&adjustment=all&feed=sip",
-			baseURL, symbol, startDate, endDate,
-		)
-		if pageToken != nil {
-			url = fmt.Sprintf("%s&page_token=%s", url, *pageToken)
-		}
-
-		req, err := http.NewRequest("GET", url, nil)
-		if err != nil {
-			return nil, fmt.Errorf("create request: %w", err)
-		}
-		req.Header.Set("APCA-API-KEY-ID", apiKey)
-		req.Header.Set("APCA-API-SECRET-KEY", apiSecret)
-
-		client := &http.Client{Timeout: 30 * time.Second}
-		resp, err := client.Do(req)
-		if err != nil {
-			return nil, fmt.Errorf("http request: %w", err)
-		}
-
-		body, err := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		if err != nil {
-			return nil, fmt.Errorf("read body: %w", err)
-		}
-
-		if resp.StatusCode != 200 {
-			return nil, fmt.Errorf("Alpaca API error %d for %s: %s", resp.StatusCode, symbol, string(body))
-		}
-
-		var alpacaResp alpacaBarsResponse
-		if err := json.Unmarshal(body, &alpacaResp); err != nil {
-			return nil, fmt.Errorf("unmarshal response for %s: %w", symbol, err)
-		}
-
-		for _, bar := range alpacaResp.Bars {
-			t, err := time.Parse(time.RFC3339, bar.T)
-			if err != nil {
-				continue
-			}
-			allBars = append(allBars, htf.DailyBar{
-				Date:   t,
-				Open:   bar.O,
-				High:   bar.H,
-				Low:    bar.L,
-				Close:  bar.C,
-				Volume: bar.V,
-			})
-		}
-
-		if alpacaResp.NextPageToken == nil {
-			break
-		}
-		pageToken = alpacaResp.NextPageToken
+// fetchDailyBars retrieves historical 1-Day bars for a single symbol between
+// startDate and endDate (inclusive, YYYY-MM-DD format) from the configured
+// market-data provider. Bars are returned sorted oldest-to-newest.
+func fetchDailyBars(provider marketdata.Provider, symbol, startDate, endDate string) ([]htf.DailyBar, error) {
+	start, err := time.Parse("2006-01-02", startDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start date %q: %w", startDate, err)
+	}
+	end, err := time.Parse("2006-01-02", endDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid end date %q: %w", endDate, err)
 	}
 
-	// Ensure oldest-first ordering for the filter algorithms.
-	sort.Slice(allBars, func(i, j int) bool {
-		return allBars[i].Date.Before(allBars[j].Date)
-	})
+	bars, err := provider.DailyBars(symbol, start, end, marketdata.AdjustmentAll)
+	if err != nil {
+		return nil, err
+	}
 
+	allBars := make([]htf.DailyBar, 0, len(bars))
+	for _, bar := range bars {
+		allBars = append(allBars, htf.DailyBar{
+			Date:   bar.Time,
+			Open:   bar.Open,
+			High:   bar.High,
+			Low:    bar.Low,
+			Close:  bar.Close,
+			Volume: bar.Volume,
+		})
+	}
 	return allBars, nil
 }
 
@@ -207,11 +146,13 @@ func main() {
 
 	loadEnv()
 
-	alpacaKey := os.Getenv("ALPACA_API_KEY")
-	alpacaSecret := os.Getenv("ALPACA_SECRET_KEY")
-	if alpacaKey == "" || alpacaSecret == "" {
-		log.Fatal("ALPACA_API_KEY or ALPACA_SECRET_KEY not set in environment")
+	provider, err := marketdata.NewProviderFromEnv()
+	if err != nil {
+		log.Fatalf("Market data provider: %v", err)
 	}
+	// Daily history is served from the on-disk bar cache; only dates not
+	// fetched on a previous run hit the API.
+	provider = marketdata.NewCachedProvider(provider, marketdata.CacheDirFromEnv())
 
 	// Load stock universe
 	symbols, err := loadSymbolsFromCSV(htf.StockUniverseCSVPath)
@@ -252,7 +193,7 @@ func main() {
 			semaphore <- struct{}{}
 			defer func() { <-semaphore }()
 
-			bars, err := fetchAlpacaDailyBars(alpacaKey, alpacaSecret, symbol, startDate, endDate)
+			bars, err := fetchDailyBars(provider, symbol, startDate, endDate)
 			if err != nil {
 				resultsCh <- scanResult{symbol: symbol, err: err}
 				return
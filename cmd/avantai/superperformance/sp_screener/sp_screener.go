@@ -11,6 +11,7 @@ import (
 
 	"github.com/joho/godotenv"
 
+	"avantai/pkg/marketdata"
 	"avantai/pkg/superperformance"
 )
 
@@ -42,6 +43,16 @@ func main() {
 		RateLimit:  make(chan struct{}, 3), // Conservative rate limiting
 	}
 
+	// Marketstack is the default; MARKET_DATA_PROVIDER switches vendors.
+	if name := os.Getenv("MARKET_DATA_PROVIDER"); name != "" {
+		provider, err := marketdata.NewProvider(name)
+		if err != nil {
+			fmt.Printf("❌ ERROR: %v\n", err)
+			os.Exit(1)
+		}
+		client.Provider = provider
+	}
+
 	// Initialize rate limiter
 	for i := 0; i < 3; i++ {
 		client.RateLimit <- struct{}{}
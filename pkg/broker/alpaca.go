@@ -0,0 +1,251 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
+	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
+	"github.com/shopspring/decimal"
+)
+
+// AlpacaBroker trades through the Alpaca trading API.
+type AlpacaBroker struct {
+	client *alpaca.Client
+	data   *marketdata.Client
+}
+
+// NewAlpacaBroker builds an AlpacaBroker.  An empty baseURL uses the SDK
+// default (live, or APCA_API_BASE_URL).
+func NewAlpacaBroker(key, secret, baseURL string) *AlpacaBroker {
+	return &AlpacaBroker{
+		client: alpaca.NewClient(alpaca.ClientOpts{APIKey: key, APISecret: secret, BaseURL: baseURL}),
+		data:   marketdata.NewClient(marketdata.ClientOpts{APIKey: key, APISecret: secret}),
+	}
+}
+
+func (a *AlpacaBroker) Name() string { return BrokerAlpaca }
+
+func (a *AlpacaBroker) Account() (*Account, error) {
+	acct, err := a.client.GetAccount()
+	if err != nil {
+		return nil, err
+	}
+	return &Account{
+		Status:         acct.Status,
+		Cash:           acct.Cash.InexactFloat64(),
+		BuyingPower:    acct.BuyingPower.InexactFloat64(),
+		PortfolioValue: acct.PortfolioValue.InexactFloat64(),
+		LastEquity:     acct.LastEquity.InexactFloat64(),
+	}, nil
+}
+
+func (a *AlpacaBroker) Asset(symbol string) (*Asset, error) {
+	asset, err := a.client.GetAsset(symbol)
+	if err != nil {
+		return nil, err
+	}
+	return &Asset{Symbol: asset.Symbol, Tradable: asset.Tradable}, nil
+}
+
+func (a *AlpacaBroker) LatestPrice(symbol string) (float64, error) {
+	trade, err := a.data.GetLatestTrade(symbol, marketdata.GetLatestTradeRequest{})
+	if err != nil {
+		return 0, err
+	}
+	return trade.Price, nil
+}
+
+func (a *AlpacaBroker) PlaceOrder(req OrderRequest) (*Order, error) {
+	qty := decimal.NewFromFloat(req.Qty)
+	r := alpaca.PlaceOrderRequest{
+		Symbol:        req.Symbol,
+		Qty:           &qty,
+		Side:          alpaca.Side(req.Side),
+		Type:          alpaca.OrderType(req.Type),
+		TimeInForce:   alpaca.TimeInForce(req.TimeInForce),
+		LimitPrice:    decimalOrNil(req.LimitPrice),
+		StopPrice:     decimalOrNil(req.StopPrice),
+		ExtendedHours: req.ExtendedHours,
+		ClientOrderID: req.ClientOrderID,
+	}
+	switch req.Class {
+	case Bracket, OTO, OCO:
+		r.OrderClass = alpaca.OrderClass(req.Class)
+		if req.TakeProfit != 0 {
+			r.TakeProfit = &alpaca.TakeProfit{LimitPrice: decimalOrNil(req.TakeProfit)}
+		}
+		if req.StopLoss != 0 {
+			r.StopLoss = &alpaca.StopLoss{StopPrice: decimalOrNil(req.StopLoss)}
+		}
+	}
+
+	order, err := a.client.PlaceOrder(r)
+	if err != nil {
+		return nil, err
+	}
+	return fromAlpacaOrder(*order), nil
+}
+
+func (a *AlpacaBroker) GetOrder(id string) (*Order, error) {
+	order, err := a.client.GetOrder(id)
+	if err != nil {
+		return nil, err
+	}
+	return fromAlpacaOrder(*order), nil
+}
+
+func (a *AlpacaBroker) ListOrders(status string) ([]Order, error) {
+	orders, err := a.client.GetOrders(alpaca.GetOrdersRequest{Status: status, Nested: true, Limit: 500})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Order, 0, len(orders))
+	for _, o := range orders {
+		out = append(out, *fromAlpacaOrder(o))
+	}
+	return out, nil
+}
+
+func (a *AlpacaBroker) ReplaceOrder(id string, req ReplaceRequest) (*Order, error) {
+	order, err := a.client.ReplaceOrder(id, alpaca.ReplaceOrderRequest{
+		Qty:        decimalOrNil(req.Qty),
+		LimitPrice: decimalOrNil(req.LimitPrice),
+		StopPrice:  decimalOrNil(req.StopPrice),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fromAlpacaOrder(*order), nil
+}
+
+func (a *AlpacaBroker) CancelOrder(id string) error {
+	return a.client.CancelOrder(id)
+}
+
+func (a *AlpacaBroker) Positions() ([]Position, error) {
+	positions, err := a.client.GetPositions()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Position, 0, len(positions))
+	for _, p := range positions {
+		out = append(out, fromAlpacaPosition(p))
+	}
+	return out, nil
+}
+
+func (a *AlpacaBroker) Position(symbol string) (*Position, error) {
+	p, err := a.client.GetPosition(symbol)
+	if err != nil {
+		var apiErr *alpaca.APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	pos := fromAlpacaPosition(*p)
+	return &pos, nil
+}
+
+// StreamTradeUpdates follows the account's trade_updates stream, resuming
+// just after the last event received whenever the connection drops.
+func (a *AlpacaBroker) StreamTradeUpdates(ctx context.Context, handler func(TradeUpdate)) error {
+	var last time.Time
+	for {
+		req := alpaca.StreamTradeUpdatesRequest{}
+		if !last.IsZero() {
+			req.Since = last.Add(time.Nanosecond)
+		}
+		err := a.client.StreamTradeUpdates(ctx, func(tu alpaca.TradeUpdate) {
+			last = tu.At
+			handler(fromAlpacaTradeUpdate(tu))
+		}, req)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("⚠️  alpaca trade updates stream: %v — reconnecting", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Conversions
+// ─────────────────────────────────────────────────────────────────────────────
+
+func decimalOrNil(f float64) *decimal.Decimal {
+	if f == 0 {
+		return nil
+	}
+	d := decimal.NewFromFloat(f)
+	return &d
+}
+
+func floatOrZero(d *decimal.Decimal) float64 {
+	if d == nil {
+		return 0
+	}
+	return d.InexactFloat64()
+}
+
+func fromAlpacaOrder(o alpaca.Order) *Order {
+	class := OrderClass(o.OrderClass)
+	if class == "" {
+		class = Simple
+	}
+	out := &Order{
+		ID:             o.ID,
+		ClientOrderID:  o.ClientOrderID,
+		Symbol:         o.Symbol,
+		Side:           Side(o.Side),
+		Type:           OrderType(o.Type),
+		Class:          class,
+		TimeInForce:    TimeInForce(o.TimeInForce),
+		Qty:            floatOrZero(o.Qty),
+		FilledQty:      o.FilledQty.InexactFloat64(),
+		FilledAvgPrice: floatOrZero(o.FilledAvgPrice),
+		LimitPrice:     floatOrZero(o.LimitPrice),
+		StopPrice:      floatOrZero(o.StopPrice),
+		ExtendedHours:  o.ExtendedHours,
+		Status:         o.Status,
+		SubmittedAt:    o.SubmittedAt,
+		FilledAt:       o.FilledAt,
+	}
+	for _, leg := range o.Legs {
+		out.Legs = append(out.Legs, *fromAlpacaOrder(leg))
+	}
+	return out
+}
+
+func fromAlpacaPosition(p alpaca.Position) Position {
+	return Position{
+		Symbol:        p.Symbol,
+		Qty:           p.Qty.InexactFloat64(),
+		AvgEntryPrice: p.AvgEntryPrice.InexactFloat64(),
+		CurrentPrice:  floatOrZero(p.CurrentPrice),
+		MarketValue:   floatOrZero(p.MarketValue),
+		UnrealizedPL:  floatOrZero(p.UnrealizedPL),
+	}
+}
+
+func fromAlpacaTradeUpdate(tu alpaca.TradeUpdate) TradeUpdate {
+	out := TradeUpdate{
+		Event:       tu.Event,
+		Time:        tu.At,
+		Order:       *fromAlpacaOrder(tu.Order),
+		Qty:         floatOrZero(tu.Qty),
+		Price:       floatOrZero(tu.Price),
+		PositionQty: floatOrZero(tu.PositionQty),
+	}
+	if tu.Timestamp != nil {
+		out.Time = *tu.Timestamp
+	}
+	return out
+}
@@ -0,0 +1,231 @@
+package broker
+
+// Broker abstraction
+//
+// pkg/ep places entries, exits and cancels through Broker rather than a
+// package-global Alpaca client, so the live strategies can run against
+// Alpaca paper/live accounts or, with no credentials at all, against the
+// in-process SimBroker fed from historical bars.
+//
+// Usage:
+//   b, err := broker.NewFromEnv()                 // BROKER=alpaca|sim
+//   order, err := b.PlaceOrder(broker.OrderRequest{Symbol: "AAPL", Qty: 10,
+//       Side: broker.Buy, Type: broker.Market, TimeInForce: broker.Day})
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Common types
+// ─────────────────────────────────────────────────────────────────────────────
+
+// Side is the order direction.
+type Side string
+
+const (
+	Buy  Side = "buy"
+	Sell Side = "sell"
+)
+
+// OrderType is how an order is priced.
+type OrderType string
+
+const (
+	Market    OrderType = "market"
+	Limit     OrderType = "limit"
+	Stop      OrderType = "stop"
+	StopLimit OrderType = "stop_limit"
+)
+
+// OrderClass groups a parent order with its exit legs.
+type OrderClass string
+
+const (
+	Simple  OrderClass = "simple"
+	Bracket OrderClass = "bracket" // entry + take-profit + stop-loss
+	OTO     OrderClass = "oto"     // entry + one exit leg (stop-loss, else take-profit)
+	OCO     OrderClass = "oco"     // take-profit limit sell + stop-loss; either fill cancels the other
+)
+
+// TimeInForce is how long an unfilled order stays working.
+type TimeInForce string
+
+const (
+	Day TimeInForce = "day"
+	GTC TimeInForce = "gtc"
+)
+
+// Order statuses, spelled as Alpaca reports them.
+const (
+	StatusNew             = "new"
+	StatusPartiallyFilled = "partially_filled"
+	StatusFilled          = "filled"
+	StatusCanceled        = "canceled"
+	StatusExpired         = "expired"
+	StatusRejected        = "rejected"
+	StatusReplaced        = "replaced" // superseded by the order ReplaceOrder returned
+	StatusHeld            = "held"     // bracket leg waiting for its parent to fill
+)
+
+// OrderRequest describes a new order.  Prices of zero are unset.  For a
+// Bracket, TakeProfit and StopLoss are the exit legs; an OTO takes one of
+// them.  An OCO is a Limit sell at TakeProfit with a StopLoss leg.
+// ExtendedHours lets a Day limit order trade pre- and post-market.
+type OrderRequest struct {
+	Symbol        string
+	Qty           float64
+	Side          Side
+	Type          OrderType
+	TimeInForce   TimeInForce
+	LimitPrice    float64
+	StopPrice     float64
+	Class         OrderClass
+	TakeProfit    float64
+	StopLoss      float64
+	ExtendedHours bool
+	ClientOrderID string
+}
+
+// ReplaceRequest amends a working order.  Zero fields keep the order's
+// current value.
+type ReplaceRequest struct {
+	Qty        float64
+	LimitPrice float64
+	StopPrice  float64
+}
+
+// Order is an order as the broker last reported it.
+type Order struct {
+	ID             string      `json:"id"`
+	ClientOrderID  string      `json:"client_order_id"`
+	Symbol         string      `json:"symbol"`
+	Side           Side        `json:"side"`
+	Type           OrderType   `json:"type"`
+	Class          OrderClass  `json:"order_class"`
+	TimeInForce    TimeInForce `json:"time_in_force"`
+	Qty            float64     `json:"qty"`
+	FilledQty      float64     `json:"filled_qty"`
+	FilledAvgPrice float64     `json:"filled_avg_price"`
+	LimitPrice     float64     `json:"limit_price"`
+	StopPrice      float64     `json:"stop_price"`
+	ExtendedHours  bool        `json:"extended_hours,omitempty"`
+	Status         string      `json:"status"`
+	SubmittedAt    time.Time   `json:"submitted_at"`
+	FilledAt       *time.Time  `json:"filled_at,omitempty"`
+	Legs           []Order     `json:"legs,omitempty"`
+}
+
+// IsOpen reports whether the order can still fill.
+func (o *Order) IsOpen() bool {
+	switch o.Status {
+	case StatusFilled, StatusCanceled, StatusExpired, StatusRejected, StatusReplaced:
+		return false
+	}
+	return true
+}
+
+// String formats an order for logs.
+func (o *Order) String() string {
+	return fmt.Sprintf("%s %s %s %.0f %s (ID: %s, status: %s)",
+		o.Symbol, o.Side, o.Type, o.Qty, o.Class, o.ID, o.Status)
+}
+
+// Position is an open position.  Qty is negative for shorts.
+type Position struct {
+	Symbol        string  `json:"symbol"`
+	Qty           float64 `json:"qty"`
+	AvgEntryPrice float64 `json:"avg_entry_price"`
+	CurrentPrice  float64 `json:"current_price"`
+	MarketValue   float64 `json:"market_value"`
+	UnrealizedPL  float64 `json:"unrealized_pl"`
+}
+
+// Account is the account summary.  LastEquity is the portfolio value at the
+// previous session's close, so PortfolioValue - LastEquity is today's P&L.
+type Account struct {
+	Status         string  `json:"status"`
+	Cash           float64 `json:"cash"`
+	BuyingPower    float64 `json:"buying_power"`
+	PortfolioValue float64 `json:"portfolio_value"`
+	LastEquity     float64 `json:"last_equity"`
+}
+
+// Asset is the tradability of one symbol.
+type Asset struct {
+	Symbol   string `json:"symbol"`
+	Tradable bool   `json:"tradable"`
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Broker interface
+// ─────────────────────────────────────────────────────────────────────────────
+
+// Broker is implemented by every execution venue.
+//
+// ListOrders takes "open", "closed" or "all".  ReplaceOrder amends a working
+// order as Alpaca does: the original ends in StatusReplaced and the returned
+// order, under a new ID, takes its place (and its place in a bracket).
+// Position returns (nil, nil) when there is no position in symbol.
+type Broker interface {
+	Name() string
+	Account() (*Account, error)
+	Asset(symbol string) (*Asset, error)
+	LatestPrice(symbol string) (float64, error)
+
+	PlaceOrder(req OrderRequest) (*Order, error)
+	GetOrder(id string) (*Order, error)
+	ListOrders(status string) ([]Order, error)
+	ReplaceOrder(id string, req ReplaceRequest) (*Order, error)
+	CancelOrder(id string) error
+
+	Positions() ([]Position, error)
+	Position(symbol string) (*Position, error)
+}
+
+// Broker names accepted by New.
+const (
+	BrokerAlpaca = "alpaca"
+	BrokerSim    = "sim"
+)
+
+// New builds the named broker using credentials from the environment.  An
+// empty name selects Alpaca.
+//
+//	alpaca: ALPACA_API_KEY, ALPACA_SECRET_KEY, ALPACA_PAPER_URL
+//	sim:    SIM_BROKER_CASH, else ACCOUNT_SIZE, else $100,000
+func New(name string) (Broker, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", BrokerAlpaca:
+		key := os.Getenv("ALPACA_API_KEY")
+		secret := os.Getenv("ALPACA_SECRET_KEY")
+		if key == "" || secret == "" {
+			return nil, fmt.Errorf("ALPACA_API_KEY / ALPACA_SECRET_KEY must be set for the alpaca broker")
+		}
+		return NewAlpacaBroker(key, secret, os.Getenv("ALPACA_PAPER_URL")), nil
+	case BrokerSim:
+		cash := 100000.0
+		for _, env := range []string{"SIM_BROKER_CASH", "ACCOUNT_SIZE"} {
+			if v := os.Getenv(env); v != "" {
+				parsed, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid %s %q: %w", env, v, err)
+				}
+				cash = parsed
+				break
+			}
+		}
+		return NewSimBroker(cash), nil
+	default:
+		return nil, fmt.Errorf("unknown broker %q (want %q or %q)", name, BrokerAlpaca, BrokerSim)
+	}
+}
+
+// NewFromEnv builds the broker named by BROKER.
+func NewFromEnv() (Broker, error) {
+	return New(os.Getenv("BROKER"))
+}
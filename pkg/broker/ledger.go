@@ -0,0 +1,232 @@
+package broker
+
+// Order ledger
+//
+// An append-only JSONL record of every order placed through a Broker: one
+// line when it is placed (parent and each bracket leg), one per observed
+// status / fill change, one per cancel request, and one per replacement
+// order (which names the order it replaced).  Folding the lines gives
+// each order's latest known state and the statuses it passed through, which
+// the reconciliation job compares against the broker.
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Ledger events.
+const (
+	LedgerPlaced          = "placed"
+	LedgerUpdated         = "updated"
+	LedgerCancelRequested = "cancel_requested"
+	LedgerReplaced        = "replaced" // a new order that replaced ReplacesID
+)
+
+// LedgerEntry is one line of the ledger.  ExpectedPrice is the price the
+// caller assumed it would trade at (the entry limit, the exit decision's
+// price), so actual fills can be compared with it.
+type LedgerEntry struct {
+	Time           time.Time   `json:"time"`
+	Event          string      `json:"event"`
+	Broker         string      `json:"broker"`
+	OrderID        string      `json:"order_id"`
+	ParentID       string      `json:"parent_id,omitempty"`
+	ReplacesID     string      `json:"replaces_id,omitempty"`
+	ClientOrderID  string      `json:"client_order_id,omitempty"`
+	Symbol         string      `json:"symbol"`
+	Side           Side        `json:"side"`
+	Type           OrderType   `json:"type"`
+	Class          OrderClass  `json:"order_class"`
+	TimeInForce    TimeInForce `json:"time_in_force"`
+	Qty            float64     `json:"qty"`
+	FilledQty      float64     `json:"filled_qty"`
+	FilledAvgPrice float64     `json:"filled_avg_price"`
+	LimitPrice     float64     `json:"limit_price,omitempty"`
+	StopPrice      float64     `json:"stop_price,omitempty"`
+	Status         string      `json:"status"`
+	ExpectedPrice  float64     `json:"expected_price,omitempty"`
+}
+
+// Ledger appends entries to a JSONL file.  It is safe for concurrent use.
+type Ledger struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+// OpenLedger opens (creating if needed) the ledger at path for appending.
+func OpenLedger(path string) (*Ledger, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create ledger directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ledger %s: %w", path, err)
+	}
+	return &Ledger{path: path, f: f}, nil
+}
+
+// Path returns the ledger file path.
+func (l *Ledger) Path() string { return l.path }
+
+// Close closes the ledger file.
+func (l *Ledger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+// Append writes one entry, stamping Time if unset.
+func (l *Ledger) Append(e LedgerEntry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode ledger entry: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write ledger %s: %w", l.path, err)
+	}
+	return nil
+}
+
+// RecordOrder appends event for o and, nested one level, each of its legs.
+func (l *Ledger) RecordOrder(event, brokerName string, o *Order, expectedPrice float64) error {
+	entry := ledgerEntry(event, brokerName, o)
+	entry.ExpectedPrice = expectedPrice
+	if err := l.Append(entry); err != nil {
+		return err
+	}
+	for i := range o.Legs {
+		leg := ledgerEntry(event, brokerName, &o.Legs[i])
+		leg.ParentID = o.ID
+		if err := l.Append(leg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecordReplacement appends o, the order that replaced replacedID.
+func (l *Ledger) RecordReplacement(brokerName, replacedID string, o *Order) error {
+	entry := ledgerEntry(LedgerReplaced, brokerName, o)
+	entry.ReplacesID = replacedID
+	return l.Append(entry)
+}
+
+func ledgerEntry(event, brokerName string, o *Order) LedgerEntry {
+	return LedgerEntry{
+		Event:          event,
+		Broker:         brokerName,
+		OrderID:        o.ID,
+		ClientOrderID:  o.ClientOrderID,
+		Symbol:         o.Symbol,
+		Side:           o.Side,
+		Type:           o.Type,
+		Class:          o.Class,
+		TimeInForce:    o.TimeInForce,
+		Qty:            o.Qty,
+		FilledQty:      o.FilledQty,
+		FilledAvgPrice: o.FilledAvgPrice,
+		LimitPrice:     o.LimitPrice,
+		StopPrice:      o.StopPrice,
+		Status:         o.Status,
+	}
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Reading
+// ─────────────────────────────────────────────────────────────────────────────
+
+// LedgerOrder is one order folded from its ledger entries: the latest entry
+// plus when it was placed and every status it was seen in, oldest first.
+type LedgerOrder struct {
+	LedgerEntry
+	PlacedAt time.Time `json:"placed_at"`
+	Statuses []string  `json:"statuses"`
+}
+
+// Changed reports whether o differs from the ledger's last record of it.
+func (lo *LedgerOrder) Changed(o *Order) bool {
+	return lo.Status != o.Status || lo.FilledQty != o.FilledQty || lo.FilledAvgPrice != o.FilledAvgPrice
+}
+
+// ReadLedger reads every entry in the ledger at path.  A missing file is an
+// empty ledger.
+func ReadLedger(path string) ([]LedgerEntry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ledger %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var entries []LedgerEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e LedgerEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("failed to parse ledger %s line %d: %w", path, n, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ledger %s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// FoldLedger collapses entries into one LedgerOrder per order ID, in the
+// order they were placed.  Cancel requests are kept in Statuses but do not
+// overwrite the last reported state.  A replacement order inherits the
+// bracket parent of the order it replaced.
+func FoldLedger(entries []LedgerEntry) []*LedgerOrder {
+	byID := make(map[string]*LedgerOrder)
+	var out []*LedgerOrder
+	for _, e := range entries {
+		lo, ok := byID[e.OrderID]
+		if !ok {
+			lo = &LedgerOrder{LedgerEntry: e, PlacedAt: e.Time}
+			if replaced, ok := byID[e.ReplacesID]; ok && lo.ParentID == "" {
+				lo.ParentID = replaced.ParentID
+			}
+			byID[e.OrderID] = lo
+			out = append(out, lo)
+		}
+		status := e.Status
+		if e.Event == LedgerCancelRequested {
+			status = LedgerCancelRequested
+		} else {
+			expected, parent, replaces := lo.ExpectedPrice, lo.ParentID, lo.ReplacesID
+			lo.LedgerEntry = e
+			if lo.ExpectedPrice == 0 {
+				lo.ExpectedPrice = expected
+			}
+			if lo.ParentID == "" {
+				lo.ParentID = parent
+			}
+			if lo.ReplacesID == "" {
+				lo.ReplacesID = replaces
+			}
+		}
+		if n := len(lo.Statuses); n == 0 || lo.Statuses[n-1] != status {
+			lo.Statuses = append(lo.Statuses, status)
+		}
+	}
+	return out
+}
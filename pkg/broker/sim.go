@@ -0,0 +1,864 @@
+package broker
+
+// Simulated broker
+//
+// SimBroker is an in-process, long-only paper account.  Orders rest until the
+// caller feeds bars through ProcessBar, which fills them at bar-level prices:
+//
+//   market        the bar's open
+//   limit         buy when low <= limit at min(open, limit); sell mirrored
+//   stop          sell when low <= stop at min(open, stop); buy mirrored
+//   stop_limit    triggers like a stop, then fills like a limit
+//
+// An order only trades on bars processed after it was placed, and bracket
+// and OTO legs only from the bar after their parent's first fill.  If both
+// sides of a bracket or OCO could trigger in one bar, the stop is assumed to
+// fill first.  ExtendedHours is recorded but not enforced: the caller
+// decides which bars to feed.
+// Participation, when set, caps each fill at that fraction of the bar's
+// volume, leaving the rest working as a partial fill.  Every fill, cancel
+// and expiry is also pushed to StreamTradeUpdates subscribers, dropping
+// events for one that falls more than its buffer behind.
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"avantai/pkg/marketdata"
+)
+
+// Fill is one execution produced by ProcessBar.
+type Fill struct {
+	OrderID string    `json:"order_id"`
+	Symbol  string    `json:"symbol"`
+	Side    Side      `json:"side"`
+	Qty     float64   `json:"qty"`
+	Price   float64   `json:"price"`
+	Time    time.Time `json:"time"`
+}
+
+// SimBroker implements Broker against bars supplied by the caller.
+type SimBroker struct {
+	// Participation caps each fill at this fraction of the bar's volume;
+	// zero fills the whole remaining quantity at once.
+	Participation float64
+
+	mu         sync.Mutex
+	now        time.Time
+	cash       float64
+	lastEquity float64 // equity at the last ExpireDayOrders
+	positions  map[string]*simHolding
+	prices     map[string]float64
+	untradable map[string]bool
+
+	orders    map[string]*Order
+	seq       []string            // order IDs in the order they are matched
+	legs      map[string][]string // parent ID → leg IDs (take-profit, stop-loss)
+	parent    map[string]string   // leg ID → parent ID
+	triggered map[string]bool     // stop_limit orders whose stop has traded
+	nextID    int
+	fills     []Fill
+
+	subscribers []chan TradeUpdate
+}
+
+type simHolding struct {
+	qty      float64
+	avgPrice float64
+}
+
+// NewSimBroker returns a SimBroker holding cash and no positions.
+func NewSimBroker(cash float64) *SimBroker {
+	return &SimBroker{
+		cash:       cash,
+		lastEquity: cash,
+		positions:  make(map[string]*simHolding),
+		prices:     make(map[string]float64),
+		untradable: make(map[string]bool),
+		orders:     make(map[string]*Order),
+		legs:       make(map[string][]string),
+		parent:     make(map[string]string),
+		triggered:  make(map[string]bool),
+	}
+}
+
+func (s *SimBroker) Name() string { return BrokerSim }
+
+// SetTime sets the simulated clock used for order timestamps.
+func (s *SimBroker) SetTime(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = t
+}
+
+// SetPrice records the last price for symbol, used for market-order buying
+// power checks, LatestPrice and position values.
+func (s *SimBroker) SetPrice(symbol string, price float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prices[symbol] = price
+}
+
+// SetTradable marks symbol as tradable or not.  Every symbol is tradable by
+// default.
+func (s *SimBroker) SetTradable(symbol string, tradable bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.untradable[symbol] = !tradable
+}
+
+// Fills returns every execution so far, oldest first.
+func (s *SimBroker) Fills() []Fill {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Fill(nil), s.fills...)
+}
+
+func (s *SimBroker) clock() time.Time {
+	if s.now.IsZero() {
+		return time.Now()
+	}
+	return s.now
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Broker
+// ─────────────────────────────────────────────────────────────────────────────
+
+func (s *SimBroker) Account() (*Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return &Account{
+		Status:         "ACTIVE",
+		Cash:           s.cash,
+		BuyingPower:    s.cash - s.reservedBuys(),
+		PortfolioValue: s.equity(),
+		LastEquity:     s.lastEquity,
+	}, nil
+}
+
+func (s *SimBroker) Asset(symbol string) (*Asset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &Asset{Symbol: symbol, Tradable: !s.untradable[symbol]}, nil
+}
+
+func (s *SimBroker) LatestPrice(symbol string) (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	price, ok := s.prices[symbol]
+	if !ok {
+		return 0, fmt.Errorf("no price for %s", symbol)
+	}
+	return price, nil
+}
+
+func (s *SimBroker) PlaceOrder(req OrderRequest) (*Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.validate(req); err != nil {
+		return nil, err
+	}
+
+	class := req.Class
+	if class == "" {
+		class = Simple
+	}
+	tif := req.TimeInForce
+	if tif == "" {
+		tif = Day
+	}
+	if class == OCO {
+		// The take-profit is the parent; the stop is its only leg and both
+		// work at once.
+		stopLoss := s.newOrder(Order{
+			Symbol: req.Symbol, Side: Sell, Type: Stop, Class: OCO, TimeInForce: tif,
+			Qty: req.Qty, StopPrice: req.StopLoss, ExtendedHours: req.ExtendedHours, Status: StatusNew,
+		})
+		takeProfit := s.newOrder(Order{
+			ClientOrderID: req.ClientOrderID, Symbol: req.Symbol, Side: Sell, Type: Limit, Class: OCO,
+			TimeInForce: tif, Qty: req.Qty, LimitPrice: req.TakeProfit, ExtendedHours: req.ExtendedHours,
+			Status: StatusNew,
+		})
+		s.legs[takeProfit.ID] = []string{stopLoss.ID}
+		s.parent[stopLoss.ID] = takeProfit.ID
+		s.emit(EventNew, takeProfit, 0, 0)
+		return s.snapshot(takeProfit), nil
+	}
+	order := s.newOrder(Order{
+		ClientOrderID: req.ClientOrderID,
+		Symbol:        req.Symbol,
+		Side:          req.Side,
+		Type:          req.Type,
+		Class:         class,
+		TimeInForce:   tif,
+		Qty:           req.Qty,
+		LimitPrice:    req.LimitPrice,
+		StopPrice:     req.StopPrice,
+		ExtendedHours: req.ExtendedHours,
+		Status:        StatusNew,
+	})
+
+	switch {
+	case class == Bracket:
+		// The stop leg is matched first so a bar through both legs stops out.
+		takeProfit := s.newOrder(Order{
+			Symbol: req.Symbol, Side: Sell, Type: Limit, Class: Bracket, TimeInForce: tif,
+			Qty: req.Qty, LimitPrice: req.TakeProfit, Status: StatusHeld,
+		})
+		stopLoss := s.newOrder(Order{
+			Symbol: req.Symbol, Side: Sell, Type: Stop, Class: Bracket, TimeInForce: tif,
+			Qty: req.Qty, StopPrice: req.StopLoss, Status: StatusHeld,
+		})
+		s.seq[len(s.seq)-2], s.seq[len(s.seq)-1] = stopLoss.ID, takeProfit.ID
+		s.legs[order.ID] = []string{takeProfit.ID, stopLoss.ID}
+		s.parent[takeProfit.ID] = order.ID
+		s.parent[stopLoss.ID] = order.ID
+	case class == OTO && req.StopLoss != 0:
+		stopLoss := s.newOrder(Order{
+			Symbol: req.Symbol, Side: Sell, Type: Stop, Class: OTO, TimeInForce: tif,
+			Qty: req.Qty, StopPrice: req.StopLoss, Status: StatusHeld,
+		})
+		s.legs[order.ID] = []string{stopLoss.ID}
+		s.parent[stopLoss.ID] = order.ID
+	case class == OTO:
+		takeProfit := s.newOrder(Order{
+			Symbol: req.Symbol, Side: Sell, Type: Limit, Class: OTO, TimeInForce: tif,
+			Qty: req.Qty, LimitPrice: req.TakeProfit, Status: StatusHeld,
+		})
+		s.legs[order.ID] = []string{takeProfit.ID}
+		s.parent[takeProfit.ID] = order.ID
+	}
+	s.emit(EventNew, order, 0, 0)
+	return s.snapshot(order), nil
+}
+
+func (s *SimBroker) GetOrder(id string) (*Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.orders[id]
+	if !ok {
+		return nil, fmt.Errorf("order %s not found", id)
+	}
+	return s.snapshot(o), nil
+}
+
+// ListOrders returns top-level orders (legs are nested) newest first.
+func (s *SimBroker) ListOrders(status string) ([]Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []Order
+	for i := len(s.seq) - 1; i >= 0; i-- {
+		o := s.orders[s.seq[i]]
+		if _, isLeg := s.parent[o.ID]; isLeg {
+			continue
+		}
+		open := o.IsOpen()
+		for _, legID := range s.legs[o.ID] {
+			open = open || s.orders[legID].IsOpen()
+		}
+		switch status {
+		case "", "open":
+			if !open {
+				continue
+			}
+		case "closed":
+			if open {
+				continue
+			}
+		case "all":
+		default:
+			return nil, fmt.Errorf("unknown order status filter %q", status)
+		}
+		out = append(out, *s.snapshot(o))
+	}
+	return out, nil
+}
+
+// ReplaceOrder moves the unfilled remainder of a new or held order to a
+// new order with req applied; a replaced bracket leg stays in its bracket.
+// A stop_limit whose stop has already traded stays triggered.
+func (s *SimBroker) ReplaceOrder(id string, req ReplaceRequest) (*Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.orders[id]
+	if !ok {
+		return nil, fmt.Errorf("order %s not found", id)
+	}
+	if old.Status != StatusNew && old.Status != StatusHeld {
+		return nil, fmt.Errorf("order %s is %s and cannot be replaced", id, old.Status)
+	}
+
+	o := *old
+	o.Legs = nil
+	if req.Qty != 0 {
+		o.Qty = req.Qty
+	}
+	if req.LimitPrice != 0 {
+		o.LimitPrice = req.LimitPrice
+	}
+	if req.StopPrice != 0 {
+		o.StopPrice = req.StopPrice
+	}
+	if o.Qty <= 0 {
+		return nil, fmt.Errorf("qty must be positive, got %v", o.Qty)
+	}
+	if o.Side == Sell && o.Status == StatusNew {
+		held := 0.0
+		if h, ok := s.positions[o.Symbol]; ok {
+			held = h.qty
+		}
+		// The order being replaced releases its own shares.
+		available := held - s.reservedSells(o.Symbol) + old.Qty
+		if _, isLeg := s.parent[id]; isLeg {
+			available = held - s.reservedSells(o.Symbol) + s.bracketReserved(s.parent[id])
+		}
+		if o.Qty > available {
+			return nil, fmt.Errorf("insufficient qty available for %s: requested %v, available %v", o.Symbol, o.Qty, available)
+		}
+	}
+
+	replacement := s.newOrder(o)
+	// Take the original's slot so a replaced stop leg still matches first.
+	s.seq = s.seq[:len(s.seq)-1]
+	for i, seqID := range s.seq {
+		if seqID == id {
+			s.seq[i] = replacement.ID
+		}
+	}
+	if s.triggered[id] {
+		s.triggered[replacement.ID] = true
+	}
+	if parentID, isLeg := s.parent[id]; isLeg {
+		for i, legID := range s.legs[parentID] {
+			if legID == id {
+				s.legs[parentID][i] = replacement.ID
+			}
+		}
+		s.parent[replacement.ID] = parentID
+		delete(s.parent, id)
+	}
+	if legs, ok := s.legs[id]; ok {
+		s.legs[replacement.ID] = legs
+		delete(s.legs, id)
+		for _, legID := range legs {
+			s.parent[legID] = replacement.ID
+		}
+	}
+
+	old.Status = StatusReplaced
+	s.emit(EventReplaced, old, 0, 0)
+	s.emit(EventNew, replacement, 0, 0)
+	return s.snapshot(replacement), nil
+}
+
+// CancelOrder cancels an open order.  Cancelling an unfilled bracket parent
+// cancels its legs; cancelling a leg cancels both legs.  Either side of an
+// OCO cancels the whole OCO.
+func (s *SimBroker) CancelOrder(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[id]
+	if !ok {
+		return fmt.Errorf("order %s not found", id)
+	}
+	if !o.IsOpen() {
+		return fmt.Errorf("order %s is already %s", id, o.Status)
+	}
+
+	if parentID, isLeg := s.parent[id]; isLeg {
+		for _, legID := range s.legs[parentID] {
+			if leg := s.orders[legID]; leg.IsOpen() {
+				leg.Status = StatusCanceled
+				s.emit(EventCanceled, leg, 0, 0)
+			}
+		}
+		if p := s.orders[parentID]; p.Class == OCO && p.IsOpen() {
+			p.Status = StatusCanceled
+			s.emit(EventCanceled, p, 0, 0)
+		}
+		return nil
+	}
+
+	o.Status = StatusCanceled
+	s.emit(EventCanceled, o, 0, 0)
+	if o.FilledQty == 0 || o.Class == OCO {
+		for _, legID := range s.legs[id] {
+			s.orders[legID].Status = StatusCanceled
+			s.emit(EventCanceled, s.orders[legID], 0, 0)
+		}
+	}
+	return nil
+}
+
+func (s *SimBroker) Positions() ([]Position, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]Position, 0, len(s.positions))
+	for sym, h := range s.positions {
+		out = append(out, s.position(sym, h))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Symbol < out[j].Symbol })
+	return out, nil
+}
+
+func (s *SimBroker) Position(symbol string) (*Position, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, ok := s.positions[symbol]
+	if !ok {
+		return nil, nil
+	}
+	pos := s.position(symbol, h)
+	return &pos, nil
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Matching
+// ─────────────────────────────────────────────────────────────────────────────
+
+// ProcessBar matches every working order in symbol against bar, advances the
+// clock to the bar and returns the fills.
+func (s *SimBroker) ProcessBar(symbol string, bar marketdata.Bar) []Fill {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.now = bar.Time
+	// Snapshot the working orders first so legs released by a fill in this
+	// bar wait for the next one.
+	var working []*Order
+	for _, id := range s.seq {
+		o := s.orders[id]
+		if o.Symbol == symbol && (o.Status == StatusNew || o.Status == StatusPartiallyFilled) {
+			working = append(working, o)
+		}
+	}
+
+	var fills []Fill
+	for _, o := range working {
+		if o.Status != StatusNew && o.Status != StatusPartiallyFilled {
+			continue // cancelled by a sibling earlier in this bar
+		}
+		price, ok := s.matchPrice(o, bar)
+		if !ok {
+			continue
+		}
+
+		qty := o.Qty - o.FilledQty
+		if s.Participation > 0 {
+			qty = math.Min(qty, math.Floor(bar.Volume*s.Participation))
+		}
+		if o.Side == Sell {
+			held := 0.0
+			if h, ok := s.positions[symbol]; ok {
+				held = h.qty
+			}
+			qty = math.Min(qty, held)
+		}
+		if qty <= 0 {
+			continue
+		}
+
+		fill := s.fill(o, qty, price)
+		fills = append(fills, fill)
+	}
+
+	s.prices[symbol] = bar.Close
+	s.fills = append(s.fills, fills...)
+	return fills
+}
+
+// ExpireDayOrders expires every working Day order, as at the session close,
+// and marks the close equity as the account's LastEquity.
+func (s *SimBroker) ExpireDayOrders() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastEquity = s.equity()
+	for _, o := range s.orders {
+		if o.TimeInForce == Day && o.IsOpen() {
+			o.Status = StatusExpired
+			s.emit(EventExpired, o, 0, 0)
+		}
+	}
+}
+
+// matchPrice returns the fill price of o in bar, if it trades.
+func (s *SimBroker) matchPrice(o *Order, bar marketdata.Bar) (float64, bool) {
+	limit := func() (float64, bool) {
+		if o.Side == Buy && bar.Low <= o.LimitPrice {
+			return math.Min(bar.Open, o.LimitPrice), true
+		}
+		if o.Side == Sell && bar.High >= o.LimitPrice {
+			return math.Max(bar.Open, o.LimitPrice), true
+		}
+		return 0, false
+	}
+	stop := func() (float64, bool) {
+		if o.Side == Buy && bar.High >= o.StopPrice {
+			return math.Max(bar.Open, o.StopPrice), true
+		}
+		if o.Side == Sell && bar.Low <= o.StopPrice {
+			return math.Min(bar.Open, o.StopPrice), true
+		}
+		return 0, false
+	}
+
+	switch o.Type {
+	case Market:
+		return bar.Open, true
+	case Limit:
+		return limit()
+	case Stop:
+		return stop()
+	case StopLimit:
+		if !s.triggered[o.ID] {
+			p, ok := stop()
+			if !ok {
+				return 0, false
+			}
+			s.triggered[o.ID] = true
+			if (o.Side == Buy && p <= o.LimitPrice) || (o.Side == Sell && p >= o.LimitPrice) {
+				return p, true
+			}
+		}
+		return limit()
+	}
+	return 0, false
+}
+
+// fill applies one execution to o, the account and any bracket relatives.
+func (s *SimBroker) fill(o *Order, qty, price float64) Fill {
+	now := s.now
+	event := EventPartialFill
+	o.FilledAvgPrice = (o.FilledAvgPrice*o.FilledQty + price*qty) / (o.FilledQty + qty)
+	o.FilledQty += qty
+	if o.FilledQty >= o.Qty {
+		o.Status = StatusFilled
+		o.FilledAt = &now
+		event = EventFill
+	} else {
+		o.Status = StatusPartiallyFilled
+	}
+
+	h, ok := s.positions[o.Symbol]
+	if !ok {
+		h = &simHolding{}
+		s.positions[o.Symbol] = h
+	}
+	if o.Side == Buy {
+		s.cash -= qty * price
+		h.avgPrice = (h.avgPrice*h.qty + price*qty) / (h.qty + qty)
+		h.qty += qty
+	} else {
+		s.cash += qty * price
+		h.qty -= qty
+		if h.qty <= 0 {
+			delete(s.positions, o.Symbol)
+		}
+	}
+
+	// An entry fill releases (or grows) its legs.
+	if o.Class != OCO {
+		for _, legID := range s.legs[o.ID] {
+			leg := s.orders[legID]
+			if leg.Status == StatusHeld {
+				leg.Status = StatusNew
+			}
+			if leg.IsOpen() {
+				leg.Qty = o.FilledQty
+			}
+		}
+	}
+	// An exit fill shrinks the exits it shares shares with (one-cancels-other).
+	for _, sibling := range s.ocoSiblings(o) {
+		if !sibling.IsOpen() {
+			continue
+		}
+		if remaining := o.Qty - o.FilledQty; remaining > 0 {
+			sibling.Qty = sibling.FilledQty + remaining
+		} else {
+			sibling.Status = StatusCanceled
+			s.emit(EventCanceled, sibling, 0, 0)
+		}
+	}
+	s.emit(event, o, qty, price)
+
+	return Fill{OrderID: o.ID, Symbol: o.Symbol, Side: o.Side, Qty: qty, Price: price, Time: now}
+}
+
+// StreamTradeUpdates calls handler for every order event until ctx is
+// cancelled.  Handlers run on the caller's goroutine, so they may call back
+// into the broker.
+func (s *SimBroker) StreamTradeUpdates(ctx context.Context, handler func(TradeUpdate)) error {
+	ch := make(chan TradeUpdate, 4096)
+	s.mu.Lock()
+	s.subscribers = append(s.subscribers, ch)
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for i, sub := range s.subscribers {
+			if sub == ch {
+				s.subscribers = append(s.subscribers[:i], s.subscribers[i+1:]...)
+				break
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case tu := <-ch:
+			handler(tu)
+		}
+	}
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Internal helpers (callers hold s.mu)
+// ─────────────────────────────────────────────────────────────────────────────
+
+func (s *SimBroker) validate(req OrderRequest) error {
+	if req.Symbol == "" {
+		return fmt.Errorf("symbol is required")
+	}
+	if req.Qty <= 0 {
+		return fmt.Errorf("qty must be positive, got %v", req.Qty)
+	}
+	if s.untradable[req.Symbol] {
+		return fmt.Errorf("%s is not tradable", req.Symbol)
+	}
+	switch req.Type {
+	case Market:
+	case Limit:
+		if req.LimitPrice <= 0 {
+			return fmt.Errorf("limit order requires a limit price")
+		}
+	case Stop:
+		if req.StopPrice <= 0 {
+			return fmt.Errorf("stop order requires a stop price")
+		}
+	case StopLimit:
+		if req.LimitPrice <= 0 || req.StopPrice <= 0 {
+			return fmt.Errorf("stop_limit order requires stop and limit prices")
+		}
+	default:
+		return fmt.Errorf("unsupported order type %q", req.Type)
+	}
+
+	switch req.Side {
+	case Buy:
+		ref := req.LimitPrice
+		if ref == 0 {
+			ref = req.StopPrice
+		}
+		if ref == 0 {
+			price, ok := s.prices[req.Symbol]
+			if !ok {
+				return fmt.Errorf("no price for %s to check buying power", req.Symbol)
+			}
+			ref = price
+		}
+		if cost, bp := req.Qty*ref, s.cash-s.reservedBuys(); cost > bp {
+			return fmt.Errorf("insufficient buying power: need $%.2f, have $%.2f", cost, bp)
+		}
+	case Sell:
+		if req.Class == Bracket || req.Class == OTO {
+			return fmt.Errorf("%s orders must be buys (the simulator is long-only)", req.Class)
+		}
+		held := 0.0
+		if h, ok := s.positions[req.Symbol]; ok {
+			held = h.qty
+		}
+		if available := held - s.reservedSells(req.Symbol); req.Qty > available {
+			return fmt.Errorf("insufficient qty available for %s: requested %v, available %v", req.Symbol, req.Qty, available)
+		}
+	default:
+		return fmt.Errorf("unsupported side %q", req.Side)
+	}
+
+	switch req.Class {
+	case "", Simple:
+	case Bracket:
+		if req.StopLoss <= 0 || req.TakeProfit <= req.StopLoss {
+			return fmt.Errorf("bracket requires 0 < stop loss < take profit, got %v / %v", req.StopLoss, req.TakeProfit)
+		}
+	case OTO:
+		if (req.StopLoss == 0) == (req.TakeProfit == 0) {
+			return fmt.Errorf("oto requires exactly one of stop loss and take profit")
+		}
+	case OCO:
+		if req.Side != Sell || req.Type != Limit || req.LimitPrice != req.TakeProfit {
+			return fmt.Errorf("oco must be a limit sell at the take-profit price")
+		}
+		if req.StopLoss <= 0 || req.TakeProfit <= req.StopLoss {
+			return fmt.Errorf("oco requires 0 < stop loss < take profit, got %v / %v", req.StopLoss, req.TakeProfit)
+		}
+	default:
+		return fmt.Errorf("unsupported order class %q", req.Class)
+	}
+	return nil
+}
+
+// emit queues an event for o on every subscriber.  It runs under s.mu, so
+// it never blocks: a subscriber whose buffer is full misses the event.
+func (s *SimBroker) emit(event string, o *Order, qty, price float64) {
+	if len(s.subscribers) == 0 {
+		return
+	}
+	tu := TradeUpdate{Event: event, Time: s.clock(), Order: *s.snapshot(o), Qty: qty, Price: price}
+	if h, ok := s.positions[o.Symbol]; ok {
+		tu.PositionQty = h.qty
+	}
+	for _, ch := range s.subscribers {
+		select {
+		case ch <- tu:
+		default:
+			log.Printf("⚠️  [%s] sim trade update subscriber is behind — dropping %s for %s", o.Symbol, event, o.ID)
+		}
+	}
+}
+
+func (s *SimBroker) newOrder(o Order) *Order {
+	s.nextID++
+	o.ID = fmt.Sprintf("sim-%06d", s.nextID)
+	o.SubmittedAt = s.clock()
+	s.orders[o.ID] = &o
+	s.seq = append(s.seq, o.ID)
+	return &o
+}
+
+// snapshot copies o with its legs nested, so callers never share state with
+// the matcher.
+func (s *SimBroker) snapshot(o *Order) *Order {
+	out := *o
+	out.Legs = nil
+	for _, legID := range s.legs[o.ID] {
+		out.Legs = append(out.Legs, *s.orders[legID])
+	}
+	return &out
+}
+
+// reservedBuys is the notional of every working buy order.
+func (s *SimBroker) reservedBuys() float64 {
+	total := 0.0
+	for _, o := range s.orders {
+		if o.Side != Buy || !o.IsOpen() {
+			continue
+		}
+		ref := o.LimitPrice
+		if ref == 0 {
+			ref = o.StopPrice
+		}
+		if ref == 0 {
+			ref = s.prices[o.Symbol]
+		}
+		total += (o.Qty - o.FilledQty) * ref
+	}
+	return total
+}
+
+// reservedSells is the quantity held by working sell orders in symbol.  The
+// legs of one bracket, or both sides of an OCO, share the same shares and
+// count once.
+func (s *SimBroker) reservedSells(symbol string) float64 {
+	total := 0.0
+	byParent := make(map[string]float64)
+	for _, o := range s.orders {
+		if o.Symbol != symbol || o.Side != Sell || (o.Status != StatusNew && o.Status != StatusPartiallyFilled) {
+			continue
+		}
+		remaining := o.Qty - o.FilledQty
+		if parentID, isLeg := s.parent[o.ID]; isLeg {
+			byParent[parentID] = math.Max(byParent[parentID], remaining)
+			continue
+		}
+		if o.Class == OCO {
+			byParent[o.ID] = math.Max(byParent[o.ID], remaining)
+			continue
+		}
+		total += remaining
+	}
+	for _, q := range byParent {
+		total += q
+	}
+	return total
+}
+
+// ocoSiblings returns the exit orders that share o's shares: the other legs
+// of its bracket, or the other side of its OCO.
+func (s *SimBroker) ocoSiblings(o *Order) []*Order {
+	parentID, isLeg := s.parent[o.ID]
+	if !isLeg {
+		if o.Class != OCO {
+			return nil
+		}
+		parentID = o.ID
+	}
+	var out []*Order
+	if p := s.orders[parentID]; p.Class == OCO && p != o {
+		out = append(out, p)
+	}
+	for _, legID := range s.legs[parentID] {
+		if legID != o.ID {
+			out = append(out, s.orders[legID])
+		}
+	}
+	return out
+}
+
+// bracketReserved is the quantity the working legs of parentID (and the
+// parent itself, for an OCO) hold.
+func (s *SimBroker) bracketReserved(parentID string) float64 {
+	reserved := 0.0
+	if p := s.orders[parentID]; p.Class == OCO && p.IsOpen() {
+		reserved = p.Qty - p.FilledQty
+	}
+	for _, legID := range s.legs[parentID] {
+		leg := s.orders[legID]
+		if leg.Status == StatusNew || leg.Status == StatusPartiallyFilled {
+			reserved = math.Max(reserved, leg.Qty-leg.FilledQty)
+		}
+	}
+	return reserved
+}
+
+func (s *SimBroker) equity() float64 {
+	value := s.cash
+	for sym, h := range s.positions {
+		value += h.qty * s.priceOf(sym, h)
+	}
+	return value
+}
+
+func (s *SimBroker) priceOf(symbol string, h *simHolding) float64 {
+	if p, ok := s.prices[symbol]; ok {
+		return p
+	}
+	return h.avgPrice
+}
+
+func (s *SimBroker) position(symbol string, h *simHolding) Position {
+	price := s.priceOf(symbol, h)
+	return Position{
+		Symbol:        symbol,
+		Qty:           h.qty,
+		AvgEntryPrice: h.avgPrice,
+		CurrentPrice:  price,
+		MarketValue:   h.qty * price,
+		UnrealizedPL:  h.qty * (price - h.avgPrice),
+	}
+}
@@ -0,0 +1,286 @@
+package broker
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"avantai/pkg/marketdata"
+)
+
+const simSymbol = "TEST"
+
+var simStart = time.Date(2024, 3, 4, 14, 30, 0, 0, time.UTC)
+
+// simBar is one minute bar, i minutes after simStart.
+func simBar(i int, open, high, low, close, volume float64) marketdata.Bar {
+	return marketdata.Bar{
+		Time: simStart.Add(time.Duration(i) * time.Minute),
+		Open: open, High: high, Low: low, Close: close, Volume: volume,
+	}
+}
+
+// newTestSim returns a SimBroker priced at $10 and, if held is positive,
+// long held shares bought at $10 on the bar at simStart.
+func newTestSim(t *testing.T, held float64) *SimBroker {
+	t.Helper()
+	s := NewSimBroker(100000)
+	s.SetPrice(simSymbol, 10)
+	if held > 0 {
+		if _, err := s.PlaceOrder(OrderRequest{Symbol: simSymbol, Qty: held, Side: Buy, Type: Market}); err != nil {
+			t.Fatalf("setup buy: %v", err)
+		}
+		if fills := s.ProcessBar(simSymbol, simBar(0, 10, 10, 10, 10, 1e6)); len(fills) != 1 {
+			t.Fatalf("setup buy: got %d fills, want 1", len(fills))
+		}
+	}
+	return s
+}
+
+func TestSimBrokerProcessBar(t *testing.T) {
+	type fill struct {
+		Side  Side
+		Qty   float64
+		Price float64
+	}
+	tests := []struct {
+		name          string
+		held          float64
+		participation float64
+		orders        []OrderRequest
+		bars          []marketdata.Bar
+		want          []fill
+		wantOpen      int // working orders left, legs included
+	}{
+		{
+			name:   "market buy fills at the next open",
+			orders: []OrderRequest{{Symbol: simSymbol, Qty: 10, Side: Buy, Type: Market}},
+			bars:   []marketdata.Bar{simBar(1, 10.5, 11, 10, 10.8, 1e6)},
+			want:   []fill{{Buy, 10, 10.5}},
+		},
+		{
+			name:   "limit buy waits for the low to reach it",
+			orders: []OrderRequest{{Symbol: simSymbol, Qty: 10, Side: Buy, Type: Limit, LimitPrice: 9.5}},
+			bars: []marketdata.Bar{
+				simBar(1, 10, 10.5, 9.8, 10.2, 1e6),
+				simBar(2, 9.9, 10, 9.4, 9.6, 1e6),
+			},
+			want: []fill{{Buy, 10, 9.5}},
+		},
+		{
+			name:   "limit buy gapping below the limit fills at the open",
+			orders: []OrderRequest{{Symbol: simSymbol, Qty: 10, Side: Buy, Type: Limit, LimitPrice: 9.5}},
+			bars:   []marketdata.Bar{simBar(1, 9.2, 9.4, 9, 9.3, 1e6)},
+			want:   []fill{{Buy, 10, 9.2}},
+		},
+		{
+			name:     "limit buy above the bar keeps working",
+			orders:   []OrderRequest{{Symbol: simSymbol, Qty: 10, Side: Buy, Type: Limit, LimitPrice: 9.5}},
+			bars:     []marketdata.Bar{simBar(1, 10, 10.5, 9.8, 10.2, 1e6)},
+			wantOpen: 1,
+		},
+		{
+			name:   "stop sell triggers at the stop",
+			held:   100,
+			orders: []OrderRequest{{Symbol: simSymbol, Qty: 100, Side: Sell, Type: Stop, StopPrice: 9, TimeInForce: GTC}},
+			bars: []marketdata.Bar{
+				simBar(1, 9.5, 9.8, 9.2, 9.4, 1e6),
+				simBar(2, 9.1, 9.2, 8.5, 8.8, 1e6),
+			},
+			want: []fill{{Sell, 100, 9}},
+		},
+		{
+			name:   "stop sell gapping through the stop fills at the open",
+			held:   100,
+			orders: []OrderRequest{{Symbol: simSymbol, Qty: 100, Side: Sell, Type: Stop, StopPrice: 9, TimeInForce: GTC}},
+			bars:   []marketdata.Bar{simBar(1, 8.5, 8.7, 8.2, 8.4, 1e6)},
+			want:   []fill{{Sell, 100, 8.5}},
+		},
+		{
+			name:   "stop buy triggers at the stop",
+			orders: []OrderRequest{{Symbol: simSymbol, Qty: 10, Side: Buy, Type: Stop, StopPrice: 10.5}},
+			bars:   []marketdata.Bar{simBar(1, 10.2, 10.8, 10.1, 10.6, 1e6)},
+			want:   []fill{{Buy, 10, 10.5}},
+		},
+		{
+			name: "stop-limit sell fills inside its limit",
+			held: 100,
+			orders: []OrderRequest{{Symbol: simSymbol, Qty: 100, Side: Sell, Type: StopLimit,
+				StopPrice: 9, LimitPrice: 8.9, TimeInForce: GTC}},
+			bars: []marketdata.Bar{simBar(1, 9.3, 9.4, 8.8, 9, 1e6)},
+			want: []fill{{Sell, 100, 9}},
+		},
+		{
+			name: "stop-limit sell gapping through its limit waits for the limit",
+			held: 100,
+			orders: []OrderRequest{{Symbol: simSymbol, Qty: 100, Side: Sell, Type: StopLimit,
+				StopPrice: 9, LimitPrice: 8.9, TimeInForce: GTC}},
+			bars: []marketdata.Bar{
+				simBar(1, 8.5, 8.7, 8.4, 8.6, 1e6),
+				simBar(2, 8.7, 9, 8.6, 8.95, 1e6),
+			},
+			want: []fill{{Sell, 100, 8.9}},
+		},
+		{
+			name: "oco take-profit fill cancels the stop",
+			held: 100,
+			orders: []OrderRequest{{Symbol: simSymbol, Qty: 100, Side: Sell, Type: Limit, Class: OCO,
+				LimitPrice: 12, TakeProfit: 12, StopLoss: 9, TimeInForce: GTC}},
+			bars: []marketdata.Bar{simBar(1, 11.5, 12.3, 11.4, 12.1, 1e6)},
+			want: []fill{{Sell, 100, 12}},
+		},
+		{
+			name: "oco stop fill cancels the take-profit",
+			held: 100,
+			orders: []OrderRequest{{Symbol: simSymbol, Qty: 100, Side: Sell, Type: Limit, Class: OCO,
+				LimitPrice: 12, TakeProfit: 12, StopLoss: 9, TimeInForce: GTC}},
+			bars: []marketdata.Bar{simBar(1, 9.5, 9.6, 8.8, 9, 1e6)},
+			want: []fill{{Sell, 100, 9}},
+		},
+		{
+			name: "bracket legs wait for the entry and the stop wins a wide bar",
+			orders: []OrderRequest{{Symbol: simSymbol, Qty: 100, Side: Buy, Type: Market, Class: Bracket,
+				TakeProfit: 12, StopLoss: 9}},
+			bars: []marketdata.Bar{
+				simBar(1, 10, 12.5, 8.5, 10, 1e6),
+				simBar(2, 10, 12.5, 8.5, 11, 1e6),
+			},
+			want: []fill{{Buy, 100, 10}, {Sell, 100, 9}},
+		},
+		{
+			name: "bracket take-profit cancels the stop leg",
+			orders: []OrderRequest{{Symbol: simSymbol, Qty: 100, Side: Buy, Type: Market, Class: Bracket,
+				TakeProfit: 12, StopLoss: 9}},
+			bars: []marketdata.Bar{
+				simBar(1, 10, 10.2, 9.9, 10, 1e6),
+				simBar(2, 11.8, 12.4, 11.7, 12.2, 1e6),
+			},
+			want: []fill{{Buy, 100, 10}, {Sell, 100, 12}},
+		},
+		{
+			name:          "participation leaves the rest working as a partial fill",
+			participation: 0.1,
+			orders:        []OrderRequest{{Symbol: simSymbol, Qty: 100, Side: Buy, Type: Market}},
+			bars: []marketdata.Bar{
+				simBar(1, 10, 10.2, 9.9, 10.1, 500),
+				simBar(2, 10.1, 10.3, 10, 10.2, 1000),
+			},
+			want: []fill{{Buy, 50, 10}, {Buy, 50, 10.1}},
+		},
+		{
+			name:          "partial fill still working after the last bar",
+			participation: 0.1,
+			orders:        []OrderRequest{{Symbol: simSymbol, Qty: 100, Side: Buy, Type: Market}},
+			bars:          []marketdata.Bar{simBar(1, 10, 10.2, 9.9, 10.1, 300)},
+			want:          []fill{{Buy, 30, 10}},
+			wantOpen:      1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSim(t, tt.held)
+			s.Participation = tt.participation
+			for _, req := range tt.orders {
+				if _, err := s.PlaceOrder(req); err != nil {
+					t.Fatalf("PlaceOrder: %v", err)
+				}
+			}
+
+			var got []fill
+			for _, bar := range tt.bars {
+				for _, f := range s.ProcessBar(simSymbol, bar) {
+					got = append(got, fill{f.Side, f.Qty, f.Price})
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("fills = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i].Side != tt.want[i].Side || got[i].Qty != tt.want[i].Qty ||
+					math.Abs(got[i].Price-tt.want[i].Price) > 1e-9 {
+					t.Errorf("fill %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+
+			open, err := s.ListOrders("open")
+			if err != nil {
+				t.Fatalf("ListOrders: %v", err)
+			}
+			working := 0
+			for _, o := range open {
+				for _, leg := range append([]Order{o}, o.Legs...) {
+					if leg.Status == StatusNew || leg.Status == StatusPartiallyFilled {
+						working++
+					}
+				}
+			}
+			if working != tt.wantOpen {
+				t.Errorf("working orders = %d, want %d: %+v", working, tt.wantOpen, open)
+			}
+		})
+	}
+}
+
+func TestSimBrokerRejectsOverSell(t *testing.T) {
+	stop := OrderRequest{Symbol: simSymbol, Qty: 100, Side: Sell, Type: Stop, StopPrice: 9, TimeInForce: GTC}
+	oco := OrderRequest{Symbol: simSymbol, Qty: 100, Side: Sell, Type: Limit, Class: OCO,
+		LimitPrice: 12, TakeProfit: 12, StopLoss: 9, TimeInForce: GTC}
+	sell := func(qty float64) OrderRequest {
+		return OrderRequest{Symbol: simSymbol, Qty: qty, Side: Sell, Type: Market}
+	}
+
+	tests := []struct {
+		name    string
+		held    float64
+		resting []OrderRequest
+		req     OrderRequest
+		wantErr bool
+	}{
+		{name: "nothing held", req: sell(1), wantErr: true},
+		{name: "more than held", held: 100, req: sell(150), wantErr: true},
+		{name: "exactly held", held: 100, req: sell(100)},
+		{name: "shares reserved by a stop", held: 100, resting: []OrderRequest{stop}, req: sell(50), wantErr: true},
+		{name: "shares reserved by an oco count once", held: 150, resting: []OrderRequest{oco}, req: sell(50)},
+		{name: "oco holds both sides' shares", held: 100, resting: []OrderRequest{oco}, req: sell(1), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSim(t, tt.held)
+			for _, req := range tt.resting {
+				if _, err := s.PlaceOrder(req); err != nil {
+					t.Fatalf("resting order: %v", err)
+				}
+			}
+			_, err := s.PlaceOrder(tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PlaceOrder error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSimBrokerCancelStopFreesShares(t *testing.T) {
+	s := newTestSim(t, 100)
+	order, err := s.PlaceOrder(OrderRequest{Symbol: simSymbol, Qty: 100, Side: Sell, Type: Stop, StopPrice: 9, TimeInForce: GTC})
+	if err != nil {
+		t.Fatalf("PlaceOrder stop: %v", err)
+	}
+	if _, err := s.PlaceOrder(OrderRequest{Symbol: simSymbol, Qty: 100, Side: Sell, Type: Market}); err == nil {
+		t.Fatal("sell with every share under a stop was accepted")
+	}
+	if err := s.CancelOrder(order.ID); err != nil {
+		t.Fatalf("CancelOrder: %v", err)
+	}
+	if _, err := s.PlaceOrder(OrderRequest{Symbol: simSymbol, Qty: 100, Side: Sell, Type: Market}); err != nil {
+		t.Fatalf("sell after cancelling the stop: %v", err)
+	}
+	fills := s.ProcessBar(simSymbol, simBar(1, 9.5, 9.6, 8, 8.5, 1e6))
+	if len(fills) != 1 || fills[0].Price != 9.5 {
+		t.Fatalf("fills = %+v, want one market fill at 9.5", fills)
+	}
+	if pos, _ := s.Position(simSymbol); pos != nil {
+		t.Errorf("position = %+v, want none", pos)
+	}
+}
@@ -0,0 +1,41 @@
+package broker
+
+import (
+	"context"
+	"time"
+)
+
+// Trade update events, spelled as Alpaca's trade_updates stream sends them.
+const (
+	EventNew         = "new"
+	EventFill        = "fill"
+	EventPartialFill = "partial_fill"
+	EventCanceled    = "canceled"
+	EventExpired     = "expired"
+	EventRejected    = "rejected"
+	EventReplaced    = "replaced"
+)
+
+// TradeUpdate is one order event pushed by the broker.  For fills, Qty and
+// Price are this execution (not the order's running totals) and PositionQty
+// is the position in Order.Symbol afterwards.
+type TradeUpdate struct {
+	Event       string    `json:"event"`
+	Time        time.Time `json:"time"`
+	Order       Order     `json:"order"`
+	Qty         float64   `json:"qty,omitempty"`
+	Price       float64   `json:"price,omitempty"`
+	PositionQty float64   `json:"position_qty"`
+}
+
+// IsFill reports whether the update is a full or partial execution.
+func (u TradeUpdate) IsFill() bool {
+	return u.Event == EventFill || u.Event == EventPartialFill
+}
+
+// TradeUpdateStreamer is implemented by brokers that push order events.
+// StreamTradeUpdates blocks, calling handler for each event in order, until
+// ctx is cancelled; it reconnects on its own after transient errors.
+type TradeUpdateStreamer interface {
+	StreamTradeUpdates(ctx context.Context, handler func(TradeUpdate)) error
+}
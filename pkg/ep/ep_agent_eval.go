@@ -0,0 +1,520 @@
+package ep
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"avantai/pkg/marketdata"
+	"avantai/pkg/sapien"
+	"avantai/pkg/spec"
+)
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Agent evaluation
+//
+// Replays the manager-agent inputs the live worker recorded
+// (responses/<date>/<symbol>/minute_N_input.json) against each of several
+// versions of one agent and scores every answer two ways:
+//   - against what the stock did next: the return from the proposed entry
+//     (or, for WAIT/PASS, the last price) to the close Horizon sessions on.
+//     A BUY that went up and a pass on one that did not are hits.
+//   - with Sapien's eval verdict on the run (ServeEvalRequestSpecV3).
+//
+// For the news and earnings agents the candidate version rewrites that
+// report from the raw files under RawDir, and the manager agent at its
+// default version decides on it; the verdict is on the report.
+// ─────────────────────────────────────────────────────────────────────────────
+
+// Agents RunAgentEval can compare versions of.
+const (
+	EvalAgentManager  = "manager"
+	EvalAgentNews     = "news"
+	EvalAgentEarnings = "earnings"
+)
+
+// AgentEvalConfig holds the parameters for RunAgentEval.
+type AgentEvalConfig struct {
+	AlpacaKey    string
+	AlpacaSecret string
+
+	Agent     string   // EvalAgentManager (default), EvalAgentNews or EvalAgentEarnings
+	Versions  []string // agent versions to compare; "" is the version Sapien serves by default
+	InputsDir string   // recorded inputs, default "responses"
+	RawDir    string   // news/earnings raw files, <RawDir>/<date>/<symbol> or <RawDir>/<symbol> (default "data")
+	StartDate string   // inputs from this session date on (optional)
+	EndDate   string   // inputs up to this session date (optional)
+	Horizon   int      // forward return horizon in sessions (default 1: the session's close)
+	MaxInputs int      // replay at most this many inputs, most recent first; 0 is all
+	SkipEval  bool     // do not ask Sapien for eval verdicts
+	OutputDir string   // default "data/backtests/agent_eval"
+}
+
+// AgentEvalRow is one version's answer to one recorded input.
+type AgentEvalRow struct {
+	Version    string  `json:"version"`
+	Input      string  `json:"input"` // file the input was read from
+	Symbol     string  `json:"symbol"`
+	Date       string  `json:"date"`
+	BarTime    string  `json:"bar_time"`
+	Action     string  `json:"action,omitempty"`
+	Confidence float64 `json:"confidence,omitempty"`
+	EntryPrice float64 `json:"entry_price,omitempty"`
+
+	Return    float64 `json:"return"` // fraction, from EntryPrice or the last price
+	HasReturn bool    `json:"has_return"`
+	Hit       bool    `json:"hit"`
+
+	Verdict       string `json:"verdict,omitempty"` // Sapien eval decision
+	VerdictReason string `json:"verdict_reason,omitempty"`
+
+	Error string `json:"error,omitempty"` // no valid answer
+}
+
+// AgentEvalSummary compares one version across every input.  Rates are
+// fractions of the rows they count: Valid of Inputs, Hit of Scored, BuyWin
+// of buys with a return, Eval* of rows with a verdict.
+type AgentEvalSummary struct {
+	Version       string  `json:"version"`
+	Inputs        int     `json:"inputs"`
+	Valid         int     `json:"valid"`
+	Buys          int     `json:"buys"`
+	Scored        int     `json:"scored"` // valid answers with a forward return
+	HitRate       float64 `json:"hit_rate"`
+	BuyWinRate    float64 `json:"buy_win_rate"`
+	AvgBuyReturn  float64 `json:"avg_buy_return"`
+	AvgSkipReturn float64 `json:"avg_skip_return"` // what WAIT/PASS answers passed up
+	AvgConfidence float64 `json:"avg_confidence"`
+	Evaluated     int     `json:"evaluated"`
+	EvalAllowRate float64 `json:"eval_allow_rate"`
+	EvalBlockRate float64 `json:"eval_block_rate"`
+}
+
+// AgentEvalReport is written to report.json.
+type AgentEvalReport struct {
+	Agent       string             `json:"agent"`
+	AgentName   string             `json:"agent_name"`
+	Horizon     int                `json:"horizon"`
+	Inputs      int                `json:"inputs"`
+	GeneratedAt string             `json:"generated_at"`
+	Summary     []AgentEvalSummary `json:"summary"`
+	Rows        []*AgentEvalRow    `json:"rows"`
+}
+
+// recordedInput is one replayable input and where it came from.
+type recordedInput struct {
+	path string
+	in   sapien.ManagerInput
+}
+
+// RunAgentEval replays the recorded inputs against every version in
+// cfg.Versions and writes rows.csv, summary.csv and report.json under
+// OutputDir.
+func RunAgentEval(cfg AgentEvalConfig) (*AgentEvalReport, error) {
+	if cfg.Agent == "" {
+		cfg.Agent = EvalAgentManager
+	}
+	if len(cfg.Versions) == 0 {
+		cfg.Versions = []string{""}
+	}
+	if cfg.InputsDir == "" {
+		cfg.InputsDir = "responses"
+	}
+	if cfg.RawDir == "" {
+		cfg.RawDir = "data"
+	}
+	if cfg.Horizon == 0 {
+		cfg.Horizon = 1
+	}
+	if cfg.OutputDir == "" {
+		cfg.OutputDir = "data/backtests/agent_eval"
+	}
+	if cfg.Horizon < 1 {
+		return nil, fmt.Errorf("horizon must be at least 1 session, got %d", cfg.Horizon)
+	}
+	agentName := map[string]string{
+		EvalAgentManager:  sapien.EpCerebrasManagerAgent,
+		EvalAgentNews:     sapien.EpNewsAgent,
+		EvalAgentEarnings: sapien.EpEarningsReportAgent,
+	}[cfg.Agent]
+	if agentName == "" {
+		return nil, fmt.Errorf("unknown agent %q (want %s, %s or %s)",
+			cfg.Agent, EvalAgentManager, EvalAgentNews, EvalAgentEarnings)
+	}
+
+	est, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load EST timezone: %v", err)
+	}
+
+	logger, err := InitLogger("data/backtests/logs", "agent_eval")
+	if err != nil {
+		fmt.Printf("⚠️  Could not create log file: %v\n", err)
+	} else {
+		defer logger.Close()
+	}
+
+	inputs, err := loadRecordedInputs(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("no recorded inputs under %s", cfg.InputsDir)
+	}
+
+	LogSection("AGENT EVALUATION")
+	LogInfo("EVAL", "Agent          : %s (%s)", cfg.Agent, agentName)
+	LogInfo("EVAL", "Versions       : %s", strings.Join(versionLabels(cfg.Versions), ", "))
+	LogInfo("EVAL", "Inputs         : %d from %s", len(inputs), cfg.InputsDir)
+	LogInfo("EVAL", "Horizon        : %d sessions", cfg.Horizon)
+
+	provider, err := newCachedMarketDataProvider(AlpacaConfig{
+		APIKey:    cfg.AlpacaKey,
+		APISecret: cfg.AlpacaSecret,
+		BaseURL:   "https://paper-api.alpaca.markets",
+		DataURL:   "https://data.alpaca.markets",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	var rows []*AgentEvalRow
+	for i, ri := range inputs {
+		LogProgress("EVAL", i+1, len(inputs), ri.in.Symbol+" "+ri.in.BarTime)
+		bars, err := forwardSessions(provider, ri.in.Symbol, ri.in.Date, cfg.Horizon, est)
+		if err != nil {
+			LogWarn("EVAL", ri.in.Symbol, "%s: no forward return: %v", ri.in.Date, err)
+		}
+		for _, version := range cfg.Versions {
+			rows = append(rows, evalOne(ctx, cfg, agentName, version, ri, bars))
+		}
+	}
+
+	report := &AgentEvalReport{
+		Agent:       cfg.Agent,
+		AgentName:   agentName,
+		Horizon:     cfg.Horizon,
+		Inputs:      len(inputs),
+		GeneratedAt: time.Now().Format(time.RFC3339),
+		Summary:     summarizeAgentEval(cfg.Versions, rows),
+		Rows:        rows,
+	}
+	if err := writeAgentEvalReport(cfg, report); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// loadRecordedInputs reads every <date>/<symbol>/minute_*_input.json under
+// cfg.InputsDir in the date range, oldest first, keeping the most recent
+// MaxInputs.  Undated <symbol>/minute_*_input.json files from older runs are
+// still read.
+func loadRecordedInputs(cfg AgentEvalConfig) ([]recordedInput, error) {
+	paths, err := filepath.Glob(filepath.Join(cfg.InputsDir, "*", "*", "minute_*_input.json"))
+	if err != nil {
+		return nil, err
+	}
+	undated, err := filepath.Glob(filepath.Join(cfg.InputsDir, "*", "minute_*_input.json"))
+	if err != nil {
+		return nil, err
+	}
+	paths = append(paths, undated...)
+	var out []recordedInput
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		var in sapien.ManagerInput
+		if err := json.Unmarshal(data, &in); err != nil {
+			LogWarn("EVAL", filepath.Base(filepath.Dir(path)), "skipping %s: %v", path, err)
+			continue
+		}
+		if in.Symbol == "" || in.Date == "" {
+			continue
+		}
+		if (cfg.StartDate != "" && in.Date < cfg.StartDate) || (cfg.EndDate != "" && in.Date > cfg.EndDate) {
+			continue
+		}
+		out = append(out, recordedInput{path: path, in: in})
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].in.BarTime != out[j].in.BarTime {
+			return out[i].in.BarTime < out[j].in.BarTime
+		}
+		return out[i].in.Symbol < out[j].in.Symbol
+	})
+	if cfg.MaxInputs > 0 && len(out) > cfg.MaxInputs {
+		out = out[len(out)-cfg.MaxInputs:]
+	}
+	return out, nil
+}
+
+// evalOne asks one version about one input and scores the answer.
+func evalOne(ctx context.Context, cfg AgentEvalConfig, agentName, version string, ri recordedInput, bars []marketdata.Bar) *AgentEvalRow {
+	in := ri.in
+	row := &AgentEvalRow{
+		Version: versionLabel(version),
+		Input:   ri.path,
+		Symbol:  in.Symbol,
+		Date:    in.Date,
+		BarTime: in.BarTime,
+	}
+
+	// The run Sapien grades: the agent under test's inputs and output.
+	var evalInput []spec.NameValueTypeV3
+	var evalOutput spec.NameValueTypeV3
+	news, earnings := in.News, in.EarningsReport
+
+	switch cfg.Agent {
+	case EvalAgentNews, EvalAgentEarnings:
+		file, pastFile, first, second := "news_report.txt", "pre_gap_news_report.txt", "ep_news", "ep_past_news"
+		if cfg.Agent == EvalAgentEarnings {
+			file, pastFile, first, second = "earnings_report.txt", "historical_earnings_report.txt", "ep_earnings", "ep_past_earnings"
+		}
+		current, past, err := readRawReport(cfg.RawDir, in.Date, in.Symbol, file, pastFile)
+		if err != nil {
+			row.Error = err.Error()
+			return row
+		}
+		var report string
+		if cfg.Agent == EvalAgentNews {
+			report, err = sapien.NewsReport(ctx, version, current, past)
+			news = report
+		} else {
+			report, err = sapien.EarningsReport(ctx, version, current, past)
+			earnings = report
+		}
+		if err != nil {
+			row.Error = err.Error()
+			return row
+		}
+		evalInput = []spec.NameValueTypeV3{{Name: first, Value: current}, {Name: second, Value: past}}
+		evalOutput = spec.NameValueTypeV3{Name: spec.DefaultResponseName, Value: report}
+	}
+
+	managerVersion := version
+	if cfg.Agent != EvalAgentManager {
+		managerVersion = ""
+	}
+	d, err := sapien.ManagerAgentDecisionVersion(ctx, managerVersion, in.StockData, news, earnings, in.Sentiment)
+	if err != nil {
+		row.Error = err.Error()
+		return row
+	}
+	row.Action, row.Confidence, row.EntryPrice = string(d.Action), d.Confidence, d.EntryPrice
+
+	if cfg.Agent == EvalAgentManager {
+		evalInput = []spec.NameValueTypeV3{
+			{Name: "stock_data", Value: in.StockData},
+			{Name: "news", Value: news},
+			{Name: "earnings_report", Value: earnings},
+			{Name: "stock_sentiment", Value: in.Sentiment},
+		}
+		out, _ := json.Marshal(d)
+		evalOutput = spec.NameValueTypeV3{
+			Name:   "decision",
+			Type:   "json",
+			Format: "application/json",
+			Schema: sapien.ManagerDecisionSchema,
+			Value:  string(out),
+		}
+	}
+
+	ref := in.LastPrice
+	if d.Action == sapien.ActionBuy {
+		ref = d.EntryPrice
+	}
+	if ref <= 0 && len(bars) > 0 {
+		ref = bars[0].Open
+	}
+	if len(bars) >= cfg.Horizon && ref > 0 {
+		row.Return = bars[cfg.Horizon-1].Close/ref - 1
+		row.HasReturn = true
+		row.Hit = (d.Action == sapien.ActionBuy) == (row.Return > 0)
+	}
+
+	if !cfg.SkipEval {
+		verdict, err := spec.EvalContext(ctx, &spec.ServeEvalRequestSpecV3{
+			AgentName:    agentName,
+			AgentVersion: version,
+			Input:        evalInput,
+			Output:       []spec.NameValueTypeV3{evalOutput},
+		})
+		if err != nil {
+			LogWarn("EVAL", in.Symbol, "%s eval: %v", row.Version, err)
+		} else {
+			row.Verdict, row.VerdictReason = string(verdict.Decision), verdict.Reason
+		}
+	}
+	return row
+}
+
+// readRawReport reads the raw file and its history for symbol, preferring
+// <rawDir>/<date>/<symbol> to <rawDir>/<symbol>.
+func readRawReport(rawDir, date, symbol, file, pastFile string) (current, past string, err error) {
+	dir := filepath.Join(rawDir, date, symbol)
+	if _, err := os.Stat(dir); err != nil {
+		dir = filepath.Join(rawDir, symbol)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, file))
+	if err != nil {
+		return "", "", fmt.Errorf("no raw %s: %w", file, err)
+	}
+	pastData, _ := os.ReadFile(filepath.Join(dir, pastFile))
+	return string(data), string(pastData), nil
+}
+
+func summarizeAgentEval(versions []string, rows []*AgentEvalRow) []AgentEvalSummary {
+	var out []AgentEvalSummary
+	for _, v := range versions {
+		s := AgentEvalSummary{Version: versionLabel(v)}
+		var hits, buyWins, buysScored, skipsScored, allow, block int
+		var buyRet, skipRet, conf float64
+		for _, r := range rows {
+			if r.Version != s.Version {
+				continue
+			}
+			s.Inputs++
+			if r.Verdict != "" {
+				s.Evaluated++
+				switch spec.Decision(r.Verdict) {
+				case spec.DecisionAllow:
+					allow++
+				case spec.DecisionBlock:
+					block++
+				}
+			}
+			if r.Error != "" {
+				continue
+			}
+			s.Valid++
+			conf += r.Confidence
+			buy := r.Action == string(sapien.ActionBuy)
+			if buy {
+				s.Buys++
+			}
+			if !r.HasReturn {
+				continue
+			}
+			s.Scored++
+			if r.Hit {
+				hits++
+			}
+			if buy {
+				buysScored++
+				buyRet += r.Return
+				if r.Return > 0 {
+					buyWins++
+				}
+			} else {
+				skipsScored++
+				skipRet += r.Return
+			}
+		}
+		ratio := func(n, d int) float64 {
+			if d == 0 {
+				return 0
+			}
+			return float64(n) / float64(d)
+		}
+		s.HitRate = ratio(hits, s.Scored)
+		s.BuyWinRate = ratio(buyWins, buysScored)
+		if buysScored > 0 {
+			s.AvgBuyReturn = buyRet / float64(buysScored)
+		}
+		if skipsScored > 0 {
+			s.AvgSkipReturn = skipRet / float64(skipsScored)
+		}
+		if s.Valid > 0 {
+			s.AvgConfidence = conf / float64(s.Valid)
+		}
+		s.EvalAllowRate = ratio(allow, s.Evaluated)
+		s.EvalBlockRate = ratio(block, s.Evaluated)
+		out = append(out, s)
+	}
+	return out
+}
+
+// PrintAgentEvalTable writes the version comparison as an aligned table.
+func PrintAgentEvalTable(w io.Writer, summary []AgentEvalSummary) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "VERSION\tINPUTS\tVALID\tBUYS\tHIT\tBUY WIN\tAVG BUY\tAVG SKIP\tCONF\tEVAL ALLOW\tEVAL BLOCK\t")
+	for _, s := range summary {
+		fmt.Fprintf(tw, "%s\t%d\t%.0f%%\t%d\t%.0f%%\t%.0f%%\t%+.2f%%\t%+.2f%%\t%.2f\t%.0f%%\t%.0f%%\t\n",
+			s.Version, s.Inputs, pctOf(s.Valid, s.Inputs), s.Buys, s.HitRate*100, s.BuyWinRate*100,
+			s.AvgBuyReturn*100, s.AvgSkipReturn*100, s.AvgConfidence, s.EvalAllowRate*100, s.EvalBlockRate*100)
+	}
+	tw.Flush()
+}
+
+func pctOf(n, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d) * 100
+}
+
+func versionLabel(v string) string {
+	if v == "" {
+		return "default"
+	}
+	return v
+}
+
+func versionLabels(vs []string) []string {
+	out := make([]string, len(vs))
+	for i, v := range vs {
+		out[i] = versionLabel(v)
+	}
+	return out
+}
+
+func writeAgentEvalReport(cfg AgentEvalConfig, report *AgentEvalReport) error {
+	if err := os.MkdirAll(cfg.OutputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	pct := func(v float64) string { return fmt.Sprintf("%.4f", v) }
+
+	rows := [][]string{{"Version", "Date", "BarTime", "Symbol", "Action", "Confidence", "EntryPrice",
+		fmt.Sprintf("Return_%dd", report.Horizon), "Hit", "Verdict", "VerdictReason", "Error", "Input"}}
+	for _, r := range report.Rows {
+		ret := ""
+		if r.HasReturn {
+			ret = pct(r.Return)
+		}
+		rows = append(rows, []string{r.Version, r.Date, r.BarTime, r.Symbol, r.Action,
+			fmt.Sprintf("%.2f", r.Confidence), fmt.Sprintf("%.2f", r.EntryPrice), ret,
+			strconv.FormatBool(r.Hit), r.Verdict, r.VerdictReason, r.Error, r.Input})
+	}
+	if err := writeCSVFile(filepath.Join(cfg.OutputDir, "rows.csv"), rows); err != nil {
+		return err
+	}
+
+	rows = [][]string{{"Version", "Inputs", "Valid", "Buys", "Scored", "HitRate", "BuyWinRate",
+		"AvgBuyReturn", "AvgSkipReturn", "AvgConfidence", "Evaluated", "EvalAllowRate", "EvalBlockRate"}}
+	for _, s := range report.Summary {
+		rows = append(rows, []string{s.Version, strconv.Itoa(s.Inputs), strconv.Itoa(s.Valid),
+			strconv.Itoa(s.Buys), strconv.Itoa(s.Scored), pct(s.HitRate), pct(s.BuyWinRate),
+			pct(s.AvgBuyReturn), pct(s.AvgSkipReturn), fmt.Sprintf("%.2f", s.AvgConfidence),
+			strconv.Itoa(s.Evaluated), pct(s.EvalAllowRate), pct(s.EvalBlockRate)})
+	}
+	if err := writeCSVFile(filepath.Join(cfg.OutputDir, "summary.csv"), rows); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal report: %w", err)
+	}
+	return os.WriteFile(filepath.Join(cfg.OutputDir, "report.json"), data, 0644)
+}
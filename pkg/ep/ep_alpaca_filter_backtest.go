@@ -1,6 +1,7 @@
 package ep
 
 import (
+	"avantai/pkg/marketdata"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
@@ -26,6 +27,8 @@ type BacktestConfig struct {
 	FinnhubSecret string // Finnhub secret key
 	TiingoKey     string // Optional - for premarket data if needed
 	LookbackDays  int    // Days of historical data to fetch (default: 300)
+	// Filter thresholds; zero means DefaultFilterParams
+	Filters FilterParams `json:"-"`
 }
 
 // CompanyInfo holds basic company information
@@ -197,25 +200,11 @@ type QuarterlyResult struct {
 	Beat        bool    `json:"beat"`
 }
 
-// Constants for filtering criteria
+// Constants for the scan itself.  Filter thresholds live in FilterParams.
 const (
-	MIN_GAP_UP_PERCENT = 8.0
-	MIN_STOCK_PRICE    = 3.00
-	MIN_DOLLAR_VOLUME  = 10000000 // $10M
-	MIN_MARKET_CAP     = 50000000 // $50M
-
-	// FIX: was 2.0 — strategy requires 3–5x average daily premarket volume
-	MIN_PREMARKET_VOL_RATIO = 3.0
-
-	// FIX: Added minimum premarket vol as % of avg daily volume (strategy: 10–20%)
-	MIN_PREMARKET_VOL_PCT_OF_DAILY = 10.0
-
-	MAX_EXTENSION_ADR      = 4.0
-	TOO_EXTENDED_ADR       = 8.0
-	NEAR_EMA_ADR_THRESHOLD = 2.0 // FIX: strategy says "within 2 ADRs" — was 1.5
-	MIN_ADR_PERCENT        = 5.0
-	MAX_CONCURRENT         = 166
-	API_CALLS_PER_SECOND   = 166
+	MIN_ADR_PERCENT      = 5.0
+	MAX_CONCURRENT       = 166
+	API_CALLS_PER_SECOND = 166
 
 	// Number of prior quarters to evaluate for earnings reaction history
 	EARNINGS_LOOKBACK_QUARTERS = 4
@@ -306,17 +295,23 @@ func FilterStocksEpisodicPivotBacktest(config BacktestConfig) error {
 		config.LookbackDays = 300
 		LogInfo("INIT", "Using default lookback period: %d days", config.LookbackDays)
 	}
+	config.Filters = config.Filters.orDefault()
+	if err := config.Filters.Validate(); err != nil {
+		return fmt.Errorf("invalid filter params: %v", err)
+	}
+	params := config.Filters
 
 	LogSubSection("Configuration Summary")
 	LogInfo("INIT", "Target Date    : %s", config.TargetDate)
 	LogInfo("INIT", "Lookback Period: %d days", config.LookbackDays)
 	LogInfo("INIT", "Alpaca Key     : %s...", config.AlpacaKey[:min(10, len(config.AlpacaKey))])
 	LogInfo("INIT", "Finnhub Key    : %s...", config.FinnhubKey[:min(10, len(config.FinnhubKey))])
+	LogFilterParams("INIT", params)
 
 	// ── Stage 1: Gap Up ────────────────────────────────────────────────────
-	LogSection(fmt.Sprintf("STAGE 1 — Gap Up Filter (min %.0f%%)", MIN_GAP_UP_PERCENT))
+	LogSection(fmt.Sprintf("STAGE 1 — Gap Up Filter (min %.0f%%)", params.MinGapUpPercent))
 	t0 := time.Now()
-	gapUpStocks, err := backtestStage1GapUp(config)
+	gapUpStocks, err := backtestStage1GapUp(config, params)
 	if err != nil {
 		LogError("S1", "", "Stage 1 failed: %v", err)
 		return fmt.Errorf("error in Stage 1 backtest: %v", err)
@@ -329,9 +324,9 @@ func FilterStocksEpisodicPivotBacktest(config BacktestConfig) error {
 	}
 
 	// ── Stage 2: Liquidity ─────────────────────────────────────────────────
-	LogSection(fmt.Sprintf("STAGE 2 — Liquidity Filter (min market cap $%dM)", MIN_MARKET_CAP/1_000_000))
+	LogSection(fmt.Sprintf("STAGE 2 — Liquidity Filter (min market cap $%.0fM)", params.MinMarketCap/1_000_000))
 	t0 = time.Now()
-	liquidStocks, err := backtestStage2Liquidity(config, gapUpStocks)
+	liquidStocks, err := backtestStage2Liquidity(config, params, gapUpStocks)
 	if err != nil {
 		LogError("S2", "", "Stage 2 failed: %v", err)
 		return fmt.Errorf("error in Stage 2 backtest: %v", err)
@@ -341,7 +336,7 @@ func FilterStocksEpisodicPivotBacktest(config BacktestConfig) error {
 	// ── Stage 3: Technical ─────────────────────────────────────────────────
 	LogSection("STAGE 3 — Technical Analysis")
 	t0 = time.Now()
-	technicalStocks, err := backtestStage3Technical(config, liquidStocks)
+	technicalStocks, err := backtestStage3Technical(config, params, liquidStocks)
 	if err != nil {
 		LogError("S3", "", "Stage 3 failed: %v", err)
 		return fmt.Errorf("error in Stage 3 backtest: %v", err)
@@ -351,7 +346,7 @@ func FilterStocksEpisodicPivotBacktest(config BacktestConfig) error {
 	// ── Stage 4: Final Filter ──────────────────────────────────────────────
 	LogSection("STAGE 4 — Final Episodic Pivot Criteria")
 	t0 = time.Now()
-	finalStocks := backtestStage4Final(technicalStocks)
+	finalStocks := backtestStage4Final(params, technicalStocks)
 	LogStageSummary("S4", len(finalStocks), len(technicalStocks), time.Since(t0))
 
 	// ── Output ─────────────────────────────────────────────────────────────
@@ -369,7 +364,7 @@ func FilterStocksEpisodicPivotBacktest(config BacktestConfig) error {
 // Stage 1: Gap Up Filter
 // ─────────────────────────────────────────────────────────────────────────────
 
-func backtestStage1GapUp(config BacktestConfig) ([]StockData, error) {
+func backtestStage1GapUp(config BacktestConfig, params FilterParams) ([]StockData, error) {
 	LogInfo("S1", "Fetching tradable symbols from Alpaca...")
 	symbols, err := getAlpacaTradableSymbols(config)
 	if err != nil {
@@ -377,7 +372,7 @@ func backtestStage1GapUp(config BacktestConfig) ([]StockData, error) {
 	}
 	LogInfo("S1", "Retrieved %d tradable symbols", len(symbols))
 	LogInfo("S1", "Criteria: Gap Up >= %.0f%%  |  Concurrency: %d  |  Rate: %d/s",
-		MIN_GAP_UP_PERCENT, MAX_CONCURRENT, API_CALLS_PER_SECOND)
+		params.MinGapUpPercent, MAX_CONCURRENT, API_CALLS_PER_SECOND)
 
 	var gapUpStocks []StockData
 	var mu sync.Mutex
@@ -433,7 +428,7 @@ func backtestStage1GapUp(config BacktestConfig) ([]StockData, error) {
 				currentData.Timestamp[:10], previousData.Timestamp[:10],
 				currentData.Open, previousData.Close, gapUp)
 
-			if gapUp >= MIN_GAP_UP_PERCENT {
+			if gapUp >= params.MinGapUpPercent {
 				stockData := StockData{
 					Symbol:                     sym,
 					Timestamp:                  currentData.Timestamp,
@@ -459,7 +454,7 @@ func backtestStage1GapUp(config BacktestConfig) ([]StockData, error) {
 				gapUpStocks = append(gapUpStocks, stockData)
 				mu.Unlock()
 			} else {
-				LogReject("S1", sym, fmt.Sprintf("Gap=%.2f%% < %.0f%% minimum", gapUp, MIN_GAP_UP_PERCENT))
+				LogReject("S1", sym, fmt.Sprintf("Gap=%.2f%% < %.0f%% minimum", gapUp, params.MinGapUpPercent))
 			}
 		}(symbol)
 	}
@@ -473,7 +468,7 @@ func backtestStage1GapUp(config BacktestConfig) ([]StockData, error) {
 // Stage 2: Liquidity Filter
 // ─────────────────────────────────────────────────────────────────────────────
 
-func backtestStage2Liquidity(config BacktestConfig, stocks []StockData) ([]BacktestResult, error) {
+func backtestStage2Liquidity(config BacktestConfig, params FilterParams, stocks []StockData) ([]BacktestResult, error) {
 	var liquidStocks []BacktestResult
 	rateLimiter := time.Tick(time.Second / 30) // Slower rate for Finnhub company profile calls
 
@@ -512,7 +507,7 @@ func backtestStage2Liquidity(config BacktestConfig, stocks []StockData) ([]Backt
 		}
 
 		marketCapM := marketCap / 1_000_000
-		minCapM := float64(MIN_MARKET_CAP) / 1_000_000
+		minCapM := params.MinMarketCap / 1_000_000
 
 		LogMetrics("S2", stock.Symbol, map[string]interface{}{
 			"market_cap_m":   fmt.Sprintf("$%.2fM", marketCapM),
@@ -523,7 +518,7 @@ func backtestStage2Liquidity(config BacktestConfig, stocks []StockData) ([]Backt
 			"gap_up_pct":     fmt.Sprintf("%.2f%%", stock.ExtendedHoursChangePercent),
 		})
 
-		if marketCap >= MIN_MARKET_CAP {
+		if marketCap >= params.MinMarketCap {
 			backtestResult := BacktestResult{
 				FilteredStock: FilteredStock{
 					Symbol: stock.Symbol,
@@ -556,19 +551,24 @@ func backtestStage2Liquidity(config BacktestConfig, stocks []StockData) ([]Backt
 // Stage 3: Technical Analysis
 // ─────────────────────────────────────────────────────────────────────────────
 
-func backtestStage3Technical(config BacktestConfig, stocks []BacktestResult) ([]BacktestResult, error) {
+func backtestStage3Technical(config BacktestConfig, params FilterParams, stocks []BacktestResult) ([]BacktestResult, error) {
 	var technicalStocks []BacktestResult
 	rateLimiter := time.Tick(time.Second / API_CALLS_PER_SECOND)
 
 	LogInfo("S3", "Analyzing technical indicators for %d stocks", len(stocks))
 
+	provider, err := newCachedMarketDataProvider(AlpacaConfig{APIKey: config.AlpacaKey, APISecret: config.AlpacaSecret})
+	if err != nil {
+		return nil, err
+	}
+
 	for i, stock := range stocks {
 		LogDebug("S3", stock.Symbol, "[%d/%d] Fetching %d days of historical data",
 			i+1, len(stocks), config.LookbackDays)
 		<-rateLimiter
 
 		historicalData, err := getHistoricalDataUpToDateAlpaca(
-			config.AlpacaKey, config.AlpacaSecret, stock.Symbol, config.TargetDate, config.LookbackDays)
+			provider, stock.Symbol, config.TargetDate, config.LookbackDays)
 		if err != nil {
 			LogWarn("S3", stock.Symbol, "Historical data error: %v", err)
 			stock.ValidationNotes = append(stock.ValidationNotes,
@@ -590,7 +590,7 @@ func backtestStage3Technical(config BacktestConfig, stocks []BacktestResult) ([]
 		stock.HistoricalDays = len(historicalData)
 
 		technicalIndicators, err := calculateTechnicalIndicatorsBacktest(
-			historicalData, stock.Symbol, config.TargetDate)
+			params, historicalData, stock.Symbol, config.TargetDate)
 		if err != nil {
 			LogWarn("S3", stock.Symbol, "Technical indicators error: %v", err)
 			stock.ValidationNotes = append(stock.ValidationNotes,
@@ -666,7 +666,7 @@ func backtestStage3Technical(config BacktestConfig, stocks []BacktestResult) ([]
 //      which were previously calculated but never used as filters.
 // ─────────────────────────────────────────────────────────────────────────────
 
-func backtestStage4Final(stocks []BacktestResult) []BacktestResult {
+func backtestStage4Final(params FilterParams, stocks []BacktestResult) []BacktestResult {
 	var finalStocks []BacktestResult
 
 	LogInfo("S4", "Applying final episodic pivot criteria to %d stocks", len(stocks))
@@ -683,20 +683,20 @@ func backtestStage4Final(stocks []BacktestResult) []BacktestResult {
 		criteria := []criterion{
 			{
 				"Dollar Volume",
-				stock.StockInfo.DolVol >= MIN_DOLLAR_VOLUME,
-				fmt.Sprintf("$%.0fM >= $%.0fM", stock.StockInfo.DolVol/1000000.0, MIN_DOLLAR_VOLUME/1000000.0),
+				stock.StockInfo.DolVol >= params.MinDollarVolume,
+				fmt.Sprintf("$%.0fM >= $%.0fM", stock.StockInfo.DolVol/1000000.0, params.MinDollarVolume/1000000.0),
 			},
 			{
-				// FIX: threshold raised from 2.0x to MIN_PREMARKET_VOL_RATIO (5.0x)
+				// FIX: threshold raised from 2.0x to MinPremarketVolRatio
 				"Premarket Vol Ratio",
-				stock.StockInfo.PremarketVolumeRatio >= MIN_PREMARKET_VOL_RATIO,
-				fmt.Sprintf("%.2fx >= %.1fx (gap-day vs avg daily volume proxy)", stock.StockInfo.PremarketVolumeRatio, MIN_PREMARKET_VOL_RATIO),
+				stock.StockInfo.PremarketVolumeRatio >= params.MinPremarketVolRatio,
+				fmt.Sprintf("%.2fx >= %.1fx (gap-day vs avg daily volume proxy)", stock.StockInfo.PremarketVolumeRatio, params.MinPremarketVolRatio),
 			},
 			{
 				// FIX: was never enforced — strategy requires 20–50% of avg daily vol
 				"Premarket Vol % of Daily",
-				stock.StockInfo.PremarketVolAsPercent >= MIN_PREMARKET_VOL_PCT_OF_DAILY,
-				fmt.Sprintf("%.2f%% >= %.0f%% of avg daily volume", stock.StockInfo.PremarketVolAsPercent, MIN_PREMARKET_VOL_PCT_OF_DAILY),
+				stock.StockInfo.PremarketVolAsPercent >= params.MinPremarketVolPctOfDaily,
+				fmt.Sprintf("%.2f%% >= %.0f%% of avg daily volume", stock.StockInfo.PremarketVolAsPercent, params.MinPremarketVolPctOfDaily),
 			},
 			{
 				"Above 200 EMA",
@@ -706,13 +706,13 @@ func backtestStage4Final(stocks []BacktestResult) []BacktestResult {
 			{
 				"Not Extended",
 				!stock.StockInfo.IsExtended,
-				fmt.Sprintf("dist=%.2f ADRs (max %.1f)", stock.StockInfo.DistanceFrom50EMA, MAX_EXTENSION_ADR),
+				fmt.Sprintf("dist=%.2f ADRs (max %.1f)", stock.StockInfo.DistanceFrom50EMA, params.MaxExtensionADR),
 			},
 			{
 				// FIX: was calculated but never filtered on — strategy: price near 10/20 EMA within 2 ADRs
 				"Near 10/20 EMA",
 				stock.StockInfo.IsNearEMA1020,
-				fmt.Sprintf("within %.1f ADRs of EMA10 or EMA20", NEAR_EMA_ADR_THRESHOLD),
+				fmt.Sprintf("within %.1f ADRs of EMA10 or EMA20", params.NearEMAADRThreshold),
 			},
 			{
 				// FIX: VolumeDriedUp was in the struct but never evaluated
@@ -735,7 +735,7 @@ func backtestStage4Final(stocks []BacktestResult) []BacktestResult {
 
 		if stock.StockInfo.IsTooExtended {
 			LogDebug("S4", stock.Symbol, "❌ FAIL  Too Extended — %.2f ADRs > %.1f",
-				stock.StockInfo.DistanceFrom50EMA, TOO_EXTENDED_ADR)
+				stock.StockInfo.DistanceFrom50EMA, params.TooExtendedADR)
 			allPassed = false
 		}
 
@@ -749,7 +749,7 @@ func backtestStage4Final(stocks []BacktestResult) []BacktestResult {
 		} else {
 			reason := "Failed one or more criteria"
 			if stock.StockInfo.IsTooExtended {
-				reason = fmt.Sprintf("Too extended (%.2f ADRs > %.1f max)", stock.StockInfo.DistanceFrom50EMA, TOO_EXTENDED_ADR)
+				reason = fmt.Sprintf("Too extended (%.2f ADRs > %.1f max)", stock.StockInfo.DistanceFrom50EMA, params.TooExtendedADR)
 			}
 			LogReject("S4", stock.Symbol, reason)
 		}
@@ -838,62 +838,26 @@ func getHistoricalDataForDateAlpaca(apiKey, apiSecret, symbol, targetDate string
 	return currentData, previousData, nil
 }
 
-func getHistoricalDataUpToDateAlpaca(apiKey, apiSecret, symbol, targetDate string, lookbackDays int) ([]AlpacaBarData, error) {
+func getHistoricalDataUpToDateAlpaca(provider marketdata.Provider, symbol, targetDate string, lookbackDays int) ([]AlpacaBarData, error) {
 	target, err := time.Parse("2006-01-02", targetDate)
 	if err != nil {
 		return nil, err
 	}
 
-	startDate := target.AddDate(0, 0, -(lookbackDays + 100)).Format("2006-01-02")
+	start := target.AddDate(0, 0, -(lookbackDays + 100))
 
-	url := fmt.Sprintf(
-		"https://data.alpaca.markets/v2/stocks/%s/bars?start=%s&end=%s&timeframe=1Day&adjustment=split&feed=sip&limit=10000",
-		symbol, startDate, targetDate)
-
-	req, err := http.NewRequest("GET", url, nil)
+	bars, err := provider.DailyBars(symbol, start, target, marketdata.AdjustmentSplit)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Add("APCA-API-KEY-ID", apiKey)
-	req.Header.Add("APCA-API-SECRET-KEY", apiSecret)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+	LogDebug("API", symbol, "getHistoricalDataUpToDate provider=%s bars=%d", provider.Name(), len(bars))
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	LogDebug("API", symbol, "getHistoricalDataUpToDate status=%d bars_preview=%s",
-		resp.StatusCode, string(body[:min(120, len(body))]))
-
-	var barsResponse AlpacaBarsResponse
-	if err := json.Unmarshal(body, &barsResponse); err != nil {
-		return nil, fmt.Errorf("failed to parse JSON: %v", err)
-	}
-
-	if len(barsResponse.Bars) == 0 {
+	if len(bars) == 0 {
 		return nil, fmt.Errorf("no bars data for symbol %s", symbol)
 	}
 
-	var filteredData []AlpacaBarData
-	for _, bar := range barsResponse.Bars {
-		barTime, err := time.Parse(time.RFC3339, bar.Timestamp)
-		if err != nil {
-			continue
-		}
-		if barTime.Before(target.AddDate(0, 0, 1)) {
-			filteredData = append(filteredData, AlpacaBarData{
-				Symbol: symbol, Timestamp: bar.Timestamp,
-				Open: bar.Open, High: bar.High, Low: bar.Low, Close: bar.Close, Volume: bar.Volume,
-			})
-		}
-	}
+	filteredData := toAlpacaBarData(symbol, bars)
 
 	LogDebug("API", symbol, "Filtered to %d bars up to %s", len(filteredData), targetDate)
 	return filteredData, nil
@@ -1925,7 +1889,7 @@ func abs(x float64) float64 {
 //
 // FIX (VolumeDriedUp): 20-day avg volume vs 60-day avg volume comparison is now
 // calculated here and returned in TechnicalIndicators.
-func calculateTechnicalIndicatorsBacktest(historicalData []AlpacaBarData, symbol, targetDate string) (*TechnicalIndicators, error) {
+func calculateTechnicalIndicatorsBacktest(params FilterParams, historicalData []AlpacaBarData, symbol, targetDate string) (*TechnicalIndicators, error) {
 	if len(historicalData) < 200 {
 		return nil, fmt.Errorf("insufficient data for technical indicators")
 	}
@@ -1979,7 +1943,7 @@ func calculateTechnicalIndicatorsBacktest(historicalData []AlpacaBarData, symbol
 		distanceFrom20EMA = abs(currentPrice-ema20) / adrValue
 	}
 	// FIX: threshold updated to 2.0 ADRs to match strategy document ("within 2 ADRs")
-	isNearEMA1020 := (distanceFrom10EMA <= NEAR_EMA_ADR_THRESHOLD) || (distanceFrom20EMA <= NEAR_EMA_ADR_THRESHOLD)
+	isNearEMA1020 := (distanceFrom10EMA <= params.NearEMAADRThreshold) || (distanceFrom20EMA <= params.NearEMAADRThreshold)
 
 	breaksResistance := false
 	if len(dataUpToTarget) >= 20 {
@@ -2019,8 +1983,8 @@ func calculateTechnicalIndicatorsBacktest(historicalData []AlpacaBarData, symbol
 		EMA10:             ema10,
 		IsAbove200EMA:     currentPrice > ema200,
 		DistanceFrom50EMA: distanceFrom50EMA,
-		IsExtended:        distanceFrom50EMA > MAX_EXTENSION_ADR,
-		IsTooExtended:     distanceFrom50EMA > TOO_EXTENDED_ADR,
+		IsExtended:        distanceFrom50EMA > params.MaxExtensionADR,
+		IsTooExtended:     distanceFrom50EMA > params.TooExtendedADR,
 		IsNearEMA1020:     isNearEMA1020,
 		BreaksResistance:  breaksResistance,
 		VolumeDriedUp:     volumeDriedUp,
@@ -2226,13 +2190,7 @@ func outputBacktestResults(config BacktestConfig, stocks []BacktestResult) error
 			"target_date":   config.TargetDate,
 			"lookback_days": config.LookbackDays,
 		},
-		"filter_criteria": map[string]interface{}{
-			"min_gap_up_percent":         MIN_GAP_UP_PERCENT,
-			"min_dollar_volume":          MIN_DOLLAR_VOLUME,
-			"min_market_cap":             MIN_MARKET_CAP,
-			"min_premarket_volume_ratio": MIN_PREMARKET_VOL_RATIO,
-			"max_extension_adr":          MAX_EXTENSION_ADR,
-		},
+		"filter_criteria":   config.Filters,
 		"qualifying_stocks": stocks,
 		"backtest_summary": map[string]interface{}{
 			"total_candidates":          len(stocks),
@@ -2400,7 +2358,7 @@ func RunMultipleDateBacktests(alpacaKey, alpacaSecret, finnhubKey string, dates
 			LookbackDays: 300,
 		}
 
-		gapUpStocks, err := backtestStage1GapUp(config)
+		gapUpStocks, err := backtestStage1GapUp(config, config.Filters.orDefault())
 		if err != nil {
 			LogError("MULTI", "", "Error backtesting %s: %v", date, err)
 			results[date] = 0
@@ -1,6 +1,8 @@
 package ep
 
 import (
+	"avantai/pkg/marketdata"
+	"avantai/pkg/replay"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
@@ -22,6 +24,7 @@ type AlpacaConfig struct {
 	DataURL    string // "https://data.alpaca.markets"
 	IsPaper    bool
 	FinnhubKey string
+	Filters    FilterParams // zero means DefaultFilterParams
 }
 
 // AlpacaBar represents a single bar from Alpaca
@@ -70,7 +73,8 @@ type RealtimeResult struct {
 	// GapUsedPrice carried from Stage 1 so Stage 3 can use it as currentPrice
 	// for EMA distance calculations instead of yesterday's close.
 	GapUsedPrice float64 `json:"gap_used_price"`
-	// Status is "confident" for 7/7 criteria, "questionable" for 6/7.
+	// Status is "confident" for 7/7 criteria, "questionable" for at least
+	// FilterParams.MinCriteriaPassed.
 	Status string `json:"status"`
 }
 
@@ -92,7 +96,7 @@ func FilterStocksEpisodicPivotRealtime(config AlpacaConfig) error {
 		return fmt.Errorf("failed to load EST timezone: %v", err)
 	}
 
-	now := time.Now().In(est)
+	now := replay.Now().In(est)
 	marketStatus := getMarketStatus(now)
 
 	LogSection("EPISODIC PIVOT REAL-TIME SCANNER")
@@ -104,9 +108,21 @@ func FilterStocksEpisodicPivotRealtime(config AlpacaConfig) error {
 			now.Format("15:04:05"))
 	}
 
-	LogSection(fmt.Sprintf("STAGE 1 — Gap Up Filter (min %.0f%%)", MIN_GAP_UP_PERCENT))
+	config.Filters = config.Filters.orDefault()
+	if err := config.Filters.Validate(); err != nil {
+		return fmt.Errorf("invalid filter params: %v", err)
+	}
+	params := config.Filters
+	LogFilterParams("INIT", params)
+
+	provider, err := newMarketDataProvider(config)
+	if err != nil {
+		return err
+	}
+
+	LogSection(fmt.Sprintf("STAGE 1 — Gap Up Filter (min %.0f%%)", params.MinGapUpPercent))
 	t0 := time.Now()
-	gapUpStocks, err := realtimeStage1GapUp(config)
+	gapUpStocks, err := realtimeStage1GapUp(config, provider, params)
 	if err != nil {
 		LogError("S1", "", "Stage 1 failed: %v", err)
 		return fmt.Errorf("error in Stage 1: %v", err)
@@ -118,9 +134,9 @@ func FilterStocksEpisodicPivotRealtime(config AlpacaConfig) error {
 		return nil
 	}
 
-	LogSection(fmt.Sprintf("STAGE 2 — Liquidity Filter (min market cap $%dM)", MIN_MARKET_CAP/1_000_000))
+	LogSection(fmt.Sprintf("STAGE 2 — Liquidity Filter (min market cap $%.0fM)", params.MinMarketCap/1_000_000))
 	t0 = time.Now()
-	liquidStocks, err := realtimeStage2Liquidity(config, gapUpStocks)
+	liquidStocks, err := realtimeStage2Liquidity(config, params, gapUpStocks)
 	if err != nil {
 		LogError("S2", "", "Stage 2 failed: %v", err)
 		return fmt.Errorf("error in Stage 2: %v", err)
@@ -129,7 +145,7 @@ func FilterStocksEpisodicPivotRealtime(config AlpacaConfig) error {
 
 	LogSection("STAGE 3 — Technical Analysis")
 	t0 = time.Now()
-	technicalStocks, err := realtimeStage3Technical(config, liquidStocks)
+	technicalStocks, err := realtimeStage3Technical(config, provider, params, liquidStocks)
 	if err != nil {
 		LogError("S3", "", "Stage 3 failed: %v", err)
 		return fmt.Errorf("error in Stage 3: %v", err)
@@ -138,7 +154,7 @@ func FilterStocksEpisodicPivotRealtime(config AlpacaConfig) error {
 
 	LogSection("STAGE 4 — Final Episodic Pivot Criteria")
 	t0 = time.Now()
-	finalStocks := realtimeStage4Final(technicalStocks)
+	finalStocks := realtimeStage4Final(params, technicalStocks)
 	// Count by status for the summary log
 	confidentCount, questionableCount := 0, 0
 	for _, s := range finalStocks {
@@ -166,8 +182,8 @@ func FilterStocksEpisodicPivotRealtime(config AlpacaConfig) error {
 // Stage 1: Gap Up Filter
 // ─────────────────────────────────────────────────────────────────────────────
 
-func realtimeStage1GapUp(config AlpacaConfig) ([]RealtimeStockData, error) {
-	symbols, err := getAlpacaTradableSymbolsMain(config)
+func realtimeStage1GapUp(config AlpacaConfig, provider marketdata.Provider, params FilterParams) ([]RealtimeStockData, error) {
+	symbols, err := getAlpacaTradableSymbolsMain(provider)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get symbols: %v", err)
 	}
@@ -242,7 +258,7 @@ func realtimeStage1GapUp(config AlpacaConfig) ([]RealtimeStockData, error) {
 			LogDebug("S1", sym, "PrevClose=$%.2f  %s  PMVol=%.0f  GapUp=%.2f%%",
 				previousClose, gapPriceLabel, premarketData.PremarketVolume, gapUp)
 
-			if gapUp >= MIN_GAP_UP_PERCENT && gapPrice >= MIN_STOCK_PRICE {
+			if gapUp >= params.MinGapUpPercent && gapPrice >= params.MinStockPrice {
 				stockData := RealtimeStockData{
 					Symbol:          sym,
 					CurrentPrice:    premarketData.PremarketClose,
@@ -262,8 +278,8 @@ func realtimeStage1GapUp(config AlpacaConfig) ([]RealtimeStockData, error) {
 				gapUpStocks = append(gapUpStocks, stockData)
 				mu.Unlock()
 			} else {
-				LogReject("S1", sym, fmt.Sprintf("Gap=%.2f%% < %.0f%% minimum", gapUp, MIN_GAP_UP_PERCENT))
-				LogReject("S1", sym, fmt.Sprintf("Stock price=$%.2f < $%.2f minimum", gapPrice, MIN_STOCK_PRICE))
+				LogReject("S1", sym, fmt.Sprintf("Gap=%.2f%% < %.0f%% minimum", gapUp, params.MinGapUpPercent))
+				LogReject("S1", sym, fmt.Sprintf("Stock price=$%.2f < $%.2f minimum", gapPrice, params.MinStockPrice))
 			}
 		}(symbol)
 	}
@@ -276,7 +292,7 @@ func realtimeStage1GapUp(config AlpacaConfig) ([]RealtimeStockData, error) {
 // Stage 2: Liquidity Filter
 // ─────────────────────────────────────────────────────────────────────────────
 
-func realtimeStage2Liquidity(config AlpacaConfig, stocks []RealtimeStockData) ([]RealtimeResult, error) {
+func realtimeStage2Liquidity(config AlpacaConfig, params FilterParams, stocks []RealtimeStockData) ([]RealtimeResult, error) {
 	var liquidStocks []RealtimeResult
 	rateLimiter := time.Tick(time.Second / API_CALLS_PER_SECOND)
 
@@ -333,19 +349,19 @@ func realtimeStage2Liquidity(config AlpacaConfig, stocks []RealtimeStockData) ([
 			"current_price":  fmt.Sprintf("$%.2f", stock.CurrentPrice),
 			"gap_used_price": fmt.Sprintf("$%.2f", stock.GapUsedPrice),
 			"market_cap_m":   fmt.Sprintf("$%.2fM", marketCap/1_000_000),
-			"min_required_m": fmt.Sprintf("$%.2fM", float64(MIN_MARKET_CAP)/1_000_000),
+			"min_required_m": fmt.Sprintf("$%.2fM", params.MinMarketCap/1_000_000),
 			"pm_volume":      fmt.Sprintf("%.0f", stock.PremarketVolume),
 			"gap_up_pct":     fmt.Sprintf("%.2f%%", stock.GapUpPercent),
 			"sector":         sector,
 			"industry":       industry,
 		})
 
-		if marketCap >= MIN_MARKET_CAP {
+		if marketCap >= params.MinMarketCap {
 			result := RealtimeResult{
 				FilteredStock: FilteredStock{
 					Symbol: stock.Symbol,
 					StockInfo: StockStats{
-						Timestamp:       time.Now().Format(time.RFC3339),
+						Timestamp:       replay.Now().Format(time.RFC3339),
 						MarketCap:       marketCap,
 						GapUp:           stock.GapUpPercent,
 						Name:            name,
@@ -355,7 +371,7 @@ func realtimeStage2Liquidity(config AlpacaConfig, stocks []RealtimeStockData) ([
 						PremarketVolume: stock.PremarketVolume,
 					},
 				},
-				ScanTime:        time.Now().Format(time.RFC3339),
+				ScanTime:        replay.Now().Format(time.RFC3339),
 				MarketStatus:    "PREMARKET",
 				DataQuality:     "Good",
 				ValidationNotes: []string{},
@@ -364,11 +380,11 @@ func realtimeStage2Liquidity(config AlpacaConfig, stocks []RealtimeStockData) ([
 			}
 
 			liquidStocks = append(liquidStocks, result)
-			LogQualify("S2", stock.Symbol, fmt.Sprintf("MarketCap=$%.0fM >= $%dM",
-				marketCap/1_000_000, MIN_MARKET_CAP/1_000_000))
+			LogQualify("S2", stock.Symbol, fmt.Sprintf("MarketCap=$%.0fM >= $%.0fM",
+				marketCap/1_000_000, params.MinMarketCap/1_000_000))
 		} else {
-			LogReject("S2", stock.Symbol, fmt.Sprintf("MarketCap=$%.0fM < $%dM",
-				marketCap/1_000_000, MIN_MARKET_CAP/1_000_000))
+			LogReject("S2", stock.Symbol, fmt.Sprintf("MarketCap=$%.0fM < $%.0fM",
+				marketCap/1_000_000, params.MinMarketCap/1_000_000))
 		}
 	}
 
@@ -379,7 +395,7 @@ func realtimeStage2Liquidity(config AlpacaConfig, stocks []RealtimeStockData) ([
 // Stage 3: Technical Analysis
 // ─────────────────────────────────────────────────────────────────────────────
 
-func realtimeStage3Technical(config AlpacaConfig, stocks []RealtimeResult) ([]RealtimeResult, error) {
+func realtimeStage3Technical(config AlpacaConfig, provider marketdata.Provider, params FilterParams, stocks []RealtimeResult) ([]RealtimeResult, error) {
 	var technicalStocks []RealtimeResult
 	rateLimiter := time.Tick(time.Second / API_CALLS_PER_SECOND)
 
@@ -389,7 +405,7 @@ func realtimeStage3Technical(config AlpacaConfig, stocks []RealtimeResult) ([]Re
 		LogDebug("S3", stock.Symbol, "[%d/%d] Fetching 300-day historical data", i+1, len(stocks))
 		<-rateLimiter
 
-		historicalData, err := getAlpacaHistoricalBars(config, stock.Symbol, 300)
+		historicalData, err := getAlpacaHistoricalBars(provider, stock.Symbol, 300)
 		if err != nil {
 			LogWarn("S3", stock.Symbol, "Historical data error: %v", err)
 			stock.ValidationNotes = append(stock.ValidationNotes,
@@ -411,7 +427,7 @@ func realtimeStage3Technical(config AlpacaConfig, stocks []RealtimeResult) ([]Re
 
 		// Pass GapUsedPrice so EMA distances are calculated against the actual
 		// gap price rather than yesterday's close.
-		technicalIndicators, err := calculateTechnicalIndicatorsRealtime(historicalData, stock.Symbol, stock.GapUsedPrice)
+		technicalIndicators, err := calculateTechnicalIndicatorsRealtime(params, historicalData, stock.Symbol, stock.GapUsedPrice)
 		if err != nil {
 			LogWarn("S3", stock.Symbol, "Technical indicators error: %v", err)
 			stock.ValidationNotes = append(stock.ValidationNotes,
@@ -488,96 +504,127 @@ func realtimeStage3Technical(config AlpacaConfig, stocks []RealtimeResult) ([]Re
 // ─────────────────────────────────────────────────────────────────────────────
 // Stage 4: Final Filter
 // Stocks passing all 7 criteria are marked "confident".
-// Stocks passing exactly 5 of 7 criteria are marked "questionable".
-// Stocks passing fewer than 5 are rejected entirely.
+// Stocks passing at least MinCriteriaPassed (default 5) of 7 criteria, with a
+// premarket volume ratio of at least 1.5x, are marked "questionable".
+// All others are rejected entirely.
 // IsTooExtended is treated as an automatic hard disqualifier regardless of
-// the 6/7 threshold — a stock that is too extended is always rejected.
+// the pass threshold — a stock that is too extended is always rejected.
 // ─────────────────────────────────────────────────────────────────────────────
 
-func realtimeStage4Final(stocks []RealtimeResult) []RealtimeResult {
+// STAGE4_CRITERIA is the number of Stage 4 criteria.
+const STAGE4_CRITERIA = 7
+
+// stage4Criterion is one Stage 4 check and its outcome.
+type stage4Criterion struct {
+	name   string
+	passed bool
+	detail string
+}
+
+// stage4Criteria evaluates the Stage 4 checks for one stock.
+func stage4Criteria(params FilterParams, stock RealtimeResult) []stage4Criterion {
+	return []stage4Criterion{
+		{
+			"Dollar Volume",
+			stock.StockInfo.DolVol >= params.MinDollarVolume,
+			fmt.Sprintf("$%.0fM >= $%.0fM", stock.StockInfo.DolVol/1_000_000, params.MinDollarVolume/1_000_000),
+		},
+		{
+			"Premarket Vol Ratio",
+			stock.StockInfo.PremarketVolumeRatio >= params.MinPremarketVolRatio,
+			fmt.Sprintf("%.2fx >= %.1fx", stock.StockInfo.PremarketVolumeRatio, params.MinPremarketVolRatio),
+		},
+		{
+			"Premarket Vol % of Daily",
+			stock.StockInfo.PremarketVolAsPercent >= params.MinPremarketVolPctOfDaily,
+			fmt.Sprintf("%.2f%% >= %.0f%% of avg daily volume",
+				stock.StockInfo.PremarketVolAsPercent, params.MinPremarketVolPctOfDaily),
+		},
+		{
+			"Above 200 EMA",
+			stock.StockInfo.IsAbove200EMA,
+			fmt.Sprintf("GapPrice=$%.2f vs EMA200=$%.2f", stock.GapUsedPrice, stock.StockInfo.EMA200),
+		},
+		{
+			"Not Extended",
+			!stock.StockInfo.IsExtended,
+			fmt.Sprintf("dist=%.2f ADRs (max %.1f)", stock.StockInfo.DistanceFrom50EMA, params.MaxExtensionADR),
+		},
+		{
+			"Near 10/20 EMA",
+			stock.StockInfo.IsNearEMA1020,
+			fmt.Sprintf("within %.1f ADRs of EMA10 or EMA20", params.NearEMAADRThreshold),
+		},
+		{
+			"Volume Dried Up",
+			stock.StockInfo.VolumeDriedUp,
+			"20-day avg vol < 60-day avg vol (consolidation signal)",
+		},
+	}
+}
+
+// classifyStage4 returns "confident", "questionable" or "" (rejected) for one
+// stock, with the number of criteria it passed.
+func classifyStage4(params FilterParams, stock RealtimeResult, criteria []stage4Criterion) (string, int) {
+	passedCount := 0
+	for _, c := range criteria {
+		if c.passed {
+			passedCount++
+		}
+	}
+	switch {
+	case stock.StockInfo.IsTooExtended:
+		return "", passedCount
+	case passedCount == len(criteria):
+		return "confident", passedCount
+	case passedCount >= params.MinCriteriaPassed && stock.StockInfo.PremarketVolumeRatio >= 1.5:
+		return "questionable", passedCount
+	default:
+		return "", passedCount
+	}
+}
+
+func realtimeStage4Final(params FilterParams, stocks []RealtimeResult) []RealtimeResult {
 	var finalStocks []RealtimeResult
 
 	LogInfo("S4", "Applying final episodic pivot criteria to %d stocks", len(stocks))
 
 	for _, stock := range stocks {
-		type criterion struct {
-			name   string
-			passed bool
-			detail string
-		}
+		criteria := stage4Criteria(params, stock)
 
-		criteria := []criterion{
-			{
-				"Dollar Volume",
-				stock.StockInfo.DolVol >= MIN_DOLLAR_VOLUME,
-				fmt.Sprintf("$%.0fM >= $%.0fM", stock.StockInfo.DolVol/1_000_000, float64(MIN_DOLLAR_VOLUME)/1_000_000),
-			},
-			{
-				"Premarket Vol Ratio",
-				stock.StockInfo.PremarketVolumeRatio >= MIN_PREMARKET_VOL_RATIO,
-				fmt.Sprintf("%.2fx >= %.1fx", stock.StockInfo.PremarketVolumeRatio, MIN_PREMARKET_VOL_RATIO),
-			},
-			{
-				"Premarket Vol % of Daily",
-				stock.StockInfo.PremarketVolAsPercent >= MIN_PREMARKET_VOL_PCT_OF_DAILY,
-				fmt.Sprintf("%.2f%% >= %.0f%% of avg daily volume",
-					stock.StockInfo.PremarketVolAsPercent, MIN_PREMARKET_VOL_PCT_OF_DAILY),
-			},
-			{
-				"Above 200 EMA",
-				stock.StockInfo.IsAbove200EMA,
-				fmt.Sprintf("GapPrice=$%.2f vs EMA200=$%.2f", stock.GapUsedPrice, stock.StockInfo.EMA200),
-			},
-			{
-				"Not Extended",
-				!stock.StockInfo.IsExtended,
-				fmt.Sprintf("dist=%.2f ADRs (max %.1f)", stock.StockInfo.DistanceFrom50EMA, MAX_EXTENSION_ADR),
-			},
-			{
-				"Near 10/20 EMA",
-				stock.StockInfo.IsNearEMA1020,
-				fmt.Sprintf("within %.1f ADRs of EMA10 or EMA20", NEAR_EMA_ADR_THRESHOLD),
-			},
-			{
-				"Volume Dried Up",
-				stock.StockInfo.VolumeDriedUp,
-				"20-day avg vol < 60-day avg vol (consolidation signal)",
-			},
-		}
-
-		// Hard disqualifier — checked independently of the 6/7 threshold.
+		// Hard disqualifier — checked independently of the pass threshold.
 		if stock.StockInfo.IsTooExtended {
 			LogDebug("S4", stock.Symbol, "❌ HARD REJECT  Too Extended — %.2f ADRs > %.1f",
-				stock.StockInfo.DistanceFrom50EMA, TOO_EXTENDED_ADR)
+				stock.StockInfo.DistanceFrom50EMA, params.TooExtendedADR)
 			LogReject("S4", stock.Symbol, fmt.Sprintf("Too extended (%.2f ADRs > %.1f max)",
-				stock.StockInfo.DistanceFrom50EMA, TOO_EXTENDED_ADR))
+				stock.StockInfo.DistanceFrom50EMA, params.TooExtendedADR))
 			continue
 		}
 
-		passedCount := 0
 		for _, c := range criteria {
 			if c.passed {
-				passedCount++
 				LogDebug("S4", stock.Symbol, "✅ PASS  %s — %s", c.name, c.detail)
 			} else {
 				LogDebug("S4", stock.Symbol, "❌ FAIL  %s — %s", c.name, c.detail)
 			}
 		}
 
-		totalCriteria := len(criteria) // 7
+		status, passedCount := classifyStage4(params, stock, criteria)
+		totalCriteria := len(criteria)
 
-		switch {
-		case passedCount == totalCriteria:
-			stock.Status = "confident"
+		switch status {
+		case "confident":
+			stock.Status = status
 			finalStocks = append(finalStocks, stock)
 			LogQualify("S4", stock.Symbol, fmt.Sprintf(
-				"[confident 7/7]  Gap=%.2f%%  GapPrice=$%.2f  DolVol=$%.0fM  ADR=%.2f%%  PMRatio=%.2fx  Dist50EMA=%.2f  VolDriedUp=%v",
+				"[confident %d/%d]  Gap=%.2f%%  GapPrice=$%.2f  DolVol=$%.0fM  ADR=%.2f%%  PMRatio=%.2fx  Dist50EMA=%.2f  VolDriedUp=%v",
+				passedCount, totalCriteria,
 				stock.StockInfo.GapUp, stock.GapUsedPrice, stock.StockInfo.DolVol/1_000_000,
 				stock.StockInfo.ADR, stock.StockInfo.PremarketVolumeRatio,
 				stock.StockInfo.DistanceFrom50EMA, stock.StockInfo.VolumeDriedUp))
 
-		case passedCount >= totalCriteria-2 && stock.StockInfo.PremarketVolumeRatio >= 1.5:
-			stock.Status = "questionable"
+		case "questionable":
+			stock.Status = status
 			// Record which criterion was missed for transparency
 			for _, c := range criteria {
 				if !c.passed {
@@ -587,14 +634,15 @@ func realtimeStage4Final(stocks []RealtimeResult) []RealtimeResult {
 			}
 			finalStocks = append(finalStocks, stock)
 			LogQualify("S4", stock.Symbol, fmt.Sprintf(
-				"[questionable 5/7]  Gap=%.2f%%  GapPrice=$%.2f  DolVol=$%.0fM  ADR=%.2f%%  PMRatio=%.2fx  Dist50EMA=%.2f  VolDriedUp=%v",
+				"[questionable %d/%d]  Gap=%.2f%%  GapPrice=$%.2f  DolVol=$%.0fM  ADR=%.2f%%  PMRatio=%.2fx  Dist50EMA=%.2f  VolDriedUp=%v",
+				passedCount, totalCriteria,
 				stock.StockInfo.GapUp, stock.GapUsedPrice, stock.StockInfo.DolVol/1_000_000,
 				stock.StockInfo.ADR, stock.StockInfo.PremarketVolumeRatio,
 				stock.StockInfo.DistanceFrom50EMA, stock.StockInfo.VolumeDriedUp))
 
 		default:
 			LogReject("S4", stock.Symbol,
-				fmt.Sprintf("Only %d/%d criteria passed (need at least 6)", passedCount, totalCriteria))
+				fmt.Sprintf("Only %d/%d criteria passed (need at least %d)", passedCount, totalCriteria, params.MinCriteriaPassed))
 		}
 	}
 
@@ -606,50 +654,21 @@ func realtimeStage4Final(stocks []RealtimeResult) []RealtimeResult {
 // Alpaca API helpers
 // ─────────────────────────────────────────────────────────────────────────────
 
-func getAlpacaTradableSymbolsMain(config AlpacaConfig) ([]string, error) {
-	url := fmt.Sprintf("%s/v2/assets?status=active&asset_class=us_equity", config.BaseURL)
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("APCA-API-KEY-ID", config.APIKey)
-	req.Header.Set("APCA-API-SECRET-KEY", config.APISecret)
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+func getAlpacaTradableSymbolsMain(provider marketdata.Provider) ([]string, error) {
+	assets, err := provider.TradableAssets()
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	var assets []struct {
-		Symbol   string `json:"symbol"`
-		Exchange string `json:"exchange"`
-		Tradable bool   `json:"tradable"`
-		Status   string `json:"status"`
-	}
-	if err := json.Unmarshal(body, &assets); err != nil {
-		return nil, fmt.Errorf("failed to parse assets: %v", err)
-	}
 
-	var symbols []string
+	symbols := make([]string, 0, len(assets))
 	for _, asset := range assets {
-		if asset.Tradable && asset.Status == "active" &&
-			(asset.Exchange == "NASDAQ" || asset.Exchange == "NYSE") {
-			symbols = append(symbols, asset.Symbol)
-		}
+		symbols = append(symbols, asset.Symbol)
 	}
 	return symbols, nil
 }
 
 func getAlpacaPreviousClose(config AlpacaConfig, symbol string) (float64, error) {
-	end := time.Now()
+	end := replay.Now()
 	start := end.AddDate(0, 0, -6)
 
 	url := fmt.Sprintf("%s/v2/stocks/%s/bars?timeframe=1Day&start=%s&end=%s&limit=5&adjustment=split&feed=sip",
@@ -688,7 +707,7 @@ func getAlpacaPreviousClose(config AlpacaConfig, symbol string) (float64, error)
 	})
 
 	est, _ := time.LoadLocation("America/New_York")
-	today := time.Now().In(est).Format("2006-01-02")
+	today := replay.Now().In(est).Format("2006-01-02")
 
 	for i := len(barsResp.Bars) - 1; i >= 0; i-- {
 		if !strings.HasPrefix(barsResp.Bars[i].Timestamp, today) {
@@ -703,7 +722,7 @@ func getAlpacaPreviousClose(config AlpacaConfig, symbol string) (float64, error)
 // Returns an error before 9:30am EST when the bar doesn't exist yet.
 func getAlpacaRegularSessionOpen(config AlpacaConfig, symbol string) (float64, error) {
 	est, _ := time.LoadLocation("America/New_York")
-	now := time.Now().In(est)
+	now := replay.Now().In(est)
 	today := now.Format("2006-01-02")
 
 	url := fmt.Sprintf("%s/v2/stocks/%s/bars?timeframe=1Day&start=%s&end=%s&limit=1&adjustment=split&feed=sip",
@@ -754,7 +773,7 @@ type AlpacaLatestBarResponse struct {
 
 func getAlpacaPremarketData(config AlpacaConfig, symbol string) (*RealtimeStockData, error) {
 	est, _ := time.LoadLocation("America/New_York")
-	today := time.Now().In(est).Format("2006-01-02")
+	today := replay.Now().In(est).Format("2006-01-02")
 
 	// ── Call 1: latest bar for price snapshot ────────────────────────────
 	latestURL := fmt.Sprintf("%s/v2/stocks/%s/bars/latest?feed=sip", config.DataURL, symbol)
@@ -876,42 +895,20 @@ func getAlpacaAssetInfo(config AlpacaConfig, symbol string) (*struct {
 	return &asset, nil
 }
 
-func getAlpacaHistoricalBars(config AlpacaConfig, symbol string, daysBack int) ([]AlpacaBar, error) {
-	end := time.Now()
+func getAlpacaHistoricalBars(provider marketdata.Provider, symbol string, daysBack int) ([]AlpacaBar, error) {
+	end := replay.Now()
 	start := end.AddDate(0, 0, -(daysBack + 50))
 
-	url := fmt.Sprintf("%s/v2/stocks/%s/bars?timeframe=1Day&start=%s&end=%s&limit=1000&adjustment=split&feed=sip",
-		config.DataURL, symbol, start.Format("2006-01-02"), end.Format("2006-01-02"))
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("APCA-API-KEY-ID", config.APIKey)
-	req.Header.Set("APCA-API-SECRET-KEY", config.APISecret)
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
+	bars, err := provider.DailyBars(symbol, start, end, marketdata.AdjustmentSplit)
 	if err != nil {
 		return nil, err
 	}
 
-	var barsResp AlpacaSingleSymbolBarsResponse
-	if err := json.Unmarshal(body, &barsResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %v. Body: %s", err, string(body))
-	}
-
-	if len(barsResp.Bars) == 0 {
+	if len(bars) == 0 {
 		return nil, fmt.Errorf("no historical data")
 	}
 
-	return barsResp.Bars, nil
+	return toAlpacaBars(bars), nil
 }
 
 // getAlpacaPremarketMetrics computes premarket volume ratio using the
@@ -923,7 +920,7 @@ func getAlpacaPremarketMetrics(config AlpacaConfig, symbol string, historicalBar
 	}
 
 	est, _ := time.LoadLocation("America/New_York")
-	today := time.Now().In(est).Format("2006-01-02")
+	today := replay.Now().In(est).Format("2006-01-02")
 
 	var priorBars []AlpacaBar
 	for _, b := range historicalBars {
@@ -973,12 +970,12 @@ func getAlpacaPremarketMetrics(config AlpacaConfig, symbol string, historicalBar
 // currentPremarketPrice is the gap-up price from Stage 1 (PremarketHigh or
 // RegularOpen). Using it instead of yesterday's close ensures IsAbove200EMA
 // and DistanceFrom50EMA reflect where the stock actually is right now.
-func calculateTechnicalIndicatorsRealtime(bars []AlpacaBar, symbol string, currentPremarketPrice float64) (*TechnicalIndicators, error) {
+func calculateTechnicalIndicatorsRealtime(params FilterParams, bars []AlpacaBar, symbol string, currentPremarketPrice float64) (*TechnicalIndicators, error) {
 	sort.Slice(bars, func(i, j int) bool { return bars[i].Timestamp < bars[j].Timestamp })
 
 	// Strip today's partial bar if present
 	est, _ := time.LoadLocation("America/New_York")
-	today := time.Now().In(est).Format("2006-01-02")
+	today := replay.Now().In(est).Format("2006-01-02")
 	if len(bars) > 0 && strings.HasPrefix(bars[len(bars)-1].Timestamp, today) {
 		bars = bars[:len(bars)-1]
 	}
@@ -1028,7 +1025,7 @@ func calculateTechnicalIndicatorsRealtime(bars []AlpacaBar, symbol string, curre
 		distanceFrom10EMA = abs(currentPrice-ema10) / adrValue
 		distanceFrom20EMA = abs(currentPrice-ema20) / adrValue
 	}
-	isNearEMA1020 := distanceFrom10EMA <= NEAR_EMA_ADR_THRESHOLD || distanceFrom20EMA <= NEAR_EMA_ADR_THRESHOLD
+	isNearEMA1020 := distanceFrom10EMA <= params.NearEMAADRThreshold || distanceFrom20EMA <= params.NearEMAADRThreshold
 
 	breaksResistance := false
 	if len(bars) >= 20 {
@@ -1064,8 +1061,8 @@ func calculateTechnicalIndicatorsRealtime(bars []AlpacaBar, symbol string, curre
 		EMA10:             ema10,
 		IsAbove200EMA:     currentPrice > ema200,
 		DistanceFrom50EMA: distanceFrom50EMA,
-		IsExtended:        distanceFrom50EMA > MAX_EXTENSION_ADR,
-		IsTooExtended:     distanceFrom50EMA > TOO_EXTENDED_ADR,
+		IsExtended:        distanceFrom50EMA > params.MaxExtensionADR,
+		IsTooExtended:     distanceFrom50EMA > params.TooExtendedADR,
 		IsNearEMA1020:     isNearEMA1020,
 		BreaksResistance:  breaksResistance,
 		VolumeDriedUp:     volumeDriedUp,
@@ -1090,7 +1087,7 @@ func calculateHistoricalMetricsRealtime(bars []AlpacaBar) (float64, float64, err
 	})
 
 	est, _ := time.LoadLocation("America/New_York")
-	today := time.Now().In(est).Format("2006-01-02")
+	today := replay.Now().In(est).Format("2006-01-02")
 
 	if len(bars) > 0 && strings.HasPrefix(bars[len(bars)-1].Timestamp, today) {
 		bars = bars[:len(bars)-1]
@@ -1221,17 +1218,9 @@ func outputRealtimeResults(config AlpacaConfig, stocks []RealtimeResult, scanTim
 	}
 
 	output := map[string]interface{}{
-		"scan_time":     scanTime.Format(time.RFC3339),
-		"market_status": getMarketStatus(scanTime),
-		"filter_criteria": map[string]interface{}{
-			"min_gap_up_percent":             MIN_GAP_UP_PERCENT,
-			"min_dollar_volume":              MIN_DOLLAR_VOLUME,
-			"min_market_cap":                 MIN_MARKET_CAP,
-			"min_premarket_volume_ratio":     MIN_PREMARKET_VOL_RATIO,
-			"min_premarket_vol_pct_of_daily": MIN_PREMARKET_VOL_PCT_OF_DAILY,
-			"max_extension_adr":              MAX_EXTENSION_ADR,
-			"near_ema_adr_threshold":         NEAR_EMA_ADR_THRESHOLD,
-		},
+		"scan_time":         scanTime.Format(time.RFC3339),
+		"market_status":     getMarketStatus(scanTime),
+		"filter_criteria":   config.Filters,
 		"qualifying_stocks": stocks,
 		"summary": map[string]interface{}{
 			"total_candidates":   len(stocks),
@@ -0,0 +1,466 @@
+package ep
+
+// Approval queue
+//
+// A proposed entry that needs a person is parked here instead of being
+// traded: a guardrail HUMAN_REVIEW verdict, a symbol never traded before
+// (APPROVAL_NEW_SYMBOLS) or a position above APPROVAL_MAX_NOTIONAL.  The
+// queue is one JSON file so it survives restarts and can be read by
+// operators.  Each approval expires at the end of the entry window it was
+// proposed in; an expired approval can no longer be approved.  ep_main and
+// ep_approvals both rewrite the file, so every load-modify-save holds an
+// flock on <queue>.lock as well as approvalMu.
+//
+// An approval goes to PlaceEntryWithStop at its (possibly edited) price and
+// size; CompleteApproval then waits for the fill and adds it to the
+// watchlist, as the live worker does.  cmd/avantai/ep/ep_approvals lists,
+// approves and rejects from the command line or over HTTP (ApprovalHandler).
+//
+// Usage:
+//   a, err := ep.QueueApproval(ep.Approval{Symbol: "ABCD", EntryPrice: 12.30,
+//       StopLoss: 11.90, Shares: 250, Reason: verdict.Reason})
+//   a, order, err := ep.ApproveApproval(a.ID, ep.ApprovalEdit{Shares: 200}, "half size")
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"avantai/pkg/broker"
+	"avantai/pkg/replay"
+
+	"github.com/google/uuid"
+)
+
+// DEFAULT_APPROVAL_QUEUE is where proposed entries wait for approval unless
+// APPROVAL_QUEUE names another file.
+const DEFAULT_APPROVAL_QUEUE = "data/approvals/queue.json"
+
+// DEFAULT_APPROVAL_TTL is how long an approval lasts when its proposer
+// gives no expiry, unless APPROVAL_TTL (a duration) says otherwise.  It
+// matches the live worker's 15-minute entry window.
+const DEFAULT_APPROVAL_TTL = 15 * time.Minute
+
+// Approval states.
+const (
+	ApprovalPending  = "pending"
+	ApprovalPlacing  = "placing"  // approved, entry order being placed
+	ApprovalApproved = "approved" // entry order placed
+	ApprovalRejected = "rejected"
+	ApprovalExpired  = "expired"
+	ApprovalFailed   = "failed" // approved, but the entry order was refused
+)
+
+// What asked for an approval.
+const (
+	ApprovalSourceGuardrail = "guardrail"
+	ApprovalSourceNewSymbol = "new_symbol"
+	ApprovalSourceSize      = "size"
+)
+
+var (
+	ErrApprovalNotFound   = errors.New("approval not found")
+	ErrApprovalNotPending = errors.New("approval is not pending")
+)
+
+// approvalMu serialises queue updates within the process; lockApprovals
+// adds the file lock that serialises them across processes.
+var approvalMu sync.Mutex
+
+// Approval is one proposed entry, in the watchlist's terms.
+type Approval struct {
+	ID           string    `json:"id"`
+	Symbol       string    `json:"symbol"`
+	EntryPrice   float64   `json:"entry_price"`
+	StopLoss     float64   `json:"stop_loss"`
+	Shares       float64   `json:"shares"`
+	PurchaseDate string    `json:"purchase_date"`
+	ExitProfile  string    `json:"exit_profile,omitempty"`
+	Source       string    `json:"source"`
+	Reason       string    `json:"reason"`
+	Status       string    `json:"status"`
+	CreatedAt    time.Time `json:"created_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+
+	DecidedAt time.Time `json:"decided_at,omitzero"`
+	Note      string    `json:"note,omitempty"`     // operator's comment on approve/reject
+	OrderID   string    `json:"order_id,omitempty"` // entry order, once approved
+	Error     string    `json:"error,omitempty"`    // why the entry order failed
+}
+
+// ApprovalEdit changes an approval's price or size as it is approved.  Zero
+// keeps the proposed value.  Shares can only shrink the proposed size unless
+// AllowUpsize is set, which the HTTP API never does.
+type ApprovalEdit struct {
+	EntryPrice  float64 `json:"entry_price,omitempty"`
+	Shares      float64 `json:"shares,omitempty"`
+	AllowUpsize bool    `json:"-"`
+}
+
+// ApprovalQueuePath returns APPROVAL_QUEUE, else DEFAULT_APPROVAL_QUEUE.
+func ApprovalQueuePath() string {
+	if p := os.Getenv("APPROVAL_QUEUE"); p != "" {
+		return p
+	}
+	return DEFAULT_APPROVAL_QUEUE
+}
+
+// LoadApprovals reads the queue, oldest first, as stored: approvals past
+// their expiry still read as pending until ExpireApprovals runs.  A missing
+// file is an empty queue.
+func LoadApprovals() ([]Approval, error) {
+	var q []Approval
+	data, err := os.ReadFile(ApprovalQueuePath())
+	if os.IsNotExist(err) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read approval queue: %w", err)
+	}
+	if err := json.Unmarshal(data, &q); err != nil {
+		return nil, fmt.Errorf("failed to parse approval queue %s: %w", ApprovalQueuePath(), err)
+	}
+	return q, nil
+}
+
+// lockApprovals takes approvalMu and an exclusive flock on the queue's
+// lock file, and returns the function that releases both.
+func lockApprovals() (func(), error) {
+	approvalMu.Lock()
+	path := ApprovalQueuePath() + ".lock"
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		approvalMu.Unlock()
+		return nil, fmt.Errorf("failed to create approval queue directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		approvalMu.Unlock()
+		return nil, fmt.Errorf("failed to open approval queue lock: %w", err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		approvalMu.Unlock()
+		return nil, fmt.Errorf("failed to lock approval queue: %w", err)
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+		approvalMu.Unlock()
+	}, nil
+}
+
+// updateApprovals loads the queue under lockApprovals, lets update change
+// it and saves it when update reports a change.  update's error is
+// returned after the save.
+func updateApprovals(update func(q *[]Approval, now time.Time) (changed bool, err error)) error {
+	unlock, err := lockApprovals()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	q, err := LoadApprovals()
+	if err != nil {
+		return err
+	}
+	changed, uerr := update(&q, replay.Now())
+	if changed {
+		if err := saveApprovals(q); err != nil {
+			return err
+		}
+	}
+	return uerr
+}
+
+// saveApprovals replaces the queue through a uniquely named temporary file.
+// Callers hold lockApprovals.
+func saveApprovals(q []Approval) error {
+	path := ApprovalQueuePath()
+	data, err := json.MarshalIndent(q, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal approval queue: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create approval queue directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write approval queue: %w", err)
+	}
+	_, werr := tmp.Write(data)
+	if cerr := tmp.Close(); werr == nil {
+		werr = cerr
+	}
+	if werr == nil {
+		werr = os.Chmod(tmp.Name(), 0644)
+	}
+	if werr != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write approval queue: %w", werr)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// expireLocked marks pending approvals past their expiry.  Callers hold
+// lockApprovals.
+func expireLocked(q []Approval, now time.Time) int {
+	n := 0
+	for i := range q {
+		if q[i].Status == ApprovalPending && !q[i].ExpiresAt.IsZero() && now.After(q[i].ExpiresAt) {
+			q[i].Status, q[i].DecidedAt = ApprovalExpired, now
+			LogInfo("APPROVAL", "[%s] %s expired unanswered", q[i].Symbol, q[i].ID)
+			n++
+		}
+	}
+	return n
+}
+
+// QueueApproval adds a pending approval and returns it with its ID.
+// Without an ExpiresAt it expires APPROVAL_TTL (DEFAULT_APPROVAL_TTL) from
+// now.
+func QueueApproval(a Approval) (Approval, error) {
+	ttl := DEFAULT_APPROVAL_TTL
+	if v := strings.TrimSpace(os.Getenv("APPROVAL_TTL")); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return a, fmt.Errorf("invalid APPROVAL_TTL %q: %w", v, err)
+		}
+		ttl = d
+	}
+	err := updateApprovals(func(q *[]Approval, now time.Time) (bool, error) {
+		a.ID = uuid.NewString()[:8]
+		a.Status = ApprovalPending
+		a.CreatedAt = now
+		if a.ExpiresAt.IsZero() {
+			a.ExpiresAt = now.Add(ttl)
+		}
+		expireLocked(*q, now)
+		*q = append(*q, a)
+		return true, nil
+	})
+	if err != nil {
+		return a, err
+	}
+	LogInfo("APPROVAL", "[%s] queued %s (%s): %.0f shares at $%.2f, stop $%.2f, expires %s — %s",
+		a.Symbol, a.ID, a.Source, a.Shares, a.EntryPrice, a.StopLoss, a.ExpiresAt.Format("15:04"), a.Reason)
+	return a, nil
+}
+
+// ExpireApprovals marks pending approvals past their expiry as expired and
+// returns how many it marked.
+func ExpireApprovals() (int, error) {
+	n := 0
+	err := updateApprovals(func(q *[]Approval, now time.Time) (bool, error) {
+		n = expireLocked(*q, now)
+		return n > 0, nil
+	})
+	return n, err
+}
+
+// ListApprovals expires stale approvals and returns those in status, or
+// every approval when status is empty.
+func ListApprovals(status string) ([]Approval, error) {
+	if _, err := ExpireApprovals(); err != nil {
+		return nil, err
+	}
+	q, err := LoadApprovals()
+	if err != nil {
+		return nil, err
+	}
+	if status == "" {
+		return q, nil
+	}
+	var out []Approval
+	for _, a := range q {
+		if a.Status == status {
+			out = append(out, a)
+		}
+	}
+	return out, nil
+}
+
+// decideApproval finds approval id in status from, expiring the queue
+// first, lets decide change it, and saves the queue.  decide runs under
+// lockApprovals, so two operators cannot act on one approval; it must not
+// call the broker.
+func decideApproval(id, from string, decide func(a *Approval, now time.Time) error) (Approval, error) {
+	var found Approval
+	err := updateApprovals(func(q *[]Approval, now time.Time) (bool, error) {
+		expired := expireLocked(*q, now) > 0
+		for i := range *q {
+			a := &(*q)[i]
+			if a.ID != id {
+				continue
+			}
+			if a.Status != from {
+				found = *a
+				return expired, fmt.Errorf("%w: %s is %s", ErrApprovalNotPending, id, a.Status)
+			}
+			derr := decide(a, now)
+			found = *a
+			return expired || derr == nil, derr
+		}
+		return expired, fmt.Errorf("%w: %s", ErrApprovalNotFound, id)
+	})
+	return found, err
+}
+
+// ApproveApproval applies edit and places the entry with PlaceEntryWithStop.
+// The approval is claimed (placing) under the queue lock, the order goes
+// out without it, and the outcome is saved under it again, so approvals
+// queued meanwhile are kept.  A refused order leaves the approval failed,
+// with the reason, and returns the error.
+func ApproveApproval(id string, edit ApprovalEdit, note string) (Approval, *broker.Order, error) {
+	a, err := decideApproval(id, ApprovalPending, func(a *Approval, now time.Time) error {
+		entry, shares := a.EntryPrice, a.Shares
+		if edit.EntryPrice > 0 {
+			entry = roundCents(edit.EntryPrice)
+		}
+		if edit.Shares > 0 {
+			shares = math.Floor(edit.Shares)
+		}
+		if entry <= a.StopLoss {
+			return fmt.Errorf("entry $%.2f must be above the stop $%.2f", entry, a.StopLoss)
+		}
+		if shares < 1 {
+			return fmt.Errorf("shares must be at least 1, got %g", shares)
+		}
+		if shares > a.Shares && !edit.AllowUpsize {
+			return fmt.Errorf("shares %g exceed the proposed %g", shares, a.Shares)
+		}
+		if entry != a.EntryPrice || shares != a.Shares {
+			LogInfo("APPROVAL", "[%s] %s edited: %.0f → %.0f shares, $%.2f → $%.2f",
+				a.Symbol, a.ID, a.Shares, shares, a.EntryPrice, entry)
+		}
+		a.EntryPrice, a.Shares, a.Note = entry, shares, note
+		a.Status, a.DecidedAt = ApprovalPlacing, now
+		return nil
+	})
+	if err != nil {
+		return a, nil, err
+	}
+
+	entry := a.EntryPrice
+	order, perr := PlaceEntryWithStop(a.Symbol, a.StopLoss, int(a.Shares), &entry)
+
+	done, err := decideApproval(id, ApprovalPlacing, func(a *Approval, now time.Time) error {
+		if perr != nil {
+			a.Status, a.Error = ApprovalFailed, perr.Error()
+			LogWarn("APPROVAL", a.Symbol, "%s approved but the entry failed: %v", a.ID, perr)
+			return nil
+		}
+		a.Status, a.OrderID = ApprovalApproved, order.ID
+		LogInfo("APPROVAL", "[%s] %s approved: %.0f shares at $%.2f, stop $%.2f (order %s)",
+			a.Symbol, a.ID, a.Shares, a.EntryPrice, a.StopLoss, order.ID)
+		return nil
+	})
+	if err == nil {
+		a = done
+	} else {
+		LogError("APPROVAL", a.Symbol, "%s: entry outcome not saved to the queue: %v", id, err)
+	}
+	if perr != nil {
+		a.Status, a.Error = ApprovalFailed, perr.Error()
+		return a, nil, fmt.Errorf("failed to place entry for %s: %w", a.Symbol, perr)
+	}
+	a.Status, a.OrderID = ApprovalApproved, order.ID
+	return a, order, nil
+}
+
+// RejectApproval rejects a pending approval.
+func RejectApproval(id string, note string) (Approval, error) {
+	return decideApproval(id, ApprovalPending, func(a *Approval, now time.Time) error {
+		a.Status, a.Note, a.DecidedAt = ApprovalRejected, note, now
+		LogInfo("APPROVAL", "[%s] %s rejected: %s", a.Symbol, a.ID, note)
+		return nil
+	})
+}
+
+// CompleteApproval manages an approved entry order until it resolves (with
+// the EP_ entry policy) and adds what filled to the watchlist at filename.
+func CompleteApproval(a Approval, order *broker.Order, filename string) (*EntryResult, error) {
+	policy, err := EntryPolicyFromEnv("EP")
+	if err != nil {
+		LogWarn("APPROVAL", a.Symbol, "%v — using the default entry policy", err)
+		policy = DefaultEntryPolicy()
+	}
+	result, err := ManageEntry(order, policy)
+	if result == nil || result.FilledQty <= 0 {
+		if err == nil {
+			err = fmt.Errorf("entry for %s not filled", a.Symbol)
+		}
+		return result, err
+	}
+	entry := WatchlistEntry{
+		StockSymbol:  a.Symbol,
+		EntryPrice:   strconv.FormatFloat(result.FilledAvgPrice, 'f', 2, 64),
+		StopLoss:     strconv.FormatFloat(a.StopLoss, 'f', 2, 64),
+		Shares:       strconv.FormatFloat(result.FilledQty, 'f', 2, 64),
+		InitialRisk:  strconv.FormatFloat(result.FilledAvgPrice-a.StopLoss, 'f', 2, 64),
+		PurchaseDate: a.PurchaseDate,
+		ExitProfile:  a.ExitProfile,
+	}
+	if werr := AddToWatchlist(filename, entry); werr != nil {
+		return result, werr
+	}
+	LogInfo("APPROVAL", "[%s] %s filled %.0f at $%.2f — added to %s",
+		a.Symbol, a.ID, result.FilledQty, result.FilledAvgPrice, filename)
+	return result, err
+}
+
+// ApprovalNeeded reports why an entry the guardrail allowed still needs a
+// person, or "" when it does not: a symbol with no fills in the order ledger
+// when APPROVAL_NEW_SYMBOLS is set, or a position worth more than
+// APPROVAL_MAX_NOTIONAL.  Settings that do not parse require approval.
+func ApprovalNeeded(symbol string, shares, entry float64) (source, reason string) {
+	if v := strings.TrimSpace(os.Getenv("APPROVAL_MAX_NOTIONAL")); v != "" {
+		limit, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return ApprovalSourceSize, fmt.Sprintf("invalid APPROVAL_MAX_NOTIONAL %q", v)
+		}
+		if notional := shares * entry; limit > 0 && notional > limit {
+			return ApprovalSourceSize, fmt.Sprintf("$%.0f notional above $%.0f", notional, limit)
+		}
+	}
+	if v := strings.TrimSpace(os.Getenv("APPROVAL_NEW_SYMBOLS")); v != "" {
+		on, err := strconv.ParseBool(v)
+		if err != nil {
+			return ApprovalSourceNewSymbol, fmt.Sprintf("invalid APPROVAL_NEW_SYMBOLS %q", v)
+		}
+		if on {
+			traded, err := tradedBefore(symbol)
+			if err != nil {
+				return ApprovalSourceNewSymbol, fmt.Sprintf("trade history unknown: %v", err)
+			}
+			if !traded {
+				return ApprovalSourceNewSymbol, "first trade in " + symbol
+			}
+		}
+	}
+	return "", ""
+}
+
+// tradedBefore reports whether the ledger has any fill in symbol.
+func tradedBefore(symbol string) (bool, error) {
+	l, err := currentLedger()
+	if err != nil {
+		return false, err
+	}
+	entries, err := broker.ReadLedger(l.Path())
+	if err != nil {
+		return false, err
+	}
+	for _, lo := range broker.FoldLedger(entries) {
+		if lo.Symbol == symbol && lo.FilledQty > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
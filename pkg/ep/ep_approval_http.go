@@ -0,0 +1,125 @@
+package ep
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"avantai/pkg/broker"
+)
+
+// ApprovalHandler serves the approval queue:
+//
+//	GET  /approvals?status=pending   list (every approval without status)
+//	POST /approvals/{id}/approve     body {"entry_price", "shares", "note"}, all optional
+//	POST /approvals/{id}/reject      body {"note"}
+//
+// With APPROVAL_TOKEN set, requests need "Authorization: Bearer <token>";
+// without it, only serve on a loopback address.  An edit can lower the
+// proposed shares but not raise them.
+// An approved order is followed to its fill in the background by
+// CompleteApproval, which adds it to watchlist.
+func ApprovalHandler(watchlist string) http.Handler {
+	token := strings.TrimSpace(os.Getenv("APPROVAL_TOKEN"))
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /approvals", func(w http.ResponseWriter, r *http.Request) {
+		q, err := ListApprovals(r.URL.Query().Get("status"))
+		if err != nil {
+			writeApprovalError(w, err)
+			return
+		}
+		if q == nil {
+			q = []Approval{}
+		}
+		writeApprovalJSON(w, http.StatusOK, q)
+	})
+
+	mux.HandleFunc("POST /approvals/{id}/approve", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			ApprovalEdit
+			Note string `json:"note"`
+		}
+		if !decodeApprovalBody(w, r, &body) {
+			return
+		}
+		a, order, err := ApproveApproval(r.PathValue("id"), body.ApprovalEdit, body.Note)
+		if err != nil {
+			writeApprovalError(w, err)
+			return
+		}
+		go func(a Approval, order *broker.Order) {
+			if _, err := CompleteApproval(a, order, watchlist); err != nil {
+				LogWarn("APPROVAL", a.Symbol, "%s: %v", a.ID, err)
+			}
+		}(a, order)
+		writeApprovalJSON(w, http.StatusOK, a)
+	})
+
+	mux.HandleFunc("POST /approvals/{id}/reject", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Note string `json:"note"`
+		}
+		if !decodeApprovalBody(w, r, &body) {
+			return
+		}
+		a, err := RejectApproval(r.PathValue("id"), body.Note)
+		if err != nil {
+			writeApprovalError(w, err)
+			return
+		}
+		writeApprovalJSON(w, http.StatusOK, a)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				writeApprovalJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+				return
+			}
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// decodeApprovalBody reads an optional JSON body into v, answering 400 on
+// a malformed one.
+func decodeApprovalBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.ContentLength == 0 {
+		return true
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeApprovalJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+func writeApprovalError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrApprovalNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrApprovalNotPending):
+		status = http.StatusConflict
+	default:
+		var breakerErr *BreakerTrippedError
+		var riskErr *RiskDeniedError
+		if errors.As(err, &breakerErr) || errors.As(err, &riskErr) {
+			status = http.StatusUnprocessableEntity
+		}
+	}
+	writeApprovalJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeApprovalJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,367 @@
+package ep
+
+// Daily kill switch
+//
+// CheckBreaker feeds the account (equity, today's P&L) and the order ledger
+// (closed round trips, for the losing streak) to the circuit breaker in
+// pkg/riskmanagement.  Once tripped, the state file keeps it tripped across
+// restarts: a daily-loss or losing-streak trip clears on the next New York
+// trading day, a weekly-drawdown trip on the next week, and any trip on
+// ResetBreaker.  PlaceEntry refuses to trade while it is tripped, and with
+// BREAKER_FLATTEN the trip cancels every order and liquidates.
+//
+// Usage:
+//   state, err := ep.CheckBreaker()
+//   if state.Tripped { ... stop opening positions ... }
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"avantai/pkg/broker"
+	"avantai/pkg/replay"
+	riskCalculator "avantai/pkg/riskmanagement"
+)
+
+// DEFAULT_BREAKER_STATE is where the breaker persists its state unless
+// BREAKER_STATE names another file.
+const DEFAULT_BREAKER_STATE = "data/risk/breaker.json"
+
+// breakerMu and a flock on BREAKER_STATE + ".lock" serialise the
+// load-check-save of the state within and across processes.
+var breakerMu sync.Mutex
+
+// BreakerState is the persisted breaker.  LossesSince is when the losing
+// streak was last reset; only trades closed after it count.
+type BreakerState struct {
+	Tripped   bool      `json:"tripped"`
+	Rule      string    `json:"rule,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+	TrippedAt time.Time `json:"tripped_at,omitempty"`
+	Flattened bool      `json:"flattened,omitempty"`
+
+	Day         string    `json:"day"`  // New York date the state was last checked on
+	Week        string    `json:"week"` // ISO week of Day, e.g. 2025-W10
+	WeekPeak    float64   `json:"week_peak"`
+	LossesSince time.Time `json:"losses_since"`
+
+	// Last inputs, for operators reading the file.
+	Equity            float64   `json:"equity"`
+	DayPL             float64   `json:"day_pl"`
+	ConsecutiveLosses int       `json:"consecutive_losses"`
+	CheckedAt         time.Time `json:"checked_at"`
+}
+
+// BreakerTrippedError is returned by PlaceEntry while the breaker is tripped.
+type BreakerTrippedError struct {
+	State BreakerState
+}
+
+func (e *BreakerTrippedError) Error() string {
+	return fmt.Sprintf("circuit breaker tripped at %s (%s): %s — no new entries",
+		e.State.TrippedAt.Format("2006-01-02 15:04"), e.State.Rule, e.State.Detail)
+}
+
+// BreakerStatePath returns BREAKER_STATE, else DEFAULT_BREAKER_STATE.
+func BreakerStatePath() string {
+	if p := os.Getenv("BREAKER_STATE"); p != "" {
+		return p
+	}
+	return DEFAULT_BREAKER_STATE
+}
+
+// LoadBreakerState reads the persisted state.  A missing file is an
+// untripped breaker.
+func LoadBreakerState() (BreakerState, error) {
+	var s BreakerState
+	data, err := os.ReadFile(BreakerStatePath())
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return s, fmt.Errorf("failed to read breaker state: %w", err)
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("failed to parse breaker state %s: %w", BreakerStatePath(), err)
+	}
+	return s, nil
+}
+
+// lockBreaker takes breakerMu and the state file's flock, and returns the
+// function that releases both.
+func lockBreaker() (func(), error) {
+	breakerMu.Lock()
+	path := BreakerStatePath() + ".lock"
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		breakerMu.Unlock()
+		return nil, fmt.Errorf("failed to create breaker state directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		breakerMu.Unlock()
+		return nil, fmt.Errorf("failed to open breaker state lock: %w", err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		breakerMu.Unlock()
+		return nil, fmt.Errorf("failed to lock breaker state: %w", err)
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+		breakerMu.Unlock()
+	}, nil
+}
+
+// saveBreakerState replaces the state through a uniquely named temporary
+// file.  Callers hold lockBreaker.
+func saveBreakerState(s BreakerState) error {
+	path := BreakerStatePath()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal breaker state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create breaker state directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write breaker state: %w", err)
+	}
+	_, werr := tmp.Write(data)
+	if cerr := tmp.Close(); werr == nil {
+		werr = cerr
+	}
+	if werr == nil {
+		werr = os.Chmod(tmp.Name(), 0644)
+	}
+	if werr != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write breaker state: %w", werr)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ResetBreaker clears a trip and restarts the losing-streak count.
+func ResetBreaker() error {
+	unlock, err := lockBreaker()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	s, err := LoadBreakerState()
+	if err != nil {
+		return err
+	}
+	if s.Tripped {
+		LogInfo("BREAKER", "reset by operator (was %s: %s)", s.Rule, s.Detail)
+	}
+	clearTrip(&s, replay.Now())
+	return saveBreakerState(s)
+}
+
+func clearTrip(s *BreakerState, now time.Time) {
+	s.Tripped, s.Rule, s.Detail, s.TrippedAt, s.Flattened = false, "", "", time.Time{}, false
+	s.LossesSince = now
+}
+
+// CheckBreaker updates the breaker from the account and the ledger, trips it
+// if a limit is breached, and returns the state.  It flattens the account
+// once per trip when BREAKER_FLATTEN is set.  A new state file starts the
+// losing streak now, so trades already in the ledger do not count.
+func CheckBreaker() (BreakerState, error) {
+	var s BreakerState
+	unlock, err := lockBreaker()
+	if err != nil {
+		return s, err
+	}
+	defer unlock()
+
+	s, err = LoadBreakerState()
+	if err != nil {
+		return s, err
+	}
+	limits, err := riskCalculator.BreakerLimitsFromEnv()
+	if err != nil {
+		return s, err
+	}
+	b, err := CurrentBroker()
+	if err != nil {
+		return s, err
+	}
+	account, err := b.Account()
+	if err != nil {
+		return s, fmt.Errorf("failed to get account: %w", err)
+	}
+
+	now := replay.Now()
+	ny := now
+	if loc, err := time.LoadLocation("America/New_York"); err == nil {
+		ny = now.In(loc)
+	}
+	year, wk := ny.ISOWeek()
+	day, week := ny.Format("2006-01-02"), fmt.Sprintf("%d-W%02d", year, wk)
+	if s.LossesSince.IsZero() {
+		s.LossesSince = now
+	}
+
+	// Roll the day and week over, expiring trips that only hold for them.
+	if s.Week != week {
+		s.Week, s.WeekPeak = week, 0
+		if s.Tripped && s.Rule == riskCalculator.RuleWeeklyDrawdown {
+			LogInfo("BREAKER", "new week %s — %s trip cleared", week, s.Rule)
+			clearTrip(&s, now)
+		}
+	}
+	if s.Day != day {
+		s.Day = day
+		if s.Tripped && s.Rule != riskCalculator.RuleWeeklyDrawdown {
+			LogInfo("BREAKER", "new day %s — %s trip cleared", day, s.Rule)
+			clearTrip(&s, now)
+		}
+	}
+
+	trades, err := closedTrades()
+	if err != nil {
+		LogWarn("BREAKER", "account", "losing streak unknown: %v", err)
+	}
+	var pl []float64
+	realisedToday := 0.0
+	for _, t := range trades {
+		if t.ClosedAt.After(s.LossesSince) {
+			pl = append(pl, t.PL)
+		}
+		if t.ClosedAt.In(ny.Location()).Format("2006-01-02") == day {
+			realisedToday += t.PL
+		}
+	}
+
+	s.Equity = account.PortfolioValue
+	if account.LastEquity > 0 {
+		s.DayPL = account.PortfolioValue - account.LastEquity
+		if s.WeekPeak == 0 {
+			s.WeekPeak = account.LastEquity
+		}
+	} else {
+		// No previous close from the broker: realised from the ledger
+		// plus what is open now.
+		s.DayPL = realisedToday
+		if positions, err := b.Positions(); err == nil {
+			for _, p := range positions {
+				s.DayPL += p.UnrealizedPL
+			}
+		}
+	}
+	s.WeekPeak = math.Max(s.WeekPeak, s.Equity)
+	s.ConsecutiveLosses = riskCalculator.ConsecutiveLosses(pl)
+	s.CheckedAt = now
+
+	if !s.Tripped {
+		trip := limits.Evaluate(riskCalculator.BreakerInput{
+			Equity:            s.Equity,
+			DayPL:             s.DayPL,
+			WeekPeak:          s.WeekPeak,
+			ConsecutiveLosses: s.ConsecutiveLosses,
+		})
+		if trip != nil {
+			s.Tripped, s.Rule, s.Detail, s.TrippedAt = true, trip.Rule, trip.Detail, now
+			LogWarn("BREAKER", "account", "TRIPPED (%s): %s — blocking new entries", trip.Rule, trip.Detail)
+		}
+	}
+
+	if s.Tripped && limits.Flatten && !s.Flattened {
+		LogWarn("BREAKER", "account", "flattening: cancelling all orders and liquidating")
+		if err := CancelAllOrders(); err != nil {
+			LogWarn("BREAKER", "account", "cancel all orders: %v", err)
+		}
+		if err := LiquidateAllPositions(); err != nil {
+			LogWarn("BREAKER", "account", "liquidate: %v", err)
+		} else {
+			s.Flattened = true
+		}
+	}
+
+	if err := saveBreakerState(s); err != nil {
+		// The trip still applies to this process.
+		log.Printf("⚠️  %v", err)
+	}
+	return s, nil
+}
+
+// ensureBreakerClear returns a *BreakerTrippedError while the breaker is
+// tripped, and any error checking it.
+func ensureBreakerClear() error {
+	s, err := CheckBreaker()
+	if err != nil {
+		return fmt.Errorf("failed to check circuit breaker: %w", err)
+	}
+	if s.Tripped {
+		return &BreakerTrippedError{State: s}
+	}
+	return nil
+}
+
+// closedTrade is one round trip in the ledger, from flat back to flat.
+type closedTrade struct {
+	Symbol   string
+	ClosedAt time.Time
+	PL       float64
+}
+
+// closedTrades replays the ledger's fills per symbol at average cost.
+// Sells with no recorded buy (positions opened outside this package) are
+// ignored.
+func closedTrades() ([]closedTrade, error) {
+	l, err := currentLedger()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := broker.ReadLedger(l.Path())
+	if err != nil {
+		return nil, err
+	}
+	var fills []*broker.LedgerOrder
+	for _, lo := range broker.FoldLedger(entries) {
+		if lo.FilledQty > 0 && lo.FilledAvgPrice > 0 {
+			fills = append(fills, lo)
+		}
+	}
+	sort.SliceStable(fills, func(i, j int) bool { return fills[i].Time.Before(fills[j].Time) })
+
+	type book struct{ qty, cost, pl float64 }
+	books := make(map[string]*book)
+	var out []closedTrade
+	for _, f := range fills {
+		bk := books[f.Symbol]
+		if bk == nil {
+			bk = &book{}
+			books[f.Symbol] = bk
+		}
+		if f.Side == broker.Buy {
+			bk.qty += f.FilledQty
+			bk.cost += f.FilledQty * f.FilledAvgPrice
+			continue
+		}
+		if bk.qty <= 0 {
+			continue
+		}
+		qty := math.Min(f.FilledQty, bk.qty)
+		avg := bk.cost / bk.qty
+		bk.pl += qty * (f.FilledAvgPrice - avg)
+		bk.cost -= qty * avg
+		bk.qty -= qty
+		if bk.qty < 1e-9 {
+			out = append(out, closedTrade{Symbol: f.Symbol, ClosedAt: f.Time, PL: bk.pl})
+			books[f.Symbol] = &book{}
+		}
+	}
+	return out, nil
+}
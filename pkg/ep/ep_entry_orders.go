@@ -0,0 +1,267 @@
+package ep
+
+// Entry order lifecycle
+//
+// ManageEntry watches an entry placed by PlaceEntry until it fills or is
+// given up on.  An unfilled entry is cancelled once Timeout passes or once
+// price runs more than ChasePct above its limit; in between, RepriceStep can
+// walk the limit up after price, never past MaxPrice.  A partial fill keeps
+// what filled and cancels the rest.  Only the result — the shares actually
+// bought and their average price — should reach the watchlist.  An entry
+// placed without a stop leg (a Simple entry, e.g. in extended hours) gets
+// its stop as a standalone GTC order for whatever filled.
+//
+// Usage:
+//   order, err := ep.PlaceEntry(symbol, stop, shares, opts)
+//   res, err := ep.ManageEntry(order, ep.DefaultEntryPolicy())
+//   if res.FilledQty > 0 { ... record res.FilledAvgPrice x res.FilledQty ... }
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"avantai/pkg/broker"
+	"avantai/pkg/replay"
+)
+
+// EntryPolicy says how long to wait for an entry and how far to chase it.
+type EntryPolicy struct {
+	Timeout      time.Duration // cancel an unfilled entry after this long (default 5m)
+	ChasePct     float64       // cancel once price is this far above the original limit (default 0.02)
+	RepriceStep  float64       // raise the limit by this many dollars when price is above it (0 = never)
+	RepriceEvery time.Duration // minimum time between reprices (default 1m)
+	MaxPrice     float64       // highest limit a reprice may set (default the chase price)
+	PollInterval time.Duration // default 5s
+}
+
+// DefaultEntryPolicy waits 5 minutes, never reprices, and gives up if price
+// runs 2% past the limit.
+func DefaultEntryPolicy() EntryPolicy {
+	return EntryPolicy{
+		Timeout:      5 * time.Minute,
+		ChasePct:     0.02,
+		RepriceEvery: time.Minute,
+		PollInterval: 5 * time.Second,
+	}
+}
+
+// EntryPolicyFromEnv starts from DefaultEntryPolicy and applies the
+// settings for one strategy, named by prefix (e.g. "EP"):
+//
+//	<prefix>_ENTRY_TIMEOUT       Go duration, e.g. 3m
+//	<prefix>_ENTRY_CHASE_PCT     fraction above the limit, e.g. 0.015
+//	<prefix>_ENTRY_REPRICE_STEP  dollars per reprice
+func EntryPolicyFromEnv(prefix string) (EntryPolicy, error) {
+	p := DefaultEntryPolicy()
+	env := func(name string) string {
+		return strings.TrimSpace(os.Getenv(prefix + "_" + name))
+	}
+	if v := env("ENTRY_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return p, fmt.Errorf("invalid %s_ENTRY_TIMEOUT %q: %w", prefix, v, err)
+		}
+		p.Timeout = d
+	}
+	for name, dst := range map[string]*float64{
+		"ENTRY_CHASE_PCT":    &p.ChasePct,
+		"ENTRY_REPRICE_STEP": &p.RepriceStep,
+	} {
+		if v := env(name); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return p, fmt.Errorf("invalid %s_%s %q: %w", prefix, name, v, err)
+			}
+			*dst = f
+		}
+	}
+	return p, nil
+}
+
+// withDefaults fills the zero fields of p from DefaultEntryPolicy.
+func (p EntryPolicy) withDefaults() EntryPolicy {
+	def := DefaultEntryPolicy()
+	if p.Timeout <= 0 {
+		p.Timeout = def.Timeout
+	}
+	if p.ChasePct <= 0 {
+		p.ChasePct = def.ChasePct
+	}
+	if p.RepriceEvery <= 0 {
+		p.RepriceEvery = def.RepriceEvery
+	}
+	if p.PollInterval <= 0 {
+		p.PollInterval = def.PollInterval
+	}
+	return p
+}
+
+// chaseLimits returns the price past which an entry limited at ref is given
+// up on, and the highest limit a reprice may set.
+func (p EntryPolicy) chaseLimits(ref float64) (chase, maxPrice float64) {
+	chase = roundCents(ref * (1 + p.ChasePct))
+	maxPrice = p.MaxPrice
+	if maxPrice == 0 || maxPrice > chase {
+		maxPrice = chase
+	}
+	return chase, maxPrice
+}
+
+// Entry outcomes.
+const (
+	EntryFilled    = "filled"
+	EntryTimedOut  = "timed_out"
+	EntryChased    = "chased"    // price ran past the chase limit
+	EntryCancelled = "cancelled" // cancelled, expired or rejected at the broker
+)
+
+// EntryResult is how a managed entry ended.  Order is the final state of the
+// entry order, which has a new ID if it was repriced.  FilledQty may be
+// non-zero for any outcome: a partial fill is kept when the rest is
+// cancelled.
+type EntryResult struct {
+	Order          *broker.Order
+	Outcome        string
+	FilledQty      float64
+	FilledAvgPrice float64
+	Reprices       int
+}
+
+// ManageEntry polls order until it fills or policy gives up on it, and
+// cancels whatever is left unfilled in that case.  Filled shares of an
+// entry with no stop leg are then protected by a standalone stop; if that
+// fails the result is still returned with the error.
+func ManageEntry(order *broker.Order, policy EntryPolicy) (*EntryResult, error) {
+	res, err := manageEntry(order, policy)
+	if res == nil || res.FilledQty <= 0 || hasStopLeg(res.Order) {
+		return res, err
+	}
+	stop := entryStop(order.ID)
+	if stop <= 0 {
+		LogWarn("ENTRY", order.Symbol, "entry %s filled without a stop leg and no known stop price", order.ID)
+		return res, err
+	}
+	if _, serr := EnsureStop(order.Symbol, stop, res.FilledQty); serr != nil {
+		return res, errors.Join(err, fmt.Errorf("entry %s filled but its stop was not placed: %w", order.ID, serr))
+	}
+	return res, err
+}
+
+// hasStopLeg reports whether o carries its own stop-loss leg.
+func hasStopLeg(o *broker.Order) bool {
+	for _, leg := range o.Legs {
+		if leg.Side == broker.Sell && (leg.Type == broker.Stop || leg.Type == broker.StopLimit) {
+			return true
+		}
+	}
+	return false
+}
+
+func manageEntry(order *broker.Order, policy EntryPolicy) (*EntryResult, error) {
+	policy = policy.withDefaults()
+
+	b, err := CurrentBroker()
+	if err != nil {
+		return nil, err
+	}
+
+	symbol := order.Symbol
+	ref := order.LimitPrice
+	if ref == 0 {
+		ref = order.StopPrice
+	}
+	chase, maxPrice := policy.chaseLimits(ref)
+
+	clock := replay.NewClock()
+	deadline := clock.Now().Add(policy.Timeout)
+	lastReprice := clock.Now()
+	res := &EntryResult{Order: order}
+
+	LogInfo("ENTRY", "[%s] managing entry %s: limit $%.2f, chase $%.2f, timeout %s",
+		symbol, order.ID, order.LimitPrice, chase, policy.Timeout)
+
+	for {
+		current, err := b.GetOrder(res.Order.ID)
+		if err != nil {
+			LogWarn("ENTRY", symbol, "cannot fetch order %s: %v", res.Order.ID, err)
+		} else {
+			res.Order = current
+		}
+		o := res.Order
+		res.FilledQty, res.FilledAvgPrice = o.FilledQty, o.FilledAvgPrice
+
+		switch {
+		case o.Status == broker.StatusFilled:
+			res.Outcome = EntryFilled
+			LogInfo("ENTRY", "[%s] entry filled: %g @ $%.2f", symbol, o.FilledQty, o.FilledAvgPrice)
+			return res, nil
+		case !o.IsOpen():
+			res.Outcome = EntryCancelled
+			LogWarn("ENTRY", symbol, "entry %s ended %s with %g filled", o.ID, o.Status, o.FilledQty)
+			return res, nil
+		}
+
+		if !clock.Now().Before(deadline) {
+			return giveUpEntry(res, EntryTimedOut)
+		}
+
+		if o.Type != broker.Market {
+			price, err := b.LatestPrice(symbol)
+			if err != nil {
+				LogWarn("ENTRY", symbol, "cannot fetch latest price: %v", err)
+			} else if price > chase {
+				LogWarn("ENTRY", symbol, "price $%.2f ran past chase limit $%.2f", price, chase)
+				return giveUpEntry(res, EntryChased)
+			} else if policy.RepriceStep > 0 && o.Status == broker.StatusNew && price > o.LimitPrice &&
+				o.LimitPrice < maxPrice && clock.Now().Sub(lastReprice) >= policy.RepriceEvery {
+				limit := roundCents(o.LimitPrice + policy.RepriceStep)
+				if limit > maxPrice {
+					limit = maxPrice
+				}
+				replaced, err := b.ReplaceOrder(o.ID, broker.ReplaceRequest{LimitPrice: limit})
+				if err != nil {
+					LogWarn("ENTRY", symbol, "reprice of %s to $%.2f failed: %v", o.ID, limit, err)
+				} else {
+					recordReplacement(b.Name(), o.ID, replaced)
+					LogInfo("ENTRY", "[%s] repriced entry $%.2f → $%.2f (order %s → %s)",
+						symbol, o.LimitPrice, limit, o.ID, replaced.ID)
+					res.Order = replaced
+					res.Reprices++
+				}
+				lastReprice = clock.Now()
+			}
+		}
+
+		clock.Sleep(policy.PollInterval)
+	}
+}
+
+// giveUpEntry cancels what is left of the entry and reports what filled.
+// The order is re-read whether or not the cancel went through: a fill can
+// land between the last poll and the cancel, and a cancel that fails
+// because the order already filled is a filled entry, not an error.
+func giveUpEntry(res *EntryResult, outcome string) (*EntryResult, error) {
+	res.Outcome = outcome
+	o := res.Order
+	cancelErr := CancelOrder(o.ID)
+
+	if b, err := CurrentBroker(); err == nil {
+		if final, err := b.GetOrder(o.ID); err == nil {
+			res.Order = final
+			res.FilledQty, res.FilledAvgPrice = final.FilledQty, final.FilledAvgPrice
+			if final.Status == broker.StatusFilled {
+				res.Outcome = EntryFilled
+				cancelErr = nil
+			}
+		}
+	}
+	if cancelErr != nil {
+		return res, fmt.Errorf("failed to give up on entry %s (%s): %w", o.ID, outcome, cancelErr)
+	}
+	LogInfo("ENTRY", "[%s] entry %s %s with %g filled", o.Symbol, o.ID, res.Outcome, res.FilledQty)
+	return res, nil
+}
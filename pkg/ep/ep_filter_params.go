@@ -0,0 +1,228 @@
+package ep
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Filter parameters
+//
+// FilterParams holds every EP scan threshold.  The realtime scanner, the
+// premarket simulation and the date backtester all take one, and each writes
+// the values it used into its report under "filter_criteria".  Any such
+// report can be fed back into LoadFilterParams to re-run a scan with the
+// thresholds it was produced with.
+// ─────────────────────────────────────────────────────────────────────────────
+
+// DefaultFilterParamsPath is read when EP_FILTERS is not set.
+const DefaultFilterParamsPath = "ep_filters.yaml"
+
+// FilterParams holds the EP filter thresholds.  A zero FilterParams means
+// DefaultFilterParams.
+type FilterParams struct {
+	MinGapUpPercent float64 `json:"min_gap_up_percent" yaml:"min_gap_up_percent"`
+	MinStockPrice   float64 `json:"min_stock_price" yaml:"min_stock_price"`
+	MinDollarVolume float64 `json:"min_dollar_volume" yaml:"min_dollar_volume"`
+	MinMarketCap    float64 `json:"min_market_cap" yaml:"min_market_cap"`
+
+	// Premarket volume vs the average daily volume: ratio and percent.
+	MinPremarketVolRatio      float64 `json:"min_premarket_volume_ratio" yaml:"min_premarket_volume_ratio"`
+	MinPremarketVolPctOfDaily float64 `json:"min_premarket_vol_pct_of_daily" yaml:"min_premarket_vol_pct_of_daily"`
+
+	// Distances from the EMAs, in ADRs.
+	MaxExtensionADR     float64 `json:"max_extension_adr" yaml:"max_extension_adr"`
+	TooExtendedADR      float64 `json:"too_extended_adr" yaml:"too_extended_adr"`
+	NearEMAADRThreshold float64 `json:"near_ema_adr_threshold" yaml:"near_ema_adr_threshold"`
+
+	// Stage 4 criteria (of 7) a realtime/simulated candidate must pass to
+	// qualify as "questionable"; 7/7 is always "confident".
+	MinCriteriaPassed int `json:"min_criteria_passed" yaml:"min_criteria_passed"`
+}
+
+// DefaultFilterParams returns the production thresholds.
+func DefaultFilterParams() FilterParams {
+	return FilterParams{
+		MinGapUpPercent: 8.0,
+		MinStockPrice:   3.00,
+		MinDollarVolume: 10000000, // $10M
+		MinMarketCap:    50000000, // $50M
+
+		// FIX: was 2.0 — strategy requires 3–5x average daily premarket volume
+		MinPremarketVolRatio: 3.0,
+		// FIX: Added minimum premarket vol as % of avg daily volume (strategy: 10–20%)
+		MinPremarketVolPctOfDaily: 10.0,
+
+		MaxExtensionADR:     4.0,
+		TooExtendedADR:      8.0,
+		NearEMAADRThreshold: 2.0, // FIX: strategy says "within 2 ADRs" — was 1.5
+
+		MinCriteriaPassed: 5,
+	}
+}
+
+// orDefault returns DefaultFilterParams for a zero FilterParams.
+func (p FilterParams) orDefault() FilterParams {
+	if p == (FilterParams{}) {
+		return DefaultFilterParams()
+	}
+	return p
+}
+
+// LoadFilterParams reads thresholds from a YAML or JSON file (by extension).
+// Keys that are missing keep their default.  The file may also be a scan or
+// backtest report, in which case its "filter_criteria" object is used.
+func LoadFilterParams(path string) (FilterParams, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return FilterParams{}, fmt.Errorf("failed to read filter params: %w", err)
+	}
+
+	params := DefaultFilterParams()
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		var report struct {
+			FilterCriteria json.RawMessage `json:"filter_criteria"`
+		}
+		if err := json.Unmarshal(data, &report); err != nil {
+			return FilterParams{}, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		if len(report.FilterCriteria) > 0 {
+			data = report.FilterCriteria
+		}
+		if err := json.Unmarshal(data, &params); err != nil {
+			return FilterParams{}, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	} else {
+		var report struct {
+			FilterCriteria *yaml.Node `yaml:"filter_criteria"`
+		}
+		if err := yaml.Unmarshal(data, &report); err != nil {
+			return FilterParams{}, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		if report.FilterCriteria != nil {
+			err = report.FilterCriteria.Decode(&params)
+		} else {
+			err = yaml.Unmarshal(data, &params)
+		}
+		if err != nil {
+			return FilterParams{}, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	}
+
+	if err := params.Validate(); err != nil {
+		return FilterParams{}, fmt.Errorf("invalid filter params in %s: %w", path, err)
+	}
+	return params, nil
+}
+
+// LoadFilterParamsFromEnv loads the file named by EP_FILTERS, falling back to
+// DefaultFilterParamsPath and then to DefaultFilterParams if that does not
+// exist.
+func LoadFilterParamsFromEnv() (FilterParams, error) {
+	if path := os.Getenv("EP_FILTERS"); path != "" {
+		return LoadFilterParams(path)
+	}
+	if _, err := os.Stat(DefaultFilterParamsPath); err != nil {
+		return DefaultFilterParams(), nil
+	}
+	return LoadFilterParams(DefaultFilterParamsPath)
+}
+
+// RegisterFlags adds one flag per threshold to fs, defaulting to the current
+// values of p.
+func (p *FilterParams) RegisterFlags(fs *flag.FlagSet) {
+	fs.Float64Var(&p.MinGapUpPercent, "min-gap-up", p.MinGapUpPercent, "minimum gap up, percent")
+	fs.Float64Var(&p.MinStockPrice, "min-price", p.MinStockPrice, "minimum gap price, dollars")
+	fs.Float64Var(&p.MinDollarVolume, "min-dollar-volume", p.MinDollarVolume, "minimum average dollar volume")
+	fs.Float64Var(&p.MinMarketCap, "min-market-cap", p.MinMarketCap, "minimum market cap, dollars")
+	fs.Float64Var(&p.MinPremarketVolRatio, "min-premarket-vol-ratio", p.MinPremarketVolRatio, "minimum premarket / average daily volume ratio")
+	fs.Float64Var(&p.MinPremarketVolPctOfDaily, "min-premarket-vol-pct", p.MinPremarketVolPctOfDaily, "minimum premarket volume, percent of average daily volume")
+	fs.Float64Var(&p.MaxExtensionADR, "max-extension-adr", p.MaxExtensionADR, "extended above this many ADRs from the 50 EMA")
+	fs.Float64Var(&p.TooExtendedADR, "too-extended-adr", p.TooExtendedADR, "rejected above this many ADRs from the 50 EMA")
+	fs.Float64Var(&p.NearEMAADRThreshold, "near-ema-adr", p.NearEMAADRThreshold, "near the 10/20 EMA within this many ADRs")
+	fs.IntVar(&p.MinCriteriaPassed, "min-passed", p.MinCriteriaPassed, "Stage 4 criteria (of 7) needed to qualify")
+}
+
+// FilterFlags registers -filters plus one flag per threshold on fs.  Call the
+// returned function after fs.Parse: it starts from the -filters file (a params
+// file or any earlier scan/backtest report), else LoadFilterParamsFromEnv, and
+// applies the threshold flags that were set explicitly on top.
+func FilterFlags(fs *flag.FlagSet) func() (FilterParams, error) {
+	path := fs.String("filters", "", "filter params file (YAML/JSON) or a previous scan/backtest report")
+	flagged := DefaultFilterParams()
+	flagged.RegisterFlags(fs)
+
+	return func() (FilterParams, error) {
+		var params FilterParams
+		var err error
+		if *path != "" {
+			params, err = LoadFilterParams(*path)
+		} else {
+			params, err = LoadFilterParamsFromEnv()
+		}
+		if err != nil {
+			return FilterParams{}, err
+		}
+
+		overrides := flag.NewFlagSet("filters", flag.ContinueOnError)
+		params.RegisterFlags(overrides)
+		fs.Visit(func(f *flag.Flag) {
+			if overrides.Lookup(f.Name) != nil && err == nil {
+				err = overrides.Set(f.Name, f.Value.String())
+			}
+		})
+		if err != nil {
+			return FilterParams{}, err
+		}
+		if err := params.Validate(); err != nil {
+			return FilterParams{}, fmt.Errorf("invalid filter params: %w", err)
+		}
+		return params, nil
+	}
+}
+
+// LogFilterParams writes the thresholds in effect to the scan log.
+func LogFilterParams(stage string, p FilterParams) {
+	LogInfo(stage, "Filters        : gap >= %.1f%%  price >= $%.2f  $vol >= $%.0fM  mcap >= $%.0fM",
+		p.MinGapUpPercent, p.MinStockPrice, p.MinDollarVolume/1_000_000, p.MinMarketCap/1_000_000)
+	LogInfo(stage, "                 pm vol >= %.1fx / %.0f%% of daily  ext > %.1f ADR  too ext > %.1f ADR  near EMA <= %.1f ADR  pass >= %d/%d",
+		p.MinPremarketVolRatio, p.MinPremarketVolPctOfDaily, p.MaxExtensionADR, p.TooExtendedADR, p.NearEMAADRThreshold,
+		p.MinCriteriaPassed, STAGE4_CRITERIA)
+}
+
+// Validate reports every out-of-range threshold.
+func (p FilterParams) Validate() error {
+	var problems []string
+	nonNegative := func(name string, v float64) {
+		if v < 0 {
+			problems = append(problems, fmt.Sprintf("%s must not be negative, got %v", name, v))
+		}
+	}
+	nonNegative("min_gap_up_percent", p.MinGapUpPercent)
+	nonNegative("min_stock_price", p.MinStockPrice)
+	nonNegative("min_dollar_volume", p.MinDollarVolume)
+	nonNegative("min_market_cap", p.MinMarketCap)
+	nonNegative("min_premarket_volume_ratio", p.MinPremarketVolRatio)
+	nonNegative("min_premarket_vol_pct_of_daily", p.MinPremarketVolPctOfDaily)
+	nonNegative("max_extension_adr", p.MaxExtensionADR)
+	nonNegative("near_ema_adr_threshold", p.NearEMAADRThreshold)
+	if p.TooExtendedADR < p.MaxExtensionADR {
+		problems = append(problems, fmt.Sprintf("too_extended_adr (%v) must not be below max_extension_adr (%v)",
+			p.TooExtendedADR, p.MaxExtensionADR))
+	}
+	if p.MinCriteriaPassed < 1 || p.MinCriteriaPassed > STAGE4_CRITERIA {
+		problems = append(problems, fmt.Sprintf("min_criteria_passed must be in [1, %d], got %d",
+			STAGE4_CRITERIA, p.MinCriteriaPassed))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
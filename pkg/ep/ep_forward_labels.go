@@ -0,0 +1,465 @@
+package ep
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"avantai/pkg/marketdata"
+)
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Forward-return labels
+//
+// Reads past scan and backtest reports (backtest_*_results.json,
+// scan_*_results.json, filtered_stocks_*.json) and labels every qualifying
+// stock with what it did next:
+//   - open → close on the scan date and 1/3/5/10/20-session returns
+//   - max favourable / adverse excursion over the longest horizon
+//   - whether the opening-range high broke later in the scan session
+//
+// Stage 4 is re-evaluated with the report's own filter_criteria so every row
+// carries its status and the outcome of each criterion, including reports
+// written before the status field existed.
+// ─────────────────────────────────────────────────────────────────────────────
+
+// LabelConfig holds the parameters for LabelScanReports.
+type LabelConfig struct {
+	AlpacaKey    string
+	AlpacaSecret string
+
+	Reports             []string // report files to label
+	Horizons            []int    // forward return horizons in sessions (default 1, 3, 5, 10, 20)
+	OpeningRangeMinutes int      // opening range length after 9:30 EST (default 5)
+	OutputDir           string   // default "data/backtests/labels"
+}
+
+// CandidateLabel is one labelled stock from one report.
+type CandidateLabel struct {
+	Report         string          `json:"report"`
+	Date           string          `json:"date"`
+	Symbol         string          `json:"symbol"`
+	Status         string          `json:"status"` // "confident", "questionable" or "" if it no longer qualifies
+	CriteriaPassed int             `json:"criteria_passed"`
+	Criteria       map[string]bool `json:"criteria"`
+
+	GapUp                float64 `json:"gap_up"`
+	MarketCap            float64 `json:"market_cap"`
+	DollarVolume         float64 `json:"dollar_volume"`
+	PremarketVolumeRatio float64 `json:"premarket_volume_ratio"`
+
+	// Fractions of the scan-date open; Returns is keyed by horizon and only
+	// holds horizons with enough bars.
+	Open         float64         `json:"open"`
+	OpenToClose  float64         `json:"open_to_close"`
+	Returns      map[int]float64 `json:"returns"`
+	MFE          float64         `json:"mfe"`
+	MAE          float64         `json:"mae"`
+	Sessions     int             `json:"sessions"` // daily bars the MFE/MAE cover
+	ORHigh       float64         `json:"or_high"`
+	ORHighBroken bool            `json:"or_high_broken"`
+
+	Error string `json:"error,omitempty"` // why the row has no outcome
+}
+
+// LabelGroupStats summarizes the labels sharing one status or one criterion
+// outcome.
+type LabelGroupStats struct {
+	Group           string         `json:"group"` // "status" or a Stage 4 criterion
+	Value           string         `json:"value"` // status, or "pass" / "fail"
+	Count           int            `json:"count"`
+	Returns         []HorizonStats `json:"returns"`
+	MeanMFE         float64        `json:"mean_mfe"`
+	MeanMAE         float64        `json:"mean_mae"`
+	ORHighBreakRate float64        `json:"or_high_break_rate"`
+}
+
+// LabelReport is written to labels.json.
+type LabelReport struct {
+	Reports     []string          `json:"reports"`
+	Horizons    []int             `json:"horizons"`
+	ORMinutes   int               `json:"opening_range_minutes"`
+	GeneratedAt string            `json:"generated_at"`
+	Labels      []*CandidateLabel `json:"labels"`
+	Summary     []LabelGroupStats `json:"summary"`
+}
+
+// labelSource is the subset of a scan or backtest report the labeller needs.
+// Backtest reports carry the date per stock and no status; realtime reports
+// carry scan_time and status.
+type labelSource struct {
+	BacktestDate     string          `json:"backtest_date"`
+	ScanTime         string          `json:"scan_time"`
+	FilterCriteria   json.RawMessage `json:"filter_criteria"`
+	QualifyingStocks []struct {
+		FilteredStock
+		BacktestDate string  `json:"backtest_date"`
+		GapUsedPrice float64 `json:"gap_used_price"`
+		Status       string  `json:"status"`
+	} `json:"qualifying_stocks"`
+}
+
+// LabelScanReports labels every qualifying stock in cfg.Reports and writes
+// labels.csv, label_summary.csv and labels.json.
+func LabelScanReports(cfg LabelConfig) (*LabelReport, error) {
+	if len(cfg.Horizons) == 0 {
+		cfg.Horizons = []int{1, 3, 5, 10, 20}
+	}
+	if cfg.OpeningRangeMinutes == 0 {
+		cfg.OpeningRangeMinutes = 5
+	}
+	if cfg.OutputDir == "" {
+		cfg.OutputDir = "data/backtests/labels"
+	}
+	if len(cfg.Reports) == 0 {
+		return nil, fmt.Errorf("no reports given")
+	}
+	for _, h := range cfg.Horizons {
+		if h < 1 {
+			return nil, fmt.Errorf("horizon must be at least 1 session, got %d", h)
+		}
+	}
+	sort.Ints(cfg.Horizons)
+
+	est, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load EST timezone: %v", err)
+	}
+
+	logger, err := InitLogger("data/backtests/logs", "labels")
+	if err != nil {
+		fmt.Printf("⚠️  Could not create log file: %v\n", err)
+	} else {
+		defer logger.Close()
+	}
+
+	LogSection("FORWARD-RETURN LABELS")
+	LogInfo("LABEL", "Reports        : %d", len(cfg.Reports))
+	LogInfo("LABEL", "Horizons       : %v sessions", cfg.Horizons)
+	LogInfo("LABEL", "Opening range  : %d min", cfg.OpeningRangeMinutes)
+
+	var labels []*CandidateLabel
+	for _, path := range cfg.Reports {
+		reportLabels, err := readLabelSource(path)
+		if err != nil {
+			LogError("LABEL", "", "Skipping %s: %v", path, err)
+			continue
+		}
+		LogInfo("LABEL", "%s: %d stocks", path, len(reportLabels))
+		labels = append(labels, reportLabels...)
+	}
+
+	provider, err := newCachedMarketDataProvider(AlpacaConfig{
+		APIKey:    cfg.AlpacaKey,
+		APISecret: cfg.AlpacaSecret,
+		BaseURL:   "https://paper-api.alpaca.markets",
+		DataURL:   "https://data.alpaca.markets",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	LogSection("FETCHING OUTCOMES")
+	for i, l := range labels {
+		if (i+1)%25 == 0 {
+			LogProgress("LABEL", i+1, len(labels), "")
+		}
+		if err := labelOutcome(provider, cfg, l, est); err != nil {
+			l.Error = err.Error()
+			LogWarn("LABEL", l.Symbol, "%s: %v", l.Date, err)
+		}
+	}
+
+	report := &LabelReport{
+		Reports:     cfg.Reports,
+		Horizons:    cfg.Horizons,
+		ORMinutes:   cfg.OpeningRangeMinutes,
+		GeneratedAt: time.Now().Format(time.RFC3339),
+		Labels:      labels,
+		Summary:     summarizeLabels(labels, cfg.Horizons),
+	}
+	if err := writeLabelReport(cfg, report); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// readLabelSource turns one report into unlabelled rows, re-running Stage 4
+// with the report's thresholds.
+func readLabelSource(path string) ([]*CandidateLabel, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report: %w", err)
+	}
+	var src labelSource
+	if err := json.Unmarshal(data, &src); err != nil {
+		return nil, fmt.Errorf("failed to parse report: %w", err)
+	}
+
+	// Older reports wrote filter_criteria in a different shape; those are
+	// re-evaluated with the defaults.
+	params := DefaultFilterParams()
+	if len(src.FilterCriteria) > 0 {
+		if err := json.Unmarshal(src.FilterCriteria, &params); err != nil {
+			LogWarn("LABEL", "", "%s: unreadable filter_criteria, using defaults: %v", path, err)
+			params = DefaultFilterParams()
+		}
+	}
+
+	reportDate := src.BacktestDate
+	if reportDate == "" && len(src.ScanTime) >= 10 {
+		reportDate = src.ScanTime[:10]
+	}
+
+	var labels []*CandidateLabel
+	for _, s := range src.QualifyingStocks {
+		date := s.BacktestDate
+		if date == "" {
+			date = reportDate
+		}
+		if date == "" {
+			return nil, fmt.Errorf("no backtest_date or scan_time for %s", s.Symbol)
+		}
+
+		stock := RealtimeResult{FilteredStock: s.FilteredStock, GapUsedPrice: s.GapUsedPrice}
+		criteria := stage4Criteria(params, stock)
+		status, passed := classifyStage4(params, stock, criteria)
+		if s.Status != "" {
+			status = s.Status
+		}
+
+		l := &CandidateLabel{
+			Report:               path,
+			Date:                 date,
+			Symbol:               s.Symbol,
+			Status:               status,
+			CriteriaPassed:       passed,
+			Criteria:             make(map[string]bool, len(criteria)),
+			GapUp:                s.StockInfo.GapUp,
+			MarketCap:            s.StockInfo.MarketCap,
+			DollarVolume:         s.StockInfo.DolVol,
+			PremarketVolumeRatio: s.StockInfo.PremarketVolumeRatio,
+			Returns:              map[int]float64{},
+		}
+		for _, c := range criteria {
+			l.Criteria[c.name] = c.passed
+		}
+		labels = append(labels, l)
+	}
+	return labels, nil
+}
+
+// labelOutcome fills in the returns, excursions and opening-range break for
+// one row.
+func labelOutcome(provider marketdata.Provider, cfg LabelConfig, l *CandidateLabel, loc *time.Location) error {
+	maxHorizon := cfg.Horizons[len(cfg.Horizons)-1]
+	bars, err := forwardSessions(provider, l.Symbol, l.Date, maxHorizon, loc)
+	if err != nil {
+		return err
+	}
+
+	l.Open = bars[0].Open
+	l.Sessions = len(bars)
+	l.OpenToClose, _ = forwardReturn(bars, 1)
+	for _, h := range cfg.Horizons {
+		if ret, ok := forwardReturn(bars, h); ok {
+			l.Returns[h] = ret
+		}
+	}
+	if l.Open > 0 {
+		high, low := bars[0].High, bars[0].Low
+		for _, b := range bars[1:] {
+			high = math.Max(high, b.High)
+			low = math.Min(low, b.Low)
+		}
+		l.MFE = high/l.Open - 1
+		l.MAE = low/l.Open - 1
+	}
+
+	// Opening range: the first OpeningRangeMinutes of the regular session.
+	day, _ := time.ParseInLocation("2006-01-02", l.Date, loc)
+	openNY := day.Add(9*time.Hour + 30*time.Minute)
+	closeNY := day.Add(16 * time.Hour)
+	minutes, err := provider.MinuteBars(l.Symbol, openNY, closeNY, marketdata.AdjustmentSplit)
+	if err != nil {
+		return fmt.Errorf("failed to fetch minute bars: %w", err)
+	}
+	sort.Slice(minutes, func(i, j int) bool { return minutes[i].Time.Before(minutes[j].Time) })
+	orEnd := openNY.Add(time.Duration(cfg.OpeningRangeMinutes) * time.Minute)
+	for _, b := range minutes {
+		if b.Time.Before(orEnd) {
+			l.ORHigh = math.Max(l.ORHigh, b.High)
+		} else if l.ORHigh > 0 && b.High > l.ORHigh {
+			l.ORHighBroken = true
+			break
+		}
+	}
+	return nil
+}
+
+// summarizeLabels groups the labelled rows by status and by the pass/fail
+// outcome of each Stage 4 criterion.  Rows without an outcome are left out.
+func summarizeLabels(labels []*CandidateLabel, horizons []int) []LabelGroupStats {
+	type key struct{ group, value string }
+	groups := make(map[key][]*CandidateLabel)
+	var order []key
+	add := func(k key, l *CandidateLabel) {
+		if _, ok := groups[k]; !ok {
+			order = append(order, k)
+		}
+		groups[k] = append(groups[k], l)
+	}
+
+	criterionNames := stage4CriterionNames()
+	for _, l := range labels {
+		if l.Error != "" {
+			continue
+		}
+		status := l.Status
+		if status == "" {
+			status = "rejected"
+		}
+		add(key{"status", status}, l)
+	}
+	for _, name := range criterionNames {
+		for _, l := range labels {
+			if l.Error != "" {
+				continue
+			}
+			value := "fail"
+			if l.Criteria[name] {
+				value = "pass"
+			}
+			add(key{name, value}, l)
+		}
+	}
+
+	var out []LabelGroupStats
+	for _, k := range order {
+		rows := groups[k]
+		stats := LabelGroupStats{Group: k.group, Value: k.value, Count: len(rows)}
+		broke := 0
+		for _, l := range rows {
+			stats.MeanMFE += l.MFE
+			stats.MeanMAE += l.MAE
+			if l.ORHighBroken {
+				broke++
+			}
+		}
+		stats.MeanMFE /= float64(len(rows))
+		stats.MeanMAE /= float64(len(rows))
+		stats.ORHighBreakRate = float64(broke) / float64(len(rows))
+		for _, h := range horizons {
+			var returns []float64
+			for _, l := range rows {
+				if ret, ok := l.Returns[h]; ok {
+					returns = append(returns, ret)
+				}
+			}
+			stats.Returns = append(stats.Returns, summarizeReturns(h, returns))
+		}
+		out = append(out, stats)
+	}
+	return out
+}
+
+// stage4CriterionNames returns the Stage 4 criterion names in check order.
+func stage4CriterionNames() []string {
+	var names []string
+	for _, c := range stage4Criteria(DefaultFilterParams(), RealtimeResult{}) {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Output
+// ─────────────────────────────────────────────────────────────────────────────
+
+func writeLabelReport(cfg LabelConfig, report *LabelReport) error {
+	if err := os.MkdirAll(cfg.OutputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	criterionNames := stage4CriterionNames()
+	pct := func(v float64) string { return fmt.Sprintf("%.4f", v) }
+
+	header := []string{"Date", "Symbol", "Status", "CriteriaPassed"}
+	header = append(header, criterionNames...)
+	header = append(header, "GapUp", "MarketCap", "DollarVolume", "PremarketVolumeRatio", "Open", "OpenToClose")
+	for _, h := range report.Horizons {
+		header = append(header, fmt.Sprintf("Return_%dd", h))
+	}
+	header = append(header, "MFE", "MAE", "Sessions", "ORHigh", "ORHighBroken", "Error", "Report")
+
+	rows := [][]string{header}
+	for _, l := range report.Labels {
+		row := []string{l.Date, l.Symbol, l.Status, strconv.Itoa(l.CriteriaPassed)}
+		for _, name := range criterionNames {
+			row = append(row, strconv.FormatBool(l.Criteria[name]))
+		}
+		row = append(row,
+			fmt.Sprintf("%.2f", l.GapUp),
+			fmt.Sprintf("%.0f", l.MarketCap),
+			fmt.Sprintf("%.0f", l.DollarVolume),
+			fmt.Sprintf("%.2f", l.PremarketVolumeRatio),
+			fmt.Sprintf("%.2f", l.Open),
+		)
+		if l.Error != "" {
+			row = append(row, "")
+		} else {
+			row = append(row, pct(l.OpenToClose))
+		}
+		for _, h := range report.Horizons {
+			if ret, ok := l.Returns[h]; ok {
+				row = append(row, pct(ret))
+			} else {
+				row = append(row, "")
+			}
+		}
+		row = append(row,
+			pct(l.MFE), pct(l.MAE), strconv.Itoa(l.Sessions),
+			fmt.Sprintf("%.2f", l.ORHigh), strconv.FormatBool(l.ORHighBroken),
+			l.Error, l.Report,
+		)
+		rows = append(rows, row)
+	}
+	if err := writeCSVFile(filepath.Join(cfg.OutputDir, "labels.csv"), rows); err != nil {
+		return err
+	}
+
+	header = []string{"Group", "Value", "Count"}
+	for _, h := range report.Horizons {
+		header = append(header, fmt.Sprintf("N_%dd", h), fmt.Sprintf("Mean_%dd", h),
+			fmt.Sprintf("Median_%dd", h), fmt.Sprintf("WinRate_%dd", h))
+	}
+	header = append(header, "MeanMFE", "MeanMAE", "ORHighBrokeRate")
+	rows = [][]string{header}
+	for _, g := range report.Summary {
+		row := []string{g.Group, g.Value, strconv.Itoa(g.Count)}
+		for _, s := range g.Returns {
+			row = append(row, strconv.Itoa(s.N), pct(s.Mean), pct(s.Median), pct(s.WinRate))
+		}
+		row = append(row, pct(g.MeanMFE), pct(g.MeanMAE), pct(g.ORHighBreakRate))
+		rows = append(rows, row)
+	}
+	if err := writeCSVFile(filepath.Join(cfg.OutputDir, "label_summary.csv"), rows); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal report: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(cfg.OutputDir, "labels.json"), data, 0644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+
+	LogInfo("LABEL", "Labels written to %s", cfg.OutputDir)
+	return nil
+}
@@ -0,0 +1,51 @@
+package ep
+
+import (
+	"fmt"
+	"time"
+
+	"avantai/pkg/marketdata"
+)
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Forward returns
+//
+// Returns are measured from the regular-session open on the scan date.  The
+// N-day return uses the close of the Nth session counting the scan date as
+// session 1, so the 1-day return is open → close on the gap day itself.
+// ─────────────────────────────────────────────────────────────────────────────
+
+// forwardSessions returns up to n daily bars starting with date's session.
+// It returns an error if the first bar is not on date (no trading that day).
+func forwardSessions(provider marketdata.Provider, symbol, date string, n int, loc *time.Location) ([]marketdata.Bar, error) {
+	start, err := time.ParseInLocation("2006-01-02", date, loc)
+	if err != nil {
+		return nil, err
+	}
+	// Calendar days needed for n sessions, with room for holidays.
+	end := start.AddDate(0, 0, n*7/5+10)
+	if today := time.Now().In(loc); end.After(today) {
+		end = today
+	}
+
+	bars, err := provider.DailyBars(symbol, start, end, marketdata.AdjustmentSplit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch daily bars: %w", err)
+	}
+	if len(bars) == 0 || bars[0].Time.UTC().Format("2006-01-02") != date {
+		return nil, fmt.Errorf("no session bar on %s", date)
+	}
+	if len(bars) > n {
+		bars = bars[:n]
+	}
+	return bars, nil
+}
+
+// forwardReturn is the return from the first bar's open to the close of the
+// Nth bar.  ok is false when fewer than n bars are available.
+func forwardReturn(bars []marketdata.Bar, n int) (ret float64, ok bool) {
+	if n < 1 || len(bars) < n || bars[0].Open <= 0 {
+		return 0, false
+	}
+	return bars[n-1].Close/bars[0].Open - 1, true
+}
@@ -0,0 +1,414 @@
+package ep
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Filter grid search
+//
+// Sweeps the gap %, premarket volume ratio and Stage 4 pass threshold over a
+// list of scan dates:
+//   1. each date is scanned once through Stage 3 (simulateThroughStage3) with
+//      the loosest gap in the grid and every other threshold from Base
+//   2. forward daily bars are fetched once per (date, symbol) through the
+//      on-disk market data cache
+//   3. every combination is applied to the same Stage 3 output in memory and
+//      scored by candidate count and 1/5/20-day forward returns
+//
+// Stage 2 and Stage 3 (market cap, price, dollar volume, the EMA/ADR flags)
+// always use Base, so only the Stage 1 gap and the Stage 4 checks vary.
+// ─────────────────────────────────────────────────────────────────────────────
+
+// GridSearchConfig holds the parameters for RunGridSearch.
+type GridSearchConfig struct {
+	AlpacaKey    string
+	AlpacaSecret string
+	FinnhubKey   string
+
+	Dates        []string     // scan dates, "2025-07-28"
+	ScanTime     string       // premarket scan time, HH:MM EST (default "09:00")
+	LookbackDays int          // days of history for Stage 3 (default 300)
+	Base         FilterParams // thresholds not swept; zero means DefaultFilterParams
+
+	GapUpPercents      []float64 // MinGapUpPercent values (default Base only)
+	PremarketVolRatios []float64 // MinPremarketVolRatio values (default Base only)
+	MinCriteriaPassed  []int     // MinCriteriaPassed values (default Base only)
+
+	Horizons    []int  // forward return horizons in sessions (default 1, 5, 20)
+	Concurrency int    // dates scanned at once (default 2)
+	OutputDir   string // default "data/backtests/grid"
+}
+
+// HorizonStats summarizes the N-session forward returns of one combination.
+type HorizonStats struct {
+	Days    int     `json:"days"`
+	N       int     `json:"n"`        // candidates with enough bars
+	Mean    float64 `json:"mean"`     // fraction, 0.05 = +5%
+	Median  float64 `json:"median"`   // fraction
+	WinRate float64 `json:"win_rate"` // fraction of returns > 0
+}
+
+// GridResult is one threshold combination.
+type GridResult struct {
+	Params       FilterParams   `json:"params"`
+	Candidates   int            `json:"candidates"`
+	Confident    int            `json:"confident"`
+	Questionable int            `json:"questionable"`
+	Returns      []HorizonStats `json:"returns"`
+	Symbols      []string       `json:"symbols"` // "2025-07-28:ABCD"
+}
+
+// GridSearchReport is written to grid_report.json.
+type GridSearchReport struct {
+	Dates       []string      `json:"dates"`
+	ScanTime    string        `json:"scan_time"`
+	Base        FilterParams  `json:"filter_criteria"`
+	Horizons    []int         `json:"horizons"`
+	GeneratedAt string        `json:"generated_at"`
+	Results     []*GridResult `json:"results"`
+}
+
+// gridCandidate is one Stage 3 survivor with its forward returns.
+type gridCandidate struct {
+	date    string
+	stock   RealtimeResult
+	returns map[int]float64 // horizon → return; missing when bars ran out
+}
+
+// RunGridSearch scans every date once and scores every threshold combination.
+func RunGridSearch(cfg GridSearchConfig) (*GridSearchReport, error) {
+	if cfg.ScanTime == "" {
+		cfg.ScanTime = "09:00"
+	}
+	if cfg.LookbackDays == 0 {
+		cfg.LookbackDays = 300
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 2
+	}
+	if cfg.OutputDir == "" {
+		cfg.OutputDir = "data/backtests/grid"
+	}
+	if len(cfg.Horizons) == 0 {
+		cfg.Horizons = []int{1, 5, 20}
+	}
+	cfg.Base = cfg.Base.orDefault()
+	if len(cfg.GapUpPercents) == 0 {
+		cfg.GapUpPercents = []float64{cfg.Base.MinGapUpPercent}
+	}
+	if len(cfg.PremarketVolRatios) == 0 {
+		cfg.PremarketVolRatios = []float64{cfg.Base.MinPremarketVolRatio}
+	}
+	if len(cfg.MinCriteriaPassed) == 0 {
+		cfg.MinCriteriaPassed = []int{cfg.Base.MinCriteriaPassed}
+	}
+	if len(cfg.Dates) == 0 {
+		return nil, fmt.Errorf("no scan dates given")
+	}
+
+	combos, err := gridCombinations(cfg)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range cfg.Horizons {
+		if h < 1 {
+			return nil, fmt.Errorf("horizon must be at least 1 session, got %d", h)
+		}
+	}
+
+	dates := append([]string(nil), cfg.Dates...)
+	sort.Strings(dates)
+
+	logger, err := InitLogger("data/backtests/logs", fmt.Sprintf("grid_%s_%s",
+		strings.ReplaceAll(dates[0], "-", ""), strings.ReplaceAll(dates[len(dates)-1], "-", "")))
+	if err != nil {
+		fmt.Printf("⚠️  Could not create log file: %v\n", err)
+	} else {
+		defer logger.Close()
+	}
+
+	LogSection("EP FILTER GRID SEARCH")
+	LogInfo("GRID", "Dates          : %d (%s → %s) at %s EST", len(dates), dates[0], dates[len(dates)-1], cfg.ScanTime)
+	LogInfo("GRID", "Combinations   : %d gap × %d pm ratio × %d pass = %d",
+		len(cfg.GapUpPercents), len(cfg.PremarketVolRatios), len(cfg.MinCriteriaPassed), len(combos))
+	LogInfo("GRID", "Horizons       : %v sessions", cfg.Horizons)
+	LogFilterParams("GRID", cfg.Base)
+
+	candidates := scanGridDates(cfg, dates, combos)
+
+	LogSection("FORWARD RETURNS")
+	fetchGridReturns(cfg, candidates)
+
+	LogSection("SCORING")
+	report := &GridSearchReport{
+		Dates:       dates,
+		ScanTime:    cfg.ScanTime,
+		Base:        cfg.Base,
+		Horizons:    cfg.Horizons,
+		GeneratedAt: time.Now().Format("2006-01-02 15:04:05"),
+	}
+	for _, params := range combos {
+		report.Results = append(report.Results, scoreGridCombination(params, cfg.Horizons, candidates))
+	}
+	for _, r := range report.Results {
+		LogInfo("GRID", "gap>=%4.1f%%  pm>=%.1fx  pass>=%d/%d  →  %3d candidates (%d confident)",
+			r.Params.MinGapUpPercent, r.Params.MinPremarketVolRatio, r.Params.MinCriteriaPassed, STAGE4_CRITERIA,
+			r.Candidates, r.Confident)
+	}
+
+	if err := writeGridSearchReport(cfg, report); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// gridCombinations returns Base with every combination of the swept values,
+// validating each.
+func gridCombinations(cfg GridSearchConfig) ([]FilterParams, error) {
+	var combos []FilterParams
+	for _, gap := range cfg.GapUpPercents {
+		for _, ratio := range cfg.PremarketVolRatios {
+			for _, passed := range cfg.MinCriteriaPassed {
+				params := cfg.Base
+				params.MinGapUpPercent = gap
+				params.MinPremarketVolRatio = ratio
+				params.MinCriteriaPassed = passed
+				if err := params.Validate(); err != nil {
+					return nil, fmt.Errorf("invalid grid point gap=%v ratio=%v passed=%d: %w", gap, ratio, passed, err)
+				}
+				combos = append(combos, params)
+			}
+		}
+	}
+	return combos, nil
+}
+
+// scanGridDates runs Stages 1–3 for each date with the loosest gap in the
+// grid, cfg.Concurrency dates at a time.  Dates that fail are logged and
+// skipped.
+func scanGridDates(cfg GridSearchConfig, dates []string, combos []FilterParams) []*gridCandidate {
+	loosest := combos[0]
+	for _, params := range combos[1:] {
+		if params.MinGapUpPercent < loosest.MinGapUpPercent {
+			loosest.MinGapUpPercent = params.MinGapUpPercent
+		}
+	}
+
+	var (
+		mu         sync.Mutex
+		wg         sync.WaitGroup
+		candidates []*gridCandidate
+	)
+	sem := make(chan struct{}, cfg.Concurrency)
+	for _, date := range dates {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(date string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			stocks, _, err := simulateThroughStage3(SimulationConfig{
+				AlpacaKey:      cfg.AlpacaKey,
+				AlpacaSecret:   cfg.AlpacaSecret,
+				FinnhubKey:     cfg.FinnhubKey,
+				Date:           date,
+				SimulateAtTime: cfg.ScanTime,
+				LookbackDays:   cfg.LookbackDays,
+				Filters:        loosest,
+			})
+			if err != nil {
+				LogError("GRID", "", "Scan for %s failed: %v", date, err)
+				return
+			}
+			LogInfo("GRID", "%s: %d stocks through Stage 3", date, len(stocks))
+
+			mu.Lock()
+			defer mu.Unlock()
+			for _, s := range stocks {
+				candidates = append(candidates, &gridCandidate{date: date, stock: s, returns: map[int]float64{}})
+			}
+		}(date)
+	}
+	wg.Wait()
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].date != candidates[j].date {
+			return candidates[i].date < candidates[j].date
+		}
+		return candidates[i].stock.Symbol < candidates[j].stock.Symbol
+	})
+	return candidates
+}
+
+// fetchGridReturns fills in each candidate's forward returns.
+func fetchGridReturns(cfg GridSearchConfig, candidates []*gridCandidate) {
+	est, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		LogError("GRID", "", "Failed to load EST timezone: %v", err)
+		return
+	}
+	provider, err := newCachedMarketDataProvider(AlpacaConfig{
+		APIKey:    cfg.AlpacaKey,
+		APISecret: cfg.AlpacaSecret,
+		BaseURL:   "https://paper-api.alpaca.markets",
+		DataURL:   "https://data.alpaca.markets",
+	})
+	if err != nil {
+		LogError("GRID", "", "Market data provider: %v", err)
+		return
+	}
+
+	maxHorizon := 0
+	for _, h := range cfg.Horizons {
+		if h > maxHorizon {
+			maxHorizon = h
+		}
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, MAX_CONCURRENT)
+	rateLimiter := time.Tick(time.Second / API_CALLS_PER_SECOND)
+	for _, c := range candidates {
+		<-rateLimiter
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(c *gridCandidate) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			bars, err := forwardSessions(provider, c.stock.Symbol, c.date, maxHorizon, est)
+			if err != nil {
+				LogWarn("GRID", c.stock.Symbol, "No forward bars from %s: %v", c.date, err)
+				return
+			}
+			for _, h := range cfg.Horizons {
+				if ret, ok := forwardReturn(bars, h); ok {
+					c.returns[h] = ret
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+}
+
+// scoreGridCombination applies one combination's gap and Stage 4 thresholds
+// to the shared candidates.
+func scoreGridCombination(params FilterParams, horizons []int, candidates []*gridCandidate) *GridResult {
+	result := &GridResult{Params: params, Symbols: []string{}}
+	returns := make(map[int][]float64)
+
+	for _, c := range candidates {
+		if c.stock.StockInfo.GapUp < params.MinGapUpPercent {
+			continue
+		}
+		status, _ := classifyStage4(params, c.stock, stage4Criteria(params, c.stock))
+		switch status {
+		case "confident":
+			result.Confident++
+		case "questionable":
+			result.Questionable++
+		default:
+			continue
+		}
+		result.Candidates++
+		result.Symbols = append(result.Symbols, c.date+":"+c.stock.Symbol)
+		for _, h := range horizons {
+			if ret, ok := c.returns[h]; ok {
+				returns[h] = append(returns[h], ret)
+			}
+		}
+	}
+
+	for _, h := range horizons {
+		result.Returns = append(result.Returns, summarizeReturns(h, returns[h]))
+	}
+	return result
+}
+
+func summarizeReturns(days int, returns []float64) HorizonStats {
+	stats := HorizonStats{Days: days, N: len(returns)}
+	if len(returns) == 0 {
+		return stats
+	}
+
+	sorted := append([]float64(nil), returns...)
+	sort.Float64s(sorted)
+	sum, wins := 0.0, 0
+	for _, r := range sorted {
+		sum += r
+		if r > 0 {
+			wins++
+		}
+	}
+	stats.Mean = sum / float64(len(sorted))
+	stats.WinRate = float64(wins) / float64(len(sorted))
+	if mid := len(sorted) / 2; len(sorted)%2 == 1 {
+		stats.Median = sorted[mid]
+	} else {
+		stats.Median = (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return stats
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Output
+// ─────────────────────────────────────────────────────────────────────────────
+
+func writeGridSearchReport(cfg GridSearchConfig, report *GridSearchReport) error {
+	dir := filepath.Join(cfg.OutputDir, fmt.Sprintf("%s_%s_%s",
+		strings.ReplaceAll(report.Dates[0], "-", ""),
+		strings.ReplaceAll(report.Dates[len(report.Dates)-1], "-", ""),
+		strings.ReplaceAll(cfg.ScanTime, ":", "")))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	header := []string{"MinGapUpPercent", "MinPremarketVolRatio", "MinCriteriaPassed", "Candidates", "Confident", "Questionable"}
+	for _, h := range report.Horizons {
+		header = append(header,
+			fmt.Sprintf("N_%dd", h), fmt.Sprintf("Mean_%dd", h),
+			fmt.Sprintf("Median_%dd", h), fmt.Sprintf("WinRate_%dd", h))
+	}
+	rows := [][]string{header}
+	for _, r := range report.Results {
+		row := []string{
+			fmt.Sprintf("%.2f", r.Params.MinGapUpPercent),
+			fmt.Sprintf("%.2f", r.Params.MinPremarketVolRatio),
+			strconv.Itoa(r.Params.MinCriteriaPassed),
+			strconv.Itoa(r.Candidates),
+			strconv.Itoa(r.Confident),
+			strconv.Itoa(r.Questionable),
+		}
+		for _, s := range r.Returns {
+			row = append(row,
+				strconv.Itoa(s.N),
+				fmt.Sprintf("%.4f", s.Mean),
+				fmt.Sprintf("%.4f", s.Median),
+				fmt.Sprintf("%.4f", s.WinRate))
+		}
+		rows = append(rows, row)
+	}
+	if err := writeCSVFile(filepath.Join(dir, "grid_results.csv"), rows); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal report: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "grid_report.json"), data, 0644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+
+	LogInfo("GRID", "Results written to %s", dir)
+	return nil
+}
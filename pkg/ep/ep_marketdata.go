@@ -0,0 +1,86 @@
+package ep
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"avantai/pkg/marketdata"
+)
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Market-data provider wiring
+// ─────────────────────────────────────────────────────────────────────────────
+
+// newMarketDataProvider returns the provider named by MARKET_DATA_PROVIDER.
+// When unset (or set to "alpaca") it builds an Alpaca provider from the
+// scanner's own credentials and URLs so existing configs keep working.  An
+// unknown or unconfigured provider is an error rather than a silent fallback,
+// so a typo never quietly swaps the data source under a run.
+func newMarketDataProvider(config AlpacaConfig) (marketdata.Provider, error) {
+	name := strings.ToLower(strings.TrimSpace(os.Getenv("MARKET_DATA_PROVIDER")))
+	if name != "" && name != marketdata.ProviderAlpaca {
+		p, err := marketdata.NewProvider(name)
+		if err != nil {
+			return nil, fmt.Errorf("MARKET_DATA_PROVIDER=%s: %w", name, err)
+		}
+		return p, nil
+	}
+
+	p := marketdata.NewAlpacaProvider(config.APIKey, config.APISecret)
+	if config.DataURL != "" {
+		p.DataURL = config.DataURL
+	}
+	if config.BaseURL != "" {
+		p.TradingURL = config.BaseURL
+	}
+	return p, nil
+}
+
+// newCachedMarketDataProvider is newMarketDataProvider behind the on-disk bar
+// cache.  Used by the backtest and simulation paths, which request the same
+// historical windows over and over.
+func newCachedMarketDataProvider(config AlpacaConfig) (marketdata.Provider, error) {
+	p, err := newMarketDataProvider(config)
+	if err != nil {
+		return nil, err
+	}
+	return marketdata.NewCachedProvider(p, marketdata.CacheDirFromEnv()), nil
+}
+
+// toAlpacaBarData converts provider bars into AlpacaBarData rows for symbol.
+func toAlpacaBarData(symbol string, bars []marketdata.Bar) []AlpacaBarData {
+	out := make([]AlpacaBarData, 0, len(bars))
+	for _, b := range bars {
+		out = append(out, AlpacaBarData{
+			Symbol:    symbol,
+			Timestamp: b.Time.UTC().Format(time.RFC3339),
+			Open:      b.Open,
+			High:      b.High,
+			Low:       b.Low,
+			Close:     b.Close,
+			Volume:    b.Volume,
+		})
+	}
+	return out
+}
+
+// toAlpacaBars converts provider bars into the AlpacaBar shape the stage
+// functions and indicator helpers already consume.
+func toAlpacaBars(bars []marketdata.Bar) []AlpacaBar {
+	out := make([]AlpacaBar, 0, len(bars))
+	for _, b := range bars {
+		out = append(out, AlpacaBar{
+			Timestamp:  b.Time.UTC().Format(time.RFC3339),
+			Open:       b.Open,
+			High:       b.High,
+			Low:        b.Low,
+			Close:      b.Close,
+			Volume:     b.Volume,
+			VWAP:       b.VWAP,
+			TradeCount: b.TradeCount,
+		})
+	}
+	return out
+}
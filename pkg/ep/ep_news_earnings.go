@@ -1,6 +1,7 @@
 package ep
 
 import (
+	"avantai/pkg/replay"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -262,7 +263,7 @@ func fetchFullEarningsContent(client *http.Client, earnings []EarningsReport) []
 			// Parse report date
 			reportDate, err := time.Parse("2006-01-02", e.ReportDate)
 			if err != nil {
-				reportDate = time.Now()
+				reportDate = replay.Now()
 			}
 
 			// Fetch earnings content from SEC EDGAR or original URL
@@ -1475,7 +1476,7 @@ func parseTargetDate(dateStr string) (time.Time, error) {
 	}
 
 	// Default to yesterday
-	return time.Now().AddDate(0, 0, -1), nil
+	return replay.Now().AddDate(0, 0, -1), nil
 }
 
 func parseYahooDate(timeText string, targetDate time.Time) time.Time {
@@ -1486,7 +1487,7 @@ func parseYahooDate(timeText string, targetDate time.Time) time.Time {
 			re := regexp.MustCompile(`(\d+)h`)
 			if matches := re.FindStringSubmatch(timeText); len(matches) > 1 {
 				if hours, err := strconv.Atoi(matches[1]); err == nil {
-					return time.Now().Add(-time.Duration(hours) * time.Hour)
+					return replay.Now().Add(-time.Duration(hours) * time.Hour)
 				}
 			}
 		} else if strings.Contains(timeText, "d") {
@@ -1494,7 +1495,7 @@ func parseYahooDate(timeText string, targetDate time.Time) time.Time {
 			re := regexp.MustCompile(`(\d+)d`)
 			if matches := re.FindStringSubmatch(timeText); len(matches) > 1 {
 				if days, err := strconv.Atoi(matches[1]); err == nil {
-					return time.Now().AddDate(0, 0, -days)
+					return replay.Now().AddDate(0, 0, -days)
 				}
 			}
 		}
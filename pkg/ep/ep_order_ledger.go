@@ -0,0 +1,164 @@
+package ep
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"avantai/pkg/broker"
+)
+
+// DEFAULT_ORDER_LEDGER is where orders placed through this package are
+// recorded unless ORDER_LEDGER names another file.
+const DEFAULT_ORDER_LEDGER = "data/ledger/orders.jsonl"
+
+var (
+	ledgerMu    sync.Mutex
+	orderLedger *broker.Ledger
+	ledgerIDs   = make(map[string]bool) // order IDs (legs included) in the ledger
+)
+
+// OrderLedgerPath returns the ledger file in use: ORDER_LEDGER, else
+// DEFAULT_ORDER_LEDGER.
+func OrderLedgerPath() string {
+	if p := os.Getenv("ORDER_LEDGER"); p != "" {
+		return p
+	}
+	return DEFAULT_ORDER_LEDGER
+}
+
+// SetOrderLedger replaces the ledger that order functions append to.
+func SetOrderLedger(l *broker.Ledger) {
+	ledgerMu.Lock()
+	defer ledgerMu.Unlock()
+	orderLedger = l
+	ledgerIDs = make(map[string]bool)
+	if l != nil {
+		loadLedgerIDs(l.Path())
+	}
+}
+
+// currentLedger opens the ledger on first use so binaries that never place
+// an order never create it.
+func currentLedger() (*broker.Ledger, error) {
+	ledgerMu.Lock()
+	defer ledgerMu.Unlock()
+	if orderLedger == nil {
+		l, err := broker.OpenLedger(OrderLedgerPath())
+		if err != nil {
+			return nil, err
+		}
+		orderLedger = l
+		loadLedgerIDs(l.Path())
+	}
+	return orderLedger, nil
+}
+
+// loadLedgerIDs seeds ledgerIDs from the file.  Callers hold ledgerMu.
+func loadLedgerIDs(path string) {
+	entries, err := broker.ReadLedger(path)
+	if err != nil {
+		log.Printf("⚠️  %v", err)
+		return
+	}
+	for _, e := range entries {
+		ledgerIDs[e.OrderID] = true
+	}
+}
+
+// inLedger reports whether orderID was placed through this package.
+func inLedger(orderID string) bool {
+	if _, err := currentLedger(); err != nil {
+		return false
+	}
+	ledgerMu.Lock()
+	defer ledgerMu.Unlock()
+	return ledgerIDs[orderID]
+}
+
+// recordOrder appends an order event to the ledger.  A ledger failure is
+// logged, never returned: the order has already reached the broker.
+func recordOrder(event, brokerName string, order *broker.Order, expectedPrice float64) {
+	l, err := currentLedger()
+	if err == nil {
+		err = l.RecordOrder(event, brokerName, order, expectedPrice)
+	}
+	if err == nil {
+		ledgerMu.Lock()
+		ledgerIDs[order.ID] = true
+		for _, leg := range order.Legs {
+			ledgerIDs[leg.ID] = true
+		}
+		ledgerMu.Unlock()
+	}
+	if err != nil {
+		log.Printf("⚠️  [%s] order %s not recorded in ledger: %v", order.Symbol, order.ID, err)
+	}
+}
+
+// recordReplacement appends the order that replaced replacedID.
+func recordReplacement(brokerName, replacedID string, order *broker.Order) {
+	l, err := currentLedger()
+	if err == nil {
+		err = l.RecordReplacement(brokerName, replacedID, order)
+	}
+	if err == nil {
+		ledgerMu.Lock()
+		ledgerIDs[order.ID] = true
+		ledgerMu.Unlock()
+	}
+	if err != nil {
+		log.Printf("⚠️  [%s] replacement %s of order %s not recorded in ledger: %v", order.Symbol, order.ID, replacedID, err)
+	}
+}
+
+// recordCancel appends a cancel request for orderID to the ledger.
+func recordCancel(brokerName, orderID string) {
+	l, err := currentLedger()
+	if err == nil {
+		err = l.Append(broker.LedgerEntry{Event: broker.LedgerCancelRequested, Broker: brokerName, OrderID: orderID})
+	}
+	if err != nil {
+		log.Printf("⚠️  cancel of order %s not recorded in ledger: %v", orderID, err)
+	}
+}
+
+// SyncOrderLedger fetches every order the ledger still has open and appends
+// an update for each whose status or fills changed.  It returns the number
+// of updates written.
+func SyncOrderLedger() (int, error) {
+	b, err := CurrentBroker()
+	if err != nil {
+		return 0, err
+	}
+	l, err := currentLedger()
+	if err != nil {
+		return 0, err
+	}
+	entries, err := broker.ReadLedger(l.Path())
+	if err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for _, lo := range broker.FoldLedger(entries) {
+		if lo.Broker != b.Name() || !(&broker.Order{Status: lo.Status}).IsOpen() {
+			continue
+		}
+		order, err := b.GetOrder(lo.OrderID)
+		if err != nil {
+			log.Printf("⚠️  [%s] cannot refresh order %s: %v", lo.Symbol, lo.OrderID, err)
+			continue
+		}
+		if !lo.Changed(order) {
+			continue
+		}
+		order.Legs = nil // legs are refreshed as ledger orders of their own
+		if err := l.RecordOrder(broker.LedgerUpdated, b.Name(), order, 0); err != nil {
+			return updated, fmt.Errorf("failed to record update for %s: %w", lo.OrderID, err)
+		}
+		updated++
+	}
+	return updated, nil
+}
@@ -1,10 +1,9 @@
 package ep
 
 import (
+	"avantai/pkg/marketdata"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
@@ -23,9 +22,11 @@ type SimulationConfig struct {
 	AlpacaKey      string
 	AlpacaSecret   string
 	FinnhubKey     string
-	Date           string // "2026-03-23" — must be today or a past date
-	SimulateAtTime string // "07:30" — HH:MM EST, must be between 04:00–09:30
-	LookbackDays   int    // days of historical data for technicals (default 300)
+	Date           string       // "2026-03-23" — must be today or a past date
+	SimulateAtTime string       // "07:30" — HH:MM EST, must be between 04:00–09:30
+	LookbackDays   int          // days of historical data for technicals (default 300)
+	Filters        FilterParams // zero means DefaultFilterParams
+	Symbols        []string     // universe to scan; nil fetches the tradable assets
 }
 
 // SimulatedPremarketSnapshot holds the aggregated premarket state for one
@@ -46,7 +47,7 @@ type BacktestReport struct {
 	BacktestConfig   BacktestConfig   `json:"backtest_config"`
 	BacktestDate     string           `json:"backtest_date"`
 	BacktestSummary  BacktestSummary  `json:"backtest_summary"`
-	FilterCriteria   FilterCriteria   `json:"filter_criteria"`
+	FilterCriteria   FilterParams     `json:"filter_criteria"`
 	GeneratedAt      string           `json:"generated_at"`
 	QualifyingStocks []BacktestResult `json:"qualifying_stocks"`
 }
@@ -58,14 +59,6 @@ type BacktestSummary struct {
 	TotalCandidates         int            `json:"total_candidates"`
 }
 
-type FilterCriteria struct {
-	MaxExtensionAdr         float64 `json:"max_extension_adr"`
-	MinDollarVolume         int64   `json:"min_dollar_volume"`
-	MinGapUpPercent         float64 `json:"min_gap_up_percent"`
-	MinMarketCap            int64   `json:"min_market_cap"`
-	MinPremarketVolumeRatio float64 `json:"min_premarket_volume_ratio"`
-}
-
 // ─────────────────────────────────────────────────────────────────────────────
 // Entry point
 // ─────────────────────────────────────────────────────────────────────────────
@@ -84,20 +77,68 @@ func RunPremarketSimulation(simConfig SimulationConfig) error {
 		defer logger.Close()
 	}
 
+	finalStocks, simulatedAt, err := SimulatePremarketScan(simConfig)
+	if err != nil {
+		return err
+	}
+	if finalStocks == nil {
+		return nil
+	}
+
+	LogSection("Saving Simulation Results")
+	if err := outputSimulationResults(simConfig, finalStocks, simulatedAt); err != nil {
+		return fmt.Errorf("failed to write simulation results: %v", err)
+	}
+
+	LogSection(fmt.Sprintf("SIMULATION COMPLETE — %d qualifying stocks at %s EST",
+		len(finalStocks), simConfig.SimulateAtTime))
+	return nil
+}
+
+// SimulatePremarketScan runs Stages 1–4 as of SimulateAtTime on Date and
+// returns the qualifying stocks without writing any files.  The result is nil
+// (not empty) when Stage 1 found no gap-ups at all.
+func SimulatePremarketScan(simConfig SimulationConfig) ([]RealtimeResult, time.Time, error) {
+	technicalStocks, simulatedAt, err := simulateThroughStage3(simConfig)
+	if err != nil || technicalStocks == nil {
+		return nil, simulatedAt, err
+	}
+
+	LogSection("STAGE 4 — Final Episodic Pivot Criteria")
+	t0 := time.Now()
+	finalStocks := realtimeStage4Final(simConfig.Filters.orDefault(), technicalStocks) // reuse identical Stage 4
+	LogStageSummary("S4", len(finalStocks), len(technicalStocks), time.Since(t0))
+
+	if finalStocks == nil {
+		finalStocks = []RealtimeResult{}
+	}
+	return finalStocks, simulatedAt, nil
+}
+
+// simulateThroughStage3 runs Stages 1–3 and returns every stock with
+// technicals, before the Stage 4 criteria.  Like SimulatePremarketScan the
+// result is nil only when Stage 1 found no gap-ups.
+func simulateThroughStage3(simConfig SimulationConfig) ([]RealtimeResult, time.Time, error) {
 	if simConfig.LookbackDays == 0 {
 		simConfig.LookbackDays = 300
 	}
+	simConfig.Filters = simConfig.Filters.orDefault()
+	if err := simConfig.Filters.Validate(); err != nil {
+		return nil, time.Time{}, fmt.Errorf("invalid filter params: %v", err)
+	}
+	params := simConfig.Filters
 
 	// Parse and validate the simulated scan time
 	simulatedAt, err := parseSimTime(simConfig.Date, simConfig.SimulateAtTime)
 	if err != nil {
-		return fmt.Errorf("invalid simulation time: %v", err)
+		return nil, time.Time{}, fmt.Errorf("invalid simulation time: %v", err)
 	}
 
 	LogSection(fmt.Sprintf("PREMARKET SIMULATION — %s at %s EST",
 		simConfig.Date, simConfig.SimulateAtTime))
 	LogInfo("SIM", "Simulating scanner state as of %s EST", simulatedAt.Format("2006-01-02 15:04:05"))
 	LogInfo("SIM", "Lookback days: %d", simConfig.LookbackDays)
+	LogFilterParams("SIM", params)
 
 	// Build an AlpacaConfig so we can reuse all existing API helpers
 	alpacaConfig := AlpacaConfig{
@@ -106,20 +147,26 @@ func RunPremarketSimulation(simConfig SimulationConfig) error {
 		BaseURL:    "https://paper-api.alpaca.markets",
 		DataURL:    "https://data.alpaca.markets",
 		FinnhubKey: simConfig.FinnhubKey,
+		Filters:    params,
+	}
+	// One provider for the whole run, so every symbol shares its bar cache.
+	provider, err := newCachedMarketDataProvider(alpacaConfig)
+	if err != nil {
+		return nil, simulatedAt, err
 	}
 
 	// ── Stage 1: fetch all symbols, replay premarket, find gap-ups ────────
-	LogSection(fmt.Sprintf("STAGE 1 — Simulated Gap Up Filter (min %.0f%%)", MIN_GAP_UP_PERCENT))
+	LogSection(fmt.Sprintf("STAGE 1 — Simulated Gap Up Filter (min %.0f%%)", params.MinGapUpPercent))
 	t0 := time.Now()
-	gapUpStocks, err := simStage1GapUp(alpacaConfig, simConfig, simulatedAt)
+	gapUpStocks, err := simStage1GapUp(provider, simConfig, params, simulatedAt)
 	if err != nil {
-		return fmt.Errorf("simulation Stage 1 failed: %v", err)
+		return nil, simulatedAt, fmt.Errorf("simulation Stage 1 failed: %v", err)
 	}
 	LogStageSummary("S1", len(gapUpStocks), len(gapUpStocks), time.Since(t0))
 
 	if len(gapUpStocks) == 0 {
 		LogWarn("SIM", "", "No gap-up stocks found for %s at %s", simConfig.Date, simConfig.SimulateAtTime)
-		return nil
+		return nil, simulatedAt, nil
 	}
 
 	// ── Stages 2–4: identical logic to the live scanner ──────────────────
@@ -127,47 +174,44 @@ func RunPremarketSimulation(simConfig SimulationConfig) error {
 	// pass directly into the existing stage functions.
 	realtimeStocks := snapshotsToRealtimeStockData(gapUpStocks)
 
-	LogSection(fmt.Sprintf("STAGE 2 — Liquidity Filter (min market cap $%dM)", MIN_MARKET_CAP/1_000_000))
+	LogSection(fmt.Sprintf("STAGE 2 — Liquidity Filter (min market cap $%.0fM)", params.MinMarketCap/1_000_000))
 	t0 = time.Now()
-	liquidStocks, err := simStage2Liquidity(alpacaConfig, realtimeStocks)
+	liquidStocks, err := simStage2Liquidity(alpacaConfig, params, realtimeStocks)
 	if err != nil {
-		return fmt.Errorf("simulation Stage 2 failed: %v", err)
+		return nil, simulatedAt, fmt.Errorf("simulation Stage 2 failed: %v", err)
 	}
 	LogStageSummary("S2", len(liquidStocks), len(realtimeStocks), time.Since(t0))
 
 	LogSection("STAGE 3 — Technical Analysis")
 	t0 = time.Now()
-	technicalStocks, err := simStage3Technical(alpacaConfig, simConfig, liquidStocks)
+	technicalStocks, err := simStage3Technical(provider, simConfig, params, liquidStocks)
 	if err != nil {
-		return fmt.Errorf("simulation Stage 3 failed: %v", err)
+		return nil, simulatedAt, fmt.Errorf("simulation Stage 3 failed: %v", err)
 	}
 	LogStageSummary("S3", len(technicalStocks), len(liquidStocks), time.Since(t0))
 
-	LogSection("STAGE 4 — Final Episodic Pivot Criteria")
-	t0 = time.Now()
-	finalStocks := realtimeStage4Final(technicalStocks) // reuse identical Stage 4
-	LogStageSummary("S4", len(finalStocks), len(technicalStocks), time.Since(t0))
-
-	LogSection("Saving Simulation Results")
-	if err := outputSimulationResults(simConfig, finalStocks, simulatedAt); err != nil {
-		return fmt.Errorf("failed to write simulation results: %v", err)
+	if technicalStocks == nil {
+		technicalStocks = []RealtimeResult{}
 	}
-
-	LogSection(fmt.Sprintf("SIMULATION COMPLETE — %d qualifying stocks at %s EST",
-		len(finalStocks), simConfig.SimulateAtTime))
-	return nil
+	return technicalStocks, simulatedAt, nil
 }
 
 // ─────────────────────────────────────────────────────────────────────────────
 // Simulation Stage 1: replay 1-min bars up to SimulateAtTime
 // ─────────────────────────────────────────────────────────────────────────────
 
-func simStage1GapUp(config AlpacaConfig, simConfig SimulationConfig, simulatedAt time.Time) ([]SimulatedPremarketSnapshot, error) {
-	symbols, err := getAlpacaTradableSymbolsMain(config)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get symbols: %v", err)
+func simStage1GapUp(provider marketdata.Provider, simConfig SimulationConfig, params FilterParams, simulatedAt time.Time) ([]SimulatedPremarketSnapshot, error) {
+	symbols := simConfig.Symbols
+	if symbols == nil {
+		var err error
+		symbols, err = getAlpacaTradableSymbolsMain(provider)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get symbols: %v", err)
+		}
+		LogInfo("S1", "Fetched %d tradable symbols", len(symbols))
+	} else {
+		LogInfo("S1", "Scanning %d shared symbols", len(symbols))
 	}
-	LogInfo("S1", "Fetched %d tradable symbols", len(symbols))
 
 	var results []SimulatedPremarketSnapshot
 	processed := 0
@@ -185,7 +229,7 @@ func simStage1GapUp(config AlpacaConfig, simConfig SimulationConfig, simulatedAt
 				fmt.Sprintf("%d qualified so far", qualified))
 		}
 
-		snap, err := buildPremarketSnapshot(config, sym, simConfig.Date, simulatedAt)
+		snap, err := buildPremarketSnapshot(provider, sym, simConfig.Date, simulatedAt)
 		if err != nil {
 			LogDebug("S1", sym, "Snapshot error: %v", err)
 			continue
@@ -197,13 +241,13 @@ func simStage1GapUp(config AlpacaConfig, simConfig SimulationConfig, simulatedAt
 		LogDebug("S1", sym, "PrevClose=$%.2f  PMHigh=$%.2f  PMVol=%.0f  Gap=%.2f%%  GapPrice=$%.2f",
     snap.PreviousClose, snap.PremarketHigh, snap.PremarketVolume, snap.GapUpPercent, snap.GapUsedPrice)
 
-		if snap.GapUpPercent >= MIN_GAP_UP_PERCENT {
+		if snap.GapUpPercent >= params.MinGapUpPercent {
 			qualified++
 			LogQualify("S1", sym, fmt.Sprintf("Gap=%.2f%%  PrevClose=$%.2f  PMHigh=$%.2f  PMVol=%.0f",
 				snap.GapUpPercent, snap.PreviousClose, snap.PremarketHigh, snap.PremarketVolume))
 			results = append(results, *snap)
 		} else {
-			LogReject("S1", sym, fmt.Sprintf("Gap=%.2f%% < %.0f%%", snap.GapUpPercent, MIN_GAP_UP_PERCENT))
+			LogReject("S1", sym, fmt.Sprintf("Gap=%.2f%% < %.0f%%", snap.GapUpPercent, params.MinGapUpPercent))
 		}
 	}
 
@@ -213,15 +257,15 @@ func simStage1GapUp(config AlpacaConfig, simConfig SimulationConfig, simulatedAt
 
 // buildPremarketSnapshot fetches all 1-min bars between 4:00am and simulatedAt
 // for a single symbol on simConfig.Date and aggregates them into a snapshot.
-func buildPremarketSnapshot(config AlpacaConfig, symbol, date string, simulatedAt time.Time) (*SimulatedPremarketSnapshot, error) {
+func buildPremarketSnapshot(provider marketdata.Provider, symbol, date string, simulatedAt time.Time) (*SimulatedPremarketSnapshot, error) {
 	// Previous close: last daily bar strictly before the simulation date
-	prevClose, err := simGetPreviousClose(config, symbol, date)
+	prevClose, err := simGetPreviousClose(provider, symbol, date)
 	if err != nil || prevClose <= 0 {
 		return nil, fmt.Errorf("no previous close: %v", err)
 	}
 
 	// Premarket 1-min bars: 4:00am EST → simulatedAt
-	bars, err := fetchPremarketMinuteBars(config, symbol, date, simulatedAt)
+	bars, err := fetchPremarketMinuteBars(provider, symbol, date, simulatedAt)
 	if err != nil || len(bars) == 0 {
 		return nil, fmt.Errorf("no premarket bars: %v", err)
 	}
@@ -258,110 +302,58 @@ func buildPremarketSnapshot(config AlpacaConfig, symbol, date string, simulatedA
 	}, nil
 }
 
-// fetchPremarketMinuteBars pulls 1-min bars from 4:00am EST to simulatedAt.
-func fetchPremarketMinuteBars(config AlpacaConfig, symbol, date string, simulatedAt time.Time) ([]AlpacaBar, error) {
-	startStr := fmt.Sprintf("%sT04:00:00-05:00", date)
-	endStr := simulatedAt.UTC().Format(time.RFC3339)
-
-	url := fmt.Sprintf(
-		"%s/v2/stocks/%s/bars?timeframe=1Min&start=%s&end=%s&limit=1000&feed=sip",
-		config.DataURL, symbol, startStr, endStr)
-
-	req, err := http.NewRequest("GET", url, nil)
+// fetchPremarketMinuteBars pulls 1-min bars from 4:00am EST to simulatedAt
+// through the bar cache, so later snapshot times on the same date only fetch
+// the minutes not seen yet.
+func fetchPremarketMinuteBars(provider marketdata.Provider, symbol, date string, simulatedAt time.Time) ([]AlpacaBar, error) {
+	start, err := time.Parse(time.RFC3339, fmt.Sprintf("%sT04:00:00-05:00", date))
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("APCA-API-KEY-ID", config.APIKey)
-	req.Header.Set("APCA-API-SECRET-KEY", config.APISecret)
 
-	client := &http.Client{Timeout: 15 * time.Second}
-	resp, err := client.Do(req)
+	bars, err := provider.MinuteBars(symbol, start, simulatedAt, marketdata.AdjustmentRaw)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API error %d", resp.StatusCode)
-	}
-
-	var barsResp AlpacaSingleSymbolBarsResponse
-	if err := json.Unmarshal(body, &barsResp); err != nil {
-		return nil, fmt.Errorf("parse error: %v", err)
-	}
-
-	return barsResp.Bars, nil
+	return toAlpacaBars(bars), nil
 }
 
 // simGetPreviousClose returns the close of the last daily bar strictly before date.
-func simGetPreviousClose(config AlpacaConfig, symbol, date string) (float64, error) {
+func simGetPreviousClose(provider marketdata.Provider, symbol, date string) (float64, error) {
 	targetDate, err := time.Parse("2006-01-02", date)
 	if err != nil {
 		return 0, err
 	}
 
-	startDate := targetDate.AddDate(0, 0, -7).Format("2006-01-02")
 	// end one day before target so we never pick up the target day itself
-	endDate := targetDate.AddDate(0, 0, -1).Format("2006-01-02")
-
-	url := fmt.Sprintf(
-		"%s/v2/stocks/%s/bars?timeframe=1Day&start=%s&end=%s&limit=5&adjustment=split&feed=sip",
-		config.DataURL, symbol, startDate, endDate)
-
-	req, err := http.NewRequest("GET", url, nil)
+	bars, err := provider.DailyBars(symbol,
+		targetDate.AddDate(0, 0, -7), targetDate.AddDate(0, 0, -1), marketdata.AdjustmentSplit)
 	if err != nil {
 		return 0, err
 	}
-	req.Header.Set("APCA-API-KEY-ID", config.APIKey)
-	req.Header.Set("APCA-API-SECRET-KEY", config.APISecret)
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return 0, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return 0, err
-	}
-
-	var barsResp AlpacaSingleSymbolBarsResponse
-	if err := json.Unmarshal(body, &barsResp); err != nil {
-		return 0, err
-	}
-
-	if len(barsResp.Bars) == 0 {
+	if len(bars) == 0 {
 		return 0, fmt.Errorf("no bars found")
 	}
 
 	// Return the most recent bar (already filtered to before target date)
-	sort.Slice(barsResp.Bars, func(i, j int) bool {
-		return barsResp.Bars[i].Timestamp < barsResp.Bars[j].Timestamp
-	})
-	return barsResp.Bars[len(barsResp.Bars)-1].Close, nil
+	sort.Slice(bars, func(i, j int) bool { return bars[i].Time.Before(bars[j].Time) })
+	return bars[len(bars)-1].Close, nil
 }
 
 // ─────────────────────────────────────────────────────────────────────────────
 // Simulation Stage 2: liquidity (reuses live logic)
 // ─────────────────────────────────────────────────────────────────────────────
 
-func simStage2Liquidity(config AlpacaConfig, stocks []RealtimeStockData) ([]RealtimeResult, error) {
+func simStage2Liquidity(config AlpacaConfig, params FilterParams, stocks []RealtimeStockData) ([]RealtimeResult, error) {
 	// Identical to realtimeStage2Liquidity — reuse it directly.
-	return realtimeStage2Liquidity(config, stocks)
+	return realtimeStage2Liquidity(config, params, stocks)
 }
 
 // ─────────────────────────────────────────────────────────────────────────────
 // Simulation Stage 3: technical analysis against historical data up to date
 // ─────────────────────────────────────────────────────────────────────────────
 
-func simStage3Technical(config AlpacaConfig, simConfig SimulationConfig, stocks []RealtimeResult) ([]RealtimeResult, error) {
+func simStage3Technical(provider marketdata.Provider, simConfig SimulationConfig, params FilterParams, stocks []RealtimeResult) ([]RealtimeResult, error) {
 	var technicalStocks []RealtimeResult
 	rateLimiter := time.Tick(time.Second / API_CALLS_PER_SECOND)
 
@@ -374,7 +366,7 @@ func simStage3Technical(config AlpacaConfig, simConfig SimulationConfig, stocks
 
 		// Fetch bars strictly up to (but not including) the simulation date
 		// so there is zero lookahead bias — same guarantee as the backtest.
-		historicalData, err := simGetHistoricalBarsUpToDate(config, stock.Symbol, simConfig.Date, simConfig.LookbackDays)
+		historicalData, err := simGetHistoricalBarsUpToDate(provider, stock.Symbol, simConfig.Date, simConfig.LookbackDays)
 		if err != nil {
 			LogWarn("S3", stock.Symbol, "Historical data error: %v", err)
 			stock.ValidationNotes = append(stock.ValidationNotes,
@@ -392,7 +384,7 @@ func simStage3Technical(config AlpacaConfig, simConfig SimulationConfig, stocks
 		// Convert []AlpacaBarData → []AlpacaBar so we can reuse the realtime helpers
 		bars := barDataToBars(historicalData)
 
-		technicalIndicators, err := calculateTechnicalIndicatorsRealtime(bars, stock.Symbol, stock.GapUsedPrice)
+		technicalIndicators, err := calculateTechnicalIndicatorsRealtime(params, bars, stock.Symbol, stock.GapUsedPrice)
 		if err != nil {
 			LogWarn("S3", stock.Symbol, "Technical indicators error: %v", err)
 			stock.ValidationNotes = append(stock.ValidationNotes, err.Error())
@@ -460,57 +452,21 @@ func simStage3Technical(config AlpacaConfig, simConfig SimulationConfig, stocks
 // simGetHistoricalBarsUpToDate fetches daily bars ending strictly before date.
 // This is the simulation equivalent of getHistoricalDataUpToDateAlpaca in the
 // backtest, ensuring zero lookahead bias.
-func simGetHistoricalBarsUpToDate(config AlpacaConfig, symbol, date string, lookbackDays int) ([]AlpacaBarData, error) {
+func simGetHistoricalBarsUpToDate(provider marketdata.Provider, symbol, date string, lookbackDays int) ([]AlpacaBarData, error) {
 	target, err := time.Parse("2006-01-02", date)
 	if err != nil {
 		return nil, err
 	}
 
-	startDate := target.AddDate(0, 0, -(lookbackDays + 100)).Format("2006-01-02")
+	start := target.AddDate(0, 0, -(lookbackDays + 100))
 	// end is the day BEFORE target so we never include the gap day
-	endDate := target.AddDate(0, 0, -1).Format("2006-01-02")
-
-	url := fmt.Sprintf(
-		"%s/v2/stocks/%s/bars?timeframe=1Day&start=%s&end=%s&limit=1000&adjustment=split&feed=sip",
-		config.DataURL, symbol, startDate, endDate)
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("APCA-API-KEY-ID", config.APIKey)
-	req.Header.Set("APCA-API-SECRET-KEY", config.APISecret)
+	end := target.AddDate(0, 0, -1)
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	bars, err := provider.DailyBars(symbol, start, end, marketdata.AdjustmentSplit)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	var barsResp AlpacaBarsResponse
-	if err := json.Unmarshal(body, &barsResp); err != nil {
-		return nil, fmt.Errorf("parse error: %v", err)
-	}
-
-	var out []AlpacaBarData
-	for _, b := range barsResp.Bars {
-		out = append(out, AlpacaBarData{
-			Symbol:    symbol,
-			Timestamp: b.Timestamp,
-			Open:      b.Open,
-			High:      b.High,
-			Low:       b.Low,
-			Close:     b.Close,
-			Volume:    b.Volume,
-		})
-	}
-	return out, nil
+	return toAlpacaBarData(symbol, bars), nil
 }
 
 // ─────────────────────────────────────────────────────────────────────────────
@@ -617,13 +573,7 @@ func outputSimulationResults(simConfig SimulationConfig, stocks []RealtimeResult
 			DataQualityDistribution: dataQualityDist,
 			TotalCandidates:         len(stocks),
 		},
-		FilterCriteria: FilterCriteria{
-			MaxExtensionAdr:         MAX_EXTENSION_ADR,
-			MinDollarVolume:         int64(MIN_DOLLAR_VOLUME),
-			MinGapUpPercent:         MIN_GAP_UP_PERCENT,
-			MinMarketCap:            int64(MIN_MARKET_CAP),
-			MinPremarketVolumeRatio: MIN_PREMARKET_VOL_RATIO,
-		},
+		FilterCriteria:   simConfig.Filters.orDefault(),
 		GeneratedAt:      time.Now().Format(time.RFC3339),
 		QualifyingStocks: qualifyingStocks,
 	}
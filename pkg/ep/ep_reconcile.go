@@ -0,0 +1,247 @@
+package ep
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"avantai/pkg/broker"
+)
+
+// ReconcileConfig controls a ledger-vs-broker reconciliation run.
+type ReconcileConfig struct {
+	LedgerPath string        // default OrderLedgerPath()
+	Since      time.Duration // ledger orders placed this recently are re-fetched (default 5 days)
+	Tolerance  float64       // allowed fill price difference in dollars (default 0.01)
+	Sync       bool          // append the broker's state for changed orders after comparing
+	OutputDir  string        // default "data/ledger"
+}
+
+// Drift kinds.
+const (
+	DriftOrphanedStop      = "orphaned_stop"      // working stop with no position behind it
+	DriftUntrackedPosition = "untracked_position" // position with no ledger fills in the symbol
+	DriftPositionMismatch  = "position_mismatch"  // position differs from the ledger's net fills
+	DriftUntrackedOrder    = "untracked_order"    // working order the ledger never saw
+	DriftFillMismatch      = "fill_mismatch"      // broker fill differs from the ledger's record
+	DriftFillVsExpected    = "fill_vs_expected"   // fill price differs from the price we assumed
+	DriftStaleStatus       = "stale_status"       // ledger has the order open, broker has closed it
+)
+
+// Drift is one discrepancy between the ledger and the broker.
+type Drift struct {
+	Kind    string  `json:"kind"`
+	Symbol  string  `json:"symbol"`
+	OrderID string  `json:"order_id,omitempty"`
+	Ledger  float64 `json:"ledger,omitempty"`
+	Broker  float64 `json:"broker,omitempty"`
+	Detail  string  `json:"detail"`
+}
+
+// ReconcileReport is the outcome of ReconcileOrders.
+type ReconcileReport struct {
+	GeneratedAt   time.Time `json:"generated_at"`
+	Broker        string    `json:"broker"`
+	Ledger        string    `json:"ledger"`
+	LedgerOrders  int       `json:"ledger_orders"`
+	OpenOrders    int       `json:"open_orders"`
+	Positions     int       `json:"positions"`
+	Drifts        []Drift   `json:"drifts"`
+	LedgerUpdates int       `json:"ledger_updates"`
+}
+
+// ReconcileOrders compares the order ledger with the broker's open orders
+// (CheckAllOrders), positions and recent order fills, and reports drift.
+func ReconcileOrders(cfg ReconcileConfig) (*ReconcileReport, error) {
+	if cfg.LedgerPath == "" {
+		cfg.LedgerPath = OrderLedgerPath()
+	}
+	if cfg.Since == 0 {
+		cfg.Since = 5 * 24 * time.Hour
+	}
+	if cfg.Tolerance == 0 {
+		cfg.Tolerance = 0.01
+	}
+	if cfg.OutputDir == "" {
+		cfg.OutputDir = "data/ledger"
+	}
+
+	b, err := CurrentBroker()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := broker.ReadLedger(cfg.LedgerPath)
+	if err != nil {
+		return nil, err
+	}
+	var ledger []*broker.LedgerOrder
+	for _, lo := range broker.FoldLedger(entries) {
+		if lo.Broker == b.Name() && lo.Symbol != "" {
+			ledger = append(ledger, lo)
+		}
+	}
+
+	open, err := CheckAllOrders()
+	if err != nil {
+		return nil, err
+	}
+	positions, err := b.Positions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get positions: %w", err)
+	}
+
+	report := &ReconcileReport{
+		GeneratedAt:  time.Now(),
+		Broker:       b.Name(),
+		Ledger:       cfg.LedgerPath,
+		LedgerOrders: len(ledger),
+		OpenOrders:   len(open),
+		Positions:    len(positions),
+	}
+	drift := func(d Drift) {
+		LogWarn("RECONCILE", d.Symbol, "%s: %s", d.Kind, d.Detail)
+		report.Drifts = append(report.Drifts, d)
+	}
+
+	// ── Refresh recent ledger orders and compare fills ──────────────────────
+	cutoff := time.Now().Add(-cfg.Since)
+	known := make(map[string]*broker.LedgerOrder, len(ledger))
+	var changed []*broker.Order
+	for _, lo := range ledger {
+		known[lo.OrderID] = lo
+		if lo.PlacedAt.Before(cutoff) {
+			continue
+		}
+		order, err := b.GetOrder(lo.OrderID)
+		if err != nil {
+			LogWarn("RECONCILE", lo.Symbol, "cannot fetch order %s: %v", lo.OrderID, err)
+			continue
+		}
+
+		ledgerOpen := (&broker.Order{Status: lo.Status}).IsOpen()
+		switch {
+		case lo.FilledQty > 0 && (lo.FilledQty != order.FilledQty ||
+			math.Abs(lo.FilledAvgPrice-order.FilledAvgPrice) > cfg.Tolerance):
+			drift(Drift{Kind: DriftFillMismatch, Symbol: lo.Symbol, OrderID: lo.OrderID,
+				Ledger: lo.FilledAvgPrice, Broker: order.FilledAvgPrice,
+				Detail: fmt.Sprintf("ledger %g @ $%.2f, broker %g @ $%.2f",
+					lo.FilledQty, lo.FilledAvgPrice, order.FilledQty, order.FilledAvgPrice)})
+		case ledgerOpen && !order.IsOpen():
+			drift(Drift{Kind: DriftStaleStatus, Symbol: lo.Symbol, OrderID: lo.OrderID,
+				Detail: fmt.Sprintf("ledger %s, broker %s", lo.Status, order.Status)})
+		}
+		if lo.ExpectedPrice > 0 && order.FilledQty > 0 &&
+			math.Abs(order.FilledAvgPrice-lo.ExpectedPrice) > cfg.Tolerance {
+			drift(Drift{Kind: DriftFillVsExpected, Symbol: lo.Symbol, OrderID: lo.OrderID,
+				Ledger: lo.ExpectedPrice, Broker: order.FilledAvgPrice,
+				Detail: fmt.Sprintf("%s assumed $%.2f, filled $%.2f", order.Side, lo.ExpectedPrice, order.FilledAvgPrice)})
+		}
+
+		if lo.Changed(order) {
+			order.Legs = nil
+			changed = append(changed, order)
+			lo.Status, lo.FilledQty, lo.FilledAvgPrice = order.Status, order.FilledQty, order.FilledAvgPrice
+		}
+	}
+
+	// ── Positions vs the ledger's net fills ─────────────────────────────────
+	net := make(map[string]float64)
+	for _, lo := range ledger {
+		switch lo.Side {
+		case broker.Buy:
+			net[lo.Symbol] += lo.FilledQty
+		case broker.Sell:
+			net[lo.Symbol] -= lo.FilledQty
+		}
+	}
+	held := make(map[string]float64, len(positions))
+	for _, p := range positions {
+		held[p.Symbol] = p.Qty
+		ledgerQty, tracked := net[p.Symbol]
+		switch {
+		case !tracked:
+			drift(Drift{Kind: DriftUntrackedPosition, Symbol: p.Symbol, Broker: p.Qty,
+				Detail: fmt.Sprintf("%g shares held, no orders in the ledger", p.Qty)})
+		case ledgerQty != p.Qty:
+			drift(Drift{Kind: DriftPositionMismatch, Symbol: p.Symbol, Ledger: ledgerQty, Broker: p.Qty,
+				Detail: fmt.Sprintf("ledger nets %g shares, broker holds %g", ledgerQty, p.Qty)})
+		}
+	}
+	symbols := make([]string, 0, len(net))
+	for sym := range net {
+		symbols = append(symbols, sym)
+	}
+	sort.Strings(symbols)
+	for _, sym := range symbols {
+		if _, ok := held[sym]; !ok && net[sym] != 0 {
+			qty := net[sym]
+			drift(Drift{Kind: DriftPositionMismatch, Symbol: sym, Ledger: qty,
+				Detail: fmt.Sprintf("ledger nets %g shares, broker holds none", qty)})
+		}
+	}
+
+	// ── Working orders: unknown to the ledger, or stops with nothing to stop ─
+	for _, o := range flattenOrders(open) {
+		if !o.IsOpen() {
+			continue
+		}
+		if _, ok := known[o.ID]; !ok {
+			drift(Drift{Kind: DriftUntrackedOrder, Symbol: o.Symbol, OrderID: o.ID,
+				Detail: fmt.Sprintf("%s not placed through the ledger", o.String())})
+		}
+		isStop := o.Type == broker.Stop || o.Type == broker.StopLimit
+		if isStop && o.Side == broker.Sell && o.Status != broker.StatusHeld && held[o.Symbol] <= 0 {
+			drift(Drift{Kind: DriftOrphanedStop, Symbol: o.Symbol, OrderID: o.ID,
+				Detail: fmt.Sprintf("sell stop @ $%.2f for %g shares with no position", o.StopPrice, o.Qty)})
+		}
+	}
+
+	if cfg.Sync && len(changed) > 0 {
+		l, err := broker.OpenLedger(cfg.LedgerPath)
+		if err != nil {
+			return nil, err
+		}
+		defer l.Close()
+		for _, order := range changed {
+			if err := l.RecordOrder(broker.LedgerUpdated, b.Name(), order, 0); err != nil {
+				return nil, fmt.Errorf("failed to record update for %s: %w", order.ID, err)
+			}
+			report.LedgerUpdates++
+		}
+	}
+
+	if err := writeReconcileReport(cfg, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// flattenOrders lists each order followed by its legs.
+func flattenOrders(orders []broker.Order) []broker.Order {
+	var out []broker.Order
+	for _, o := range orders {
+		out = append(out, o)
+		out = append(out, flattenOrders(o.Legs)...)
+	}
+	return out
+}
+
+func writeReconcileReport(cfg ReconcileConfig, report *ReconcileReport) error {
+	if err := os.MkdirAll(cfg.OutputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode reconcile report: %w", err)
+	}
+	path := filepath.Join(cfg.OutputDir, fmt.Sprintf("reconcile_%s.json", report.GeneratedAt.Format("20060102_150405")))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	LogInfo("RECONCILE", "report written to %s", path)
+	return nil
+}
@@ -0,0 +1,221 @@
+package ep
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"avantai/pkg/broker"
+	riskCalculator "avantai/pkg/riskmanagement"
+)
+
+// DEFAULT_SECTOR_FILE remembers the sector of every symbol entered, so the
+// risk engine can group positions opened by earlier runs.  RISK_SECTORS
+// names another file.
+const DEFAULT_SECTOR_FILE = "data/risk/sectors.json"
+
+var (
+	sectorsMu     sync.Mutex
+	sectors       map[string]string
+	sectorsLoaded bool
+
+	// entryRiskMu serialises the risk check and the order it allows, so
+	// concurrent workers in one process each see the others' entries.
+	entryRiskMu sync.Mutex
+
+	// entryStops holds the stop each entry placed by this process will get,
+	// by order ID, for entries (OTO without legs yet, Simple) whose stop is
+	// not a working order while they wait to fill.
+	entryStopsMu sync.Mutex
+	entryStops   = make(map[string]float64)
+)
+
+// RiskDeniedError is returned by PlaceEntry when the portfolio risk engine
+// denies the trade.
+type RiskDeniedError struct {
+	Symbol   string
+	Decision riskCalculator.Decision
+}
+
+func (e *RiskDeniedError) Error() string {
+	return fmt.Sprintf("risk engine denied %s entry: %s", e.Symbol, e.Decision)
+}
+
+func sectorFilePath() string {
+	if p := os.Getenv("RISK_SECTORS"); p != "" {
+		return p
+	}
+	return DEFAULT_SECTOR_FILE
+}
+
+// loadSectors reads the sector file once.  Callers hold sectorsMu.
+func loadSectors() {
+	if sectorsLoaded {
+		return
+	}
+	sectorsLoaded = true
+	sectors = make(map[string]string)
+	data, err := os.ReadFile(sectorFilePath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("⚠️  cannot read %s: %v", sectorFilePath(), err)
+		}
+		return
+	}
+	if err := json.Unmarshal(data, &sectors); err != nil {
+		log.Printf("⚠️  cannot parse %s: %v", sectorFilePath(), err)
+	}
+}
+
+// RecordSector remembers symbol's sector for the sector exposure limit.
+func RecordSector(symbol, sector string) {
+	if symbol == "" || sector == "" {
+		return
+	}
+	sectorsMu.Lock()
+	defer sectorsMu.Unlock()
+	loadSectors()
+	if sectors[symbol] == sector {
+		return
+	}
+	sectors[symbol] = sector
+
+	path := sectorFilePath()
+	data, err := json.MarshalIndent(sectors, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(path, data, 0644)
+	}
+	if err != nil {
+		log.Printf("⚠️  [%s] sector not saved to %s: %v", symbol, path, err)
+	}
+}
+
+// SectorOf returns the sector recorded for symbol, or "".
+func SectorOf(symbol string) string {
+	sectorsMu.Lock()
+	defer sectorsMu.Unlock()
+	loadSectors()
+	return sectors[symbol]
+}
+
+// rememberEntryStop records the stop an entry order will be protected by.
+func rememberEntryStop(orderID string, stop float64) {
+	entryStopsMu.Lock()
+	defer entryStopsMu.Unlock()
+	entryStops[orderID] = stop
+}
+
+func entryStop(orderID string) float64 {
+	entryStopsMu.Lock()
+	defer entryStopsMu.Unlock()
+	return entryStops[orderID]
+}
+
+// PortfolioSnapshot builds the risk engine's view of the account: equity,
+// today's P&L, and each position with its sector and working stop.  Open
+// buy orders count as pending holdings for their unfilled quantity at their
+// limit (or trigger) price, so entries waiting to fill use up the limits
+// too.  A pending entry with no known stop counts as fully at risk.
+func PortfolioSnapshot() (riskCalculator.Portfolio, error) {
+	var p riskCalculator.Portfolio
+	b, err := CurrentBroker()
+	if err != nil {
+		return p, err
+	}
+	account, err := b.Account()
+	if err != nil {
+		return p, fmt.Errorf("failed to get account: %w", err)
+	}
+	positions, err := b.Positions()
+	if err != nil {
+		return p, fmt.Errorf("failed to get positions: %w", err)
+	}
+	orders, err := b.ListOrders("open")
+	if err != nil {
+		return p, fmt.Errorf("failed to get orders: %w", err)
+	}
+
+	// The highest working sell stop protects each position.
+	stops := make(map[string]float64)
+	for _, o := range flattenOrders(orders) {
+		isStop := o.Type == broker.Stop || o.Type == broker.StopLimit
+		if isStop && o.Side == broker.Sell && o.IsOpen() && o.StopPrice > stops[o.Symbol] {
+			stops[o.Symbol] = o.StopPrice
+		}
+	}
+
+	p.Equity = account.PortfolioValue
+	if account.LastEquity > 0 {
+		p.DayPL = account.PortfolioValue - account.LastEquity
+	}
+	for _, pos := range positions {
+		p.Holdings = append(p.Holdings, riskCalculator.Holding{
+			Symbol: pos.Symbol,
+			Sector: SectorOf(pos.Symbol),
+			Qty:    pos.Qty,
+			Price:  pos.CurrentPrice,
+			Stop:   stops[pos.Symbol],
+		})
+	}
+	for _, o := range orders {
+		remaining := o.Qty - o.FilledQty
+		if o.Side != broker.Buy || !o.IsOpen() || remaining <= 0 {
+			continue
+		}
+		price := o.LimitPrice
+		if price <= 0 {
+			price = o.StopPrice
+		}
+		if price <= 0 {
+			if price, err = b.LatestPrice(o.Symbol); err != nil {
+				return p, fmt.Errorf("failed to price pending %s entry: %w", o.Symbol, err)
+			}
+		}
+		stop := stops[o.Symbol]
+		if stop <= 0 {
+			stop = entryStop(o.ID)
+		}
+		p.Holdings = append(p.Holdings, riskCalculator.Holding{
+			Symbol:  o.Symbol,
+			Sector:  SectorOf(o.Symbol),
+			Qty:     remaining,
+			Price:   price,
+			Stop:    stop,
+			Pending: true,
+		})
+	}
+	sort.Slice(p.Holdings, func(i, j int) bool { return p.Holdings[i].Symbol < p.Holdings[j].Symbol })
+	return p, nil
+}
+
+// CheckEntryRisk runs t through the portfolio risk engine with the limits
+// from the environment (riskCalculator.LimitsFromEnv).  An empty Sector is
+// looked up with SectorOf.
+func CheckEntryRisk(t riskCalculator.Proposal) (riskCalculator.Decision, error) {
+	limits, err := riskCalculator.LimitsFromEnv()
+	if err != nil {
+		return riskCalculator.Decision{}, err
+	}
+	portfolio, err := PortfolioSnapshot()
+	if err != nil {
+		return riskCalculator.Decision{}, err
+	}
+	if t.Sector == "" {
+		t.Sector = SectorOf(t.Symbol)
+	}
+
+	d := limits.Check(portfolio, t)
+	if d.Allowed {
+		LogInfo("RISK", "[%s] %g @ $%.2f stop $%.2f: %s", t.Symbol, t.Qty, t.Entry, t.Stop, d)
+	} else {
+		LogWarn("RISK", t.Symbol, "%g @ $%.2f stop $%.2f: %s", t.Qty, t.Entry, t.Stop, d)
+	}
+	return d, nil
+}
@@ -0,0 +1,58 @@
+package ep
+
+// Simulator bar feed
+//
+// A *broker.SimBroker only fills orders on bars it is handed.  The live
+// binaries already fetch each symbol's minute bars (from the vendor, or from
+// the replay archive under REPLAY_MODE=replay), so they pass the same bars to
+// FeedSimBars and the simulator's entries, stops and exits trade as the
+// session unfolds.  Against a real broker FeedSimBars does nothing.
+
+import (
+	"sync"
+	"time"
+
+	"avantai/pkg/broker"
+	"avantai/pkg/marketdata"
+)
+
+var (
+	simFedMu sync.Mutex
+	simFed   = make(map[string]time.Time) // symbol → last bar fed
+)
+
+// CurrentSimBroker returns the configured broker if it is the local
+// simulator, otherwise nil.
+func CurrentSimBroker() *broker.SimBroker {
+	b, err := CurrentBroker()
+	if err != nil {
+		return nil
+	}
+	sim, _ := b.(*broker.SimBroker)
+	return sim
+}
+
+// FeedSimBars matches the simulator's working orders in symbol against bars
+// and returns the fills.  Bars at or before the last one already fed for
+// symbol are skipped, so callers may pass the whole session on every poll.
+func FeedSimBars(symbol string, bars []marketdata.Bar) []broker.Fill {
+	sim := CurrentSimBroker()
+	if sim == nil {
+		return nil
+	}
+
+	simFedMu.Lock()
+	defer simFedMu.Unlock()
+	var fills []broker.Fill
+	for _, bar := range bars {
+		if !bar.Time.After(simFed[symbol]) {
+			continue
+		}
+		fills = append(fills, sim.ProcessBar(symbol, bar)...)
+		simFed[symbol] = bar.Time
+	}
+	for _, f := range fills {
+		LogInfo("SIM_FILL", "%s %s %g @ $%.2f (order %s)", f.Symbol, f.Side, f.Qty, f.Price, f.OrderID)
+	}
+	return fills
+}
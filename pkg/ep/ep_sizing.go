@@ -0,0 +1,105 @@
+package ep
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	riskCalculator "avantai/pkg/riskmanagement"
+)
+
+// DEFAULT_TRADE_HISTORY is the watcher's trade_results.csv, which the Kelly
+// sizing model reads its win rate and payoff from.  SIZING_TRADE_HISTORY
+// names another file.
+const DEFAULT_TRADE_HISTORY = "trade_results.csv"
+
+// LoadTradeStats summarises the trades in a trade_results.csv.  Partial exits
+// of one entry (same symbol, entry date and entry price) are one trade, whose
+// R-multiple is its total P/L over InitialRisk × the shares exited.
+func LoadTradeStats(path string) (riskCalculator.TradeStats, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return riskCalculator.TradeStats{}, fmt.Errorf("failed to open trade history: %w", err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return riskCalculator.TradeStats{}, fmt.Errorf("failed to read trade history: %w", err)
+	}
+
+	type trade struct{ pl, risk float64 }
+	var order []string
+	trades := make(map[string]*trade)
+	for i, row := range records {
+		if i == 0 || len(row) < 11 {
+			continue
+		}
+		shares, _ := strconv.ParseFloat(row[3], 64)
+		initialRisk, _ := strconv.ParseFloat(row[4], 64)
+		pl, _ := strconv.ParseFloat(row[5], 64)
+
+		key := strings.Join([]string{row[0], row[7], row[1]}, "|")
+		t, ok := trades[key]
+		if !ok {
+			t = &trade{}
+			trades[key] = t
+			order = append(order, key)
+		}
+		t.pl += pl
+		t.risk += initialRisk * shares
+	}
+
+	rs := make([]float64, 0, len(order))
+	for _, key := range order {
+		if t := trades[key]; t.risk > 0 {
+			rs = append(rs, t.pl/t.risk)
+		}
+	}
+	return riskCalculator.StatsFromR(rs), nil
+}
+
+// SizeEntry sizes a long entry with the model from the environment
+// (riskCalculator.SizingFromEnv).  Equity is ACCOUNT_SIZE when set, else the
+// broker's portfolio value; ADR and dollar volume come from the scan.
+func SizeEntry(symbol string, entry, stop float64, stats StockStats) (riskCalculator.Sizing, error) {
+	cfg, err := riskCalculator.SizingFromEnv()
+	if err != nil {
+		return riskCalculator.Sizing{}, err
+	}
+
+	in := riskCalculator.SizingInput{Entry: entry, Stop: stop, ADRPct: stats.ADR, DolVol: stats.DolVol}
+	if v := strings.TrimSpace(os.Getenv("ACCOUNT_SIZE")); v != "" {
+		in.Equity, err = strconv.ParseFloat(v, 64)
+		if err != nil {
+			return riskCalculator.Sizing{}, fmt.Errorf("invalid ACCOUNT_SIZE %q: %w", v, err)
+		}
+	} else {
+		b, err := CurrentBroker()
+		if err != nil {
+			return riskCalculator.Sizing{}, err
+		}
+		account, err := b.Account()
+		if err != nil {
+			return riskCalculator.Sizing{}, fmt.Errorf("failed to get account: %w", err)
+		}
+		in.Equity = account.PortfolioValue
+	}
+
+	if cfg.Model == riskCalculator.ModelKelly {
+		path := os.Getenv("SIZING_TRADE_HISTORY")
+		if path == "" {
+			path = DEFAULT_TRADE_HISTORY
+		}
+		in.History, err = LoadTradeStats(path)
+		if err != nil {
+			// Kelly falls back to fixed-fractional without history.
+			LogWarn("SIZE", symbol, "%v", err)
+		}
+	}
+
+	s := cfg.Size(in)
+	LogInfo("SIZE", "[%s] entry $%.2f stop $%.2f: %s", symbol, entry, stop, s)
+	return s, nil
+}
@@ -0,0 +1,180 @@
+package ep
+
+// Broker-side stop amendment
+//
+// PlaceEntryWithStop leaves the initial stop with the broker.  As the
+// position manager ratchets its own stop (breakeven, +1R, trailing bands),
+// SyncStop replaces that order so the broker keeps protecting the position
+// if this process dies.  Every amendment is logged and recorded in the
+// order ledger.  Before the position manager sells, CancelStop or a smaller
+// SyncStopOnce frees the shares the stop reserves; EnsureStop restores it if
+// the sell is refused.
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"avantai/pkg/broker"
+)
+
+const (
+	STOP_AMEND_ATTEMPTS = 3
+	STOP_AMEND_BACKOFF  = 2 * time.Second // doubled after each failed attempt
+)
+
+// FindStopOrder returns the working sell stop for symbol — the stop leg of
+// its bracket or a standalone stop — or nil if there is none.  A leg still
+// held behind an unfilled entry is returned only if nothing is working.
+func FindStopOrder(symbol string) (*broker.Order, error) {
+	b, err := CurrentBroker()
+	if err != nil {
+		return nil, err
+	}
+	orders, err := b.ListOrders("open")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get orders: %w", err)
+	}
+
+	var held *broker.Order
+	for _, o := range flattenOrders(orders) {
+		if o.Symbol != symbol || o.Side != broker.Sell || !o.IsOpen() {
+			continue
+		}
+		if o.Type != broker.Stop && o.Type != broker.StopLimit {
+			continue
+		}
+		o := o
+		if o.Status != broker.StatusHeld {
+			return &o, nil
+		}
+		if held == nil {
+			held = &o
+		}
+	}
+	return held, nil
+}
+
+// ReplaceStop moves stop order orderID to stopPrice and, if qty is positive,
+// resizes it.  The replacement is recorded in the order ledger.
+func ReplaceStop(orderID string, stopPrice, qty float64) (*broker.Order, error) {
+	b, err := CurrentBroker()
+	if err != nil {
+		return nil, err
+	}
+	order, err := b.ReplaceOrder(orderID, broker.ReplaceRequest{Qty: qty, StopPrice: roundCents(stopPrice)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to replace stop order %s: %w", orderID, err)
+	}
+	recordReplacement(b.Name(), orderID, order)
+	return order, nil
+}
+
+// errNoStop is returned by SyncStopOnce when symbol has no working stop.
+var errNoStop = errors.New("no open stop order")
+
+// SyncStop makes the broker's stop for symbol match stopPrice and, if qty is
+// positive, qty shares.  Failed amendments are retried up to
+// STOP_AMEND_ATTEMPTS times, re-finding the stop each time in case an earlier
+// attempt went through.  It returns the stop now working, which is unchanged
+// if it already matched.  It sleeps between attempts; callers holding a lock
+// should use SyncStopOnce and retry later instead.
+func SyncStop(symbol string, stopPrice, qty float64) (*broker.Order, error) {
+	backoff := STOP_AMEND_BACKOFF
+
+	var lastErr error
+	for attempt := 1; attempt <= STOP_AMEND_ATTEMPTS; attempt++ {
+		if attempt > 1 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		stop, err := SyncStopOnce(symbol, stopPrice, qty)
+		if err == nil {
+			return stop, nil
+		}
+		if errors.Is(err, errNoStop) {
+			return nil, err
+		}
+		lastErr = err
+		LogWarn("STOP_SYNC", symbol, "attempt %d/%d: %v", attempt, STOP_AMEND_ATTEMPTS, err)
+	}
+	return nil, fmt.Errorf("failed to sync stop for %s after %d attempts: %w", symbol, STOP_AMEND_ATTEMPTS, lastErr)
+}
+
+// SyncStopOnce is one SyncStop attempt, without retries or sleeps.
+func SyncStopOnce(symbol string, stopPrice, qty float64) (*broker.Order, error) {
+	stopPrice = roundCents(stopPrice)
+	stop, err := FindStopOrder(symbol)
+	if err != nil {
+		return nil, err
+	}
+	if stop == nil {
+		return nil, fmt.Errorf("%w for %s", errNoStop, symbol)
+	}
+
+	remaining := stop.Qty - stop.FilledQty
+	priceOK := math.Abs(stop.StopPrice-stopPrice) < 0.005
+	qtyOK := qty <= 0 || remaining == qty
+	if priceOK && qtyOK {
+		return stop, nil
+	}
+	newQty := 0.0
+	if !qtyOK {
+		newQty = qty
+	}
+
+	replaced, err := ReplaceStop(stop.ID, stopPrice, newQty)
+	if err != nil {
+		return nil, err
+	}
+	LogInfo("STOP_SYNC", "[%s] stop $%.2f x %g → $%.2f x %g (order %s → %s)",
+		symbol, stop.StopPrice, remaining, replaced.StopPrice, replaced.Qty-replaced.FilledQty, stop.ID, replaced.ID)
+	return replaced, nil
+}
+
+// CancelStop cancels symbol's working stop so its shares can be sold, and
+// returns the cancelled order, or nil if there was none.
+func CancelStop(symbol string) (*broker.Order, error) {
+	stop, err := FindStopOrder(symbol)
+	if err != nil || stop == nil {
+		return nil, err
+	}
+	if err := CancelOrder(stop.ID); err != nil {
+		return nil, err
+	}
+	LogInfo("STOP_SYNC", "[%s] stop $%.2f x %g cancelled (order %s)",
+		symbol, stop.StopPrice, stop.Qty-stop.FilledQty, stop.ID)
+	return stop, nil
+}
+
+// EnsureStop is SyncStopOnce, except that when symbol has no working stop a
+// standalone GTC sell stop for qty shares is placed.  It puts a stop back
+// after CancelStop when the exit it made room for was refused.
+func EnsureStop(symbol string, stopPrice, qty float64) (*broker.Order, error) {
+	stop, err := SyncStopOnce(symbol, stopPrice, qty)
+	if !errors.Is(err, errNoStop) {
+		return stop, err
+	}
+	if qty <= 0 {
+		return nil, err
+	}
+	b, err := CurrentBroker()
+	if err != nil {
+		return nil, err
+	}
+	order, err := b.PlaceOrder(broker.OrderRequest{
+		Symbol:      symbol,
+		Qty:         qty,
+		Side:        broker.Sell,
+		Type:        broker.Stop,
+		TimeInForce: broker.GTC,
+		StopPrice:   roundCents(stopPrice),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to place stop for %s: %w", symbol, err)
+	}
+	recordOrder(broker.LedgerPlaced, b.Name(), order, order.StopPrice)
+	LogInfo("STOP_SYNC", "[%s] stop $%.2f x %g placed (order %s)", symbol, order.StopPrice, qty, order.ID)
+	return order, nil
+}
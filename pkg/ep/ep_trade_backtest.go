@@ -0,0 +1,899 @@
+package ep
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"avantai/pkg/broker"
+	"avantai/pkg/exits"
+	"avantai/pkg/marketdata"
+	riskCalculator "avantai/pkg/riskmanagement"
+	"avantai/pkg/sapien"
+	"avantai/pkg/spec"
+)
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Trade-level backtest
+//
+// For every trading day in [StartDate, EndDate]:
+//   1. replay the premarket scan at ScanTime (Stages 1–4, SimulatePremarketScan)
+//   2. run the ep_main_alpaca entry worker for the first EntryWindowMinutes:
+//      one manager-agent decision per minute on the bars seen so far, stop at
+//      the latest bar's low, shares from the Sizing model (Kelly reads the
+//      trades closed so far), filled as EntryOptions prices the order and
+//      given up on as EntryPolicy says, the same rules the live worker uses
+//   3. walk every open position through the session minute by minute with
+//      the same pkg/exits engine the live watcher uses
+//
+// Positions still open after EndDate are closed at the last close seen.
+// ─────────────────────────────────────────────────────────────────────────────
+
+// TradeBacktestConfig holds the parameters for RunTradeBacktest.
+type TradeBacktestConfig struct {
+	StartDate    string // "2025-01-02" — first scan date (inclusive)
+	EndDate      string // "2025-03-31" — last trading date (inclusive)
+	AlpacaKey    string
+	AlpacaSecret string
+	FinnhubKey   string
+
+	ScanTime           string                       // premarket scan time, HH:MM EST (default "09:00")
+	LookbackDays       int                          // days of history for Stage 3 (default 300)
+	EntryWindowMinutes int                          // minutes after the open the entry worker runs (default 15)
+	AccountSize        float64                      // ACCOUNT_SIZE
+	RiskPerTrade       float64                      // RISK_PER_TRADE, e.g. 0.01
+	Sizing             *riskCalculator.SizingConfig // default fixed-fractional at RiskPerTrade
+	EntryOptions       *EntryOptions                // default EntryOptionsFromEnv("EP")
+	EntryPolicy        *EntryPolicy                 // default EntryPolicyFromEnv("EP")
+	Filters            FilterParams                 // scan thresholds; zero means DefaultFilterParams
+
+	ReportsDir   string            // holds <SYMBOL>/news_report.txt and earnings_report.txt (default "reports")
+	OutputDir    string            // default "data/backtests/trades"
+	Entry        EntryDecider      // default ManagerAgentEntry
+	ExitProfiles *exits.ProfileSet // picked per candidate by scanner status (default exits.LoadProfilesFromEnv)
+}
+
+// TradeRecord is one full or partial exit, in the same shape the watcher
+// appends to trade_results.csv.
+type TradeRecord struct {
+	Symbol      string  `json:"symbol"`
+	EntryPrice  float64 `json:"entry_price"`
+	ExitPrice   float64 `json:"exit_price"`
+	Shares      float64 `json:"shares"`
+	InitialRisk float64 `json:"initial_risk"`
+	ProfitLoss  float64 `json:"profit_loss"`
+	RiskReward  float64 `json:"risk_reward"`
+	EntryDate   string  `json:"entry_date"`
+	ExitDate    string  `json:"exit_date"`
+	ExitReason  string  `json:"exit_reason"`
+	IsWinner    bool    `json:"is_winner"`
+	ExitProfile string  `json:"exit_profile"`
+}
+
+// EquityPoint is the account value at one session close.
+type EquityPoint struct {
+	Date          string  `json:"date"`
+	Equity        float64 `json:"equity"`
+	RealizedPL    float64 `json:"realized_pl"`
+	UnrealizedPL  float64 `json:"unrealized_pl"`
+	OpenPositions int     `json:"open_positions"`
+	Drawdown      float64 `json:"drawdown"` // fraction below the running peak
+}
+
+// TradeBacktestSummary aggregates results per position (all partial exits of
+// one entry count as a single trade).
+type TradeBacktestSummary struct {
+	TradingDays     int     `json:"trading_days"`
+	Candidates      int     `json:"candidates"`
+	Trades          int     `json:"trades"`
+	ExitFills       int     `json:"exit_fills"`
+	Winners         int     `json:"winners"`
+	Losers          int     `json:"losers"`
+	WinRate         float64 `json:"win_rate"`
+	TotalPL         float64 `json:"total_pl"`
+	AvgWinner       float64 `json:"avg_winner"`
+	AvgLoser        float64 `json:"avg_loser"`
+	ProfitFactor    float64 `json:"profit_factor"`
+	AvgR            float64 `json:"avg_r"`
+	StartEquity     float64 `json:"start_equity"`
+	FinalEquity     float64 `json:"final_equity"`
+	ReturnPercent   float64 `json:"return_percent"`
+	MaxDrawdown     float64 `json:"max_drawdown"`
+	MaxDrawdownDate string  `json:"max_drawdown_date"`
+}
+
+// TradeBacktestReport is everything RunTradeBacktest produces.
+type TradeBacktestReport struct {
+	StartDate   string               `json:"start_date"`
+	EndDate     string               `json:"end_date"`
+	ScanTime    string               `json:"scan_time"`
+	Filters     FilterParams         `json:"filter_criteria"`
+	GeneratedAt string               `json:"generated_at"`
+	Summary     TradeBacktestSummary `json:"summary"`
+	Trades      []TradeRecord        `json:"trades"`
+	EquityCurve []EquityPoint        `json:"equity_curve"`
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Entry decisions
+// ─────────────────────────────────────────────────────────────────────────────
+
+// EntryDecision is a manager-agent style answer for one minute.
+type EntryDecision struct {
+	Buy         bool
+	EntryPrice  float64
+	RiskPercent float64 // as the agent answered; sizing does not use it
+	Reasoning   string
+	// Guardrail, when set, vets the order about to be placed — the actual
+	// stop and sized risk — and returns false to skip it.
+	Guardrail func(plan sapien.PlannedEntry) bool
+}
+
+// EntryDecider is called once per minute of the entry window with every
+// session bar so far (ep_main_alpaca's convertToEP shape) and the candidate's
+// sentiment JSON.  Returning an error skips that minute.
+type EntryDecider func(symbol string, bars []StockData, sentiment, reportsDir string) (*EntryDecision, error)
+
+// ManagerAgentEntry asks the Sapien manager agent for a schema-validated
+// decision, with the same prompt data and guardrail as ep_main_alpaca's
+// runManagerAgent.  A response that never validates is an error, so that
+// minute is skipped.
+func ManagerAgentEntry(symbol string, bars []StockData, sentiment, reportsDir string) (*EntryDecision, error) {
+	stockData := ""
+	for i, b := range bars {
+		stockData += fmt.Sprintf("%d min - Open: %v Close: %v High: %v Low: %v\n",
+			i, b.Open, b.PreviousClose, b.High, b.Low)
+	}
+
+	news, _ := os.ReadFile(filepath.Join(reportsDir, symbol, "news_report.txt"))
+	earnings, _ := os.ReadFile(filepath.Join(reportsDir, symbol, "earnings_report.txt"))
+
+	d, err := sapien.ManagerAgentDecision(context.Background(), stockData, string(news), string(earnings), sentiment)
+	if err != nil {
+		return nil, fmt.Errorf("manager agent decision failed: %w", err)
+	}
+
+	decision := &EntryDecision{Reasoning: strings.Join(d.Reasons, "; ")}
+	if d.Action != sapien.ActionBuy || len(bars) == 0 {
+		return decision, nil
+	}
+
+	decision.Buy = true
+	decision.EntryPrice = d.EntryPrice
+	decision.RiskPercent = d.RiskFraction * 100
+	// No one approves in a backtest: anything but ALLOW is no trade.
+	last := bars[len(bars)-1]
+	decision.Guardrail = func(plan sapien.PlannedEntry) bool {
+		verdict := sapien.ManagerGuardrail(context.Background(), d, plan, sapien.StockData{
+			Symbol: symbol, Open: last.Open, High: last.High, Low: last.Low, Price: last.Close,
+		}, stockData, string(news), string(earnings), sentiment)
+		if verdict.Decision != spec.DecisionAllow {
+			LogWarn("BT", symbol, "guardrail %s", verdict)
+			return false
+		}
+		return true
+	}
+	return decision, nil
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Entry point
+// ─────────────────────────────────────────────────────────────────────────────
+
+// RunTradeBacktest simulates entries and exits over the configured date range
+// and writes trades.csv, equity_curve.csv and report.json under OutputDir.
+func RunTradeBacktest(cfg TradeBacktestConfig) (*TradeBacktestReport, error) {
+	if cfg.ScanTime == "" {
+		cfg.ScanTime = "09:00"
+	}
+	if cfg.LookbackDays == 0 {
+		cfg.LookbackDays = 300
+	}
+	if cfg.EntryWindowMinutes == 0 {
+		cfg.EntryWindowMinutes = 15
+	}
+	if cfg.ReportsDir == "" {
+		cfg.ReportsDir = "reports"
+	}
+	if cfg.OutputDir == "" {
+		cfg.OutputDir = "data/backtests/trades"
+	}
+	if cfg.Entry == nil {
+		cfg.Entry = ManagerAgentEntry
+	}
+	if cfg.ExitProfiles == nil {
+		profiles, err := exits.LoadProfilesFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		cfg.ExitProfiles = profiles
+	}
+	if err := cfg.ExitProfiles.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid exit profiles: %w", err)
+	}
+	cfg.Filters = cfg.Filters.orDefault()
+	if err := cfg.Filters.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid filter params: %w", err)
+	}
+	if cfg.AccountSize <= 0 || cfg.RiskPerTrade <= 0 {
+		return nil, fmt.Errorf("account size and risk per trade must be positive")
+	}
+	if cfg.Sizing == nil {
+		sizing := riskCalculator.DefaultSizingConfig()
+		sizing.RiskPct = cfg.RiskPerTrade * 100
+		cfg.Sizing = &sizing
+	}
+	if err := cfg.Sizing.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid sizing config: %w", err)
+	}
+	if cfg.EntryOptions == nil {
+		opts, err := EntryOptionsFromEnv("EP")
+		if err != nil {
+			return nil, err
+		}
+		cfg.EntryOptions = &opts
+	}
+	opts := cfg.EntryOptions.withDefaults()
+	if err := opts.validate(); err != nil {
+		return nil, fmt.Errorf("invalid entry options: %w", err)
+	}
+	cfg.EntryOptions = &opts
+	if cfg.EntryPolicy == nil {
+		policy, err := EntryPolicyFromEnv("EP")
+		if err != nil {
+			return nil, err
+		}
+		cfg.EntryPolicy = &policy
+	}
+	policy := cfg.EntryPolicy.withDefaults()
+	cfg.EntryPolicy = &policy
+
+	est, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load EST timezone: %v", err)
+	}
+	start, err := time.ParseInLocation("2006-01-02", cfg.StartDate, est)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start date: %v", err)
+	}
+	end, err := time.ParseInLocation("2006-01-02", cfg.EndDate, est)
+	if err != nil {
+		return nil, fmt.Errorf("invalid end date: %v", err)
+	}
+	if end.Before(start) {
+		return nil, fmt.Errorf("end date %s is before start date %s", cfg.EndDate, cfg.StartDate)
+	}
+
+	logger, err := InitLogger("data/backtests/logs", fmt.Sprintf("trades_%s_%s",
+		strings.ReplaceAll(cfg.StartDate, "-", ""), strings.ReplaceAll(cfg.EndDate, "-", "")))
+	if err != nil {
+		fmt.Printf("⚠️  Could not create log file: %v\n", err)
+	} else {
+		defer logger.Close()
+	}
+
+	provider, err := newCachedMarketDataProvider(AlpacaConfig{
+		APIKey:    cfg.AlpacaKey,
+		APISecret: cfg.AlpacaSecret,
+		BaseURL:   "https://paper-api.alpaca.markets",
+		DataURL:   "https://data.alpaca.markets",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	bt := &tradeBacktest{
+		cfg:      cfg,
+		provider: provider,
+		loc:      est,
+		clock:    &exits.ManualClock{},
+	}
+	report := &TradeBacktestReport{
+		StartDate: cfg.StartDate,
+		EndDate:   cfg.EndDate,
+		ScanTime:  cfg.ScanTime,
+		Filters:   cfg.Filters,
+	}
+
+	for _, day := range bt.tradingDays(start, end) {
+		bt.runDay(day)
+	}
+	bt.closeAll()
+
+	report.GeneratedAt = time.Now().Format(time.RFC3339)
+	report.Trades = bt.trades
+	report.EquityCurve = bt.equity
+	report.Summary = bt.summarize()
+
+	if err := writeTradeBacktestReport(cfg, report); err != nil {
+		return report, fmt.Errorf("failed to write trade backtest results: %w", err)
+	}
+
+	LogSection(fmt.Sprintf("TRADE BACKTEST COMPLETE — %d trades, P/L $%.2f, max DD %.1f%%",
+		report.Summary.Trades, report.Summary.TotalPL, report.Summary.MaxDrawdown*100))
+	return report, nil
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Simulation
+// ─────────────────────────────────────────────────────────────────────────────
+
+// Watchlist entry filters, as in the watcher's tryOpenPosition.
+const (
+	WATCHLIST_MIN_PRICE = 2.0
+	WATCHLIST_MAX_PRICE = 200.0
+)
+
+// simPosition is an exits.Position plus the fills it has produced.
+type simPosition struct {
+	exits.Position
+	Profile string
+	Fills   []TradeRecord // every full or partial exit, in order
+
+	engine *exits.Engine
+}
+
+type tradeBacktest struct {
+	cfg      TradeBacktestConfig
+	provider marketdata.Provider
+	loc      *time.Location
+	clock    *exits.ManualClock // shared by every position's engine
+
+	open       []*simPosition
+	closed     []*simPosition
+	trades     []TradeRecord
+	equity     []EquityPoint
+	realized   float64 // P/L of closed positions
+	peak       float64
+	candidates int
+}
+
+// tradingDays lists the sessions in [start, end].
+func (bt *tradeBacktest) tradingDays(start, end time.Time) []time.Time {
+	return tradingCalendar(bt.provider, start, end, bt.loc, "BT")
+}
+
+// tradingCalendar lists the sessions in [start, end] from SPY's daily bars,
+// falling back to plain weekdays if they cannot be fetched.
+func tradingCalendar(provider marketdata.Provider, start, end time.Time, loc *time.Location, stage string) []time.Time {
+	var days []time.Time
+	bars, err := provider.DailyBars("SPY", start, end, marketdata.AdjustmentRaw)
+	if err == nil && len(bars) > 0 {
+		for _, b := range bars {
+			d := b.Time.UTC()
+			days = append(days, time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, loc))
+		}
+		return days
+	}
+	LogWarn(stage, "SPY", "Cannot load trading calendar (%v) — using weekdays", err)
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		if day.Weekday() != time.Saturday && day.Weekday() != time.Sunday {
+			days = append(days, day)
+		}
+	}
+	return days
+}
+
+// runDay manages open positions, scans and enters new ones, then marks the
+// book to the session close.
+func (bt *tradeBacktest) runDay(day time.Time) {
+	date := day.Format("2006-01-02")
+	openNY := time.Date(day.Year(), day.Month(), day.Day(), 9, 30, 0, 0, bt.loc)
+	closeNY := time.Date(day.Year(), day.Month(), day.Day(), 16, 0, 0, 0, bt.loc)
+
+	LogSection(fmt.Sprintf("TRADE BACKTEST — %s", date))
+
+	// ── Existing positions ───────────────────────────────────────────────
+	held := make(map[string]bool)
+	var still []*simPosition
+	for _, pos := range bt.open {
+		held[pos.Symbol] = true
+		bars, err := bt.sessionBars(pos.Symbol, openNY, closeNY)
+		if err != nil {
+			LogWarn("BT", pos.Symbol, "Cannot fetch session bars: %v — holding", err)
+			still = append(still, pos)
+			continue
+		}
+		if bt.walk(pos, bars) {
+			bt.finish(pos)
+			continue
+		}
+		still = append(still, pos)
+	}
+	bt.open = still
+
+	// ── Scan and enter ───────────────────────────────────────────────────
+	stocks, _, err := SimulatePremarketScan(SimulationConfig{
+		AlpacaKey:      bt.cfg.AlpacaKey,
+		AlpacaSecret:   bt.cfg.AlpacaSecret,
+		FinnhubKey:     bt.cfg.FinnhubKey,
+		Date:           date,
+		SimulateAtTime: bt.cfg.ScanTime,
+		LookbackDays:   bt.cfg.LookbackDays,
+		Filters:        bt.cfg.Filters,
+	})
+	if err != nil {
+		LogWarn("BT", "", "Scan failed for %s: %v", date, err)
+	}
+	bt.candidates += len(stocks)
+
+	for _, stock := range stocks {
+		if held[stock.Symbol] {
+			continue // the watcher never opens a second position in a symbol
+		}
+		bars, err := bt.sessionBars(stock.Symbol, openNY, closeNY)
+		if err != nil || len(bars) == 0 {
+			LogWarn("BT", stock.Symbol, "No session bars on %s: %v", date, err)
+			continue
+		}
+
+		pos, rest := bt.enter(stock, bars, openNY)
+		if pos == nil {
+			continue
+		}
+		held[pos.Symbol] = true
+		if bt.walk(pos, rest) {
+			bt.finish(pos)
+			continue
+		}
+		bt.open = append(bt.open, pos)
+	}
+
+	bt.markToMarket(date)
+}
+
+// enter runs the entry worker over the first EntryWindowMinutes of bars.
+// It returns the filled position and the bars after the fill, or nil.
+func (bt *tradeBacktest) enter(stock RealtimeResult, bars []marketdata.Bar, openNY time.Time) (*simPosition, []marketdata.Bar) {
+	sentimentJSON, err := json.Marshal(map[string]interface{}{
+		"Stock_name":   stock.Symbol,
+		"Stock_info":   stock.StockInfo,
+		"Stock_status": stock.Status,
+	})
+	if err != nil {
+		LogWarn("BT", stock.Symbol, "Cannot marshal sentiment: %v", err)
+		return nil, nil
+	}
+
+	for minute := 1; minute <= bt.cfg.EntryWindowMinutes; minute++ {
+		tick := openNY.Add(time.Duration(minute) * time.Minute)
+		seen := 0
+		for seen < len(bars) && bars[seen].Time.Before(tick) {
+			seen++
+		}
+		if seen == 0 {
+			continue
+		}
+
+		decision, err := bt.cfg.Entry(stock.Symbol, minuteBarsToStockData(stock.Symbol, bars[:seen], bt.loc),
+			string(sentimentJSON), bt.cfg.ReportsDir)
+		if err != nil {
+			LogWarn("BT", stock.Symbol, "Entry decision failed at minute %d: %v", minute, err)
+			continue
+		}
+		if decision == nil || !decision.Buy {
+			continue
+		}
+
+		// Same arithmetic as runManagerAgent.
+		stopLoss := bars[seen-1].Low
+		if decision.EntryPrice-stopLoss <= 0 {
+			LogWarn("BT", stock.Symbol, "Invalid risk: entry %.2f <= stop %.2f", decision.EntryPrice, stopLoss)
+			continue
+		}
+		sizing := bt.cfg.Sizing.Size(riskCalculator.SizingInput{
+			Equity:  bt.cfg.AccountSize,
+			Entry:   decision.EntryPrice,
+			Stop:    stopLoss,
+			ADRPct:  stock.StockInfo.ADR,
+			DolVol:  stock.StockInfo.DolVol,
+			History: bt.history(),
+		})
+		shares := sizing.Shares
+		if shares <= 0 {
+			LogWarn("BT", stock.Symbol, "Invalid share calculation resulted in %.0f shares (%s)", shares, sizing)
+			continue
+		}
+		if decision.Guardrail != nil && !decision.Guardrail(sapien.PlannedEntry{
+			StopLoss: stopLoss, Shares: shares, RiskFraction: sizing.RiskFraction(),
+		}) {
+			continue
+		}
+
+		// The worker stops after its first buy, filled or not.
+		pos, rest := bt.fill(stock.Symbol, bars, seen, stopLoss, shares)
+		if pos != nil {
+			pos.Profile = bt.cfg.ExitProfiles.NameForStatus(stock.Status)
+			rules, _ := bt.cfg.ExitProfiles.Rules(pos.Profile) // validated in RunTradeBacktest
+			pos.engine = exits.NewEngine(rules, bt.clock)
+		}
+		return pos, rest
+	}
+	return nil, nil
+}
+
+// history summarises the positions closed so far for Kelly sizing.
+func (bt *tradeBacktest) history() riskCalculator.TradeStats {
+	rs := make([]float64, 0, len(bt.closed))
+	for _, pos := range bt.closed {
+		if pos.InitialRisk <= 0 || pos.InitialShares <= 0 {
+			continue
+		}
+		pl := 0.0
+		for _, f := range pos.Fills {
+			pl += f.ProfitLoss
+		}
+		rs = append(rs, pl/(pos.InitialRisk*pos.InitialShares))
+	}
+	return riskCalculator.StatsFromR(rs)
+}
+
+// fill simulates the live entry: the order PlaceEntry builds from
+// EntryOptions, placed as bar from-1 closes, then ManageEntry's EntryPolicy
+// (timeout, chase and reprices) checked on every bar that does not fill it,
+// and the watcher's tryOpenPosition checks on the fill.  A stop-limit entry
+// triggers a cent above the first five bars' high, as ep_main places it.
+func (bt *tradeBacktest) fill(symbol string, bars []marketdata.Bar, from int, stopLoss, shares float64) (*simPosition, []marketdata.Bar) {
+	opts, policy := *bt.cfg.EntryOptions, *bt.cfg.EntryPolicy
+	stopLoss = roundCents(stopLoss)
+
+	var limit, trigger float64
+	switch opts.Type {
+	case broker.Limit:
+		limit = roundCents(bars[from-1].Close + opts.Slippage)
+		if opts.EntryPrice > 0 {
+			limit = roundCents(opts.EntryPrice)
+		}
+	case broker.StopLimit:
+		for _, b := range bars[:min(from, 5)] {
+			trigger = math.Max(trigger, b.High)
+		}
+		trigger = roundCents(trigger + 0.01)
+		limit = roundCents(trigger + opts.Slippage)
+	}
+	ref := limit
+	if opts.Type == broker.StopLimit {
+		ref = trigger
+	}
+	chase, maxPrice := policy.chaseLimits(ref)
+
+	placed := bars[from-1].Time.Add(time.Minute)
+	deadline := placed.Add(policy.Timeout)
+	lastReprice := placed
+	triggered := false
+
+	for i := from; i < len(bars); i++ {
+		b := bars[i]
+		if !b.Time.Before(deadline) {
+			LogReject("BT", symbol, fmt.Sprintf("entry timed out after %s unfilled", policy.Timeout))
+			return nil, nil
+		}
+
+		price := 0.0
+		switch opts.Type {
+		case broker.Market:
+			price = b.Open
+		case broker.Limit:
+			if b.Low <= limit {
+				price = math.Min(b.Open, limit)
+			}
+		case broker.StopLimit:
+			if !triggered && b.High >= trigger {
+				triggered = true
+				if b.Open < trigger && trigger <= limit {
+					price = trigger // triggered inside the bar
+					break
+				}
+			}
+			if triggered && b.Low <= limit {
+				price = math.Min(b.Open, limit)
+			}
+		}
+
+		if price == 0 {
+			if opts.Type == broker.Market {
+				continue
+			}
+			// ManageEntry reads the latest trade after each unfilled poll.
+			if b.Close > chase {
+				LogReject("BT", symbol, fmt.Sprintf("price $%.2f ran past chase limit $%.2f", b.Close, chase))
+				return nil, nil
+			}
+			now := b.Time.Add(time.Minute)
+			if policy.RepriceStep > 0 && b.Close > limit && limit < maxPrice &&
+				now.Sub(lastReprice) >= policy.RepriceEvery {
+				limit = math.Min(roundCents(limit+policy.RepriceStep), maxPrice)
+				lastReprice = now
+			}
+			continue
+		}
+
+		price = roundCents(price)
+		if price < WATCHLIST_MIN_PRICE || price > WATCHLIST_MAX_PRICE {
+			LogReject("BT", symbol, fmt.Sprintf("fill $%.2f outside $%.0f–$%.0f", price, WATCHLIST_MIN_PRICE, WATCHLIST_MAX_PRICE))
+			return nil, nil
+		}
+		if stopLoss <= 0 || stopLoss >= price {
+			LogReject("BT", symbol, fmt.Sprintf("stop $%.2f invalid vs fill $%.2f", stopLoss, price))
+			return nil, nil
+		}
+
+		fillTime := b.Time.In(bt.loc)
+		LogQualify("BT", symbol, fmt.Sprintf("%s entry filled %.0f @ $%.2f at %s, stop $%.2f",
+			opts.Type, shares, price, fillTime.Format("15:04"), stopLoss))
+		return &simPosition{Position: *exits.NewPosition(symbol, price, stopLoss, shares, fillTime)}, bars[i+1:]
+	}
+	LogReject("BT", symbol, fmt.Sprintf("%s entry never filled", opts.Type))
+	return nil, nil
+}
+
+// walk evaluates pos once per minute over bars, which must all belong to one
+// session.  On the entry day bars start after the fill bar: the stop sits at
+// the entry bar's low, so counting earlier bars would stop out immediately.
+func (bt *tradeBacktest) walk(pos *simPosition, bars []marketdata.Bar) bool {
+	session := make([]exits.Bar, 0, len(bars))
+	for _, b := range bars {
+		session = append(session, exits.Bar{Time: b.Time, Open: b.Open, High: b.High, Low: b.Low, Close: b.Close})
+
+		// The watcher sees a bar once it has closed.
+		bt.clock.Set(b.Time.Add(time.Minute))
+		res := pos.engine.Evaluate(&pos.Position, session)
+		for _, d := range res.Decisions {
+			pos.record(d)
+		}
+		if res.Closed {
+			return true
+		}
+	}
+	return false
+}
+
+// record turns a sell decision into a TradeRecord.
+func (pos *simPosition) record(d exits.Decision) {
+	if d.Kind == exits.KindStopMoved {
+		return
+	}
+	pos.Fills = append(pos.Fills, TradeRecord{
+		Symbol:      pos.Symbol,
+		EntryPrice:  pos.EntryPrice,
+		ExitPrice:   d.Price,
+		Shares:      float64(d.Shares),
+		InitialRisk: pos.InitialRisk,
+		ProfitLoss:  d.ProfitLoss,
+		RiskReward:  d.RiskReward,
+		EntryDate:   pos.PurchaseDate.Format("2006-01-02"),
+		ExitDate:    d.Time.Format("2006-01-02"),
+		ExitReason:  d.Reason,
+		IsWinner:    d.IsWinner,
+		ExitProfile: pos.Profile,
+	})
+}
+
+func (bt *tradeBacktest) finish(pos *simPosition) {
+	for _, f := range pos.Fills {
+		bt.realized += f.ProfitLoss
+	}
+	bt.trades = append(bt.trades, pos.Fills...)
+	bt.closed = append(bt.closed, pos)
+}
+
+// closeAll exits anything still open at the last price seen.
+func (bt *tradeBacktest) closeAll() {
+	if len(bt.open) == 0 {
+		return
+	}
+	for _, pos := range bt.open {
+		if d, ok := exits.Close(&pos.Position, pos.LastPrice, pos.LastCheckDate, "Backtest End"); ok {
+			pos.record(d)
+		}
+		bt.finish(pos)
+	}
+	bt.open = nil
+
+	// Closing at the last price leaves equity unchanged; restate the final
+	// point so its realized/unrealized split and position count are right.
+	if n := len(bt.equity); n > 0 {
+		last := bt.equity[n-1]
+		bt.equity = bt.equity[:n-1]
+		bt.markToMarket(last.Date)
+	}
+}
+
+func (bt *tradeBacktest) markToMarket(date string) {
+	realized := bt.realized
+	unrealized := 0.0
+	for _, pos := range bt.open {
+		realized += pos.CumulativeProfit // partial exits already taken
+		unrealized += (pos.LastPrice - pos.EntryPrice) * pos.Shares
+	}
+	equity := bt.cfg.AccountSize + realized + unrealized
+	if equity > bt.peak {
+		bt.peak = equity
+	}
+	dd := 0.0
+	if bt.peak > 0 {
+		dd = (bt.peak - equity) / bt.peak
+	}
+	bt.equity = append(bt.equity, EquityPoint{
+		Date:          date,
+		Equity:        equity,
+		RealizedPL:    realized,
+		UnrealizedPL:  unrealized,
+		OpenPositions: len(bt.open),
+		Drawdown:      dd,
+	})
+}
+
+func (bt *tradeBacktest) summarize() TradeBacktestSummary {
+	s := TradeBacktestSummary{
+		TradingDays: len(bt.equity),
+		Candidates:  bt.candidates,
+		Trades:      len(bt.closed),
+		ExitFills:   len(bt.trades),
+		StartEquity: bt.cfg.AccountSize,
+		FinalEquity: bt.cfg.AccountSize,
+	}
+
+	var grossWin, grossLoss, sumR float64
+	for _, pos := range bt.closed {
+		pl := 0.0
+		for _, f := range pos.Fills {
+			pl += f.ProfitLoss
+		}
+		s.TotalPL += pl
+		if pos.InitialRisk > 0 && pos.InitialShares > 0 {
+			sumR += pl / (pos.InitialRisk * pos.InitialShares)
+		}
+		if pl > 0 {
+			s.Winners++
+			grossWin += pl
+		} else {
+			s.Losers++
+			grossLoss += -pl
+		}
+	}
+
+	if s.Trades > 0 {
+		s.WinRate = float64(s.Winners) / float64(s.Trades)
+		s.AvgR = sumR / float64(s.Trades)
+	}
+	if s.Winners > 0 {
+		s.AvgWinner = grossWin / float64(s.Winners)
+	}
+	if s.Losers > 0 {
+		s.AvgLoser = -grossLoss / float64(s.Losers)
+	}
+	if grossLoss > 0 {
+		s.ProfitFactor = grossWin / grossLoss
+	}
+
+	if n := len(bt.equity); n > 0 {
+		s.FinalEquity = bt.equity[n-1].Equity
+	}
+	s.ReturnPercent = (s.FinalEquity - s.StartEquity) / s.StartEquity * 100
+	for _, p := range bt.equity {
+		if p.Drawdown > s.MaxDrawdown {
+			s.MaxDrawdown = p.Drawdown
+			s.MaxDrawdownDate = p.Date
+		}
+	}
+	return s
+}
+
+// sessionBars returns regular-session minute bars for one day, oldest first.
+func (bt *tradeBacktest) sessionBars(symbol string, openNY, closeNY time.Time) ([]marketdata.Bar, error) {
+	bars, err := bt.provider.MinuteBars(symbol, openNY, closeNY, marketdata.AdjustmentRaw)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(bars, func(i, j int) bool { return bars[i].Time.Before(bars[j].Time) })
+	return bars, nil
+}
+
+// minuteBarsToStockData mirrors ep_main_alpaca's convertToEP: PreviousClose
+// is the prior bar's close (the first bar uses its own open).
+func minuteBarsToStockData(symbol string, bars []marketdata.Bar, loc *time.Location) []StockData {
+	out := make([]StockData, 0, len(bars))
+	var prevClose float64
+	for i, b := range bars {
+		if i == 0 {
+			prevClose = b.Open
+		}
+		out = append(out, StockData{
+			Symbol:        symbol,
+			Timestamp:     b.Time.In(loc).Format("2006-01-02 15:04:00"),
+			Open:          b.Open,
+			High:          b.High,
+			Low:           b.Low,
+			Close:         b.Close,
+			Volume:        int64(b.Volume),
+			PreviousClose: prevClose,
+		})
+		prevClose = b.Close
+	}
+	return out
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Output
+// ─────────────────────────────────────────────────────────────────────────────
+
+func writeTradeBacktestReport(cfg TradeBacktestConfig, report *TradeBacktestReport) error {
+	dir := filepath.Join(cfg.OutputDir, fmt.Sprintf("%s_%s",
+		strings.ReplaceAll(cfg.StartDate, "-", ""), strings.ReplaceAll(cfg.EndDate, "-", "")))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	trades := [][]string{{
+		"Symbol", "EntryPrice", "ExitPrice", "Shares", "InitialRisk",
+		"ProfitLoss", "RiskReward", "EntryDate", "ExitDate", "ExitReason", "IsWinner", "ExitProfile",
+	}}
+	for _, r := range report.Trades {
+		trades = append(trades, []string{
+			r.Symbol,
+			fmt.Sprintf("%.2f", r.EntryPrice),
+			fmt.Sprintf("%.2f", r.ExitPrice),
+			fmt.Sprintf("%.2f", r.Shares),
+			fmt.Sprintf("%.2f", r.InitialRisk),
+			fmt.Sprintf("%.2f", r.ProfitLoss),
+			fmt.Sprintf("%.2f", r.RiskReward),
+			r.EntryDate,
+			r.ExitDate,
+			r.ExitReason,
+			fmt.Sprintf("%t", r.IsWinner),
+			r.ExitProfile,
+		})
+	}
+	if err := writeCSVFile(filepath.Join(dir, "trades.csv"), trades); err != nil {
+		return err
+	}
+
+	equity := [][]string{{"Date", "Equity", "RealizedPL", "UnrealizedPL", "OpenPositions", "Drawdown"}}
+	for _, p := range report.EquityCurve {
+		equity = append(equity, []string{
+			p.Date,
+			fmt.Sprintf("%.2f", p.Equity),
+			fmt.Sprintf("%.2f", p.RealizedPL),
+			fmt.Sprintf("%.2f", p.UnrealizedPL),
+			strconv.Itoa(p.OpenPositions),
+			fmt.Sprintf("%.4f", p.Drawdown),
+		})
+	}
+	if err := writeCSVFile(filepath.Join(dir, "equity_curve.csv"), equity); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal report: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "report.json"), data, 0644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+
+	LogInfo("BT", "Results written to %s", dir)
+	return nil
+}
+
+func writeCSVFile(path string, rows [][]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if err := w.WriteAll(rows); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
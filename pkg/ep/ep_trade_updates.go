@@ -0,0 +1,34 @@
+package ep
+
+import (
+	"context"
+	"fmt"
+
+	"avantai/pkg/broker"
+)
+
+// StreamTradeUpdates follows the broker's order events (fills, partial fills,
+// cancels, bracket-leg executions) and calls handler for each, blocking until
+// ctx is cancelled.  Updates to orders placed through this package are also
+// appended to the order ledger, so fills are recorded as they happen rather
+// than on the next SyncOrderLedger.
+func StreamTradeUpdates(ctx context.Context, handler func(broker.TradeUpdate)) error {
+	b, err := CurrentBroker()
+	if err != nil {
+		return err
+	}
+	streamer, ok := b.(broker.TradeUpdateStreamer)
+	if !ok {
+		return fmt.Errorf("broker %s does not stream trade updates", b.Name())
+	}
+
+	LogInfo("TRADE_UPDATES", "streaming %s trade updates", b.Name())
+	return streamer.StreamTradeUpdates(ctx, func(tu broker.TradeUpdate) {
+		if tu.Event != broker.EventNew && inLedger(tu.Order.ID) {
+			order := tu.Order
+			order.Legs = nil
+			recordOrder(broker.LedgerUpdated, b.Name(), &order, 0)
+		}
+		handler(tu)
+	})
+}
@@ -0,0 +1,451 @@
+package ep
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Walk-forward premarket simulation
+//
+// Replays SimulatePremarketScan for every trading date in a range at several
+// snapshot times (e.g. 07:00, 08:00, 09:10), Concurrency simulations at a
+// time.  The tradable symbol list is fetched once and shared, and every
+// simulation reads bars through the same on-disk cache, so a later snapshot
+// on the same date only fetches the premarket minutes the earlier one did
+// not.  The consolidated report shows, per date, how the candidate list
+// grows and shrinks as the premarket progresses.
+// ─────────────────────────────────────────────────────────────────────────────
+
+// WalkForwardConfig holds the parameters for RunWalkForward.
+type WalkForwardConfig struct {
+	AlpacaKey    string
+	AlpacaSecret string
+	FinnhubKey   string
+
+	StartDate     string       // "2025-07-28" — first date (inclusive)
+	EndDate       string       // "2025-08-15" — last date (inclusive)
+	Calendar      []string     // trading dates to run; nil uses SPY's sessions in the range
+	SnapshotTimes []string     // HH:MM EST (default 07:00, 08:00, 09:10)
+	LookbackDays  int          // days of history for Stage 3 (default 300)
+	Filters       FilterParams // zero means DefaultFilterParams
+	Concurrency   int          // simulations at once (default 2)
+	OutputDir     string       // default "data/backtests/walkforward"
+}
+
+// WalkForwardCandidate is one qualifying stock at one snapshot.
+type WalkForwardCandidate struct {
+	Symbol               string  `json:"symbol"`
+	Status               string  `json:"status"`
+	GapUp                float64 `json:"gap_up"`
+	PremarketVolume      float64 `json:"premarket_volume"`
+	PremarketVolumeRatio float64 `json:"premarket_volume_ratio"`
+	MarketCap            float64 `json:"market_cap"`
+}
+
+// WalkForwardSnapshot is the scan result for one date at one time.  Added
+// and Dropped are relative to the previous successful snapshot that day.
+type WalkForwardSnapshot struct {
+	Time       string                 `json:"time"`
+	Candidates []WalkForwardCandidate `json:"candidates"`
+	Added      []string               `json:"added"`
+	Dropped    []string               `json:"dropped"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+// WalkForwardDay holds every snapshot for one date.
+type WalkForwardDay struct {
+	Date      string                 `json:"date"`
+	Snapshots []*WalkForwardSnapshot `json:"snapshots"`
+}
+
+// WalkForwardTimeStats aggregates one snapshot time across all dates.
+type WalkForwardTimeStats struct {
+	Time          string  `json:"time"`
+	Days          int     `json:"days"` // dates whose snapshot succeeded
+	Candidates    int     `json:"candidates"`
+	AvgCandidates float64 `json:"avg_candidates"`
+	Confident     int     `json:"confident"`
+	Questionable  int     `json:"questionable"`
+	Added         int     `json:"added"`
+	Dropped       int     `json:"dropped"`
+	// Fraction of this snapshot's candidates still on the list at the last
+	// snapshot time that day.
+	SurvivalRate float64 `json:"survival_rate"`
+}
+
+// WalkForwardReport is written to walkforward_report.json.
+type WalkForwardReport struct {
+	StartDate     string                 `json:"start_date"`
+	EndDate       string                 `json:"end_date"`
+	SnapshotTimes []string               `json:"snapshot_times"`
+	Filters       FilterParams           `json:"filter_criteria"`
+	GeneratedAt   string                 `json:"generated_at"`
+	Days          []*WalkForwardDay      `json:"days"`
+	Summary       []WalkForwardTimeStats `json:"summary"`
+}
+
+// RunWalkForward simulates every date × snapshot time and writes the
+// consolidated report.
+func RunWalkForward(cfg WalkForwardConfig) (*WalkForwardReport, error) {
+	if len(cfg.SnapshotTimes) == 0 {
+		cfg.SnapshotTimes = []string{"07:00", "08:00", "09:10"}
+	}
+	if cfg.LookbackDays == 0 {
+		cfg.LookbackDays = 300
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 2
+	}
+	if cfg.OutputDir == "" {
+		cfg.OutputDir = "data/backtests/walkforward"
+	}
+	cfg.Filters = cfg.Filters.orDefault()
+	if err := cfg.Filters.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid filter params: %w", err)
+	}
+
+	// Normalize to HH:MM so the times sort chronologically.
+	times := make([]string, len(cfg.SnapshotTimes))
+	for i, t := range cfg.SnapshotTimes {
+		at, err := parseSimTime(cfg.StartDate, t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid snapshot time %q: %w", t, err)
+		}
+		times[i] = at.Format("15:04")
+	}
+	sort.Strings(times)
+	cfg.SnapshotTimes = times
+
+	est, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load EST timezone: %v", err)
+	}
+	start, err := time.ParseInLocation("2006-01-02", cfg.StartDate, est)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start date: %v", err)
+	}
+	end, err := time.ParseInLocation("2006-01-02", cfg.EndDate, est)
+	if err != nil {
+		return nil, fmt.Errorf("invalid end date: %v", err)
+	}
+	if end.Before(start) {
+		return nil, fmt.Errorf("end date %s is before start date %s", cfg.EndDate, cfg.StartDate)
+	}
+
+	logger, err := InitLogger("data/backtests/logs", fmt.Sprintf("walkforward_%s_%s",
+		strings.ReplaceAll(cfg.StartDate, "-", ""), strings.ReplaceAll(cfg.EndDate, "-", "")))
+	if err != nil {
+		fmt.Printf("⚠️  Could not create log file: %v\n", err)
+	} else {
+		defer logger.Close()
+	}
+
+	alpacaConfig := AlpacaConfig{
+		APIKey:    cfg.AlpacaKey,
+		APISecret: cfg.AlpacaSecret,
+		BaseURL:   "https://paper-api.alpaca.markets",
+		DataURL:   "https://data.alpaca.markets",
+	}
+
+	provider, err := newCachedMarketDataProvider(alpacaConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	var dates []string
+	if cfg.Calendar != nil {
+		for _, d := range cfg.Calendar {
+			if d >= cfg.StartDate && d <= cfg.EndDate {
+				dates = append(dates, d)
+			}
+		}
+		sort.Strings(dates)
+	} else {
+		for _, day := range tradingCalendar(provider, start, end, est, "WF") {
+			dates = append(dates, day.Format("2006-01-02"))
+		}
+	}
+	if len(dates) == 0 {
+		return nil, fmt.Errorf("no trading dates between %s and %s", cfg.StartDate, cfg.EndDate)
+	}
+
+	LogSection("WALK-FORWARD PREMARKET SIMULATION")
+	LogInfo("WF", "Dates          : %d (%s → %s)", len(dates), dates[0], dates[len(dates)-1])
+	LogInfo("WF", "Snapshots      : %s EST", strings.Join(cfg.SnapshotTimes, ", "))
+	LogInfo("WF", "Concurrency    : %d", cfg.Concurrency)
+	LogFilterParams("WF", cfg.Filters)
+
+	symbols, err := getAlpacaTradableSymbolsMain(provider)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get symbols: %w", err)
+	}
+	LogInfo("WF", "Fetched %d tradable symbols (shared by every simulation)", len(symbols))
+
+	report := &WalkForwardReport{
+		StartDate:     cfg.StartDate,
+		EndDate:       cfg.EndDate,
+		SnapshotTimes: cfg.SnapshotTimes,
+		Filters:       cfg.Filters,
+	}
+	for _, date := range dates {
+		day := &WalkForwardDay{Date: date}
+		for _, t := range cfg.SnapshotTimes {
+			day.Snapshots = append(day.Snapshots, &WalkForwardSnapshot{Time: t})
+		}
+		report.Days = append(report.Days, day)
+	}
+
+	// Jobs run date by date, earliest snapshot first, so each date's later
+	// snapshots tend to find the earlier minutes already cached.
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, cfg.Concurrency)
+	for _, day := range report.Days {
+		for _, snap := range day.Snapshots {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(date string, snap *WalkForwardSnapshot) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				stocks, _, err := SimulatePremarketScan(SimulationConfig{
+					AlpacaKey:      cfg.AlpacaKey,
+					AlpacaSecret:   cfg.AlpacaSecret,
+					FinnhubKey:     cfg.FinnhubKey,
+					Date:           date,
+					SimulateAtTime: snap.Time,
+					LookbackDays:   cfg.LookbackDays,
+					Filters:        cfg.Filters,
+					Symbols:        symbols,
+				})
+				if err != nil {
+					snap.Error = err.Error()
+					LogError("WF", "", "%s %s failed: %v", date, snap.Time, err)
+					return
+				}
+				snap.Candidates = []WalkForwardCandidate{}
+				for _, s := range stocks {
+					snap.Candidates = append(snap.Candidates, WalkForwardCandidate{
+						Symbol:               s.Symbol,
+						Status:               s.Status,
+						GapUp:                s.StockInfo.GapUp,
+						PremarketVolume:      s.StockInfo.PremarketVolume,
+						PremarketVolumeRatio: s.StockInfo.PremarketVolumeRatio,
+						MarketCap:            s.StockInfo.MarketCap,
+					})
+				}
+				sort.Slice(snap.Candidates, func(i, j int) bool {
+					return snap.Candidates[i].Symbol < snap.Candidates[j].Symbol
+				})
+				LogInfo("WF", "%s %s: %d candidates", date, snap.Time, len(snap.Candidates))
+			}(day.Date, snap)
+		}
+	}
+	wg.Wait()
+
+	for _, day := range report.Days {
+		diffWalkForwardSnapshots(day)
+	}
+	report.Summary = summarizeWalkForward(report)
+	report.GeneratedAt = time.Now().Format(time.RFC3339)
+
+	if err := writeWalkForwardReport(cfg, report); err != nil {
+		return report, fmt.Errorf("failed to write walk-forward results: %w", err)
+	}
+
+	LogSection(fmt.Sprintf("WALK-FORWARD COMPLETE — %d dates × %d snapshots", len(report.Days), len(cfg.SnapshotTimes)))
+	return report, nil
+}
+
+// diffWalkForwardSnapshots fills Added and Dropped for each successful
+// snapshot against the previous successful one.
+func diffWalkForwardSnapshots(day *WalkForwardDay) {
+	var prev map[string]bool
+	for _, snap := range day.Snapshots {
+		if snap.Error != "" {
+			continue
+		}
+		current := make(map[string]bool, len(snap.Candidates))
+		snap.Added, snap.Dropped = []string{}, []string{}
+		for _, c := range snap.Candidates {
+			current[c.Symbol] = true
+			if !prev[c.Symbol] {
+				snap.Added = append(snap.Added, c.Symbol)
+			}
+		}
+		for sym := range prev {
+			if !current[sym] {
+				snap.Dropped = append(snap.Dropped, sym)
+			}
+		}
+		sort.Strings(snap.Dropped)
+		prev = current
+	}
+}
+
+func summarizeWalkForward(report *WalkForwardReport) []WalkForwardTimeStats {
+	stats := make([]WalkForwardTimeStats, len(report.SnapshotTimes))
+	survived := make([]int, len(report.SnapshotTimes))
+	for i, t := range report.SnapshotTimes {
+		stats[i].Time = t
+	}
+
+	for _, day := range report.Days {
+		last := day.Snapshots[len(day.Snapshots)-1]
+		final := make(map[string]bool)
+		for _, c := range last.Candidates {
+			final[c.Symbol] = true
+		}
+
+		for i, snap := range day.Snapshots {
+			if snap.Error != "" {
+				continue
+			}
+			s := &stats[i]
+			s.Days++
+			s.Candidates += len(snap.Candidates)
+			s.Added += len(snap.Added)
+			s.Dropped += len(snap.Dropped)
+			for _, c := range snap.Candidates {
+				switch c.Status {
+				case "confident":
+					s.Confident++
+				case "questionable":
+					s.Questionable++
+				}
+				if last.Error == "" && final[c.Symbol] {
+					survived[i]++
+				}
+			}
+		}
+	}
+
+	for i := range stats {
+		if stats[i].Days > 0 {
+			stats[i].AvgCandidates = float64(stats[i].Candidates) / float64(stats[i].Days)
+		}
+		if stats[i].Candidates > 0 {
+			stats[i].SurvivalRate = float64(survived[i]) / float64(stats[i].Candidates)
+		}
+	}
+	return stats
+}
+
+// ReadDateList reads one YYYY-MM-DD date per line, skipping blank lines and
+// # comments (the dates.txt format).
+func ReadDateList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open date list: %w", err)
+	}
+	defer f.Close()
+
+	var dates []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", line); err != nil {
+			return nil, fmt.Errorf("invalid date %q in %s", line, path)
+		}
+		dates = append(dates, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read date list: %w", err)
+	}
+	return dates, nil
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Output
+// ─────────────────────────────────────────────────────────────────────────────
+
+func writeWalkForwardReport(cfg WalkForwardConfig, report *WalkForwardReport) error {
+	dir := filepath.Join(cfg.OutputDir, fmt.Sprintf("%s_%s",
+		strings.ReplaceAll(cfg.StartDate, "-", ""), strings.ReplaceAll(cfg.EndDate, "-", "")))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	snapshots := [][]string{{"Date", "Time", "Candidates", "Confident", "Questionable", "Added", "Dropped", "Symbols", "Error"}}
+	for _, day := range report.Days {
+		for _, snap := range day.Snapshots {
+			confident, questionable := 0, 0
+			var symbols []string
+			for _, c := range snap.Candidates {
+				symbols = append(symbols, c.Symbol)
+				switch c.Status {
+				case "confident":
+					confident++
+				case "questionable":
+					questionable++
+				}
+			}
+			snapshots = append(snapshots, []string{
+				day.Date,
+				snap.Time,
+				strconv.Itoa(len(snap.Candidates)),
+				strconv.Itoa(confident),
+				strconv.Itoa(questionable),
+				strings.Join(snap.Added, " "),
+				strings.Join(snap.Dropped, " "),
+				strings.Join(symbols, " "),
+				snap.Error,
+			})
+		}
+	}
+	if err := writeCSVFile(filepath.Join(dir, "walkforward_snapshots.csv"), snapshots); err != nil {
+		return err
+	}
+
+	// One row per (date, symbol) ever listed, with its status at each time.
+	header := append([]string{"Date", "Symbol", "FirstSeen"}, report.SnapshotTimes...)
+	candidates := [][]string{header}
+	for _, day := range report.Days {
+		statuses := make(map[string][]string)
+		var order []string
+		for i, snap := range day.Snapshots {
+			for _, c := range snap.Candidates {
+				if _, ok := statuses[c.Symbol]; !ok {
+					statuses[c.Symbol] = make([]string, len(day.Snapshots))
+					order = append(order, c.Symbol)
+				}
+				statuses[c.Symbol][i] = c.Status
+			}
+		}
+		for _, sym := range order {
+			firstSeen := ""
+			for i, status := range statuses[sym] {
+				if status != "" {
+					firstSeen = report.SnapshotTimes[i]
+					break
+				}
+			}
+			candidates = append(candidates, append([]string{day.Date, sym, firstSeen}, statuses[sym]...))
+		}
+	}
+	if err := writeCSVFile(filepath.Join(dir, "walkforward_candidates.csv"), candidates); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal report: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "walkforward_report.json"), data, 0644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+
+	LogInfo("WF", "Results written to %s", dir)
+	return nil
+}
@@ -0,0 +1,80 @@
+package ep
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+)
+
+// DEFAULT_WATCHLIST is the file the EP watcher monitors, relative to the
+// working directory.
+const DEFAULT_WATCHLIST = "watchlist.csv"
+
+// WatchlistEntry is one row of watchlist.csv, in the column order the
+// watchlist monitor reads.
+type WatchlistEntry struct {
+	StockSymbol  string
+	EntryPrice   string
+	StopLoss     string
+	Shares       string
+	InitialRisk  string
+	PurchaseDate string
+	ExitProfile  string
+}
+
+// AddToWatchlist appends entry to the watchlist CSV at filename, writing the
+// header if the file is new.  An entry with the same symbol, entry price,
+// stop and shares as an existing row is a "duplicate entry" error.
+func AddToWatchlist(filename string, entry WatchlistEntry) error {
+	existingEntries := make(map[string]WatchlistEntry)
+	if file, err := os.Open(filename); err == nil {
+		defer file.Close()
+		reader := csv.NewReader(file)
+		records, err := reader.ReadAll()
+		if err != nil {
+			return fmt.Errorf("failed to read existing watchlist: %w", err)
+		}
+		startIdx := 0
+		if len(records) > 0 && records[0][0] == "stock_symbol" {
+			startIdx = 1
+		}
+		for i := startIdx; i < len(records); i++ {
+			if len(records[i]) >= 4 {
+				key := fmt.Sprintf("%s|%s|%s|%s", records[i][0], records[i][1], records[i][2], records[i][3])
+				existingEntries[key] = WatchlistEntry{
+					StockSymbol: records[i][0],
+					EntryPrice:  records[i][1],
+					StopLoss:    records[i][2],
+					Shares:      records[i][3],
+				}
+			}
+		}
+	}
+	entryKey := fmt.Sprintf("%s|%s|%s|%s", entry.StockSymbol, entry.EntryPrice, entry.StopLoss, entry.Shares)
+	if _, exists := existingEntries[entryKey]; exists {
+		return fmt.Errorf("duplicate entry: %s with entry price %s and stop loss %s already exists in watchlist",
+			entry.StockSymbol, entry.EntryPrice, entry.StopLoss)
+	}
+	fileExists := true
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		fileExists = false
+	}
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open watchlist file: %w", err)
+	}
+	defer file.Close()
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+	if !fileExists {
+		if err := writer.Write([]string{"stock_symbol", "entry_price", "stop_loss_price", "shares", "initial_risk", "purchase_date", "exit_profile"}); err != nil {
+			return fmt.Errorf("failed to write CSV header: %w", err)
+		}
+	}
+	record := []string{entry.StockSymbol, entry.EntryPrice, entry.StopLoss, entry.Shares,
+		entry.InitialRisk, entry.PurchaseDate, entry.ExitProfile}
+	if err := writer.Write(record); err != nil {
+		return fmt.Errorf("failed to write CSV record: %w", err)
+	}
+	return nil
+}
@@ -1,344 +1,640 @@
-package ep
-
-import (
-	"fmt"
-	"log"
-	"os"
-	"path/filepath"
-	"time"
-
-	"github.com/alpacahq/alpaca-trade-api-go/v3/alpaca"
-	"github.com/alpacahq/alpaca-trade-api-go/v3/marketdata"
-	"github.com/joho/godotenv"
-	"github.com/shopspring/decimal"
-)
-
-var (
-	apiClient    *alpaca.Client
-	marketClient *marketdata.Client
-)
-
-func init() {
-	loadEnv()
-	initClients()
-}
-
-// loadEnv walks up the directory tree from the current working directory
-// until it finds a .env file and loads it.  This means tests running from
-// a sub-package directory (e.g. cmd/avantai/ep/ep_watchlist/) will still
-// find the .env at the project root.
-func loadEnv() {
-	dir, err := os.Getwd()
-	if err != nil {
-		log.Println("Warning: cannot determine working directory")
-		return
-	}
-
-	for {
-		candidate := filepath.Join(dir, ".env")
-		if _, err := os.Stat(candidate); err == nil {
-			if err := godotenv.Load(candidate); err != nil {
-				log.Printf("Warning: found .env at %s but could not load it: %v", candidate, err)
-			}
-			return
-		}
-
-		parent := filepath.Dir(dir)
-		if parent == dir {
-			log.Println("Warning: .env file not found in any parent directory")
-			return
-		}
-		dir = parent
-	}
-}
-
-// initClients builds the Alpaca clients from environment variables.
-// Separated from init() so that missing credentials during tests do not
-// call log.Fatal and kill the test binary at import time.
-func initClients() {
-	apiKey := os.Getenv("ALPACA_API_KEY")
-	apiSecret := os.Getenv("ALPACA_SECRET_KEY")
-	paperURL := os.Getenv("ALPACA_PAPER_URL")
-
-	if apiKey == "" || apiSecret == "" {
-		// Not fatal — tests run without real credentials.
-		// Any real call through apiClient/marketClient will panic,
-		// which is the correct signal that keys are missing in production.
-		log.Println("⚠️  ALPACA_API_KEY / ALPACA_SECRET_KEY not set — Alpaca client calls will fail")
-		return
-	}
-
-	apiClient = alpaca.NewClient(alpaca.ClientOpts{
-		APIKey:    apiKey,
-		APISecret: apiSecret,
-		BaseURL:   paperURL,
-	})
-
-	marketClient = marketdata.NewClient(marketdata.ClientOpts{
-		APIKey:    apiKey,
-		APISecret: apiSecret,
-	})
-}
-
-// ─────────────────────────────────────────────────────────────────────────────
-// Account & Position helpers
-// ─────────────────────────────────────────────────────────────────────────────
-
-// AccountInfo holds key account information.
-type AccountInfo struct {
-	Status         string
-	Cash           string
-	BuyingPower    string
-	PortfolioValue string
-}
-
-// GetAccountInfo retrieves key account information.
-func GetAccountInfo() (*AccountInfo, error) {
-	account, err := apiClient.GetAccount()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get account: %w", err)
-	}
-	return &AccountInfo{
-		Status:         string(account.Status),
-		Cash:           account.Cash.StringFixed(2),
-		BuyingPower:    account.BuyingPower.StringFixed(2),
-		PortfolioValue: account.PortfolioValue.StringFixed(2),
-	}, nil
-}
-
-// GetAsset retrieves the Alpaca Asset object for a given symbol and ensures it is tradable.
-func GetAsset(symbol string) (*alpaca.Asset, error) {
-	asset, err := apiClient.GetAsset(symbol)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get asset %s: %w", symbol, err)
-	}
-	if !asset.Tradable {
-		return nil, fmt.Errorf("%s is not tradable", symbol)
-	}
-	return asset, nil
-}
-
-// CheckAllOrders retrieves and logs all open orders.
-func CheckAllOrders() ([]alpaca.Order, error) {
-	orders, err := apiClient.GetOrders(alpaca.GetOrdersRequest{Status: "open"})
-	if err != nil {
-		return nil, fmt.Errorf("failed to get orders: %w", err)
-	}
-
-	fmt.Printf("\n=== All Open Orders (%d) ===\n", len(orders))
-	for _, order := range orders {
-		fmt.Printf("\nOrder ID: %s\n", order.ID)
-		fmt.Printf("  Symbol: %s | Side: %s | Type: %s | Qty: %s | Status: %s\n",
-			order.Symbol, order.Side, order.Type, order.Qty, order.Status)
-		if order.LimitPrice != nil {
-			fmt.Printf("  Limit Price: $%s\n", order.LimitPrice.StringFixed(2))
-		}
-		if order.StopPrice != nil {
-			fmt.Printf("  Stop Price: $%s\n", order.StopPrice.StringFixed(2))
-		}
-	}
-	return orders, nil
-}
-
-// CancelAllOrders cancels all open orders.
-func CancelAllOrders() error {
-	orders, err := apiClient.GetOrders(alpaca.GetOrdersRequest{Status: "open"})
-	if err != nil {
-		return fmt.Errorf("failed to get orders: %w", err)
-	}
-	for _, order := range orders {
-		if err := apiClient.CancelOrder(order.ID); err != nil {
-			log.Printf("Failed to cancel order %s: %v", order.ID, err)
-		}
-	}
-	fmt.Printf("Cancelled %d open orders.\n", len(orders))
-	return nil
-}
-
-// LiquidateAllPositions sells all positions at market price.
-func LiquidateAllPositions() error {
-	positions, err := apiClient.GetPositions()
-	if err != nil {
-		return fmt.Errorf("failed to get positions: %w", err)
-	}
-	for _, pos := range positions {
-		qty, _ := pos.Qty.Float64()
-		absQty := pos.Qty.Abs()
-		side := alpaca.Sell
-		if qty < 0 {
-			side = alpaca.Buy
-		}
-		_, err := apiClient.PlaceOrder(alpaca.PlaceOrderRequest{
-			Symbol:      pos.Symbol,
-			Qty:         &absQty,
-			Side:        side,
-			Type:        alpaca.Market,
-			TimeInForce: alpaca.Day,
-		})
-		if err != nil {
-			log.Printf("Failed to liquidate %s: %v", pos.Symbol, err)
-		} else {
-			fmt.Printf("Liquidating %s: %s shares\n", pos.Symbol, pos.Qty.String())
-		}
-	}
-	fmt.Printf("Liquidated %d positions.\n", len(positions))
-	return nil
-}
-
-// ─────────────────────────────────────────────────────────────────────────────
-// Order placement
-// ─────────────────────────────────────────────────────────────────────────────
-
-// PlaceEntryWithStop places a bracket limit buy order.
-// If entryPrice is nil, it uses market price + $0.10.
-// takeProfit is set to 7× entry by default — override as needed.
-func PlaceEntryWithStop(symbol string, stopLoss float64, shares int, entryPrice *float64) (*alpaca.Order, error) {
-	if _, err := GetAsset(symbol); err != nil {
-		return nil, err
-	}
-
-	var entry float64
-	if entryPrice == nil {
-		trade, err := marketClient.GetLatestTrade(symbol, marketdata.GetLatestTradeRequest{})
-		if err != nil {
-			return nil, fmt.Errorf("failed to get latest trade for %s: %w", symbol, err)
-		}
-		entry = roundCents(trade.Price + 0.10)
-	} else {
-		entry = roundCents(*entryPrice)
-	}
-
-	stopLoss = roundCents(stopLoss)
-	takeProfitPrice := roundCents(entry * 7)
-
-	if stopLoss >= entry {
-		return nil, fmt.Errorf("stop loss $%.2f must be below entry $%.2f", stopLoss, entry)
-	}
-
-	fmt.Printf("[%s] Entry: $%.2f | Stop: $%.2f | TP: $%.2f | Shares: %d\n",
-		symbol, entry, stopLoss, takeProfitPrice, shares)
-
-	qty := decimal.NewFromInt(int64(shares))
-	limitPrice := decimal.NewFromFloat(entry)
-	stopLossPrice := decimal.NewFromFloat(stopLoss)
-	takeProfitLimit := decimal.NewFromFloat(takeProfitPrice)
-
-	order, err := apiClient.PlaceOrder(alpaca.PlaceOrderRequest{
-		Symbol:      symbol,
-		Qty:         &qty,
-		Side:        alpaca.Buy,
-		Type:        alpaca.Limit,
-		TimeInForce: alpaca.Day,
-		LimitPrice:  &limitPrice,
-		OrderClass:  alpaca.Bracket,
-		StopLoss: &alpaca.StopLoss{
-			StopPrice: &stopLossPrice,
-		},
-		TakeProfit: &alpaca.TakeProfit{
-			LimitPrice: &takeProfitLimit,
-		},
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to place bracket order for %s: %w", symbol, err)
-	}
-
-	fmt.Printf("[%s] ✅ Bracket order placed (ID: %s, status: %s)\n", symbol, order.ID, order.Status)
-	return order, nil
-}
-
-// PlaceSellOrder places a sell order for a given symbol.
-// If sellPrice is nil, a market order is placed; otherwise a limit order.
-func PlaceSellOrder(symbol string, shares int, sellPrice *float64) (*alpaca.Order, error) {
-	if _, err := GetAsset(symbol); err != nil {
-		return nil, err
-	}
-
-	if shares <= 0 {
-		return nil, fmt.Errorf("shares must be positive, got %d", shares)
-	}
-
-	qty := decimal.NewFromInt(int64(shares))
-
-	orderReq := alpaca.PlaceOrderRequest{
-		Symbol:      symbol,
-		Qty:         &qty,
-		Side:        alpaca.Sell,
-		TimeInForce: alpaca.Day,
-	}
-
-	if sellPrice == nil {
-		orderReq.Type = alpaca.Market
-		log.Printf("[%s] Placing MARKET sell for %d shares", symbol, shares)
-	} else {
-		rounded := roundCents(*sellPrice)
-		limitPrice := decimal.NewFromFloat(rounded)
-		orderReq.Type = alpaca.Limit
-		orderReq.LimitPrice = &limitPrice
-		log.Printf("[%s] Placing LIMIT sell for %d shares @ $%.2f", symbol, shares, rounded)
-	}
-
-	order, err := apiClient.PlaceOrder(orderReq)
-	if err != nil {
-		return nil, fmt.Errorf("failed to place sell order for %s: %w", symbol, err)
-	}
-
-	log.Printf("[%s] ✅ Sell order placed (ID: %s, status: %s)", symbol, order.ID, order.Status)
-	return order, nil
-}
-
-// CancelOrder cancels a single order by ID.
-func CancelOrder(orderID string) error {
-	if err := apiClient.CancelOrder(orderID); err != nil {
-		return fmt.Errorf("failed to cancel order %s: %w", orderID, err)
-	}
-	log.Printf("Cancelled order %s", orderID)
-	return nil
-}
-
-// ─────────────────────────────────────────────────────────────────────────────
-// Internal helpers
-// ─────────────────────────────────────────────────────────────────────────────
-
-// roundCents rounds a float to 2 decimal places (avoids sub-penny issues).
-func roundCents(f float64) float64 {
-	return float64(int(f*100+0.5)) / 100
-}
-
-// ─────────────────────────────────────────────────────────────────────────────
-// main (manual test / smoke-test only — remove or gate before production)
-// ─────────────────────────────────────────────────────────────────────────────
-
-func main() {
-	fmt.Println("=== Account Info ===")
-	info, err := GetAccountInfo()
-	if err != nil {
-		log.Fatalf("Failed to get account info: %v", err)
-	}
-	fmt.Printf("Status: %s | Cash: $%s | Buying Power: $%s | Portfolio: $%s\n",
-		info.Status, info.Cash, info.BuyingPower, info.PortfolioValue)
-
-	fmt.Println("\n=== Cleaning Up ===")
-	_ = CancelAllOrders()
-	_ = LiquidateAllPositions()
-	time.Sleep(3 * time.Second)
-
-	fmt.Println("\n=== Test Orders ===")
-	symbols := []string{"AAPL", "NVDA", "AMD"}
-	for _, sym := range symbols {
-		trade, err := marketClient.GetLatestTrade(sym, marketdata.GetLatestTradeRequest{})
-		if err != nil {
-			log.Printf("Skip %s — price fetch error: %v", sym, err)
-			continue
-		}
-		stopLoss := roundCents(trade.Price * 0.95)
-		order, err := PlaceEntryWithStop(sym, stopLoss, 10, nil)
-		if err != nil {
-			log.Printf("✗ %s order error: %v", sym, err)
-			continue
-		}
-		fmt.Printf("✓ %s order placed (ID: %s)\n", sym, order.ID)
-	}
-
-	time.Sleep(2 * time.Second)
-	_, _ = CheckAllOrders()
-}
+package ep
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"avantai/pkg/broker"
+	riskCalculator "avantai/pkg/riskmanagement"
+
+	"github.com/joho/godotenv"
+)
+
+var (
+	brokerMu     sync.RWMutex
+	activeBroker broker.Broker
+)
+
+func init() {
+	loadEnv()
+	initClients()
+}
+
+// loadEnv walks up the directory tree from the current working directory
+// until it finds a .env file and loads it.  This means tests running from
+// a sub-package directory (e.g. cmd/avantai/ep/ep_watchlist/) will still
+// find the .env at the project root.
+func loadEnv() {
+	dir, err := os.Getwd()
+	if err != nil {
+		log.Println("Warning: cannot determine working directory")
+		return
+	}
+
+	for {
+		candidate := filepath.Join(dir, ".env")
+		if _, err := os.Stat(candidate); err == nil {
+			if err := godotenv.Load(candidate); err != nil {
+				log.Printf("Warning: found .env at %s but could not load it: %v", candidate, err)
+			}
+			return
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			log.Println("Warning: .env file not found in any parent directory")
+			return
+		}
+		dir = parent
+	}
+}
+
+// initClients builds the broker named by BROKER (alpaca by default, or sim
+// for the local paper simulator) from environment variables.
+// Separated from init() so that missing credentials during tests do not
+// call log.Fatal and kill the test binary at import time.
+func initClients() {
+	b, err := broker.NewFromEnv()
+	if err != nil {
+		// Not fatal — tests run without real credentials.
+		// Any order call before SetBroker returns an error instead.
+		log.Printf("⚠️  %v — broker calls will fail", err)
+		return
+	}
+	SetBroker(b)
+}
+
+// SetBroker replaces the broker used by every order function in this
+// package, e.g. with a *broker.SimBroker for offline runs.
+func SetBroker(b broker.Broker) {
+	brokerMu.Lock()
+	defer brokerMu.Unlock()
+	activeBroker = b
+}
+
+// CurrentBroker returns the broker used by the order functions, or an error
+// if none is configured.
+func CurrentBroker() (broker.Broker, error) {
+	brokerMu.RLock()
+	defer brokerMu.RUnlock()
+	if activeBroker == nil {
+		return nil, fmt.Errorf("no broker configured (set BROKER, or ALPACA_API_KEY / ALPACA_SECRET_KEY)")
+	}
+	return activeBroker, nil
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Account & Position helpers
+// ─────────────────────────────────────────────────────────────────────────────
+
+// AccountInfo holds key account information.
+type AccountInfo struct {
+	Status         string
+	Cash           string
+	BuyingPower    string
+	PortfolioValue string
+}
+
+// GetAccountInfo retrieves key account information.
+func GetAccountInfo() (*AccountInfo, error) {
+	b, err := CurrentBroker()
+	if err != nil {
+		return nil, err
+	}
+	account, err := b.Account()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account: %w", err)
+	}
+	return &AccountInfo{
+		Status:         account.Status,
+		Cash:           fmt.Sprintf("%.2f", account.Cash),
+		BuyingPower:    fmt.Sprintf("%.2f", account.BuyingPower),
+		PortfolioValue: fmt.Sprintf("%.2f", account.PortfolioValue),
+	}, nil
+}
+
+// GetAsset retrieves the broker's Asset for a given symbol and ensures it is tradable.
+func GetAsset(symbol string) (*broker.Asset, error) {
+	b, err := CurrentBroker()
+	if err != nil {
+		return nil, err
+	}
+	asset, err := b.Asset(symbol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get asset %s: %w", symbol, err)
+	}
+	if !asset.Tradable {
+		return nil, fmt.Errorf("%s is not tradable", symbol)
+	}
+	return asset, nil
+}
+
+// CheckAllOrders retrieves and logs all open orders.
+func CheckAllOrders() ([]broker.Order, error) {
+	b, err := CurrentBroker()
+	if err != nil {
+		return nil, err
+	}
+	orders, err := b.ListOrders("open")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get orders: %w", err)
+	}
+
+	fmt.Printf("\n=== All Open Orders (%d) ===\n", len(orders))
+	for _, order := range orders {
+		fmt.Printf("\nOrder ID: %s\n", order.ID)
+		fmt.Printf("  Symbol: %s | Side: %s | Type: %s | Qty: %g | Status: %s\n",
+			order.Symbol, order.Side, order.Type, order.Qty, order.Status)
+		if order.LimitPrice != 0 {
+			fmt.Printf("  Limit Price: $%.2f\n", order.LimitPrice)
+		}
+		if order.StopPrice != 0 {
+			fmt.Printf("  Stop Price: $%.2f\n", order.StopPrice)
+		}
+	}
+	return orders, nil
+}
+
+// CancelAllOrders cancels all open orders.
+func CancelAllOrders() error {
+	b, err := CurrentBroker()
+	if err != nil {
+		return err
+	}
+	orders, err := b.ListOrders("open")
+	if err != nil {
+		return fmt.Errorf("failed to get orders: %w", err)
+	}
+	for _, order := range orders {
+		if err := b.CancelOrder(order.ID); err != nil {
+			log.Printf("Failed to cancel order %s: %v", order.ID, err)
+			continue
+		}
+		recordCancel(b.Name(), order.ID)
+	}
+	fmt.Printf("Cancelled %d open orders.\n", len(orders))
+	return nil
+}
+
+// LiquidateAllPositions sells all positions at market price.
+func LiquidateAllPositions() error {
+	b, err := CurrentBroker()
+	if err != nil {
+		return err
+	}
+	positions, err := b.Positions()
+	if err != nil {
+		return fmt.Errorf("failed to get positions: %w", err)
+	}
+	for _, pos := range positions {
+		qty := pos.Qty
+		side := broker.Sell
+		if qty < 0 {
+			side = broker.Buy
+			qty = -qty
+		}
+		order, err := b.PlaceOrder(broker.OrderRequest{
+			Symbol:      pos.Symbol,
+			Qty:         qty,
+			Side:        side,
+			Type:        broker.Market,
+			TimeInForce: broker.Day,
+		})
+		if err != nil {
+			log.Printf("Failed to liquidate %s: %v", pos.Symbol, err)
+		} else {
+			recordOrder(broker.LedgerPlaced, b.Name(), order, 0)
+			fmt.Printf("Liquidating %s: %g shares\n", pos.Symbol, pos.Qty)
+		}
+	}
+	fmt.Printf("Liquidated %d positions.\n", len(positions))
+	return nil
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Order placement
+// ─────────────────────────────────────────────────────────────────────────────
+
+// DEFAULT_TAKE_PROFIT_MULTIPLE places the bracket take-profit at this
+// multiple of entry when EntryOptions sets neither TakeProfit nor
+// TakeProfitR — far enough away that exits are left to the position manager.
+const DEFAULT_TAKE_PROFIT_MULTIPLE = 7.0
+
+// EntryOptions controls how PlaceEntry prices and protects an entry.  Zero
+// fields take the defaults noted, which reproduce PlaceEntryWithStop, except
+// Slippage: zero means none, and DefaultEntryOptions sets the $0.10.
+type EntryOptions struct {
+	// Type is broker.Limit (default), broker.Market or broker.StopLimit.
+	Type broker.OrderType
+	// EntryPrice is the limit for a Limit entry.  Zero means a marketable
+	// limit: the latest trade plus Slippage.
+	EntryPrice float64
+	// Trigger is the stop price of a StopLimit entry, e.g. just above the
+	// opening-range high; its limit is Trigger plus Slippage.
+	Trigger float64
+	// Slippage is how far above the reference price the limit sits.
+	Slippage float64
+	// Class is broker.Bracket (default), broker.OTO (stop-loss leg only,
+	// exits left to the position manager) or broker.Simple (no legs; the
+	// stop goes in as a standalone GTC order once ManageEntry sees a fill).
+	Class broker.OrderClass
+	// TakeProfit is the bracket take-profit price.  If zero, TakeProfitR
+	// places it that many R (entry − stop) above entry; if that is zero too,
+	// at DEFAULT_TAKE_PROFIT_MULTIPLE × entry.
+	TakeProfit  float64
+	TakeProfitR float64
+	// TimeInForce is broker.Day (default) or broker.GTC.
+	TimeInForce broker.TimeInForce
+	// ExtendedHours lets the entry trade pre- and post-market.  The broker
+	// only accepts it on a simple Day limit order, so the stop follows the
+	// fill as for any Simple entry.
+	ExtendedHours bool
+}
+
+// DefaultEntryOptions is a Day bracket with a marketable limit at the latest
+// trade + $0.10 and a take-profit at 7× entry.
+func DefaultEntryOptions() EntryOptions {
+	return EntryOptions{
+		Type:        broker.Limit,
+		Slippage:    0.10,
+		Class:       broker.Bracket,
+		TimeInForce: broker.Day,
+	}
+}
+
+// EntryOptionsFromEnv starts from DefaultEntryOptions and applies the
+// settings for one strategy, named by prefix (e.g. "EP", "HTF"):
+//
+//	<prefix>_ENTRY_TYPE      limit | market | stop_limit
+//	<prefix>_ENTRY_SLIPPAGE  dollars above the reference price
+//	<prefix>_ORDER_CLASS     bracket | oto | simple
+//	<prefix>_TAKE_PROFIT_R   take-profit as an R multiple
+//	<prefix>_TIME_IN_FORCE   day | gtc
+//	<prefix>_EXTENDED_HOURS  true | false
+//
+// A stop_limit entry still needs its Trigger set by the caller.
+func EntryOptionsFromEnv(prefix string) (EntryOptions, error) {
+	opts := DefaultEntryOptions()
+	env := func(name string) string {
+		return strings.ToLower(strings.TrimSpace(os.Getenv(prefix + "_" + name)))
+	}
+	float := func(name string, dst *float64) error {
+		if v := env(name); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return fmt.Errorf("invalid %s_%s %q: %w", prefix, name, v, err)
+			}
+			*dst = f
+		}
+		return nil
+	}
+
+	if v := env("ENTRY_TYPE"); v != "" {
+		opts.Type = broker.OrderType(v)
+	}
+	if err := float("ENTRY_SLIPPAGE", &opts.Slippage); err != nil {
+		return opts, err
+	}
+	if v := env("ORDER_CLASS"); v != "" {
+		opts.Class = broker.OrderClass(v)
+	}
+	if err := float("TAKE_PROFIT_R", &opts.TakeProfitR); err != nil {
+		return opts, err
+	}
+	if v := env("TIME_IN_FORCE"); v != "" {
+		opts.TimeInForce = broker.TimeInForce(v)
+	}
+	if v := env("EXTENDED_HOURS"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid %s_EXTENDED_HOURS %q: %w", prefix, v, err)
+		}
+		opts.ExtendedHours = b
+	}
+	return opts, opts.validate()
+}
+
+// withDefaults fills the empty Type, Class and TimeInForce of o from
+// DefaultEntryOptions.
+func (o EntryOptions) withDefaults() EntryOptions {
+	def := DefaultEntryOptions()
+	if o.Type == "" {
+		o.Type = def.Type
+	}
+	if o.Class == "" {
+		o.Class = def.Class
+	}
+	if o.TimeInForce == "" {
+		o.TimeInForce = def.TimeInForce
+	}
+	return o
+}
+
+func (o EntryOptions) validate() error {
+	switch o.Type {
+	case broker.Limit, broker.Market, broker.StopLimit:
+	default:
+		return fmt.Errorf("unsupported entry type %q", o.Type)
+	}
+	switch o.Class {
+	case broker.Bracket, broker.OTO, broker.Simple:
+	default:
+		return fmt.Errorf("unsupported entry order class %q", o.Class)
+	}
+	switch o.TimeInForce {
+	case broker.Day, broker.GTC:
+	default:
+		return fmt.Errorf("unsupported time in force %q", o.TimeInForce)
+	}
+	if o.ExtendedHours && (o.Type != broker.Limit || o.TimeInForce != broker.Day) {
+		return fmt.Errorf("extended hours requires a day limit entry")
+	}
+	if o.ExtendedHours && o.Class != broker.Simple {
+		return fmt.Errorf("extended hours requires a simple entry order, not %q (brokers reject bracket/OTO/OCO legs outside regular hours)", o.Class)
+	}
+	if o.Slippage < 0 || o.TakeProfitR < 0 {
+		return fmt.Errorf("slippage and take-profit R must not be negative")
+	}
+	return nil
+}
+
+// PlaceEntryWithStop places a bracket limit buy order.
+// If entryPrice is nil, it uses market price + $0.10.
+// takeProfit is set to 7× entry by default — use PlaceEntry to override.
+func PlaceEntryWithStop(symbol string, stopLoss float64, shares int, entryPrice *float64) (*broker.Order, error) {
+	opts := DefaultEntryOptions()
+	if entryPrice != nil {
+		opts.EntryPrice = *entryPrice
+	}
+	return PlaceEntry(symbol, stopLoss, shares, opts)
+}
+
+// PlaceEntry places a buy entry with a stop at stopLoss as opts describes,
+// once the circuit breaker is clear (a *BreakerTrippedError otherwise) and
+// the portfolio risk engine allows it (a *RiskDeniedError otherwise).
+func PlaceEntry(symbol string, stopLoss float64, shares int, opts EntryOptions) (*broker.Order, error) {
+	opts = opts.withDefaults()
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	b, err := CurrentBroker()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := GetAsset(symbol); err != nil {
+		return nil, err
+	}
+	if shares <= 0 {
+		return nil, fmt.Errorf("shares must be positive, got %d", shares)
+	}
+
+	req := broker.OrderRequest{
+		Symbol:        symbol,
+		Qty:           float64(shares),
+		Side:          broker.Buy,
+		Type:          opts.Type,
+		TimeInForce:   opts.TimeInForce,
+		Class:         opts.Class,
+		ExtendedHours: opts.ExtendedHours,
+	}
+
+	// entry is the worst price the order can fill at, which risk and the
+	// take-profit are measured from; expected is the price we assume.
+	var entry, expected float64
+	switch opts.Type {
+	case broker.Market, broker.Limit:
+		if opts.Type == broker.Limit && opts.EntryPrice > 0 {
+			entry = roundCents(opts.EntryPrice)
+			expected = entry
+			break
+		}
+		price, err := b.LatestPrice(symbol)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get latest trade for %s: %w", symbol, err)
+		}
+		entry, expected = roundCents(price+opts.Slippage), roundCents(price)
+		if opts.Type == broker.Limit {
+			expected = entry
+		}
+	case broker.StopLimit:
+		if opts.Trigger <= 0 {
+			return nil, fmt.Errorf("stop_limit entry for %s requires a trigger price", symbol)
+		}
+		req.StopPrice = roundCents(opts.Trigger)
+		entry, expected = roundCents(opts.Trigger+opts.Slippage), req.StopPrice
+	}
+	if opts.Type != broker.Market {
+		req.LimitPrice = entry
+	}
+
+	stopLoss = roundCents(stopLoss)
+	if stopLoss >= expected {
+		return nil, fmt.Errorf("stop loss $%.2f must be below entry $%.2f", stopLoss, expected)
+	}
+
+	var takeProfitPrice float64
+	switch {
+	case opts.Class != broker.Bracket:
+	case opts.TakeProfit > 0:
+		takeProfitPrice = roundCents(opts.TakeProfit)
+	case opts.TakeProfitR > 0:
+		takeProfitPrice = roundCents(entry + opts.TakeProfitR*(entry-stopLoss))
+	default:
+		takeProfitPrice = roundCents(entry * DEFAULT_TAKE_PROFIT_MULTIPLE)
+	}
+	if opts.Class == broker.Bracket && takeProfitPrice <= entry {
+		return nil, fmt.Errorf("take profit $%.2f must be above entry $%.2f", takeProfitPrice, entry)
+	}
+	if opts.Class != broker.Simple {
+		req.StopLoss = stopLoss
+	}
+	req.TakeProfit = takeProfitPrice
+
+	// A tripped circuit breaker blocks every entry.  The portfolio limits
+	// are checked at the worst fill price.  Without an account to check
+	// against, nothing goes out.
+	if err := ensureBreakerClear(); err != nil {
+		return nil, err
+	}
+	entryRiskMu.Lock()
+	defer entryRiskMu.Unlock()
+	decision, err := CheckEntryRisk(riskCalculator.Proposal{
+		Symbol: symbol, Qty: float64(shares), Entry: entry, Stop: stopLoss,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to check portfolio risk for %s: %w", symbol, err)
+	}
+	if !decision.Allowed {
+		return nil, &RiskDeniedError{Symbol: symbol, Decision: decision}
+	}
+
+	fmt.Printf("[%s] %s %s entry: $%.2f | Stop: $%.2f | TP: $%.2f | Shares: %d | TIF: %s\n",
+		symbol, opts.Class, opts.Type, expected, stopLoss, takeProfitPrice, shares, opts.TimeInForce)
+
+	order, err := b.PlaceOrder(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to place %s entry for %s: %w", opts.Class, symbol, err)
+	}
+	recordOrder(broker.LedgerPlaced, b.Name(), order, expected)
+	rememberEntryStop(order.ID, stopLoss)
+
+	fmt.Printf("[%s] ✅ %s entry placed via %s (ID: %s, status: %s)\n", symbol, opts.Class, b.Name(), order.ID, order.Status)
+	return order, nil
+}
+
+// PlaceExitOCO protects shares already held with a take-profit limit and a
+// stop-loss, either of which cancels the other — the exits for an entry
+// placed as OTO or Simple.
+func PlaceExitOCO(symbol string, shares int, takeProfit, stopLoss float64) (*broker.Order, error) {
+	b, err := CurrentBroker()
+	if err != nil {
+		return nil, err
+	}
+	takeProfit, stopLoss = roundCents(takeProfit), roundCents(stopLoss)
+	if stopLoss <= 0 || takeProfit <= stopLoss {
+		return nil, fmt.Errorf("oco requires 0 < stop loss < take profit, got $%.2f / $%.2f", stopLoss, takeProfit)
+	}
+
+	order, err := b.PlaceOrder(broker.OrderRequest{
+		Symbol:      symbol,
+		Qty:         float64(shares),
+		Side:        broker.Sell,
+		Type:        broker.Limit,
+		TimeInForce: broker.GTC,
+		LimitPrice:  takeProfit,
+		Class:       broker.OCO,
+		TakeProfit:  takeProfit,
+		StopLoss:    stopLoss,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to place oco exit for %s: %w", symbol, err)
+	}
+	recordOrder(broker.LedgerPlaced, b.Name(), order, takeProfit)
+
+	log.Printf("[%s] ✅ OCO exit placed via %s: TP $%.2f / stop $%.2f x %d (ID: %s)", symbol, b.Name(), takeProfit, stopLoss, shares, order.ID)
+	return order, nil
+}
+
+// PlaceSellOrder places a sell order for a given symbol.
+// If sellPrice is nil, a market order is placed; otherwise a limit order.
+func PlaceSellOrder(symbol string, shares int, sellPrice *float64) (*broker.Order, error) {
+	return PlaceSellOrderAs("", symbol, shares, sellPrice)
+}
+
+// PlaceSellOrderAs is PlaceSellOrder with the caller's client order ID, so
+// trade updates for the order can be recognised before it returns.
+func PlaceSellOrderAs(clientOrderID, symbol string, shares int, sellPrice *float64) (*broker.Order, error) {
+	b, err := CurrentBroker()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := GetAsset(symbol); err != nil {
+		return nil, err
+	}
+
+	if shares <= 0 {
+		return nil, fmt.Errorf("shares must be positive, got %d", shares)
+	}
+
+	orderReq := broker.OrderRequest{
+		Symbol:        symbol,
+		Qty:           float64(shares),
+		Side:          broker.Sell,
+		TimeInForce:   broker.Day,
+		ClientOrderID: clientOrderID,
+	}
+
+	expected := 0.0
+	if sellPrice == nil {
+		orderReq.Type = broker.Market
+		log.Printf("[%s] Placing MARKET sell for %d shares", symbol, shares)
+	} else {
+		rounded := roundCents(*sellPrice)
+		orderReq.Type = broker.Limit
+		orderReq.LimitPrice = rounded
+		expected = rounded
+		log.Printf("[%s] Placing LIMIT sell for %d shares @ $%.2f", symbol, shares, rounded)
+	}
+
+	order, err := b.PlaceOrder(orderReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to place sell order for %s: %w", symbol, err)
+	}
+	recordOrder(broker.LedgerPlaced, b.Name(), order, expected)
+
+	log.Printf("[%s] ✅ Sell order placed via %s (ID: %s, status: %s)", symbol, b.Name(), order.ID, order.Status)
+	return order, nil
+}
+
+// CancelOrder cancels a single order by ID.
+func CancelOrder(orderID string) error {
+	b, err := CurrentBroker()
+	if err != nil {
+		return err
+	}
+	if err := b.CancelOrder(orderID); err != nil {
+		return fmt.Errorf("failed to cancel order %s: %w", orderID, err)
+	}
+	recordCancel(b.Name(), orderID)
+	log.Printf("Cancelled order %s", orderID)
+	return nil
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Internal helpers
+// ─────────────────────────────────────────────────────────────────────────────
+
+// roundCents rounds a float to 2 decimal places (avoids sub-penny issues).
+func roundCents(f float64) float64 {
+	return float64(int(f*100+0.5)) / 100
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// main (manual test / smoke-test only — remove or gate before production)
+// ─────────────────────────────────────────────────────────────────────────────
+
+func main() {
+	fmt.Println("=== Account Info ===")
+	info, err := GetAccountInfo()
+	if err != nil {
+		log.Fatalf("Failed to get account info: %v", err)
+	}
+	fmt.Printf("Status: %s | Cash: $%s | Buying Power: $%s | Portfolio: $%s\n",
+		info.Status, info.Cash, info.BuyingPower, info.PortfolioValue)
+
+	fmt.Println("\n=== Cleaning Up ===")
+	_ = CancelAllOrders()
+	_ = LiquidateAllPositions()
+	time.Sleep(3 * time.Second)
+
+	fmt.Println("\n=== Test Orders ===")
+	symbols := []string{"AAPL", "NVDA", "AMD"}
+	for _, sym := range symbols {
+		b, err := CurrentBroker()
+		if err != nil {
+			log.Fatalf("No broker: %v", err)
+		}
+		price, err := b.LatestPrice(sym)
+		if err != nil {
+			log.Printf("Skip %s — price fetch error: %v", sym, err)
+			continue
+		}
+		stopLoss := roundCents(price * 0.95)
+		order, err := PlaceEntryWithStop(sym, stopLoss, 10, nil)
+		if err != nil {
+			log.Printf("✗ %s order error: %v", sym, err)
+			continue
+		}
+		fmt.Printf("✓ %s order placed (ID: %s)\n", sym, order.ID)
+	}
+
+	time.Sleep(2 * time.Second)
+	_, _ = CheckAllOrders()
+}
@@ -0,0 +1,418 @@
+// Package exits is the EP exit-rule engine: weak close, stop, breakeven,
+// no-follow-through tightening, strong-EP profit, three partial take-profit
+// levels and the trailing stop.
+//
+// The engine owns no orders, files or global state.  Each Evaluate call takes
+// a position, the session's bars so far and the engine's clock, updates the
+// position's rule state, and returns what should happen as Decisions.  The
+// live watcher turns sells into broker orders; the backtester turns them into
+// fills.
+package exits
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Bar is one intraday OHLC bar.
+type Bar struct {
+	Time                   time.Time
+	Open, High, Low, Close float64
+}
+
+// Clock supplies "now" for an evaluation.  replay.Clock satisfies it.
+type Clock interface {
+	Now() time.Time
+}
+
+// WallClock is the real time.
+type WallClock struct{}
+
+func (WallClock) Now() time.Time { return time.Now() }
+
+// ManualClock is set by the caller, e.g. to each bar's close in a backtest.
+type ManualClock struct{ T time.Time }
+
+func (c *ManualClock) Now() time.Time { return c.T }
+
+// Set moves the clock to t.
+func (c *ManualClock) Set(t time.Time) { c.T = t }
+
+// Position is an open long position and all of its exit-rule state.
+type Position struct {
+	Symbol          string
+	EntryPrice      float64
+	StopLoss        float64
+	InitialStopLoss float64
+	InitialRisk     float64 // per share
+	Shares          float64 // decremented on partial exits
+	InitialShares   float64
+	PurchaseDate    time.Time
+	DaysHeld        int
+	LastCheckDate   time.Time // last calendar date DaysHeld was incremented
+
+	// Profit-taking flags
+	ProfitTaken  bool
+	ProfitTaken2 bool
+	ProfitTaken3 bool
+
+	// Trailing / advanced stop state
+	TrailingStopMode bool
+	HighestPrice     float64 // highest intraday high seen since entry
+
+	// Running tally of realised profit from partial exits
+	CumulativeProfit float64
+
+	// Per-session OHLC from the latest evaluation
+	SessionHigh float64
+	SessionLow  float64
+	SessionOpen float64
+	LastPrice   float64
+
+	// Set true if a weak close was detected
+	WeakCloseDetected bool
+}
+
+// NewPosition returns a position opened at entry with the given stop.
+func NewPosition(symbol string, entry, stop, shares float64, purchased time.Time) *Position {
+	return &Position{
+		Symbol:          symbol,
+		EntryPrice:      entry,
+		StopLoss:        stop,
+		InitialStopLoss: stop,
+		InitialRisk:     entry - stop,
+		Shares:          shares,
+		InitialShares:   shares,
+		PurchaseDate:    purchased,
+		LastCheckDate:   purchased,
+		HighestPrice:    entry,
+		SessionLow:      math.MaxFloat64,
+		LastPrice:       entry,
+	}
+}
+
+// Kind classifies a Decision.
+type Kind string
+
+const (
+	KindStopMoved   Kind = "stop_moved"   // no order; StopLoss changed
+	KindPartialExit Kind = "partial_exit" // sell Shares, position stays open
+	KindExit        Kind = "exit"         // sell all remaining Shares
+)
+
+// Decision is one action the caller should carry out.  For sells, the
+// ProfitLoss/RiskReward/IsWinner fields are what trade_results.csv records.
+type Decision struct {
+	Kind   Kind
+	Time   time.Time
+	Reason string
+
+	// Stop moves
+	OldStop float64
+	NewStop float64
+
+	// Sells
+	Shares     int
+	Price      float64
+	ProfitLoss float64
+	RiskReward float64
+	IsWinner   bool
+}
+
+// Result is the outcome of one Evaluate call.
+type Result struct {
+	Price       float64 // latest close
+	SessionHigh float64
+	SessionLow  float64
+	Gain        float64 // price − entry
+	RR          float64 // gain in units of initial risk
+	Decisions   []Decision
+	Closed      bool
+}
+
+// Engine applies Rules to positions.
+type Engine struct {
+	Rules    Rules
+	Clock    Clock
+	Location *time.Location // calendar for DaysHeld; default America/New_York
+}
+
+// NewEngine returns an engine with the given rules and clock.  A nil clock
+// means the wall clock.
+func NewEngine(rules Rules, clock Clock) *Engine {
+	if clock == nil {
+		clock = WallClock{}
+	}
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		loc = time.UTC
+	}
+	return &Engine{Rules: rules, Clock: clock, Location: loc}
+}
+
+// Evaluate runs one tick for pos over every bar of the current session so
+// far.  It mutates pos and returns the resulting decisions.  Rules are checked
+// in a fixed order and a sell ends the tick, exactly as the watcher always has.
+func (e *Engine) Evaluate(pos *Position, bars []Bar) Result {
+	if len(bars) == 0 {
+		return Result{}
+	}
+	r := e.Rules
+	now := e.Clock.Now()
+	if e.Location != nil {
+		now = now.In(e.Location)
+	}
+
+	// ── Session OHLC from all bars since open ────────────────────────────
+	sessionHigh := 0.0
+	sessionLow := math.MaxFloat64
+	for _, b := range bars {
+		if b.High > sessionHigh {
+			sessionHigh = b.High
+		}
+		if b.Low < sessionLow {
+			sessionLow = b.Low
+		}
+	}
+	currentPrice := bars[len(bars)-1].Close
+
+	pos.SessionHigh = sessionHigh
+	pos.SessionLow = sessionLow
+	pos.SessionOpen = bars[0].Open
+	pos.LastPrice = currentPrice
+
+	if sessionHigh > pos.HighestPrice {
+		pos.HighestPrice = sessionHigh
+	}
+
+	// ── Increment DaysHeld once per calendar day ─────────────────────────
+	if now.Format("2006-01-02") != pos.LastCheckDate.Format("2006-01-02") {
+		pos.DaysHeld++
+		pos.LastCheckDate = now
+	}
+
+	currentGain := currentPrice - pos.EntryPrice
+	currentRR := 0.0
+	if pos.InitialRisk > 0 {
+		currentRR = currentGain / pos.InitialRisk
+	}
+
+	res := Result{
+		Price:       currentPrice,
+		SessionHigh: sessionHigh,
+		SessionLow:  sessionLow,
+		Gain:        currentGain,
+		RR:          currentRR,
+	}
+	t := &tick{pos: pos, now: now, res: &res}
+
+	// ── 1. Weak close ────────────────────────────────────────────────────
+	if sessionHigh > 0 && !pos.WeakCloseDetected {
+		closeFromHigh := (sessionHigh - currentPrice) / sessionHigh
+		if closeFromHigh >= r.WeakCloseThreshold {
+			pos.WeakCloseDetected = true
+			t.exit(currentPrice, "Weak Close")
+			return res
+		}
+	}
+
+	// ── 2. Stop loss — session low catches intraday wicks ────────────────
+	if sessionLow <= pos.StopLoss || currentPrice <= pos.StopLoss {
+		t.stopOut(pos.StopLoss)
+		return res
+	}
+
+	// ── 3. Move to breakeven ─────────────────────────────────────────────
+	if pos.DaysHeld >= r.BreakevenTriggerDays && !pos.ProfitTaken {
+		pctGain := (sessionHigh - pos.EntryPrice) / pos.EntryPrice
+		if pctGain >= r.BreakevenTriggerPercent && pos.StopLoss < pos.EntryPrice {
+			t.moveStop(pos.EntryPrice, fmt.Sprintf("Breakeven — session touched +%.1f%% on day %d",
+				pctGain*100, pos.DaysHeld))
+		}
+	}
+
+	// ── 4. Tighten stop if no follow-through after N days ────────────────
+	if pos.DaysHeld >= r.MaxDaysNoFollowThrough && currentRR < r.NoFollowThroughRR && !pos.ProfitTaken {
+		tighter := math.Max(pos.EntryPrice-(pos.InitialRisk*r.NoFollowThroughRiskCut), pos.EntryPrice)
+		if tighter > pos.StopLoss {
+			t.moveStop(tighter, fmt.Sprintf("No follow-through after %d days", r.MaxDaysNoFollowThrough))
+		}
+	}
+
+	// ── 5. Strong EP — big gain in first few days ────────────────────────
+	pctGain := (currentPrice - pos.EntryPrice) / pos.EntryPrice
+	if pos.DaysHeld <= r.StrongEPDays && pctGain >= r.StrongEPGain && !pos.ProfitTaken {
+		t.partial(currentPrice, r.StrongEPTakePercent,
+			fmt.Sprintf("Strong EP — %.0f%% sold", r.StrongEPTakePercent*100))
+		t.moveStop(math.Max(pos.EntryPrice, pos.StopLoss), "Stop moved to breakeven after Strong EP")
+		pos.ProfitTaken = true
+		pos.TrailingStopMode = true
+		res.Closed = pos.Shares <= 0
+		return res
+	}
+
+	// ── 6. Graduated profit taking ───────────────────────────────────────
+	if currentRR >= r.ProfitTake1RR && !pos.ProfitTaken {
+		t.partial(currentPrice, r.ProfitTake1Percent, fmt.Sprintf("Profit Level 1 at %.2fR", currentRR))
+		pos.TrailingStopMode = true
+		pos.ProfitTaken = true
+		if pos.DaysHeld >= r.BreakevenTriggerDays {
+			t.moveStop(math.Max(pos.StopLoss, pos.EntryPrice), "Stop locked at breakeven after Level 1 profit")
+		}
+		res.Closed = pos.Shares <= 0
+		return res
+	}
+
+	if currentRR >= r.ProfitTake2RR && pos.ProfitTaken && !pos.ProfitTaken2 {
+		t.partial(currentPrice, r.ProfitTake2Percent, fmt.Sprintf("Profit Level 2 at %.2fR", currentRR))
+		t.moveStop(math.Max(pos.StopLoss, pos.EntryPrice+pos.InitialRisk*r.ProfitTake2LockR),
+			fmt.Sprintf("Stop locked at +%.0fR after Level 2 profit", r.ProfitTake2LockR))
+		pos.ProfitTaken2 = true
+		res.Closed = pos.Shares <= 0
+		return res
+	}
+
+	if currentRR >= r.ProfitTake3RR && pos.ProfitTaken2 && !pos.ProfitTaken3 {
+		t.partial(currentPrice, r.ProfitTake3Percent, fmt.Sprintf("Profit Level 3 at %.2fR", currentRR))
+		t.moveStop(math.Max(pos.StopLoss, pos.EntryPrice+pos.InitialRisk*r.ProfitTake3LockR),
+			fmt.Sprintf("Stop locked at +%.0fR after Level 3 profit", r.ProfitTake3LockR))
+		pos.ProfitTaken3 = true
+		res.Closed = pos.Shares <= 0
+		return res
+	}
+
+	// ── 7. Trailing stop (active after first profit taken) ───────────────
+	if pos.TrailingStopMode {
+		pctFromEntry := (currentPrice - pos.EntryPrice) / pos.EntryPrice
+
+		newStop := pos.EntryPrice // floor at breakeven
+		for _, tier := range r.TrailingTiers {
+			if pctFromEntry > tier.MinGain {
+				newStop = currentPrice * tier.StopFactor
+				break
+			}
+		}
+		if newStop > pos.StopLoss {
+			t.moveStop(newStop, fmt.Sprintf("Trailing stop (%.1f%% from entry)", pctFromEntry*100))
+		}
+
+		if pctFromEntry < r.TrailingExitMaxGain && currentPrice < pos.EntryPrice*r.TrailingExitFactor {
+			t.exit(math.Max(pos.StopLoss, pos.EntryPrice), "Trailing — retreated below threshold")
+			return res
+		}
+	}
+
+	return res
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Decision helpers
+// ─────────────────────────────────────────────────────────────────────────────
+
+type tick struct {
+	pos *Position
+	now time.Time
+	res *Result
+}
+
+func (t *tick) moveStop(stop float64, reason string) {
+	if stop == t.pos.StopLoss {
+		return
+	}
+	t.res.Decisions = append(t.res.Decisions, Decision{
+		Kind:    KindStopMoved,
+		Time:    t.now,
+		Reason:  reason,
+		OldStop: t.pos.StopLoss,
+		NewStop: stop,
+	})
+	t.pos.StopLoss = stop
+}
+
+// stopOut sells all remaining shares at the stop price.
+func (t *tick) stopOut(stopPrice float64) {
+	reason := "Stop Loss Hit"
+	if t.pos.ProfitTaken {
+		reason = "Trailing Stop Hit (partial profit protected)"
+	}
+	shares := int(math.Round(t.pos.Shares))
+	if t.pos.CumulativeProfit > 0 {
+		totalPL := (stopPrice-t.pos.EntryPrice)*float64(shares) + t.pos.CumulativeProfit
+		reason = fmt.Sprintf("%s — cumulative P/L incl. partials: $%.2f", reason, totalPL)
+	}
+	t.sellAll(stopPrice, reason)
+}
+
+// exit sells all remaining shares for reason.
+func (t *tick) exit(price float64, reason string) {
+	if t.pos.CumulativeProfit != 0 {
+		shares := int(math.Round(t.pos.Shares))
+		totalPL := (price-t.pos.EntryPrice)*float64(shares) + t.pos.CumulativeProfit
+		reason = fmt.Sprintf("%s (prev. partial P/L: $%.2f, total: $%.2f)", reason, t.pos.CumulativeProfit, totalPL)
+	}
+	t.sellAll(price, reason)
+}
+
+func (t *tick) sellAll(price float64, reason string) {
+	t.res.Closed = true
+	shares := int(math.Round(t.pos.Shares))
+	if shares < 1 {
+		return
+	}
+
+	pl := (price - t.pos.EntryPrice) * float64(shares)
+	rr := 0.0
+	if t.pos.InitialRisk > 0 {
+		rr = (price - t.pos.EntryPrice) / t.pos.InitialRisk
+	}
+	t.res.Decisions = append(t.res.Decisions, Decision{
+		Kind:       KindExit,
+		Time:       t.now,
+		Reason:     reason,
+		Shares:     shares,
+		Price:      price,
+		ProfitLoss: pl,
+		RiskReward: rr,
+		IsWinner:   pl+t.pos.CumulativeProfit > 0,
+	})
+	t.pos.Shares = 0
+}
+
+// partial sells pct of the remaining shares (at least one).
+func (t *tick) partial(price, pct float64, reason string) {
+	sharesToSell := int(math.Floor(t.pos.Shares * pct))
+	if sharesToSell < 1 {
+		sharesToSell = 1
+	}
+	if sharesToSell > int(t.pos.Shares) {
+		sharesToSell = int(t.pos.Shares)
+	}
+
+	pl := (price - t.pos.EntryPrice) * float64(sharesToSell)
+	t.res.Decisions = append(t.res.Decisions, Decision{
+		Kind:       KindPartialExit,
+		Time:       t.now,
+		Reason:     reason,
+		Shares:     sharesToSell,
+		Price:      price,
+		ProfitLoss: pl,
+		RiskReward: (price - t.pos.EntryPrice) / t.pos.InitialRisk,
+		IsWinner:   true,
+	})
+
+	t.pos.CumulativeProfit += pl
+	t.pos.Shares -= float64(sharesToSell)
+}
+
+// Close sells everything left in pos at price, outside the rules — e.g. a
+// manual close or the end of a backtest.  It returns false if pos was empty.
+func Close(pos *Position, price float64, now time.Time, reason string) (Decision, bool) {
+	var res Result
+	t := &tick{pos: pos, now: now, res: &res}
+	t.exit(price, reason)
+	if len(res.Decisions) == 0 {
+		return Decision{}, false
+	}
+	return res.Decisions[0], true
+}
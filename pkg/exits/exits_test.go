@@ -0,0 +1,289 @@
+package exits
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testNow is mid-session on a Monday, New York time.
+func testNow(t *testing.T) time.Time {
+	t.Helper()
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("load location: %v", err)
+	}
+	return time.Date(2024, 3, 11, 11, 0, 0, 0, loc)
+}
+
+// testPosition is 100 shares entered at $10 with a $9 stop (R = $1), already
+// checked today so Evaluate leaves DaysHeld alone.
+func testPosition(now time.Time, daysHeld int) *Position {
+	pos := NewPosition("TEST", 10, 9, 100, now.AddDate(0, 0, -daysHeld))
+	pos.DaysHeld = daysHeld
+	pos.LastCheckDate = now
+	return pos
+}
+
+// afterProfit1 is testPosition after Level 1: 75 shares, stop at breakeven,
+// trailing.
+func afterProfit1(pos *Position) {
+	pos.Shares = 75
+	pos.StopLoss = 10
+	pos.ProfitTaken = true
+	pos.TrailingStopMode = true
+}
+
+func TestEvaluateRules(t *testing.T) {
+	// want lists the decisions in order; NewStop is checked for stop moves,
+	// Shares and Price for sells, and Reason as a prefix when set.
+	tests := []struct {
+		name       string
+		daysHeld   int
+		setup      func(*Position)
+		bar        Bar // the session so far, as one bar
+		want       []Decision
+		wantClosed bool
+		wantShares float64
+	}{
+		{
+			name:       "weak close exits 30% off the session high",
+			bar:        Bar{Open: 12, High: 14, Low: 9.5, Close: 9.7},
+			want:       []Decision{{Kind: KindExit, Shares: 100, Price: 9.7, Reason: "Weak Close"}},
+			wantClosed: true,
+		},
+		{
+			name:       "weak close only fires once",
+			setup:      func(p *Position) { p.WeakCloseDetected = true },
+			bar:        Bar{Open: 12, High: 14, Low: 9.5, Close: 9.7},
+			wantShares: 100,
+		},
+		{
+			name:       "stop hit on the session low sells at the stop",
+			bar:        Bar{Open: 10, High: 10.2, Low: 8.9, Close: 9.5},
+			want:       []Decision{{Kind: KindExit, Shares: 100, Price: 9, Reason: "Stop Loss Hit"}},
+			wantClosed: true,
+		},
+		{
+			name:     "stop hit after a partial is a trailing stop",
+			daysHeld: 5,
+			setup: func(p *Position) {
+				afterProfit1(p)
+				p.CumulativeProfit = 40
+			},
+			bar:        Bar{Open: 10.2, High: 10.3, Low: 9.9, Close: 10.1},
+			want:       []Decision{{Kind: KindExit, Shares: 75, Price: 10, Reason: "Trailing Stop Hit"}},
+			wantClosed: true,
+		},
+		{
+			name:       "breakeven once the high is 2% up from day 2",
+			daysHeld:   2,
+			bar:        Bar{Open: 10, High: 10.25, Low: 9.95, Close: 10.1},
+			want:       []Decision{{Kind: KindStopMoved, NewStop: 10, Reason: "Breakeven"}},
+			wantShares: 100,
+		},
+		{
+			name:       "no breakeven before day 2",
+			daysHeld:   1,
+			bar:        Bar{Open: 10, High: 10.25, Low: 9.95, Close: 10.1},
+			wantShares: 100,
+		},
+		{
+			name:       "no follow-through tightens the stop after 8 days",
+			daysHeld:   8,
+			bar:        Bar{Open: 10, High: 10.1, Low: 9.95, Close: 10.05},
+			want:       []Decision{{Kind: KindStopMoved, NewStop: 10, Reason: "No follow-through"}},
+			wantShares: 100,
+		},
+		{
+			name:     "strong EP sells 30% and moves the stop to breakeven",
+			daysHeld: 1,
+			bar:      Bar{Open: 10.5, High: 11.7, Low: 10.5, Close: 11.6},
+			want: []Decision{
+				{Kind: KindPartialExit, Shares: 30, Price: 11.6, Reason: "Strong EP"},
+				{Kind: KindStopMoved, NewStop: 10},
+			},
+			wantShares: 70,
+		},
+		{
+			name:     "profit level 1 at 1.5R after breakeven",
+			daysHeld: 5,
+			bar:      Bar{Open: 10.5, High: 11.7, Low: 10.5, Close: 11.6},
+			want: []Decision{
+				{Kind: KindStopMoved, NewStop: 10, Reason: "Breakeven"},
+				{Kind: KindPartialExit, Shares: 25, Price: 11.6, Reason: "Profit Level 1"},
+			},
+			wantShares: 75,
+		},
+		{
+			name:     "profit level 2 at 3R locks +1R",
+			daysHeld: 5,
+			setup:    afterProfit1,
+			bar:      Bar{Open: 13, High: 13.2, Low: 12.9, Close: 13.1},
+			want: []Decision{
+				{Kind: KindPartialExit, Shares: 18, Price: 13.1, Reason: "Profit Level 2"},
+				{Kind: KindStopMoved, NewStop: 11},
+			},
+			wantShares: 57,
+		},
+		{
+			name:     "profit level 3 at 5R locks +2R",
+			daysHeld: 5,
+			setup: func(p *Position) {
+				afterProfit1(p)
+				p.Shares = 57
+				p.StopLoss = 11
+				p.ProfitTaken2 = true
+			},
+			bar: Bar{Open: 15, High: 15.2, Low: 14.9, Close: 15.1},
+			want: []Decision{
+				{Kind: KindPartialExit, Shares: 14, Price: 15.1, Reason: "Profit Level 3"},
+				{Kind: KindStopMoved, NewStop: 12},
+			},
+			wantShares: 43,
+		},
+		{
+			name:       "trailing tier above 20% trails 6% under price",
+			daysHeld:   5,
+			setup:      afterProfit1,
+			bar:        Bar{Open: 12.4, High: 12.6, Low: 12.4, Close: 12.5},
+			want:       []Decision{{Kind: KindStopMoved, NewStop: 12.5 * 0.94, Reason: "Trailing stop"}},
+			wantShares: 75,
+		},
+		{
+			name:       "trailing tier above 10% trails 5% under price",
+			daysHeld:   5,
+			setup:      afterProfit1,
+			bar:        Bar{Open: 11.1, High: 11.3, Low: 11.1, Close: 11.2},
+			want:       []Decision{{Kind: KindStopMoved, NewStop: 11.2 * 0.95}},
+			wantShares: 75,
+		},
+		{
+			name:       "trailing tier above 5% trails 4% under price",
+			daysHeld:   5,
+			setup:      afterProfit1,
+			bar:        Bar{Open: 10.5, High: 10.7, Low: 10.5, Close: 10.6},
+			want:       []Decision{{Kind: KindStopMoved, NewStop: 10.6 * 0.96}},
+			wantShares: 75,
+		},
+		{
+			name:       "trailing below every tier floors at entry",
+			daysHeld:   5,
+			setup:      afterProfit1,
+			bar:        Bar{Open: 10.2, High: 10.4, Low: 10.2, Close: 10.3},
+			wantShares: 75,
+		},
+		{
+			name:     "trailing never lowers the stop",
+			daysHeld: 5,
+			setup: func(p *Position) {
+				afterProfit1(p)
+				p.StopLoss = 11
+			},
+			bar:        Bar{Open: 11.1, High: 11.3, Low: 11.1, Close: 11.2},
+			wantShares: 75,
+		},
+		{
+			name:     "trailing exit when price retreats under 96% of entry",
+			daysHeld: 5,
+			setup: func(p *Position) {
+				afterProfit1(p)
+				p.StopLoss = 9
+			},
+			bar: Bar{Open: 9.55, High: 9.6, Low: 9.4, Close: 9.5},
+			want: []Decision{
+				{Kind: KindStopMoved, NewStop: 10},
+				{Kind: KindExit, Shares: 75, Price: 10, Reason: "Trailing — retreated"},
+			},
+			wantClosed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := testNow(t)
+			pos := testPosition(now, tt.daysHeld)
+			if tt.setup != nil {
+				tt.setup(pos)
+			}
+			engine := NewEngine(DefaultRules(), &ManualClock{T: now})
+
+			bar := tt.bar
+			bar.Time = now
+			res := engine.Evaluate(pos, []Bar{bar})
+
+			if len(res.Decisions) != len(tt.want) {
+				t.Fatalf("decisions = %+v, want %d", res.Decisions, len(tt.want))
+			}
+			for i, want := range tt.want {
+				got := res.Decisions[i]
+				if got.Kind != want.Kind {
+					t.Errorf("decision %d kind = %s, want %s", i, got.Kind, want.Kind)
+					continue
+				}
+				if want.Reason != "" && !strings.HasPrefix(got.Reason, want.Reason) {
+					t.Errorf("decision %d reason = %q, want prefix %q", i, got.Reason, want.Reason)
+				}
+				switch got.Kind {
+				case KindStopMoved:
+					if math.Abs(got.NewStop-want.NewStop) > 1e-9 {
+						t.Errorf("decision %d new stop = %v, want %v", i, got.NewStop, want.NewStop)
+					}
+				default:
+					if got.Shares != want.Shares || math.Abs(got.Price-want.Price) > 1e-9 {
+						t.Errorf("decision %d sold %d @ %v, want %d @ %v", i, got.Shares, got.Price, want.Shares, want.Price)
+					}
+				}
+			}
+			if res.Closed != tt.wantClosed {
+				t.Errorf("closed = %v, want %v", res.Closed, tt.wantClosed)
+			}
+			if pos.Shares != tt.wantShares {
+				t.Errorf("shares left = %v, want %v", pos.Shares, tt.wantShares)
+			}
+		})
+	}
+}
+
+func TestEvaluateCountsDaysHeldOncePerDay(t *testing.T) {
+	now := testNow(t)
+	pos := NewPosition("TEST", 10, 9, 100, now.AddDate(0, 0, -1))
+	clock := &ManualClock{T: now}
+	engine := NewEngine(DefaultRules(), clock)
+	bars := []Bar{{Time: now, Open: 10, High: 10.1, Low: 9.9, Close: 10}}
+
+	engine.Evaluate(pos, bars)
+	clock.Set(now.Add(time.Hour))
+	engine.Evaluate(pos, bars)
+	if pos.DaysHeld != 1 {
+		t.Fatalf("DaysHeld after two ticks on one day = %d, want 1", pos.DaysHeld)
+	}
+
+	clock.Set(now.AddDate(0, 0, 1))
+	engine.Evaluate(pos, bars)
+	if pos.DaysHeld != 2 {
+		t.Errorf("DaysHeld on the next day = %d, want 2", pos.DaysHeld)
+	}
+}
+
+func TestClose(t *testing.T) {
+	now := testNow(t)
+	pos := testPosition(now, 3)
+	pos.Shares = 75
+	pos.CumulativeProfit = 40
+
+	d, ok := Close(pos, 11, now, "Manual close")
+	if !ok {
+		t.Fatal("Close on an open position returned false")
+	}
+	if d.Kind != KindExit || d.Shares != 75 || d.Price != 11 || d.ProfitLoss != 75 || !d.IsWinner {
+		t.Errorf("decision = %+v, want exit of 75 @ 11 for +$75", d)
+	}
+	if pos.Shares != 0 {
+		t.Errorf("shares left = %v, want 0", pos.Shares)
+	}
+	if _, ok := Close(pos, 11, now, "Manual close"); ok {
+		t.Error("Close on an empty position returned true")
+	}
+}
@@ -0,0 +1,247 @@
+package exits
+
+// Exit profiles
+//
+// A profile file names one or more Rules sets and says which one to use for
+// each scanner status.  Every profile starts from DefaultRules, so a profile
+// only needs to list the thresholds it changes:
+//
+//   default: standard
+//   by_status:
+//     confident: aggressive      # 7/7 criteria
+//     questionable: tight        # 6/7 criteria
+//   profiles:
+//     standard: {}
+//     aggressive:
+//       profit_take_1_rr: 2.0
+//     tight:
+//       breakeven_trigger_days: 1
+//
+// Files ending in .json are read as JSON, anything else as YAML.
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultProfilesPath is read when EXIT_PROFILES is not set.
+	DefaultProfilesPath = "exit_profiles.yaml"
+
+	// StandardProfile is the built-in profile holding DefaultRules.
+	StandardProfile = "standard"
+)
+
+// ProfileSet is a validated collection of named exit profiles.
+type ProfileSet struct {
+	Default  string            `json:"default" yaml:"default"`
+	ByStatus map[string]string `json:"by_status" yaml:"by_status"`
+	Profiles map[string]Rules  `json:"profiles" yaml:"profiles"`
+}
+
+// DefaultProfiles is the set used when no profile file exists: a single
+// "standard" profile with DefaultRules.
+func DefaultProfiles() *ProfileSet {
+	return &ProfileSet{
+		Default:  StandardProfile,
+		Profiles: map[string]Rules{StandardProfile: DefaultRules()},
+	}
+}
+
+// LoadProfiles reads and validates a profile file.
+func LoadProfiles(path string) (*ProfileSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exit profiles: %w", err)
+	}
+
+	// Decode each profile over DefaultRules so omitted keys keep their
+	// production values.
+	set := &ProfileSet{Profiles: make(map[string]Rules)}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		var raw struct {
+			Default  string                     `json:"default"`
+			ByStatus map[string]string          `json:"by_status"`
+			Profiles map[string]json.RawMessage `json:"profiles"`
+		}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		for name, msg := range raw.Profiles {
+			rules := DefaultRules()
+			if err := json.Unmarshal(msg, &rules); err != nil {
+				return nil, fmt.Errorf("failed to parse profile %q: %w", name, err)
+			}
+			set.Profiles[name] = rules
+		}
+		set.Default, set.ByStatus = raw.Default, raw.ByStatus
+	} else {
+		var raw struct {
+			Default  string               `yaml:"default"`
+			ByStatus map[string]string    `yaml:"by_status"`
+			Profiles map[string]yaml.Node `yaml:"profiles"`
+		}
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		for name, node := range raw.Profiles {
+			rules := DefaultRules()
+			if err := node.Decode(&rules); err != nil {
+				return nil, fmt.Errorf("failed to parse profile %q: %w", name, err)
+			}
+			set.Profiles[name] = rules
+		}
+		set.Default, set.ByStatus = raw.Default, raw.ByStatus
+	}
+
+	if set.Default == "" {
+		set.Default = StandardProfile
+	}
+	if _, ok := set.Profiles[StandardProfile]; !ok {
+		set.Profiles[StandardProfile] = DefaultRules()
+	}
+
+	if err := set.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid exit profiles in %s: %w", path, err)
+	}
+	return set, nil
+}
+
+// LoadProfilesFromEnv loads the file named by EXIT_PROFILES, falling back to
+// DefaultProfilesPath and then to DefaultProfiles if that does not exist.
+// Only a missing default file is tolerated; a named file that cannot be read
+// or fails validation is an error.
+func LoadProfilesFromEnv() (*ProfileSet, error) {
+	if path := os.Getenv("EXIT_PROFILES"); path != "" {
+		return LoadProfiles(path)
+	}
+	if _, err := os.Stat(DefaultProfilesPath); err != nil {
+		return DefaultProfiles(), nil
+	}
+	return LoadProfiles(DefaultProfilesPath)
+}
+
+// Validate checks every profile and every reference to one.
+func (s *ProfileSet) Validate() error {
+	var problems []string
+	if _, ok := s.Profiles[s.Default]; !ok {
+		problems = append(problems, fmt.Sprintf("default profile %q is not defined", s.Default))
+	}
+	for status, name := range s.ByStatus {
+		if _, ok := s.Profiles[name]; !ok {
+			problems = append(problems, fmt.Sprintf("status %q maps to undefined profile %q", status, name))
+		}
+	}
+	for _, name := range s.Names() {
+		rules := s.Profiles[name]
+		if err := rules.Validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("profile %q: %v", name, err))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Names returns the profile names in sorted order.
+func (s *ProfileSet) Names() []string {
+	names := make([]string, 0, len(s.Profiles))
+	for name := range s.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Rules returns the named profile, or an error if it does not exist.  An
+// empty name means the default profile.
+func (s *ProfileSet) Rules(name string) (Rules, error) {
+	if name == "" {
+		name = s.Default
+	}
+	rules, ok := s.Profiles[name]
+	if !ok {
+		return Rules{}, fmt.Errorf("unknown exit profile %q", name)
+	}
+	return rules, nil
+}
+
+// NameForStatus returns the profile name for a scanner status ("confident",
+// "questionable"), or the default profile if the status is not mapped.
+func (s *ProfileSet) NameForStatus(status string) string {
+	if name, ok := s.ByStatus[strings.ToLower(strings.TrimSpace(status))]; ok {
+		return name
+	}
+	return s.Default
+}
+
+// Validate reports every out-of-range threshold.
+func (r Rules) Validate() error {
+	var problems []string
+	fraction := func(name string, v float64) {
+		if v <= 0 || v > 1 {
+			problems = append(problems, fmt.Sprintf("%s must be in (0, 1], got %v", name, v))
+		}
+	}
+	positive := func(name string, v float64) {
+		if v <= 0 {
+			problems = append(problems, fmt.Sprintf("%s must be positive, got %v", name, v))
+		}
+	}
+	nonNegative := func(name string, v int) {
+		if v < 0 {
+			problems = append(problems, fmt.Sprintf("%s must not be negative, got %d", name, v))
+		}
+	}
+
+	fraction("weak_close_threshold", r.WeakCloseThreshold)
+	positive("breakeven_trigger_percent", r.BreakevenTriggerPercent)
+	nonNegative("breakeven_trigger_days", r.BreakevenTriggerDays)
+	nonNegative("max_days_no_follow_through", r.MaxDaysNoFollowThrough)
+	positive("no_follow_through_rr", r.NoFollowThroughRR)
+	if r.NoFollowThroughRiskCut < 0 || r.NoFollowThroughRiskCut > 1 {
+		problems = append(problems, fmt.Sprintf("no_follow_through_risk_cut must be in [0, 1], got %v", r.NoFollowThroughRiskCut))
+	}
+	positive("strong_ep_gain", r.StrongEPGain)
+	nonNegative("strong_ep_days", r.StrongEPDays)
+	fraction("strong_ep_take_percent", r.StrongEPTakePercent)
+
+	positive("profit_take_1_rr", r.ProfitTake1RR)
+	fraction("profit_take_1_percent", r.ProfitTake1Percent)
+	fraction("profit_take_2_percent", r.ProfitTake2Percent)
+	fraction("profit_take_3_percent", r.ProfitTake3Percent)
+	if !(r.ProfitTake1RR < r.ProfitTake2RR && r.ProfitTake2RR < r.ProfitTake3RR) {
+		problems = append(problems, fmt.Sprintf("profit take levels must be increasing, got %vR / %vR / %vR",
+			r.ProfitTake1RR, r.ProfitTake2RR, r.ProfitTake3RR))
+	}
+	if r.ProfitTake2LockR < 0 || r.ProfitTake3LockR < r.ProfitTake2LockR {
+		problems = append(problems, fmt.Sprintf("profit lock levels must be non-negative and non-decreasing, got +%vR / +%vR",
+			r.ProfitTake2LockR, r.ProfitTake3LockR))
+	}
+
+	for i, tier := range r.TrailingTiers {
+		positive(fmt.Sprintf("trailing_tiers[%d].min_gain", i), tier.MinGain)
+		if tier.StopFactor <= 0 || tier.StopFactor >= 1 {
+			problems = append(problems, fmt.Sprintf("trailing_tiers[%d].stop_factor must be in (0, 1), got %v", i, tier.StopFactor))
+		}
+		if i > 0 && tier.MinGain >= r.TrailingTiers[i-1].MinGain {
+			problems = append(problems, "trailing_tiers must be ordered from the largest min_gain down")
+		}
+	}
+	if r.TrailingExitMaxGain < 0 {
+		problems = append(problems, fmt.Sprintf("trailing_exit_max_gain must not be negative, got %v", r.TrailingExitMaxGain))
+	}
+	fraction("trailing_exit_factor", r.TrailingExitFactor)
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package exits
+
+// Rules holds every threshold the exit engine uses.  DefaultRules returns the
+// values the live watcher has always traded with.
+type Rules struct {
+	// Weak close: exit when price is this far below the session high.
+	WeakCloseThreshold float64 `json:"weak_close_threshold" yaml:"weak_close_threshold"`
+
+	// Move the stop to breakeven once the session high is this far above
+	// entry, from this many days held onward.
+	BreakevenTriggerPercent float64 `json:"breakeven_trigger_percent" yaml:"breakeven_trigger_percent"`
+	BreakevenTriggerDays    int     `json:"breakeven_trigger_days" yaml:"breakeven_trigger_days"`
+
+	// Tighten the stop after this many days if the trade is still below
+	// NoFollowThroughRR and no profit has been taken.
+	MaxDaysNoFollowThrough int     `json:"max_days_no_follow_through" yaml:"max_days_no_follow_through"`
+	NoFollowThroughRR      float64 `json:"no_follow_through_rr" yaml:"no_follow_through_rr"`
+	NoFollowThroughRiskCut float64 `json:"no_follow_through_risk_cut" yaml:"no_follow_through_risk_cut"` // stop = max(entry − cut×R, entry)
+
+	// Strong EP: sell a slice on a big early gain.
+	StrongEPGain        float64 `json:"strong_ep_gain" yaml:"strong_ep_gain"`
+	StrongEPDays        int     `json:"strong_ep_days" yaml:"strong_ep_days"`
+	StrongEPTakePercent float64 `json:"strong_ep_take_percent" yaml:"strong_ep_take_percent"`
+
+	// Graduated profit taking.  Levels 2 and 3 lock the stop at entry + N×R.
+	ProfitTake1RR      float64 `json:"profit_take_1_rr" yaml:"profit_take_1_rr"`
+	ProfitTake1Percent float64 `json:"profit_take_1_percent" yaml:"profit_take_1_percent"`
+	ProfitTake2RR      float64 `json:"profit_take_2_rr" yaml:"profit_take_2_rr"`
+	ProfitTake2Percent float64 `json:"profit_take_2_percent" yaml:"profit_take_2_percent"`
+	ProfitTake2LockR   float64 `json:"profit_take_2_lock_r" yaml:"profit_take_2_lock_r"`
+	ProfitTake3RR      float64 `json:"profit_take_3_rr" yaml:"profit_take_3_rr"`
+	ProfitTake3Percent float64 `json:"profit_take_3_percent" yaml:"profit_take_3_percent"`
+	ProfitTake3LockR   float64 `json:"profit_take_3_lock_r" yaml:"profit_take_3_lock_r"`
+
+	// Trailing stop tiers, checked in order; the first tier whose MinGain is
+	// exceeded sets stop = price × StopFactor.  Below every tier the stop
+	// floors at entry.
+	TrailingTiers []TrailingTier `json:"trailing_tiers" yaml:"trailing_tiers"`
+
+	// While trailing, exit if gain is under TrailingExitMaxGain and price has
+	// fallen below entry × TrailingExitFactor.
+	TrailingExitMaxGain float64 `json:"trailing_exit_max_gain" yaml:"trailing_exit_max_gain"`
+	TrailingExitFactor  float64 `json:"trailing_exit_factor" yaml:"trailing_exit_factor"`
+}
+
+// TrailingTier is one band of the trailing stop.
+type TrailingTier struct {
+	MinGain    float64 `json:"min_gain" yaml:"min_gain"`
+	StopFactor float64 `json:"stop_factor" yaml:"stop_factor"`
+}
+
+// DefaultRules returns the production exit rules.
+func DefaultRules() Rules {
+	return Rules{
+		WeakCloseThreshold: 0.30,
+
+		BreakevenTriggerPercent: 0.02,
+		BreakevenTriggerDays:    2,
+
+		MaxDaysNoFollowThrough: 8,
+		NoFollowThroughRR:      0.5,
+		NoFollowThroughRiskCut: 0.3,
+
+		StrongEPGain:        0.15,
+		StrongEPDays:        3,
+		StrongEPTakePercent: 0.30,
+
+		ProfitTake1RR:      1.5,
+		ProfitTake1Percent: 0.25,
+		ProfitTake2RR:      3.0,
+		ProfitTake2Percent: 0.25,
+		ProfitTake2LockR:   1.0,
+		ProfitTake3RR:      5.0,
+		ProfitTake3Percent: 0.25,
+		ProfitTake3LockR:   2.0,
+
+		TrailingTiers: []TrailingTier{
+			{MinGain: 0.20, StopFactor: 0.94}, // wide trail — give big runners room
+			{MinGain: 0.10, StopFactor: 0.95},
+			{MinGain: 0.05, StopFactor: 0.96},
+		},
+
+		TrailingExitMaxGain: 0.05,
+		TrailingExitFactor:  0.96,
+	}
+}
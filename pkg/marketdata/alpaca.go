@@ -0,0 +1,281 @@
+package marketdata
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	AlpacaDataURL    = "https://data.alpaca.markets"
+	AlpacaTradingURL = "https://paper-api.alpaca.markets"
+
+	// alpacaSnapshotBatch is the max number of symbols per snapshots call.
+	alpacaSnapshotBatch = 200
+)
+
+// AlpacaProvider talks to the Alpaca v2 REST data API.
+type AlpacaProvider struct {
+	APIKey     string
+	APISecret  string
+	DataURL    string
+	TradingURL string
+	Feed       string
+	HTTPClient *http.Client
+}
+
+// NewAlpacaProvider returns a provider on the SIP feed with default URLs.
+func NewAlpacaProvider(apiKey, apiSecret string) *AlpacaProvider {
+	return &AlpacaProvider{
+		APIKey:     apiKey,
+		APISecret:  apiSecret,
+		DataURL:    AlpacaDataURL,
+		TradingURL: AlpacaTradingURL,
+		Feed:       "sip",
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (a *AlpacaProvider) Name() string { return ProviderAlpaca }
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Bars
+// ─────────────────────────────────────────────────────────────────────────────
+
+type alpacaBar struct {
+	T  string  `json:"t"`
+	O  float64 `json:"o"`
+	H  float64 `json:"h"`
+	L  float64 `json:"l"`
+	C  float64 `json:"c"`
+	V  float64 `json:"v"`
+	N  int     `json:"n"`
+	VW float64 `json:"vw"`
+}
+
+func (b alpacaBar) toBar() (Bar, error) {
+	t, err := time.Parse(time.RFC3339, b.T)
+	if err != nil {
+		return Bar{}, err
+	}
+	return Bar{Time: t, Open: b.O, High: b.H, Low: b.L, Close: b.C, Volume: b.V, VWAP: b.VW, TradeCount: b.N}, nil
+}
+
+type alpacaBarsResponse struct {
+	Bars          []alpacaBar `json:"bars"`
+	Symbol        string      `json:"symbol"`
+	NextPageToken *string     `json:"next_page_token"`
+}
+
+// DailyBars fetches 1Day bars between two calendar dates (inclusive).
+func (a *AlpacaProvider) DailyBars(symbol string, start, end time.Time, adj Adjustment) ([]Bar, error) {
+	return a.bars(symbol, "1Day", start.Format("2006-01-02"), end.Format("2006-01-02"), adj)
+}
+
+// MinuteBars fetches 1Min bars between two instants.
+func (a *AlpacaProvider) MinuteBars(symbol string, start, end time.Time, adj Adjustment) ([]Bar, error) {
+	return a.bars(symbol, "1Min", start.UTC().Format(time.RFC3339), end.UTC().Format(time.RFC3339), adj)
+}
+
+// bars follows next_page_token until the range is exhausted.
+func (a *AlpacaProvider) bars(symbol, timeframe, start, end string, adj Adjustment) ([]Bar, error) {
+	if adj == "" {
+		adj = AdjustmentRaw
+	}
+
+	var all []Bar
+	var pageToken *string
+
+	for {
+		q := url.Values{}
+		q.Set("timeframe", timeframe)
+		q.Set("start", start)
+		q.Set("end", end)
+		q.Set("limit", "10000")
+		q.Set("adjustment", string(adj))
+		q.Set("feed", a.Feed)
+		if pageToken != nil {
+			q.Set("page_token", *pageToken)
+		}
+		endpoint := fmt.Sprintf("%s/v2/stocks/%s/bars?%s", a.DataURL, url.PathEscape(symbol), q.Encode())
+
+		body, err := a.get(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch %s bars for %s: %w", timeframe, symbol, err)
+		}
+
+		var resp alpacaBarsResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, fmt.Errorf("failed to parse %s bars for %s: %w", timeframe, symbol, err)
+		}
+
+		for _, b := range resp.Bars {
+			bar, err := b.toBar()
+			if err != nil {
+				continue
+			}
+			all = append(all, bar)
+		}
+
+		if resp.NextPageToken == nil || *resp.NextPageToken == "" {
+			break
+		}
+		pageToken = resp.NextPageToken
+	}
+
+	sortBars(all)
+	return all, nil
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Trades & snapshots
+// ─────────────────────────────────────────────────────────────────────────────
+
+type alpacaTrade struct {
+	T string  `json:"t"`
+	P float64 `json:"p"`
+	S float64 `json:"s"`
+}
+
+func (t alpacaTrade) toTrade(symbol string) *Trade {
+	ts, _ := time.Parse(time.RFC3339Nano, t.T)
+	return &Trade{Symbol: symbol, Price: t.P, Size: t.S, Time: ts}
+}
+
+// LatestTrade returns the most recent trade for a symbol.
+func (a *AlpacaProvider) LatestTrade(symbol string) (*Trade, error) {
+	endpoint := fmt.Sprintf("%s/v2/stocks/%s/trades/latest?feed=%s", a.DataURL, url.PathEscape(symbol), a.Feed)
+	body, err := a.get(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest trade for %s: %w", symbol, err)
+	}
+
+	var resp struct {
+		Symbol string      `json:"symbol"`
+		Trade  alpacaTrade `json:"trade"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse latest trade for %s: %w", symbol, err)
+	}
+	if resp.Trade.P <= 0 {
+		return nil, fmt.Errorf("no latest trade for %s", symbol)
+	}
+	return resp.Trade.toTrade(symbol), nil
+}
+
+type alpacaSnapshot struct {
+	LatestTrade  *alpacaTrade `json:"latestTrade"`
+	MinuteBar    *alpacaBar   `json:"minuteBar"`
+	DailyBar     *alpacaBar   `json:"dailyBar"`
+	PrevDailyBar *alpacaBar   `json:"prevDailyBar"`
+}
+
+// Snapshots fetches snapshots in batches.  Symbols Alpaca has no data for are
+// omitted from the result rather than reported as errors.
+func (a *AlpacaProvider) Snapshots(symbols []string) (map[string]*Snapshot, error) {
+	out := make(map[string]*Snapshot, len(symbols))
+
+	for _, batch := range chunk(symbols, alpacaSnapshotBatch) {
+		endpoint := fmt.Sprintf("%s/v2/stocks/snapshots?symbols=%s&feed=%s",
+			a.DataURL, url.QueryEscape(strings.Join(batch, ",")), a.Feed)
+		body, err := a.get(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get snapshots: %w", err)
+		}
+
+		var resp map[string]*alpacaSnapshot
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, fmt.Errorf("failed to parse snapshots: %w", err)
+		}
+
+		for sym, s := range resp {
+			if s == nil {
+				continue
+			}
+			snap := &Snapshot{Symbol: sym}
+			if s.LatestTrade != nil {
+				snap.LatestTrade = s.LatestTrade.toTrade(sym)
+			}
+			snap.MinuteBar = optionalBar(s.MinuteBar)
+			snap.DailyBar = optionalBar(s.DailyBar)
+			snap.PrevDailyBar = optionalBar(s.PrevDailyBar)
+			out[sym] = snap
+		}
+	}
+	return out, nil
+}
+
+func optionalBar(b *alpacaBar) *Bar {
+	if b == nil {
+		return nil
+	}
+	bar, err := b.toBar()
+	if err != nil {
+		return nil
+	}
+	return &bar
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Assets
+// ─────────────────────────────────────────────────────────────────────────────
+
+// TradableAssets returns active, tradable US equities listed on NASDAQ or NYSE.
+func (a *AlpacaProvider) TradableAssets() ([]Asset, error) {
+	endpoint := fmt.Sprintf("%s/v2/assets?status=active&asset_class=us_equity", a.TradingURL)
+	body, err := a.get(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get assets: %w", err)
+	}
+
+	var raw []struct {
+		Symbol   string `json:"symbol"`
+		Name     string `json:"name"`
+		Exchange string `json:"exchange"`
+		Tradable bool   `json:"tradable"`
+		Status   string `json:"status"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse assets: %w", err)
+	}
+
+	var assets []Asset
+	for _, r := range raw {
+		if r.Tradable && r.Status == "active" && (r.Exchange == "NASDAQ" || r.Exchange == "NYSE") {
+			assets = append(assets, Asset{Symbol: r.Symbol, Name: r.Name, Exchange: r.Exchange, Tradable: true})
+		}
+	}
+	return assets, nil
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// HTTP
+// ─────────────────────────────────────────────────────────────────────────────
+
+func (a *AlpacaProvider) get(endpoint string) ([]byte, error) {
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("APCA-API-KEY-ID", a.APIKey)
+	req.Header.Set("APCA-API-SECRET-KEY", a.APISecret)
+
+	resp, err := a.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Alpaca API error %d: %s", resp.StatusCode, string(body))
+	}
+	return body, nil
+}
@@ -0,0 +1,330 @@
+package marketdata
+
+// On-disk bar cache
+//
+// Backtests and simulations re-request the same year of daily bars for the
+// same symbols on every run.  CachedProvider wraps any Provider and keeps one
+// gzip-compressed JSON file per symbol, keyed by provider, timeframe and
+// adjustment:
+//
+//   <dir>/<provider>/<timeframe>/<adjustment>/<SYMBOL>.json.gz
+//
+// Each file records which time ranges have already been fetched.  A request
+// only hits the network for the sub-ranges that are not yet covered, and the
+// newly fetched bars are merged back into the file.
+//
+// Bars from the current (New York) trading day are never recorded as covered
+// because they are still changing; they are always fetched live.
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultCacheDir is used when BAR_CACHE_DIR is not set.
+	DefaultCacheDir = "data/cache/bars"
+
+	// DefaultAdjustedMaxAge bounds how long split/dividend-adjusted files are
+	// trusted.  A new corporate action rewrites every historical adjusted bar,
+	// so adjusted caches are rebuilt periodically.  Raw bars never expire.
+	DefaultAdjustedMaxAge = 7 * 24 * time.Hour
+
+	timeframeDay    = "1Day"
+	timeframeMinute = "1Min"
+)
+
+// CacheDirFromEnv returns BAR_CACHE_DIR, or DefaultCacheDir when unset.
+func CacheDirFromEnv() string {
+	if dir := os.Getenv("BAR_CACHE_DIR"); dir != "" {
+		return dir
+	}
+	return DefaultCacheDir
+}
+
+// CachedProvider decorates a Provider with the on-disk bar cache.  Only
+// DailyBars and MinuteBars are cached; every other call passes through.
+type CachedProvider struct {
+	Provider
+	Dir    string
+	MaxAge time.Duration // applies to adjusted bars only; 0 disables expiry
+}
+
+// NewCachedProvider wraps p with a bar cache rooted at dir.
+func NewCachedProvider(p Provider, dir string) *CachedProvider {
+	if dir == "" {
+		dir = DefaultCacheDir
+	}
+	return &CachedProvider{Provider: p, Dir: dir, MaxAge: DefaultAdjustedMaxAge}
+}
+
+// DailyBars serves daily bars from the cache, fetching only uncovered dates.
+func (c *CachedProvider) DailyBars(symbol string, start, end time.Time, adj Adjustment) ([]Bar, error) {
+	from := dateUTC(start)
+	to := dateUTC(end).AddDate(0, 0, 1) // end date is inclusive
+	fetch := func(s, e time.Time) ([]Bar, error) {
+		return c.Provider.DailyBars(symbol, s, e.AddDate(0, 0, -1), adj)
+	}
+	return c.cached(symbol, timeframeDay, adj, from, to, dateUTC(nowNY()), fetch)
+}
+
+// MinuteBars serves minute bars from the cache, fetching only uncovered spans.
+func (c *CachedProvider) MinuteBars(symbol string, start, end time.Time, adj Adjustment) ([]Bar, error) {
+	fetch := func(s, e time.Time) ([]Bar, error) {
+		return c.Provider.MinuteBars(symbol, s, e, adj)
+	}
+	today := nowNY()
+	horizon := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, today.Location()).UTC()
+	return c.cached(symbol, timeframeMinute, adj, start.UTC(), end.UTC(), horizon, fetch)
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Cache file
+// ─────────────────────────────────────────────────────────────────────────────
+
+type cacheRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"` // exclusive
+}
+
+type cacheFile struct {
+	Provider   string       `json:"provider"`
+	Symbol     string       `json:"symbol"`
+	Timeframe  string       `json:"timeframe"`
+	Adjustment Adjustment   `json:"adjustment"`
+	CreatedAt  time.Time    `json:"created_at"`
+	Coverage   []cacheRange `json:"coverage"`
+	Bars       []Bar        `json:"bars"`
+}
+
+// cacheLocks serialises access to each cache file across goroutines and
+// across CachedProvider instances pointing at the same directory.
+var cacheLocks sync.Map // path → *sync.Mutex
+
+func lockPath(path string) func() {
+	m, _ := cacheLocks.LoadOrStore(path, &sync.Mutex{})
+	mu := m.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+func (c *CachedProvider) path(symbol, timeframe string, adj Adjustment) string {
+	if adj == "" {
+		adj = AdjustmentRaw
+	}
+	return filepath.Join(c.Dir, c.Provider.Name(), timeframe, string(adj),
+		strings.ToUpper(symbol)+".json.gz")
+}
+
+// cached returns bars in [from, to), filling any gaps in the cache file via
+// fetch(gapFrom, gapTo).  Nothing at or after horizon is marked as covered.
+func (c *CachedProvider) cached(symbol, timeframe string, adj Adjustment, from, to, horizon time.Time,
+	fetch func(from, to time.Time) ([]Bar, error)) ([]Bar, error) {
+
+	if !from.Before(to) {
+		return nil, nil
+	}
+
+	path := c.path(symbol, timeframe, adj)
+	unlock := lockPath(path)
+	defer unlock()
+
+	cf, err := readCacheFile(path)
+	if err != nil || c.expired(cf, adj) {
+		cf = &cacheFile{
+			Provider:   c.Provider.Name(),
+			Symbol:     strings.ToUpper(symbol),
+			Timeframe:  timeframe,
+			Adjustment: adj,
+			CreatedAt:  time.Now().UTC(),
+		}
+	}
+
+	var live []Bar
+	dirty := false
+
+	for _, gap := range missingRanges(cf.Coverage, from, to) {
+		bars, err := fetch(gap.From, gap.To)
+		if err != nil {
+			return nil, err
+		}
+
+		// Only the part of the gap before the horizon is final.
+		covered := cacheRange{From: gap.From, To: gap.To}
+		if covered.To.After(horizon) {
+			covered.To = horizon
+		}
+		for _, b := range bars {
+			if b.Time.Before(covered.To) {
+				cf.Bars = append(cf.Bars, b)
+			} else {
+				live = append(live, b)
+			}
+		}
+		if covered.From.Before(covered.To) {
+			cf.Coverage = append(cf.Coverage, covered)
+			dirty = true
+		}
+	}
+
+	if dirty {
+		cf.Bars = dedupeBars(cf.Bars)
+		cf.Coverage = mergeRanges(cf.Coverage)
+		if err := writeCacheFile(path, cf); err != nil {
+			// A failed write only costs a refetch next time.
+			fmt.Printf("⚠️  bar cache: could not write %s: %v\n", path, err)
+		}
+	}
+
+	var out []Bar
+	for _, b := range cf.Bars {
+		if !b.Time.Before(from) && b.Time.Before(to) {
+			out = append(out, b)
+		}
+	}
+	for _, b := range live {
+		if !b.Time.Before(from) && b.Time.Before(to) {
+			out = append(out, b)
+		}
+	}
+	return dedupeBars(out), nil
+}
+
+func (c *CachedProvider) expired(cf *cacheFile, adj Adjustment) bool {
+	if adj == AdjustmentRaw || adj == "" || c.MaxAge <= 0 {
+		return false
+	}
+	return time.Since(cf.CreatedAt) > c.MaxAge
+}
+
+func readCacheFile(path string) (*cacheFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var cf cacheFile
+	if err := json.NewDecoder(zr).Decode(&cf); err != nil {
+		return nil, err
+	}
+	return &cf, nil
+}
+
+// writeCacheFile writes atomically via a temp file so a crash mid-write
+// never leaves a truncated archive behind.
+func writeCacheFile(path string, cf *cacheFile) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".bars-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	zw := gzip.NewWriter(tmp)
+	if err := json.NewEncoder(zw).Encode(cf); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Range helpers
+// ─────────────────────────────────────────────────────────────────────────────
+
+// nowNY is the current time on the New York trading calendar.
+func nowNY() time.Time {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		loc = time.UTC
+	}
+	return time.Now().In(loc)
+}
+
+func dateUTC(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// missingRanges returns the parts of [from, to) not covered by coverage.
+// coverage must already be merged and sorted.
+func missingRanges(coverage []cacheRange, from, to time.Time) []cacheRange {
+	var gaps []cacheRange
+	cursor := from
+	for _, r := range coverage {
+		if !r.To.After(cursor) {
+			continue
+		}
+		if !r.From.Before(to) {
+			break
+		}
+		if r.From.After(cursor) {
+			gaps = append(gaps, cacheRange{From: cursor, To: r.From})
+		}
+		cursor = r.To
+		if !cursor.Before(to) {
+			return gaps
+		}
+	}
+	if cursor.Before(to) {
+		gaps = append(gaps, cacheRange{From: cursor, To: to})
+	}
+	return gaps
+}
+
+// mergeRanges sorts ranges and joins overlapping or touching ones.
+func mergeRanges(ranges []cacheRange) []cacheRange {
+	if len(ranges) == 0 {
+		return ranges
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].From.Before(ranges[j].From) })
+
+	merged := []cacheRange{ranges[0]}
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if !r.From.After(last.To) {
+			if r.To.After(last.To) {
+				last.To = r.To
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// dedupeBars sorts bars and keeps the last copy of each timestamp.
+func dedupeBars(bars []Bar) []Bar {
+	sort.SliceStable(bars, func(i, j int) bool { return bars[i].Time.Before(bars[j].Time) })
+	out := bars[:0]
+	for _, b := range bars {
+		if n := len(out); n > 0 && out[n-1].Time.Equal(b.Time) {
+			out[n-1] = b
+			continue
+		}
+		out = append(out, b)
+	}
+	return out
+}
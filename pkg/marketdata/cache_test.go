@@ -0,0 +1,92 @@
+package marketdata
+
+import (
+	"testing"
+	"time"
+)
+
+// day is midnight UTC on the nth of January 2024.
+func day(n int) time.Time {
+	return time.Date(2024, 1, n, 0, 0, 0, 0, time.UTC)
+}
+
+func span(from, to int) cacheRange {
+	return cacheRange{From: day(from), To: day(to)}
+}
+
+func equalRanges(a, b []cacheRange) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].From.Equal(b[i].From) || !a[i].To.Equal(b[i].To) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMergeRanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		ranges []cacheRange
+		want   []cacheRange
+	}{
+		{name: "empty", ranges: nil, want: nil},
+		{name: "one", ranges: []cacheRange{span(1, 3)}, want: []cacheRange{span(1, 3)}},
+		{name: "unsorted and apart", ranges: []cacheRange{span(5, 6), span(1, 3)}, want: []cacheRange{span(1, 3), span(5, 6)}},
+		{name: "touching", ranges: []cacheRange{span(1, 3), span(3, 5)}, want: []cacheRange{span(1, 5)}},
+		{name: "overlapping", ranges: []cacheRange{span(2, 6), span(1, 4)}, want: []cacheRange{span(1, 6)}},
+		{name: "contained", ranges: []cacheRange{span(1, 10), span(3, 4), span(12, 13)}, want: []cacheRange{span(1, 10), span(12, 13)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeRanges(tt.ranges); !equalRanges(got, tt.want) {
+				t.Errorf("mergeRanges = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissingRanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		coverage []cacheRange
+		from, to int
+		want     []cacheRange
+	}{
+		{name: "nothing cached", from: 1, to: 5, want: []cacheRange{span(1, 5)}},
+		{name: "fully covered", coverage: []cacheRange{span(1, 10)}, from: 2, to: 5, want: nil},
+		{name: "exactly covered", coverage: []cacheRange{span(2, 5)}, from: 2, to: 5, want: nil},
+		{name: "head missing", coverage: []cacheRange{span(3, 10)}, from: 1, to: 5, want: []cacheRange{span(1, 3)}},
+		{name: "tail missing", coverage: []cacheRange{span(1, 3)}, from: 2, to: 6, want: []cacheRange{span(3, 6)}},
+		{
+			name:     "hole between ranges",
+			coverage: []cacheRange{span(1, 3), span(5, 8)},
+			from:     2, to: 7,
+			want: []cacheRange{span(3, 5)},
+		},
+		{
+			name:     "ranges outside the window",
+			coverage: []cacheRange{span(1, 2), span(10, 12)},
+			from:     3, to: 6,
+			want: []cacheRange{span(3, 6)},
+		},
+		{
+			name:     "gaps on every side",
+			coverage: []cacheRange{span(3, 4), span(6, 7)},
+			from:     1, to: 9,
+			want: []cacheRange{span(1, 3), span(4, 6), span(7, 9)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := missingRanges(tt.coverage, day(tt.from), day(tt.to))
+			if !equalRanges(got, tt.want) {
+				t.Errorf("missingRanges = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
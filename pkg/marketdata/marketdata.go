@@ -0,0 +1,151 @@
+package marketdata
+
+// Market-data provider abstraction
+//
+// Every scanner in the repo (EP, HTF, superperformance, biggest movers) needs
+// the same handful of things from a data vendor: daily bars, minute bars, the
+// latest trade, a snapshot, and the list of tradable symbols.  Provider is
+// that contract.  Vendors are selected by name so switching from Alpaca to
+// Marketstack (or adding a new vendor) is a config change rather than another
+// copy of an HTTP fetcher.
+//
+// Usage:
+//   p, err := marketdata.NewProviderFromEnv()        // MARKET_DATA_PROVIDER=alpaca|marketstack
+//   bars, err := p.DailyBars("AAPL", start, end, marketdata.AdjustmentAll)
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Common types
+// ─────────────────────────────────────────────────────────────────────────────
+
+// Adjustment controls how corporate actions are applied to historical bars.
+type Adjustment string
+
+const (
+	AdjustmentRaw   Adjustment = "raw"
+	AdjustmentSplit Adjustment = "split"
+	AdjustmentAll   Adjustment = "all"
+)
+
+// Bar is a single OHLCV bar.  Time is the bar's open timestamp as reported
+// by the vendor (midnight ET for daily bars, the minute start for 1Min bars).
+type Bar struct {
+	Time       time.Time `json:"t"`
+	Open       float64   `json:"o"`
+	High       float64   `json:"h"`
+	Low        float64   `json:"l"`
+	Close      float64   `json:"c"`
+	Volume     float64   `json:"v"`
+	VWAP       float64   `json:"vw,omitempty"`
+	TradeCount int       `json:"n,omitempty"`
+}
+
+// Trade is the most recent print for a symbol.
+type Trade struct {
+	Symbol string    `json:"symbol"`
+	Price  float64   `json:"price"`
+	Size   float64   `json:"size"`
+	Time   time.Time `json:"time"`
+}
+
+// Snapshot bundles the latest trade with the current and previous daily bars.
+// Any field may be nil when the vendor does not supply it.
+type Snapshot struct {
+	Symbol       string `json:"symbol"`
+	LatestTrade  *Trade `json:"latest_trade,omitempty"`
+	MinuteBar    *Bar   `json:"minute_bar,omitempty"`
+	DailyBar     *Bar   `json:"daily_bar,omitempty"`
+	PrevDailyBar *Bar   `json:"prev_daily_bar,omitempty"`
+}
+
+// Asset describes a listed, tradable instrument.
+type Asset struct {
+	Symbol   string `json:"symbol"`
+	Name     string `json:"name"`
+	Exchange string `json:"exchange"`
+	Tradable bool   `json:"tradable"`
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Provider interface
+// ─────────────────────────────────────────────────────────────────────────────
+
+// Provider is implemented by every market-data vendor.
+//
+// DailyBars treats start and end as calendar dates (inclusive); only the
+// year/month/day of each is used.  MinuteBars uses the exact instants.
+// All bar slices are returned sorted oldest-to-newest.
+type Provider interface {
+	Name() string
+	DailyBars(symbol string, start, end time.Time, adj Adjustment) ([]Bar, error)
+	MinuteBars(symbol string, start, end time.Time, adj Adjustment) ([]Bar, error)
+	LatestTrade(symbol string) (*Trade, error)
+	Snapshots(symbols []string) (map[string]*Snapshot, error)
+	TradableAssets() ([]Asset, error)
+}
+
+// Provider names accepted by NewProvider.
+const (
+	ProviderAlpaca      = "alpaca"
+	ProviderMarketstack = "marketstack"
+)
+
+// NewProvider builds the named provider using credentials from the
+// environment.  An empty name selects Alpaca.
+func NewProvider(name string) (Provider, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", ProviderAlpaca:
+		key := os.Getenv("ALPACA_API_KEY")
+		secret := os.Getenv("ALPACA_SECRET_KEY")
+		if key == "" || secret == "" {
+			return nil, fmt.Errorf("ALPACA_API_KEY / ALPACA_SECRET_KEY must be set for the alpaca provider")
+		}
+		return NewAlpacaProvider(key, secret), nil
+	case ProviderMarketstack:
+		token := os.Getenv("MARKETSTACK_TOKEN")
+		if token == "" {
+			token = os.Getenv("MARKETSTACK_API_KEY")
+		}
+		if token == "" {
+			return nil, fmt.Errorf("MARKETSTACK_TOKEN must be set for the marketstack provider")
+		}
+		return NewMarketstackProvider(token), nil
+	default:
+		return nil, fmt.Errorf("unknown market data provider %q", name)
+	}
+}
+
+// NewProviderFromEnv selects the provider named by MARKET_DATA_PROVIDER.
+func NewProviderFromEnv() (Provider, error) {
+	return NewProvider(os.Getenv("MARKET_DATA_PROVIDER"))
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Helpers
+// ─────────────────────────────────────────────────────────────────────────────
+
+func sortBars(bars []Bar) {
+	sort.Slice(bars, func(i, j int) bool {
+		return bars[i].Time.Before(bars[j].Time)
+	})
+}
+
+// chunk splits symbols into batches of at most n.
+func chunk(symbols []string, n int) [][]string {
+	var out [][]string
+	for len(symbols) > n {
+		out = append(out, symbols[:n])
+		symbols = symbols[n:]
+	}
+	if len(symbols) > 0 {
+		out = append(out, symbols)
+	}
+	return out
+}
@@ -0,0 +1,281 @@
+package marketdata
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	MarketstackURL = "https://api.marketstack.com/v2"
+
+	marketstackPageLimit   = 1000
+	marketstackMaxRetries  = 3
+	marketstackRetryDelay  = 5 * time.Second        // base for exponential backoff on 429
+	marketstackRateLimit   = 220 * time.Millisecond // ~4.5 requests/sec
+	marketstackSymbolBatch = 100
+)
+
+// MarketstackProvider talks to the Marketstack v2 REST API.
+//
+// Marketstack only exposes raw and fully adjusted (split + dividend) prices,
+// so AdjustmentSplit is served from the adjusted fields as well.
+type MarketstackProvider struct {
+	Token      string
+	BaseURL    string
+	Exchange   string // optional MIC filter, e.g. "XNAS"
+	HTTPClient *http.Client
+}
+
+// NewMarketstackProvider returns a provider with default settings.
+func NewMarketstackProvider(token string) *MarketstackProvider {
+	return &MarketstackProvider{
+		Token:      token,
+		BaseURL:    MarketstackURL,
+		HTTPClient: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+func (m *MarketstackProvider) Name() string { return ProviderMarketstack }
+
+type marketstackPagination struct {
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+	Count  int `json:"count"`
+	Total  int `json:"total"`
+}
+
+type marketstackBar struct {
+	Date      string  `json:"date"`
+	Symbol    string  `json:"symbol"`
+	Open      float64 `json:"open"`
+	High      float64 `json:"high"`
+	Low       float64 `json:"low"`
+	Close     float64 `json:"close"`
+	Last      float64 `json:"last"`
+	Volume    float64 `json:"volume"`
+	AdjOpen   float64 `json:"adj_open"`
+	AdjHigh   float64 `json:"adj_high"`
+	AdjLow    float64 `json:"adj_low"`
+	AdjClose  float64 `json:"adj_close"`
+	AdjVolume float64 `json:"adj_volume"`
+}
+
+func (b marketstackBar) toBar(adj Adjustment) (Bar, bool) {
+	t := parseMarketstackDate(b.Date)
+	if t.IsZero() {
+		return Bar{}, false
+	}
+	bar := Bar{Time: t, Open: b.Open, High: b.High, Low: b.Low, Close: b.Close, Volume: b.Volume}
+	if bar.Close == 0 && b.Last > 0 {
+		bar.Close = b.Last // intraday endpoint reports "last" instead of "close"
+	}
+	if adj != AdjustmentRaw && b.AdjClose > 0 {
+		bar.Open, bar.High, bar.Low, bar.Close = b.AdjOpen, b.AdjHigh, b.AdjLow, b.AdjClose
+		if b.AdjVolume > 0 {
+			bar.Volume = b.AdjVolume
+		}
+	}
+	// Drop bars with missing prices, same as the superperformance fetcher.
+	if bar.High <= 0 || bar.Low <= 0 || bar.Close <= 0 {
+		return Bar{}, false
+	}
+	return bar, true
+}
+
+type marketstackBarsResponse struct {
+	Pagination marketstackPagination `json:"pagination"`
+	Data       []marketstackBar      `json:"data"`
+}
+
+// DailyBars fetches end-of-day bars between two calendar dates (inclusive).
+func (m *MarketstackProvider) DailyBars(symbol string, start, end time.Time, adj Adjustment) ([]Bar, error) {
+	q := url.Values{}
+	q.Set("symbols", symbol)
+	q.Set("date_from", start.Format("2006-01-02"))
+	q.Set("date_to", end.Format("2006-01-02"))
+	return m.bars("eod", q, adj)
+}
+
+// MinuteBars fetches 1-minute bars from the intraday endpoint (paid plans only).
+func (m *MarketstackProvider) MinuteBars(symbol string, start, end time.Time, adj Adjustment) ([]Bar, error) {
+	q := url.Values{}
+	q.Set("symbols", symbol)
+	q.Set("interval", "1min")
+	q.Set("date_from", start.UTC().Format(time.RFC3339))
+	q.Set("date_to", end.UTC().Format(time.RFC3339))
+	bars, err := m.bars("intraday", q, AdjustmentRaw)
+	if err != nil {
+		return nil, err
+	}
+
+	// date_from/date_to are day-granular on some plans; trim to the window.
+	out := bars[:0]
+	for _, b := range bars {
+		if !b.Time.Before(start) && b.Time.Before(end) {
+			out = append(out, b)
+		}
+	}
+	return out, nil
+}
+
+func (m *MarketstackProvider) bars(path string, q url.Values, adj Adjustment) ([]Bar, error) {
+	if m.Exchange != "" {
+		q.Set("exchange", m.Exchange)
+	}
+	q.Set("limit", fmt.Sprint(marketstackPageLimit))
+
+	var all []Bar
+	offset := 0
+	for {
+		q.Set("offset", fmt.Sprint(offset))
+		var resp marketstackBarsResponse
+		if err := m.getJSON(path, q, &resp); err != nil {
+			return nil, fmt.Errorf("failed to fetch %s for %s: %w", path, q.Get("symbols"), err)
+		}
+
+		for _, d := range resp.Data {
+			if bar, ok := d.toBar(adj); ok {
+				all = append(all, bar)
+			}
+		}
+
+		if len(resp.Data) < marketstackPageLimit {
+			break
+		}
+		offset += marketstackPageLimit
+	}
+
+	sortBars(all)
+	return all, nil
+}
+
+// LatestTrade approximates the last trade with the latest intraday bar.
+func (m *MarketstackProvider) LatestTrade(symbol string) (*Trade, error) {
+	q := url.Values{}
+	q.Set("symbols", symbol)
+	var resp marketstackBarsResponse
+	if err := m.getJSON("intraday/latest", q, &resp); err != nil {
+		return nil, fmt.Errorf("failed to get latest trade for %s: %w", symbol, err)
+	}
+	if len(resp.Data) == 0 {
+		return nil, fmt.Errorf("no latest trade for %s", symbol)
+	}
+	bar, ok := resp.Data[0].toBar(AdjustmentRaw)
+	if !ok {
+		return nil, fmt.Errorf("no latest trade for %s", symbol)
+	}
+	return &Trade{Symbol: symbol, Price: bar.Close, Time: bar.Time}, nil
+}
+
+// Snapshots builds snapshots from the latest EOD bar.  Marketstack has no
+// previous-day field, so PrevDailyBar is left nil.
+func (m *MarketstackProvider) Snapshots(symbols []string) (map[string]*Snapshot, error) {
+	out := make(map[string]*Snapshot, len(symbols))
+	for _, batch := range chunk(symbols, marketstackSymbolBatch) {
+		q := url.Values{}
+		q.Set("symbols", strings.Join(batch, ","))
+		var resp marketstackBarsResponse
+		if err := m.getJSON("eod/latest", q, &resp); err != nil {
+			return nil, fmt.Errorf("failed to get snapshots: %w", err)
+		}
+		for _, d := range resp.Data {
+			bar, ok := d.toBar(AdjustmentRaw)
+			if !ok {
+				continue
+			}
+			b := bar
+			out[d.Symbol] = &Snapshot{
+				Symbol:      d.Symbol,
+				LatestTrade: &Trade{Symbol: d.Symbol, Price: bar.Close, Time: bar.Time},
+				DailyBar:    &b,
+			}
+		}
+	}
+	return out, nil
+}
+
+// TradableAssets lists tickers on NASDAQ (XNAS) and NYSE (XNYS).
+func (m *MarketstackProvider) TradableAssets() ([]Asset, error) {
+	var assets []Asset
+	for _, ex := range []struct{ mic, name string }{{"XNAS", "NASDAQ"}, {"XNYS", "NYSE"}} {
+		offset := 0
+		for {
+			q := url.Values{}
+			q.Set("limit", fmt.Sprint(marketstackPageLimit))
+			q.Set("offset", fmt.Sprint(offset))
+			var resp struct {
+				Pagination marketstackPagination `json:"pagination"`
+				Data       struct {
+					Tickers []struct {
+						Symbol string `json:"symbol"`
+						Name   string `json:"name"`
+					} `json:"tickers"`
+				} `json:"data"`
+			}
+			if err := m.getJSON("exchanges/"+ex.mic+"/tickers", q, &resp); err != nil {
+				return nil, fmt.Errorf("failed to list %s tickers: %w", ex.name, err)
+			}
+			for _, t := range resp.Data.Tickers {
+				assets = append(assets, Asset{Symbol: t.Symbol, Name: t.Name, Exchange: ex.name, Tradable: true})
+			}
+			if len(resp.Data.Tickers) < marketstackPageLimit {
+				break
+			}
+			offset += marketstackPageLimit
+		}
+	}
+	return assets, nil
+}
+
+// getJSON performs a rate-limited GET with exponential backoff on 429.
+func (m *MarketstackProvider) getJSON(path string, q url.Values, out interface{}) error {
+	q.Set("access_key", m.Token)
+	endpoint := fmt.Sprintf("%s/%s?%s", m.BaseURL, path, q.Encode())
+
+	for attempt := 0; ; attempt++ {
+		time.Sleep(marketstackRateLimit)
+
+		resp, err := m.HTTPClient.Get(endpoint)
+		if err != nil {
+			return fmt.Errorf("http request: %w", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("read body: %w", err)
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < marketstackMaxRetries {
+			time.Sleep(marketstackRetryDelay * time.Duration(1<<uint(attempt)))
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("Marketstack API error %d: %s", resp.StatusCode, string(body))
+		}
+		if err := json.Unmarshal(body, out); err != nil {
+			return fmt.Errorf("unmarshal: %w", err)
+		}
+		return nil
+	}
+}
+
+// parseMarketstackDate handles the handful of timestamp layouts Marketstack returns.
+func parseMarketstackDate(s string) time.Time {
+	for _, layout := range []string{
+		"2006-01-02T15:04:05-0700",
+		"2006-01-02T15:04:05Z07:00",
+		"2006-01-02T15:04:05+0000",
+		"2006-01-02T15:04:05",
+		"2006-01-02",
+	} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,333 @@
+package marketdata
+
+// Streaming minute bars
+//
+// BarStream multiplexes every watched symbol over one Alpaca market-data
+// websocket and fans bars (and trades) out to per-symbol subscribers, so a
+// worker per gapper no longer re-polls REST for every bar since the open each
+// minute.  A bar subscription is first backfilled over REST from its start
+// time, and after a reconnect every symbol is backfilled from its last
+// delivered bar; live bars that arrive meanwhile are held back, so each
+// subscriber sees every completed minute exactly once, in order.
+//
+// Trades are live only: prints missed while disconnected are not replayed.
+//
+// Usage:
+//   bs, err := marketdata.ConnectBarStream(ctx, marketdata.BarStreamConfig{APIKey: key, APISecret: secret})
+//   sub, err := bs.SubscribeBars("AAPL", openNY)
+//   defer sub.Close()
+//   for bar := range sub.C { ... }
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	alpacastream "github.com/alpacahq/alpaca-trade-api-go/v3/marketdata/stream"
+)
+
+// BarStreamConfig configures ConnectBarStream.
+type BarStreamConfig struct {
+	APIKey    string
+	APISecret string
+	Feed      string   // "sip" (default) or "iex"
+	Backfill  Provider // REST source for missed bars (default NewAlpacaProvider on Feed)
+	Buffer    int      // per-subscription channel size (default 1024)
+}
+
+// BarStream is one websocket connection shared by every subscription.
+type BarStream struct {
+	cfg    BarStreamConfig
+	client *alpacastream.StocksClient
+
+	subMu sync.Mutex // the SDK forbids concurrent subscription changes
+
+	mu        sync.Mutex
+	bars      map[string][]*BarSubscription
+	trades    map[string][]*TradeSubscription
+	connected int
+}
+
+// BarSubscription delivers completed minute bars for one symbol on C.  C is
+// closed by Close.
+type BarSubscription struct {
+	Symbol string
+	C      <-chan Bar
+
+	ch          chan Bar
+	stream      *BarStream
+	since       time.Time
+	last        time.Time // last bar delivered
+	backfilling bool
+	pending     []Bar // live bars held back while backfilling
+	closed      bool
+}
+
+// TradeSubscription delivers live trades for one symbol on C.
+type TradeSubscription struct {
+	Symbol string
+	C      <-chan Trade
+
+	ch     chan Trade
+	stream *BarStream
+	closed bool
+}
+
+// ConnectBarStream opens the websocket and blocks until the first connection
+// succeeds.  The SDK reconnects on its own until ctx is cancelled.
+func ConnectBarStream(ctx context.Context, cfg BarStreamConfig) (*BarStream, error) {
+	if cfg.Feed == "" {
+		cfg.Feed = "sip"
+	}
+	if cfg.Buffer == 0 {
+		cfg.Buffer = 1024
+	}
+	if cfg.Backfill == nil {
+		p := NewAlpacaProvider(cfg.APIKey, cfg.APISecret)
+		p.Feed = cfg.Feed
+		cfg.Backfill = p
+	}
+
+	s := &BarStream{
+		cfg:    cfg,
+		bars:   make(map[string][]*BarSubscription),
+		trades: make(map[string][]*TradeSubscription),
+	}
+	s.client = alpacastream.NewStocksClient(cfg.Feed,
+		alpacastream.WithCredentials(cfg.APIKey, cfg.APISecret),
+		alpacastream.WithBars(s.onBar),
+		alpacastream.WithTrades(s.onTrade),
+		alpacastream.WithConnectCallback(s.onConnect),
+		alpacastream.WithDisconnectCallback(func() {
+			log.Printf("⚠️  market data stream disconnected — reconnecting")
+		}),
+	)
+	if err := s.client.Connect(ctx); err != nil {
+		return nil, fmt.Errorf("failed to connect market data stream: %w", err)
+	}
+	return s, nil
+}
+
+// Terminated receives once the stream has stopped for good (ctx cancelled or
+// reconnects exhausted).
+func (s *BarStream) Terminated() <-chan error {
+	return s.client.Terminated()
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Subscriptions
+// ─────────────────────────────────────────────────────────────────────────────
+
+// SubscribeBars streams completed minute bars for symbol, starting with a
+// REST backfill of every bar from since.
+func (s *BarStream) SubscribeBars(symbol string, since time.Time) (*BarSubscription, error) {
+	ch := make(chan Bar, s.cfg.Buffer)
+	sub := &BarSubscription{Symbol: symbol, C: ch, ch: ch, stream: s, since: since, backfilling: true}
+
+	s.mu.Lock()
+	first := len(s.bars[symbol]) == 0
+	s.bars[symbol] = append(s.bars[symbol], sub)
+	s.mu.Unlock()
+
+	if first {
+		s.subMu.Lock()
+		err := s.client.SubscribeToBars(s.onBar, symbol)
+		s.subMu.Unlock()
+		if err != nil {
+			sub.Close()
+			return nil, fmt.Errorf("failed to subscribe to %s bars: %w", symbol, err)
+		}
+	}
+	go s.backfill(sub, since)
+	return sub, nil
+}
+
+// SubscribeTrades streams live trades for symbol.
+func (s *BarStream) SubscribeTrades(symbol string) (*TradeSubscription, error) {
+	ch := make(chan Trade, s.cfg.Buffer)
+	sub := &TradeSubscription{Symbol: symbol, C: ch, ch: ch, stream: s}
+
+	s.mu.Lock()
+	first := len(s.trades[symbol]) == 0
+	s.trades[symbol] = append(s.trades[symbol], sub)
+	s.mu.Unlock()
+
+	if first {
+		s.subMu.Lock()
+		err := s.client.SubscribeToTrades(s.onTrade, symbol)
+		s.subMu.Unlock()
+		if err != nil {
+			sub.Close()
+			return nil, fmt.Errorf("failed to subscribe to %s trades: %w", symbol, err)
+		}
+	}
+	return sub, nil
+}
+
+// Close stops delivery and closes C.  The symbol is unsubscribed from the
+// websocket once no subscriber is left.
+func (sub *BarSubscription) Close() {
+	s := sub.stream
+	s.mu.Lock()
+	if sub.closed {
+		s.mu.Unlock()
+		return
+	}
+	sub.closed = true
+	close(sub.ch)
+	s.bars[sub.Symbol] = removeSub(s.bars[sub.Symbol], sub)
+	last := len(s.bars[sub.Symbol]) == 0
+	if last {
+		delete(s.bars, sub.Symbol)
+	}
+	s.mu.Unlock()
+
+	if last {
+		s.subMu.Lock()
+		defer s.subMu.Unlock()
+		if err := s.client.UnsubscribeFromBars(sub.Symbol); err != nil {
+			log.Printf("⚠️  [%s] failed to unsubscribe bars: %v", sub.Symbol, err)
+		}
+	}
+}
+
+// Close stops delivery and closes C.
+func (sub *TradeSubscription) Close() {
+	s := sub.stream
+	s.mu.Lock()
+	if sub.closed {
+		s.mu.Unlock()
+		return
+	}
+	sub.closed = true
+	close(sub.ch)
+	s.trades[sub.Symbol] = removeSub(s.trades[sub.Symbol], sub)
+	last := len(s.trades[sub.Symbol]) == 0
+	if last {
+		delete(s.trades, sub.Symbol)
+	}
+	s.mu.Unlock()
+
+	if last {
+		s.subMu.Lock()
+		defer s.subMu.Unlock()
+		if err := s.client.UnsubscribeFromTrades(sub.Symbol); err != nil {
+			log.Printf("⚠️  [%s] failed to unsubscribe trades: %v", sub.Symbol, err)
+		}
+	}
+}
+
+func removeSub[T comparable](subs []T, sub T) []T {
+	for i, x := range subs {
+		if x == sub {
+			return append(subs[:i], subs[i+1:]...)
+		}
+	}
+	return subs
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Delivery
+// ─────────────────────────────────────────────────────────────────────────────
+
+func (s *BarStream) onBar(b alpacastream.Bar) {
+	bar := Bar{
+		Time: b.Timestamp, Open: b.Open, High: b.High, Low: b.Low, Close: b.Close,
+		Volume: float64(b.Volume), VWAP: b.VWAP, TradeCount: int(b.TradeCount),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sub := range s.bars[b.Symbol] {
+		if sub.backfilling {
+			sub.pending = append(sub.pending, bar)
+			continue
+		}
+		sub.deliver(bar)
+	}
+}
+
+func (s *BarStream) onTrade(t alpacastream.Trade) {
+	trade := Trade{Symbol: t.Symbol, Price: t.Price, Size: float64(t.Size), Time: t.Timestamp}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sub := range s.trades[t.Symbol] {
+		select {
+		case sub.ch <- trade:
+		default:
+			log.Printf("⚠️  [%s] trade subscriber is behind — dropping trade", t.Symbol)
+		}
+	}
+}
+
+// onConnect backfills every bar subscription after a reconnect.
+func (s *BarStream) onConnect() {
+	s.mu.Lock()
+	s.connected++
+	if s.connected == 1 {
+		s.mu.Unlock()
+		return
+	}
+	var resume []*BarSubscription
+	for _, subs := range s.bars {
+		for _, sub := range subs {
+			if !sub.backfilling {
+				sub.backfilling = true
+				resume = append(resume, sub)
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	log.Printf("🔌 market data stream reconnected — backfilling %d subscription(s)", len(resume))
+	for _, sub := range resume {
+		from := sub.since
+		if !sub.last.IsZero() {
+			from = sub.last.Add(time.Minute)
+		}
+		go s.backfill(sub, from)
+	}
+}
+
+// backfill delivers completed bars from `from` over REST, then releases the
+// live bars held back meanwhile.
+func (s *BarStream) backfill(sub *BarSubscription, from time.Time) {
+	// The current minute is still forming; the stream delivers it complete.
+	until := time.Now().Truncate(time.Minute)
+	var bars []Bar
+	if from.Before(until) {
+		var err error
+		bars, err = s.cfg.Backfill.MinuteBars(sub.Symbol, from, until, AdjustmentRaw)
+		if err != nil {
+			log.Printf("⚠️  [%s] bar backfill from %s failed: %v", sub.Symbol, from.Format("15:04"), err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range bars {
+		if b.Time.Before(until) {
+			sub.deliver(b)
+		}
+	}
+	for _, b := range sub.pending {
+		sub.deliver(b)
+	}
+	sub.pending = nil
+	sub.backfilling = false
+}
+
+// deliver sends bar unless it is not newer than the last one sent.  Callers
+// hold the stream's mu.
+func (sub *BarSubscription) deliver(bar Bar) {
+	if sub.closed || !bar.Time.After(sub.last) {
+		return
+	}
+	select {
+	case sub.ch <- bar:
+		sub.last = bar.Time
+	default:
+		log.Printf("⚠️  [%s] bar subscriber is behind — dropping %s bar", sub.Symbol, bar.Time.Format("15:04"))
+	}
+}
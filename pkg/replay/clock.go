@@ -0,0 +1,62 @@
+package replay
+
+import (
+	"sync"
+	"time"
+)
+
+// Now is time.Now, except in replay mode where it returns the recorded
+// program's start time plus the wall time elapsed since the archive was
+// loaded.  Use it anywhere "today" or "the current minute" feeds into a
+// request or a decision, so a replay sees the same trading day it recorded.
+func Now() time.Time {
+	s := Active()
+	if s == nil || s.Mode != ModeReplay || s.recordedAt.IsZero() {
+		return time.Now()
+	}
+	return s.recordedAt.Add(time.Since(s.replayOpened)).In(time.Local)
+}
+
+// Clock is a per-goroutine time source for polling loops.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+// NewClock returns the wall clock normally.  In replay mode it returns a
+// virtual clock starting at Now() whose Sleep returns immediately after
+// advancing the clock, so a recorded session of minute-by-minute polling
+// replays in seconds.  Each caller gets its own clock so concurrent
+// workers do not advance each other.
+func NewClock() Clock {
+	s := Active()
+	if s == nil || s.Mode != ModeReplay {
+		return wallClock{}
+	}
+	return &virtualClock{now: Now()}
+}
+
+type wallClock struct{}
+
+func (wallClock) Now() time.Time        { return time.Now() }
+func (wallClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+type virtualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *virtualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *virtualClock) Sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
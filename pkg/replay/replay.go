@@ -0,0 +1,493 @@
+package replay
+
+// HTTP record / replay
+//
+// A Session is an http.RoundTripper that sits in front of http.DefaultTransport.
+//
+//   REPLAY_MODE=record   every request goes to the network as normal and the
+//                        response is appended to the session archive.
+//   REPLAY_MODE=replay   no request leaves the process; responses are served
+//                        back from the archive in the order they were recorded.
+//
+// The archive (REPLAY_ARCHIVE, default data/replay/session_YYYYMMDD.jsonl.gz)
+// is a stream of gzip members, one JSON entry per member, so every response is
+// on disk as soon as it arrives and several programs (pre-market scan, intraday
+// workers, agents) can record into the same trading-day archive one after the
+// other.
+//
+// Because every client in the EP pipeline that does not set its own Transport
+// falls through to http.DefaultTransport — Alpaca REST, Finnhub, the news
+// scrapers, the Sapien client and the Alpaca SDK — installing the session once
+// in main() covers all of them.
+//
+// Matching on replay:
+//   1. exact:  method + URL (credentials stripped) + SHA-256 of the body
+//   2. route:  method + URL with time-window params (start, end, from, …)
+//              dropped, for requests whose URL embeds "now"
+// Within each key responses are handed out in recorded order; once a key is
+// exhausted its last response is repeated.
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mode selects what a Session does with each request.
+type Mode string
+
+const (
+	ModeOff    Mode = ""
+	ModeRecord Mode = "record"
+	ModeReplay Mode = "replay"
+
+	DefaultArchiveDir = "data/replay"
+)
+
+// redactedParams are query parameters that carry credentials.  They are
+// removed before a URL is written to the archive or used as a match key.
+var redactedParams = map[string]bool{
+	"token":      true,
+	"access_key": true,
+	"apikey":     true,
+	"api_key":    true,
+	"key":        true,
+}
+
+// volatileParams are dropped from the route key because their values
+// depend on the wall clock at the time of the request.
+var volatileParams = map[string]bool{
+	"start":      true,
+	"end":        true,
+	"from":       true,
+	"to":         true,
+	"date":       true,
+	"date_from":  true,
+	"date_to":    true,
+	"page_token": true,
+	"_":          true,
+}
+
+// Entry is one line of the session archive.
+type Entry struct {
+	Type     string      `json:"type"` // "session" header or "http"
+	Seq      int         `json:"seq"`
+	Program  string      `json:"program"`
+	Time     time.Time   `json:"time"`
+	Method   string      `json:"method,omitempty"`
+	URL      string      `json:"url,omitempty"`
+	BodySHA  string      `json:"body_sha,omitempty"`
+	Status   int         `json:"status,omitempty"`
+	Header   http.Header `json:"header,omitempty"`
+	Body     []byte      `json:"body,omitempty"`
+	ErrorMsg string      `json:"error,omitempty"`
+}
+
+// Session records to or replays from a single archive file.
+type Session struct {
+	Mode    Mode
+	Path    string
+	Program string
+
+	next http.RoundTripper // record mode only
+
+	mu   sync.Mutex
+	file *os.File
+	seq  int
+
+	// replay state
+	entries      []Entry
+	byExact      map[string][]int
+	byRoute      map[string][]int
+	used         []bool
+	exactCursor  map[string]int
+	recordedAt   time.Time // start of the recorded program run
+	replayOpened time.Time
+}
+
+var (
+	activeMu sync.RWMutex
+	active   *Session
+)
+
+// Active returns the installed session, or nil when record/replay is off.
+func Active() *Session {
+	activeMu.RLock()
+	defer activeMu.RUnlock()
+	return active
+}
+
+// InstallFromEnv opens a session from REPLAY_MODE / REPLAY_ARCHIVE and swaps
+// it in as http.DefaultTransport.  It returns (nil, nil) when REPLAY_MODE is
+// unset.  Callers should defer Close on the returned session.
+func InstallFromEnv() (*Session, error) {
+	mode := Mode(strings.ToLower(strings.TrimSpace(os.Getenv("REPLAY_MODE"))))
+	if mode == ModeOff || mode == "off" {
+		return nil, nil
+	}
+	path := os.Getenv("REPLAY_ARCHIVE")
+	if path == "" {
+		path = filepath.Join(DefaultArchiveDir, fmt.Sprintf("session_%s.jsonl.gz", time.Now().Format("20060102")))
+	}
+	s, err := Open(mode, path, http.DefaultTransport)
+	if err != nil {
+		return nil, err
+	}
+	Install(s)
+	return s, nil
+}
+
+// Install makes s the process-wide transport.
+func Install(s *Session) {
+	activeMu.Lock()
+	active = s
+	activeMu.Unlock()
+	http.DefaultTransport = s
+	fmt.Printf("🎞️  replay: %s mode, archive %s\n", s.Mode, s.Path)
+}
+
+// Open creates a session.  next is the real transport used in record mode.
+func Open(mode Mode, path string, next http.RoundTripper) (*Session, error) {
+	s := &Session{
+		Mode:    mode,
+		Path:    path,
+		Program: strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe"),
+		next:    next,
+	}
+
+	switch mode {
+	case ModeRecord:
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create archive dir: %w", err)
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open archive %s: %w", path, err)
+		}
+		s.file = f
+		if err := s.append(Entry{Type: "session", Program: s.Program, Time: time.Now().UTC()}); err != nil {
+			f.Close()
+			return nil, err
+		}
+	case ModeReplay:
+		if err := s.load(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown replay mode %q (want record or replay)", mode)
+	}
+	return s, nil
+}
+
+// Close flushes and closes the archive.
+func (s *Session) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// RoundTrip implements http.RoundTripper.
+func (s *Session) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	if s.Mode == ModeReplay {
+		return s.replay(req, body)
+	}
+	return s.record(req, body)
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Record
+// ─────────────────────────────────────────────────────────────────────────────
+
+func (s *Session) record(req *http.Request, body []byte) (*http.Response, error) {
+	entry := Entry{
+		Type:    "http",
+		Program: s.Program,
+		Time:    time.Now().UTC(),
+		Method:  req.Method,
+		URL:     redactURL(req.URL),
+		BodySHA: bodyHash(body),
+	}
+
+	resp, err := s.next.RoundTrip(req)
+	if err != nil {
+		entry.ErrorMsg = err.Error()
+		s.appendLogged(entry)
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("replay: failed to read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	entry.Status = resp.StatusCode
+	entry.Header = keepHeaders(resp.Header)
+	entry.Body = respBody
+	s.appendLogged(entry)
+	return resp, nil
+}
+
+func (s *Session) appendLogged(e Entry) {
+	if err := s.append(e); err != nil {
+		fmt.Printf("⚠️  replay: failed to record %s %s: %v\n", e.Method, e.URL, err)
+	}
+}
+
+// append writes e as its own gzip member so the archive is always readable
+// up to the last completed request, even if the process is killed.
+func (s *Session) append(e Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return errors.New("archive closed")
+	}
+	s.seq++
+	e.Seq = s.seq
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(s.file)
+	if _, err := zw.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Replay
+// ─────────────────────────────────────────────────────────────────────────────
+
+func (s *Session) load() error {
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive %s: %w", s.Path, err)
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("failed to read archive %s: %w", s.Path, err)
+	}
+	defer zr.Close()
+
+	var firstStart time.Time
+	dec := json.NewDecoder(zr)
+	for {
+		var e Entry
+		if err := dec.Decode(&e); err != nil {
+			if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+				break // a truncated final member is expected after a crash
+			}
+			return fmt.Errorf("failed to decode archive %s: %w", s.Path, err)
+		}
+		if e.Type == "session" {
+			if firstStart.IsZero() {
+				firstStart = e.Time
+			}
+			if s.recordedAt.IsZero() && e.Program == s.Program {
+				s.recordedAt = e.Time
+			}
+			continue
+		}
+		s.entries = append(s.entries, e)
+	}
+	if s.recordedAt.IsZero() {
+		s.recordedAt = firstStart
+	}
+
+	s.byExact = make(map[string][]int)
+	s.byRoute = make(map[string][]int)
+	s.exactCursor = make(map[string]int)
+	s.used = make([]bool, len(s.entries))
+	for i, e := range s.entries {
+		u, err := url.Parse(e.URL)
+		if err != nil {
+			continue
+		}
+		s.byExact[exactKey(e.Method, e.URL, e.BodySHA)] = append(s.byExact[exactKey(e.Method, e.URL, e.BodySHA)], i)
+		s.byRoute[routeKey(e.Method, u)] = append(s.byRoute[routeKey(e.Method, u)], i)
+	}
+	s.replayOpened = time.Now()
+
+	fmt.Printf("🎞️  replay: loaded %d responses from %s (recorded %s)\n",
+		len(s.entries), s.Path, s.recordedAt.Format(time.RFC3339))
+	return nil
+}
+
+func (s *Session) replay(req *http.Request, body []byte) (*http.Response, error) {
+	redacted := redactURL(req.URL)
+	exact := exactKey(req.Method, redacted, bodyHash(body))
+	route := routeKey(req.Method, req.URL)
+
+	s.mu.Lock()
+	idx := s.nextExact(exact)
+	if idx < 0 {
+		idx = s.nextRoute(route)
+	}
+	var e Entry
+	if idx >= 0 {
+		s.used[idx] = true
+		e = s.entries[idx]
+	}
+	s.mu.Unlock()
+
+	if idx < 0 {
+		return nil, fmt.Errorf("replay: no recorded response for %s %s", req.Method, redacted)
+	}
+	if e.ErrorMsg != "" {
+		return nil, fmt.Errorf("replay: recorded error: %s", e.ErrorMsg)
+	}
+
+	header := e.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status)),
+		StatusCode:    e.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}, nil
+}
+
+// nextExact hands out exact matches in order, repeating the last one.
+func (s *Session) nextExact(key string) int {
+	idxs := s.byExact[key]
+	if len(idxs) == 0 {
+		return -1
+	}
+	c := s.exactCursor[key]
+	if c >= len(idxs) {
+		return idxs[len(idxs)-1]
+	}
+	s.exactCursor[key] = c + 1
+	return idxs[c]
+}
+
+// nextRoute returns the first not-yet-served entry on the route, or the last
+// entry on the route once all have been served.
+func (s *Session) nextRoute(key string) int {
+	idxs := s.byRoute[key]
+	if len(idxs) == 0 {
+		return -1
+	}
+	for _, i := range idxs {
+		if !s.used[i] {
+			return i
+		}
+	}
+	return idxs[len(idxs)-1]
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Keys & helpers
+// ─────────────────────────────────────────────────────────────────────────────
+
+func exactKey(method, redactedURL, bodySHA string) string {
+	return method + " " + redactedURL + " " + bodySHA
+}
+
+func routeKey(method string, u *url.URL) string {
+	q := u.Query()
+	for k := range q {
+		if redactedParams[strings.ToLower(k)] || volatileParams[strings.ToLower(k)] {
+			q.Del(k)
+		}
+	}
+	return method + " " + u.Host + u.Path + "?" + encodeSorted(q)
+}
+
+func redactURL(u *url.URL) string {
+	c := *u
+	q := c.Query()
+	for k := range q {
+		if redactedParams[strings.ToLower(k)] {
+			q.Del(k)
+		}
+	}
+	c.RawQuery = encodeSorted(q)
+	c.User = nil
+	return c.String()
+}
+
+func encodeSorted(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		for _, v := range q[k] {
+			if b.Len() > 0 {
+				b.WriteByte('&')
+			}
+			b.WriteString(url.QueryEscape(k) + "=" + url.QueryEscape(v))
+		}
+	}
+	return b.String()
+}
+
+func bodyHash(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("replay: failed to read request body: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// keepHeaders drops everything except the headers callers actually inspect,
+// so cookies and auth echoes never end up in the archive.
+func keepHeaders(h http.Header) http.Header {
+	out := http.Header{}
+	for _, k := range []string{"Content-Type", "Content-Encoding", "Retry-After"} {
+		if v := h.Values(k); len(v) > 0 {
+			out[k] = v
+		}
+	}
+	return out
+}
@@ -0,0 +1,134 @@
+package riskCalculator
+
+// Circuit breaker
+//
+// Limits.Check refuses one entry at a time.  The circuit breaker latches:
+// once today's loss, the drawdown from this week's equity peak or a run of
+// losing trades crosses its limit, it stays tripped (the caller persists
+// that) and every entry is blocked until the day or week rolls over or an
+// operator resets it.  With Flatten set the caller also closes everything.
+//
+// Usage:
+//   limits, err := riskCalculator.BreakerLimitsFromEnv()
+//   if trip := limits.Evaluate(riskCalculator.BreakerInput{Equity: 97000,
+//       DayPL: -3100, WeekPeak: 101000, ConsecutiveLosses: 2}); trip != nil {
+//       log.Println(trip.Detail)
+//   }
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Rules a breaker trips on, besides RuleDailyLoss.
+const (
+	RuleWeeklyDrawdown    = "weekly_drawdown"
+	RuleConsecutiveLosses = "consecutive_losses"
+)
+
+// BreakerLimits are the thresholds that trip the breaker.  A zero limit is
+// not enforced.
+type BreakerLimits struct {
+	MaxDailyLossPct      float64 // today's realised + unrealised loss, percent of equity
+	MaxWeeklyDrawdownPct float64 // drop from this week's equity peak, percent
+	MaxConsecutiveLosses int     // losing closed trades in a row
+	Flatten              bool    // cancel orders and liquidate when tripped
+}
+
+// DefaultBreakerLimits trips at a 3% daily loss, a 6% weekly drawdown or 4
+// losses in a row, and does not flatten.
+func DefaultBreakerLimits() BreakerLimits {
+	return BreakerLimits{
+		MaxDailyLossPct:      3,
+		MaxWeeklyDrawdownPct: 6,
+		MaxConsecutiveLosses: 4,
+	}
+}
+
+// BreakerLimitsFromEnv starts from DefaultBreakerLimits and applies
+// BREAKER_MAX_DAILY_LOSS_PCT, BREAKER_MAX_WEEKLY_DRAWDOWN_PCT,
+// BREAKER_MAX_CONSECUTIVE_LOSSES and BREAKER_FLATTEN.
+func BreakerLimitsFromEnv() (BreakerLimits, error) {
+	l := DefaultBreakerLimits()
+	env := func(name string) string { return strings.TrimSpace(os.Getenv(name)) }
+	for name, dst := range map[string]*float64{
+		"BREAKER_MAX_DAILY_LOSS_PCT":      &l.MaxDailyLossPct,
+		"BREAKER_MAX_WEEKLY_DRAWDOWN_PCT": &l.MaxWeeklyDrawdownPct,
+	} {
+		if v := env(name); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return l, fmt.Errorf("invalid %s %q: %w", name, v, err)
+			}
+			*dst = f
+		}
+	}
+	if v := env("BREAKER_MAX_CONSECUTIVE_LOSSES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return l, fmt.Errorf("invalid BREAKER_MAX_CONSECUTIVE_LOSSES %q: %w", v, err)
+		}
+		l.MaxConsecutiveLosses = n
+	}
+	if v := env("BREAKER_FLATTEN"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return l, fmt.Errorf("invalid BREAKER_FLATTEN %q: %w", v, err)
+		}
+		l.Flatten = b
+	}
+	return l, nil
+}
+
+// BreakerInput is the account as the breaker sees it.
+type BreakerInput struct {
+	Equity            float64
+	DayPL             float64 // realised + unrealised since the previous close
+	WeekPeak          float64 // highest equity seen this week
+	ConsecutiveLosses int     // most recent closed trades that lost, in a row
+}
+
+// Trip says which limit tripped the breaker.  Value and Limit are in the
+// rule's units (a percent, or a count of trades).
+type Trip struct {
+	Rule   string
+	Value  float64
+	Limit  float64
+	Detail string
+}
+
+// Evaluate returns the first limit in breach, or nil.
+func (l BreakerLimits) Evaluate(in BreakerInput) *Trip {
+	if in.Equity > 0 && l.MaxDailyLossPct > 0 {
+		// Today's loss against the equity the day started with.
+		if start := in.Equity - in.DayPL; start > 0 && in.DayPL < 0 {
+			if loss := -in.DayPL / start * 100; loss >= l.MaxDailyLossPct {
+				return &Trip{Rule: RuleDailyLoss, Value: loss, Limit: l.MaxDailyLossPct,
+					Detail: fmt.Sprintf("down %.2f%% today ($%.2f), limit %.2f%%", loss, in.DayPL, l.MaxDailyLossPct)}
+			}
+		}
+	}
+	if in.WeekPeak > 0 && in.Equity > 0 && l.MaxWeeklyDrawdownPct > 0 {
+		if dd := (in.WeekPeak - in.Equity) / in.WeekPeak * 100; dd >= l.MaxWeeklyDrawdownPct {
+			return &Trip{Rule: RuleWeeklyDrawdown, Value: dd, Limit: l.MaxWeeklyDrawdownPct,
+				Detail: fmt.Sprintf("%.2f%% below this week's peak $%.2f, limit %.2f%%", dd, in.WeekPeak, l.MaxWeeklyDrawdownPct)}
+		}
+	}
+	if l.MaxConsecutiveLosses > 0 && in.ConsecutiveLosses >= l.MaxConsecutiveLosses {
+		return &Trip{Rule: RuleConsecutiveLosses, Value: float64(in.ConsecutiveLosses), Limit: float64(l.MaxConsecutiveLosses),
+			Detail: fmt.Sprintf("%d losing trades in a row, limit %d", in.ConsecutiveLosses, l.MaxConsecutiveLosses)}
+	}
+	return nil
+}
+
+// ConsecutiveLosses counts the losing trades at the end of pl, which holds
+// closed-trade P&L oldest first.
+func ConsecutiveLosses(pl []float64) int {
+	n := 0
+	for i := len(pl) - 1; i >= 0 && pl[i] < 0; i-- {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,90 @@
+package riskCalculator
+
+import "testing"
+
+func TestBreakerLimitsEvaluate(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits BreakerLimits
+		in     BreakerInput
+		want   string // rule tripped, "" for none
+	}{
+		{
+			name:   "within every limit",
+			limits: DefaultBreakerLimits(),
+			in:     BreakerInput{Equity: 100000, DayPL: -1000, WeekPeak: 101000, ConsecutiveLosses: 1},
+		},
+		{
+			name:   "daily loss at the limit",
+			limits: DefaultBreakerLimits(),
+			in:     BreakerInput{Equity: 97000, DayPL: -3000, WeekPeak: 100000},
+			want:   RuleDailyLoss,
+		},
+		{
+			// 2.95% of the $100k the day started with, 3.04% of what is left.
+			name:   "daily loss measured against the open",
+			limits: DefaultBreakerLimits(),
+			in:     BreakerInput{Equity: 97050, DayPL: -2950, WeekPeak: 100000},
+		},
+		{
+			name:   "weekly drawdown",
+			limits: DefaultBreakerLimits(),
+			in:     BreakerInput{Equity: 94000, DayPL: 0, WeekPeak: 100000},
+			want:   RuleWeeklyDrawdown,
+		},
+		{
+			name:   "daily loss reported before drawdown",
+			limits: DefaultBreakerLimits(),
+			in:     BreakerInput{Equity: 94000, DayPL: -6000, WeekPeak: 100000},
+			want:   RuleDailyLoss,
+		},
+		{
+			name:   "losing streak",
+			limits: DefaultBreakerLimits(),
+			in:     BreakerInput{Equity: 100000, WeekPeak: 100000, ConsecutiveLosses: 4},
+			want:   RuleConsecutiveLosses,
+		},
+		{
+			name:   "no equity skips the money limits",
+			limits: DefaultBreakerLimits(),
+			in:     BreakerInput{DayPL: -5000, WeekPeak: 100000},
+		},
+		{
+			name:   "zero limits are not enforced",
+			limits: BreakerLimits{},
+			in:     BreakerInput{Equity: 50000, DayPL: -20000, WeekPeak: 100000, ConsecutiveLosses: 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trip := tt.limits.Evaluate(tt.in)
+			switch {
+			case tt.want == "" && trip != nil:
+				t.Errorf("tripped %s: %s", trip.Rule, trip.Detail)
+			case tt.want != "" && trip == nil:
+				t.Errorf("did not trip, want %s", tt.want)
+			case trip != nil && trip.Rule != tt.want:
+				t.Errorf("tripped %s, want %s", trip.Rule, tt.want)
+			}
+		})
+	}
+}
+
+func TestConsecutiveLosses(t *testing.T) {
+	tests := []struct {
+		pl   []float64
+		want int
+	}{
+		{pl: nil, want: 0},
+		{pl: []float64{-1, 2}, want: 0},
+		{pl: []float64{1, -1, -2}, want: 2},
+		{pl: []float64{-1, 0, -1}, want: 1},
+		{pl: []float64{-1, -1, -1}, want: 3},
+	}
+	for _, tt := range tests {
+		if got := ConsecutiveLosses(tt.pl); got != tt.want {
+			t.Errorf("ConsecutiveLosses(%v) = %d, want %d", tt.pl, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package riskCalculator
+
+// Portfolio risk engine
+//
+// RiskCalculator sizes one trade in isolation.  Limits.Check decides whether
+// a sized trade may go out given everything already held: how many
+// positions are open, how much is at risk to their stops, how much sits in
+// one sector, how large the new position is against equity, and how much
+// has been lost today.  Every limit is a percent of equity, like riskPerc.
+//
+// Usage:
+//   limits, err := riskCalculator.LimitsFromEnv()
+//   d := limits.Check(portfolio, riskCalculator.Proposal{Symbol: "AAPL",
+//       Sector: "Technology", Qty: 100, Entry: 190, Stop: 186})
+//   if !d.Allowed { log.Println(d.Reasons()) }
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Limits are the portfolio-wide constraints.  A zero limit is not enforced.
+type Limits struct {
+	MaxPositions    int     // concurrent positions
+	MaxOpenRiskPct  float64 // total risk to stops, new trade included
+	MaxSectorPct    float64 // market value in one sector, new trade included
+	MaxPositionPct  float64 // market value of the new position
+	MaxDailyLossPct float64 // no new entries once today's loss reaches this
+}
+
+// DefaultLimits allows 5 positions, 6% open risk, 30% per sector, 25% per
+// position and a 3% daily loss.
+func DefaultLimits() Limits {
+	return Limits{
+		MaxPositions:    5,
+		MaxOpenRiskPct:  6,
+		MaxSectorPct:    30,
+		MaxPositionPct:  25,
+		MaxDailyLossPct: 3,
+	}
+}
+
+// LimitsFromEnv starts from DefaultLimits and applies RISK_MAX_POSITIONS,
+// RISK_MAX_OPEN_RISK_PCT, RISK_MAX_SECTOR_PCT, RISK_MAX_POSITION_PCT and
+// RISK_MAX_DAILY_LOSS_PCT.
+func LimitsFromEnv() (Limits, error) {
+	l := DefaultLimits()
+	if v := strings.TrimSpace(os.Getenv("RISK_MAX_POSITIONS")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return l, fmt.Errorf("invalid RISK_MAX_POSITIONS %q: %w", v, err)
+		}
+		l.MaxPositions = n
+	}
+	for name, dst := range map[string]*float64{
+		"RISK_MAX_OPEN_RISK_PCT":  &l.MaxOpenRiskPct,
+		"RISK_MAX_SECTOR_PCT":     &l.MaxSectorPct,
+		"RISK_MAX_POSITION_PCT":   &l.MaxPositionPct,
+		"RISK_MAX_DAILY_LOSS_PCT": &l.MaxDailyLossPct,
+	} {
+		if v := strings.TrimSpace(os.Getenv(name)); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return l, fmt.Errorf("invalid %s %q: %w", name, v, err)
+			}
+			*dst = f
+		}
+	}
+	return l, nil
+}
+
+// Holding is one open position, or with Pending set an entry order that
+// has not filled yet and is counted as if it had.  Stop is the price its
+// protective stop sits at; zero means unprotected, and the whole market
+// value is at risk.
+type Holding struct {
+	Symbol  string
+	Sector  string
+	Qty     float64
+	Price   float64
+	Stop    float64
+	Pending bool
+}
+
+// Risk is what the holding loses if its stop fills.
+func (h Holding) Risk() float64 {
+	switch {
+	case h.Stop <= 0:
+		return math.Abs(h.Qty) * h.Price
+	case h.Stop >= h.Price:
+		return 0 // the stop locks in a gain
+	}
+	return math.Abs(h.Qty) * (h.Price - h.Stop)
+}
+
+// Portfolio is the account as the engine sees it.  DayPL is today's
+// realised plus unrealised P&L.
+type Portfolio struct {
+	Equity   float64
+	DayPL    float64
+	Holdings []Holding
+}
+
+// Proposal is a trade about to be placed.
+type Proposal struct {
+	Symbol string
+	Sector string
+	Qty    float64
+	Entry  float64
+	Stop   float64
+}
+
+// Rules reported in a Violation.
+const (
+	RuleMaxPositions = "max_positions"
+	RuleOpenRisk     = "max_open_risk"
+	RuleSector       = "max_sector_exposure"
+	RulePositionSize = "max_position_size"
+	RuleDailyLoss    = "daily_loss_limit"
+	RuleInvalid      = "invalid_proposal"
+)
+
+// Violation is one limit the proposal would break.  Value and Limit are in
+// the rule's units (a count, or a percent of equity).
+type Violation struct {
+	Rule   string
+	Value  float64
+	Limit  float64
+	Detail string
+}
+
+// Decision is the engine's verdict on a Proposal.
+type Decision struct {
+	Allowed    bool
+	Violations []Violation
+
+	// The portfolio after the trade, in percent of equity.
+	OpenRiskPct   float64
+	SectorPct     float64
+	PositionPct   float64
+	DailyLossPct  float64
+	OpenPositions int
+}
+
+// Reasons lists the violations as text.
+func (d Decision) Reasons() []string {
+	out := make([]string, 0, len(d.Violations))
+	for _, v := range d.Violations {
+		out = append(out, fmt.Sprintf("%s: %s", v.Rule, v.Detail))
+	}
+	return out
+}
+
+// String summarises the decision for logs.
+func (d Decision) String() string {
+	if d.Allowed {
+		return fmt.Sprintf("ALLOW (positions %d, open risk %.2f%%, sector %.1f%%, position %.1f%%)",
+			d.OpenPositions, d.OpenRiskPct, d.SectorPct, d.PositionPct)
+	}
+	return "DENY: " + strings.Join(d.Reasons(), "; ")
+}
+
+// Check decides whether t may be placed on top of p.  Adding to a symbol
+// already held or pending does not count as a new position.
+func (l Limits) Check(p Portfolio, t Proposal) Decision {
+	var d Decision
+	deny := func(rule string, value, limit float64, format string, args ...interface{}) {
+		d.Violations = append(d.Violations, Violation{Rule: rule, Value: value, Limit: limit, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	if p.Equity <= 0 || t.Qty <= 0 || t.Entry <= 0 || t.Stop >= t.Entry {
+		deny(RuleInvalid, 0, 0, "equity $%.2f, %g shares, entry $%.2f, stop $%.2f", p.Equity, t.Qty, t.Entry, t.Stop)
+		return d
+	}
+	pct := func(v float64) float64 { return v / p.Equity * 100 }
+
+	added := Holding{Symbol: t.Symbol, Sector: t.Sector, Qty: t.Qty, Price: t.Entry, Stop: t.Stop}
+	symbols := map[string]bool{t.Symbol: true}
+	openRisk := added.Risk()
+	sectorValue := 0.0
+	positionValue := t.Qty * t.Entry
+	for _, h := range p.Holdings {
+		if h.Qty == 0 {
+			continue
+		}
+		if h.Symbol == t.Symbol {
+			positionValue += math.Abs(h.Qty) * h.Price
+		}
+		symbols[h.Symbol] = true
+		openRisk += h.Risk()
+		if t.Sector != "" && strings.EqualFold(h.Sector, t.Sector) {
+			sectorValue += math.Abs(h.Qty) * h.Price
+		}
+	}
+	if t.Sector != "" {
+		sectorValue += t.Qty * t.Entry
+	}
+
+	positions := len(symbols)
+	d.OpenPositions = positions
+	d.OpenRiskPct = pct(openRisk)
+	d.SectorPct = pct(sectorValue)
+	d.PositionPct = pct(positionValue)
+	d.DailyLossPct = math.Max(0, -pct(p.DayPL))
+
+	if l.MaxPositions > 0 && positions > l.MaxPositions {
+		deny(RuleMaxPositions, float64(positions), float64(l.MaxPositions),
+			"%d positions would be open, limit %d", positions, l.MaxPositions)
+	}
+	if l.MaxOpenRiskPct > 0 && d.OpenRiskPct > l.MaxOpenRiskPct {
+		deny(RuleOpenRisk, d.OpenRiskPct, l.MaxOpenRiskPct,
+			"open risk would be %.2f%% of equity, limit %.2f%%", d.OpenRiskPct, l.MaxOpenRiskPct)
+	}
+	if l.MaxSectorPct > 0 && t.Sector != "" && d.SectorPct > l.MaxSectorPct {
+		deny(RuleSector, d.SectorPct, l.MaxSectorPct,
+			"%s exposure would be %.1f%% of equity, limit %.1f%%", t.Sector, d.SectorPct, l.MaxSectorPct)
+	}
+	if l.MaxPositionPct > 0 && d.PositionPct > l.MaxPositionPct {
+		deny(RulePositionSize, d.PositionPct, l.MaxPositionPct,
+			"%s would be %.1f%% of equity, limit %.1f%%", t.Symbol, d.PositionPct, l.MaxPositionPct)
+	}
+	if l.MaxDailyLossPct > 0 && d.DailyLossPct >= l.MaxDailyLossPct {
+		deny(RuleDailyLoss, d.DailyLossPct, l.MaxDailyLossPct,
+			"down %.2f%% today, limit %.2f%%", d.DailyLossPct, l.MaxDailyLossPct)
+	}
+
+	d.Allowed = len(d.Violations) == 0
+	return d
+}
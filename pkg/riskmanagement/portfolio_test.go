@@ -0,0 +1,123 @@
+package riskCalculator
+
+import "testing"
+
+func TestLimitsCheck(t *testing.T) {
+	// The proposal risks $200 (0.2%) on a $5,000 position (5%) of $100k.
+	proposal := Proposal{Symbol: "NEW", Sector: "Technology", Qty: 100, Entry: 50, Stop: 48}
+	small := func(symbol string) Holding {
+		return Holding{Symbol: symbol, Qty: 10, Price: 10, Stop: 9}
+	}
+
+	tests := []struct {
+		name      string
+		limits    Limits
+		portfolio Portfolio
+		proposal  Proposal
+		want      []string // rules violated, in Check's order
+	}{
+		{
+			name:      "allowed",
+			limits:    DefaultLimits(),
+			portfolio: Portfolio{Equity: 100000, Holdings: []Holding{small("A")}},
+			proposal:  proposal,
+		},
+		{
+			name:      "stop at entry is invalid",
+			limits:    DefaultLimits(),
+			portfolio: Portfolio{Equity: 100000},
+			proposal:  Proposal{Symbol: "NEW", Qty: 100, Entry: 50, Stop: 50},
+			want:      []string{RuleInvalid},
+		},
+		{
+			name:      "no equity is invalid",
+			limits:    DefaultLimits(),
+			portfolio: Portfolio{},
+			proposal:  proposal,
+			want:      []string{RuleInvalid},
+		},
+		{
+			name:   "sixth position",
+			limits: DefaultLimits(),
+			portfolio: Portfolio{Equity: 100000, Holdings: []Holding{
+				small("A"), small("B"), small("C"), small("D"), small("E"),
+			}},
+			proposal: proposal,
+			want:     []string{RuleMaxPositions},
+		},
+		{
+			name:   "adding to a held symbol is not a new position",
+			limits: DefaultLimits(),
+			portfolio: Portfolio{Equity: 100000, Holdings: []Holding{
+				small("A"), small("B"), small("C"), small("D"), small("NEW"),
+			}},
+			proposal: proposal,
+		},
+		{
+			name:   "unprotected pending entry counts as open risk",
+			limits: DefaultLimits(),
+			portfolio: Portfolio{Equity: 100000, Holdings: []Holding{
+				{Symbol: "P", Qty: 100, Price: 60, Pending: true},
+			}},
+			proposal: proposal,
+			want:     []string{RuleOpenRisk},
+		},
+		{
+			name:   "sector exposure matches case-insensitively",
+			limits: DefaultLimits(),
+			portfolio: Portfolio{Equity: 100000, Holdings: []Holding{
+				{Symbol: "T", Sector: "technology", Qty: 280, Price: 100, Stop: 99},
+			}},
+			proposal: proposal,
+			want:     []string{RuleSector},
+		},
+		{
+			name:      "position too large",
+			limits:    DefaultLimits(),
+			portfolio: Portfolio{Equity: 100000},
+			proposal:  Proposal{Symbol: "NEW", Qty: 600, Entry: 50, Stop: 48},
+			want:      []string{RulePositionSize},
+		},
+		{
+			name:      "daily loss at the limit",
+			limits:    DefaultLimits(),
+			portfolio: Portfolio{Equity: 100000, DayPL: -3000},
+			proposal:  proposal,
+			want:      []string{RuleDailyLoss},
+		},
+		{
+			name:      "zero limits are not enforced",
+			limits:    Limits{},
+			portfolio: Portfolio{Equity: 100000, DayPL: -9000},
+			proposal:  Proposal{Symbol: "NEW", Sector: "Technology", Qty: 1000, Entry: 50, Stop: 40},
+		},
+		{
+			name:      "several limits at once",
+			limits:    DefaultLimits(),
+			portfolio: Portfolio{Equity: 100000, DayPL: -5000},
+			proposal:  Proposal{Symbol: "NEW", Qty: 1000, Entry: 50, Stop: 40},
+			want:      []string{RuleOpenRisk, RulePositionSize, RuleDailyLoss},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := tt.limits.Check(tt.portfolio, tt.proposal)
+			var got []string
+			for _, v := range d.Violations {
+				got = append(got, v.Rule)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("violations = %v, want %v (%s)", got, tt.want, d)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("violation %d = %s, want %s", i, got[i], tt.want[i])
+				}
+			}
+			if d.Allowed != (len(tt.want) == 0) {
+				t.Errorf("Allowed = %v with violations %v", d.Allowed, got)
+			}
+		})
+	}
+}
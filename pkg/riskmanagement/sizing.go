@@ -0,0 +1,294 @@
+package riskCalculator
+
+// Position sizing models
+//
+// RiskCalculator risks a fixed percent of the account to the stop and
+// nothing else.  SizingConfig.Size picks the percent to risk with one of
+// three models, then caps the position by liquidity and by share and
+// notional bounds:
+//
+//   fixed_fractional  risk RiskPct of equity
+//   volatility        risk RiskPct scaled down by TargetADRPct / ADR, so a
+//                     stock that moves twice the target risks half as much
+//   kelly             risk KellyFraction of the Kelly fraction implied by the
+//                     historical win rate and payoff, never more than RiskPct
+//
+// Whatever the model, the position is held to MaxDolVolPct of the average
+// daily dollar volume, MaxShares and MaxNotional.  A position smaller than
+// MinShares or MinNotional is not worth taking and sizes to zero.
+//
+// Usage:
+//   cfg, err := riskCalculator.SizingFromEnv()
+//   s := cfg.Size(riskCalculator.SizingInput{Equity: 100000, Entry: 25.40,
+//       Stop: 24.80, ADRPct: 6.2, DolVol: 180e6})
+//   if s.Shares > 0 { ... }
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Sizing models.
+const (
+	ModelFixedFractional = "fixed_fractional"
+	ModelVolatility      = "volatility"
+	ModelKelly           = "kelly"
+)
+
+// SizingConfig selects a sizing model and its caps.  Percentages are of
+// equity (RiskPct) or of dollar volume (MaxDolVolPct), like riskPerc.  A
+// zero cap or bound is not enforced.
+type SizingConfig struct {
+	Model          string
+	RiskPct        float64 // risk to the stop; the most any model risks (default 1)
+	TargetADRPct   float64 // volatility: ADR that gets the full RiskPct (default 5)
+	KellyFraction  float64 // kelly: share of full Kelly to risk (default 0.25)
+	KellyMinTrades int     // kelly: fewer trades than this size fixed-fractional (default 30)
+	MaxDolVolPct   float64 // position value vs average daily dollar volume (default 1)
+	MinShares      float64
+	MaxShares      float64
+	MinNotional    float64
+	MaxNotional    float64
+}
+
+// DefaultSizingConfig risks 1% of equity, fixed-fractional, in at most 1% of
+// a day's dollar volume.
+func DefaultSizingConfig() SizingConfig {
+	return SizingConfig{
+		Model:          ModelFixedFractional,
+		RiskPct:        1,
+		TargetADRPct:   5,
+		KellyFraction:  0.25,
+		KellyMinTrades: 30,
+		MaxDolVolPct:   1,
+	}
+}
+
+// SizingFromEnv starts from DefaultSizingConfig and applies SIZING_MODEL,
+// SIZING_RISK_PCT, SIZING_TARGET_ADR_PCT, SIZING_KELLY_FRACTION,
+// SIZING_KELLY_MIN_TRADES, SIZING_MAX_DOLVOL_PCT, SIZING_MIN_SHARES,
+// SIZING_MAX_SHARES, SIZING_MIN_NOTIONAL and SIZING_MAX_NOTIONAL.  Without
+// SIZING_RISK_PCT, RISK_PER_TRADE (a fraction, e.g. 0.01) sets RiskPct.
+func SizingFromEnv() (SizingConfig, error) {
+	c := DefaultSizingConfig()
+	if v := strings.TrimSpace(os.Getenv("SIZING_MODEL")); v != "" {
+		c.Model = strings.ToLower(v)
+	}
+	if v := strings.TrimSpace(os.Getenv("RISK_PER_TRADE")); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return c, fmt.Errorf("invalid RISK_PER_TRADE %q: %w", v, err)
+		}
+		c.RiskPct = f * 100
+	}
+	if v := strings.TrimSpace(os.Getenv("SIZING_KELLY_MIN_TRADES")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return c, fmt.Errorf("invalid SIZING_KELLY_MIN_TRADES %q: %w", v, err)
+		}
+		c.KellyMinTrades = n
+	}
+	for name, dst := range map[string]*float64{
+		"SIZING_RISK_PCT":       &c.RiskPct,
+		"SIZING_TARGET_ADR_PCT": &c.TargetADRPct,
+		"SIZING_KELLY_FRACTION": &c.KellyFraction,
+		"SIZING_MAX_DOLVOL_PCT": &c.MaxDolVolPct,
+		"SIZING_MIN_SHARES":     &c.MinShares,
+		"SIZING_MAX_SHARES":     &c.MaxShares,
+		"SIZING_MIN_NOTIONAL":   &c.MinNotional,
+		"SIZING_MAX_NOTIONAL":   &c.MaxNotional,
+	} {
+		if v := strings.TrimSpace(os.Getenv(name)); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return c, fmt.Errorf("invalid %s %q: %w", name, v, err)
+			}
+			*dst = f
+		}
+	}
+	return c, c.Validate()
+}
+
+// Validate rejects an unknown model and negative settings.
+func (c SizingConfig) Validate() error {
+	switch c.Model {
+	case ModelFixedFractional, ModelVolatility, ModelKelly:
+	default:
+		return fmt.Errorf("unknown sizing model %q (want %s, %s or %s)",
+			c.Model, ModelFixedFractional, ModelVolatility, ModelKelly)
+	}
+	if c.RiskPct <= 0 {
+		return fmt.Errorf("risk percent must be positive, got %g", c.RiskPct)
+	}
+	for name, v := range map[string]float64{
+		"target ADR":       c.TargetADRPct,
+		"Kelly fraction":   c.KellyFraction,
+		"max dollar vol %": c.MaxDolVolPct,
+		"min shares":       c.MinShares,
+		"max shares":       c.MaxShares,
+		"min notional":     c.MinNotional,
+		"max notional":     c.MaxNotional,
+	} {
+		if v < 0 {
+			return fmt.Errorf("%s must not be negative, got %g", name, v)
+		}
+	}
+	return nil
+}
+
+// TradeStats summarises closed trades for the Kelly model.  AvgWinR and
+// AvgLossR are average R-multiples of winners and losers, both positive.
+type TradeStats struct {
+	Trades   int
+	WinRate  float64 // fraction, 0–1
+	AvgWinR  float64
+	AvgLossR float64
+}
+
+// StatsFromR summarises trades given as R-multiples.  A trade at 0R or less
+// counts as a loser.
+func StatsFromR(rs []float64) TradeStats {
+	s := TradeStats{Trades: len(rs)}
+	var wins, sumWin, sumLoss float64
+	for _, r := range rs {
+		if r > 0 {
+			wins++
+			sumWin += r
+		} else {
+			sumLoss += -r
+		}
+	}
+	if s.Trades > 0 {
+		s.WinRate = wins / float64(s.Trades)
+	}
+	if wins > 0 {
+		s.AvgWinR = sumWin / wins
+	}
+	if losses := float64(s.Trades) - wins; losses > 0 {
+		s.AvgLossR = sumLoss / losses
+	}
+	return s
+}
+
+// Kelly is the full Kelly fraction W − (1 − W) / (AvgWinR / AvgLossR).  It
+// is zero or negative when the history shows no edge.
+func (s TradeStats) Kelly() float64 {
+	if s.AvgWinR <= 0 || s.AvgLossR <= 0 {
+		return 0
+	}
+	return s.WinRate - (1-s.WinRate)/(s.AvgWinR/s.AvgLossR)
+}
+
+// SizingInput is one trade to size.  ADRPct is the average daily range in
+// percent, as in StockStats.ADR; ATR, in dollars, is used when ADRPct is
+// unknown.  DolVol is the average daily dollar volume.
+type SizingInput struct {
+	Equity  float64
+	Entry   float64
+	Stop    float64
+	ADRPct  float64
+	ATR     float64
+	DolVol  float64
+	History TradeStats
+}
+
+// Sizing is the result of SizingConfig.Size.  Notes explain every fallback
+// and cap that changed the size.
+type Sizing struct {
+	Model    string
+	Shares   float64
+	RiskPct  float64 // percent of equity the model chose to risk
+	Risk     float64 // dollars lost if the stop fills
+	Notional float64
+	Equity   float64 // account equity the size was taken from
+	Notes    []string
+}
+
+// String summarises the sizing for logs.
+func (s Sizing) String() string {
+	out := fmt.Sprintf("%s: %.0f shares, $%.2f notional, $%.2f risk (%.2f%% budget)",
+		s.Model, s.Shares, s.Notional, s.Risk, s.RiskPct)
+	if len(s.Notes) > 0 {
+		out += " — " + strings.Join(s.Notes, "; ")
+	}
+	return out
+}
+
+// RiskFraction is Risk as a fraction of Equity, 0 without equity.
+func (s Sizing) RiskFraction() float64 {
+	if s.Equity <= 0 {
+		return 0
+	}
+	return s.Risk / s.Equity
+}
+
+// Size sizes in with the configured model and caps.
+func (c SizingConfig) Size(in SizingInput) Sizing {
+	s := Sizing{Model: c.Model, Equity: in.Equity}
+	note := func(format string, args ...interface{}) {
+		s.Notes = append(s.Notes, fmt.Sprintf(format, args...))
+	}
+
+	riskPerShare := in.Entry - in.Stop
+	if in.Equity <= 0 || in.Entry <= 0 || riskPerShare <= 0 {
+		note("invalid input: equity $%.2f, entry $%.2f, stop $%.2f", in.Equity, in.Entry, in.Stop)
+		return s
+	}
+
+	s.RiskPct = c.RiskPct
+	switch c.Model {
+	case ModelVolatility:
+		adr := in.ADRPct
+		if adr <= 0 && in.ATR > 0 {
+			adr = in.ATR / in.Entry * 100
+		}
+		if adr <= 0 || c.TargetADRPct <= 0 {
+			note("no volatility data, sized fixed-fractional")
+		} else if adr > c.TargetADRPct {
+			s.RiskPct = c.RiskPct * c.TargetADRPct / adr
+			note("ADR %.2f%% above target %.2f%%", adr, c.TargetADRPct)
+		}
+	case ModelKelly:
+		h := in.History
+		if h.Trades < c.KellyMinTrades {
+			note("%d trades of history, need %d for Kelly, sized fixed-fractional", h.Trades, c.KellyMinTrades)
+		} else {
+			k := h.Kelly()
+			s.RiskPct = math.Min(c.RiskPct, math.Max(0, k*c.KellyFraction*100))
+			note("Kelly %.3f from %d trades (win %.0f%%, %.2fR/%.2fR)",
+				k, h.Trades, h.WinRate*100, h.AvgWinR, h.AvgLossR)
+		}
+	}
+
+	shares := math.Floor(in.Equity * s.RiskPct / 100 / riskPerShare)
+	clamp := func(max float64, format string, args ...interface{}) {
+		if max > 0 && shares > max {
+			shares = max
+			note(format, args...)
+		}
+	}
+	if c.MaxDolVolPct > 0 && in.DolVol > 0 {
+		limit := in.DolVol * c.MaxDolVolPct / 100
+		clamp(math.Floor(limit/in.Entry), "capped at %.2f%% of $%.0fM dollar volume", c.MaxDolVolPct, in.DolVol/1e6)
+	}
+	if c.MaxNotional > 0 {
+		clamp(math.Floor(c.MaxNotional/in.Entry), "capped at $%.0f notional", c.MaxNotional)
+	}
+	clamp(c.MaxShares, "capped at %.0f shares", c.MaxShares)
+
+	if shares < c.MinShares || shares*in.Entry < c.MinNotional {
+		note("%.0f shares ($%.2f) below minimum %.0f shares / $%.0f", shares, shares*in.Entry, c.MinShares, c.MinNotional)
+		shares = 0
+	}
+	if shares < 0 {
+		shares = 0
+	}
+
+	s.Shares = shares
+	s.Notional = shares * in.Entry
+	s.Risk = shares * riskPerShare
+	return s
+}
@@ -0,0 +1,155 @@
+package riskCalculator
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSizingConfigSize(t *testing.T) {
+	// $100k equity, entry $10, stop $9: each 1% of equity risked is 1,000
+	// shares.
+	in := SizingInput{Equity: 100000, Entry: 10, Stop: 9}
+	cfg := func(edit func(*SizingConfig)) SizingConfig {
+		c := DefaultSizingConfig()
+		edit(&c)
+		return c
+	}
+	with := func(edit func(*SizingInput)) SizingInput {
+		i := in
+		edit(&i)
+		return i
+	}
+	model := func(m string) func(*SizingConfig) {
+		return func(c *SizingConfig) { c.Model = m }
+	}
+
+	tests := []struct {
+		name        string
+		cfg         SizingConfig
+		in          SizingInput
+		wantShares  float64
+		wantRiskPct float64
+	}{
+		{name: "fixed fractional", cfg: DefaultSizingConfig(), in: in, wantShares: 1000, wantRiskPct: 1},
+		{
+			name:       "invalid stop sizes to zero",
+			cfg:        DefaultSizingConfig(),
+			in:         with(func(i *SizingInput) { i.Stop = 10 }),
+			wantShares: 0,
+		},
+		{
+			name:        "capped by dollar volume",
+			cfg:         DefaultSizingConfig(),
+			in:          with(func(i *SizingInput) { i.DolVol = 500000 }),
+			wantShares:  500,
+			wantRiskPct: 1,
+		},
+		{
+			name:        "volatility above target scales risk down",
+			cfg:         cfg(model(ModelVolatility)),
+			in:          with(func(i *SizingInput) { i.ADRPct = 10 }),
+			wantShares:  500,
+			wantRiskPct: 0.5,
+		},
+		{
+			name:        "volatility from ATR without ADR",
+			cfg:         cfg(model(ModelVolatility)),
+			in:          with(func(i *SizingInput) { i.ATR = 2 }),
+			wantShares:  250,
+			wantRiskPct: 0.25,
+		},
+		{
+			name:        "volatility below target keeps full risk",
+			cfg:         cfg(model(ModelVolatility)),
+			in:          with(func(i *SizingInput) { i.ADRPct = 3 }),
+			wantShares:  1000,
+			wantRiskPct: 1,
+		},
+		{
+			name:        "kelly without enough history is fixed fractional",
+			cfg:         cfg(model(ModelKelly)),
+			in:          with(func(i *SizingInput) { i.History = TradeStats{Trades: 10, WinRate: 0.9, AvgWinR: 3, AvgLossR: 1} }),
+			wantShares:  1000,
+			wantRiskPct: 1,
+		},
+		{
+			name: "kelly below the risk cap",
+			cfg:  cfg(func(c *SizingConfig) { c.Model, c.RiskPct = ModelKelly, 5 }),
+			// Kelly 0.4 - 0.6/2 = 0.1, a quarter of it is 2.5%.
+			in:          with(func(i *SizingInput) { i.History = TradeStats{Trades: 40, WinRate: 0.4, AvgWinR: 2, AvgLossR: 1} }),
+			wantShares:  2500,
+			wantRiskPct: 2.5,
+		},
+		{
+			name:        "kelly held to the risk cap",
+			cfg:         cfg(model(ModelKelly)),
+			in:          with(func(i *SizingInput) { i.History = TradeStats{Trades: 40, WinRate: 0.4, AvgWinR: 2, AvgLossR: 1} }),
+			wantShares:  1000,
+			wantRiskPct: 1,
+		},
+		{
+			name:       "kelly without an edge risks nothing",
+			cfg:        cfg(model(ModelKelly)),
+			in:         with(func(i *SizingInput) { i.History = TradeStats{Trades: 40, WinRate: 0.3, AvgWinR: 1, AvgLossR: 1} }),
+			wantShares: 0,
+		},
+		{
+			name:        "capped by notional",
+			cfg:         cfg(func(c *SizingConfig) { c.MaxNotional = 5000 }),
+			in:          in,
+			wantShares:  500,
+			wantRiskPct: 1,
+		},
+		{
+			name:        "capped by shares",
+			cfg:         cfg(func(c *SizingConfig) { c.MaxShares = 300 }),
+			in:          in,
+			wantShares:  300,
+			wantRiskPct: 1,
+		},
+		{
+			name:        "below the minimum size",
+			cfg:         cfg(func(c *SizingConfig) { c.MinShares = 2000 }),
+			in:          in,
+			wantShares:  0,
+			wantRiskPct: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.cfg.Size(tt.in)
+			if s.Shares != tt.wantShares {
+				t.Errorf("shares = %g, want %g (%s)", s.Shares, tt.wantShares, s)
+			}
+			if math.Abs(s.RiskPct-tt.wantRiskPct) > 1e-9 {
+				t.Errorf("risk pct = %g, want %g (%s)", s.RiskPct, tt.wantRiskPct, s)
+			}
+			if s.Risk != s.Shares*(tt.in.Entry-tt.in.Stop) && s.Shares > 0 {
+				t.Errorf("risk = %g for %g shares", s.Risk, s.Shares)
+			}
+		})
+	}
+}
+
+func TestKelly(t *testing.T) {
+	tests := []struct {
+		name  string
+		stats TradeStats
+		want  float64
+	}{
+		{name: "edge", stats: TradeStats{Trades: 40, WinRate: 0.5, AvgWinR: 2, AvgLossR: 1}, want: 0.25},
+		{name: "no edge", stats: TradeStats{Trades: 40, WinRate: 0.3, AvgWinR: 1, AvgLossR: 1}, want: -0.4},
+		{name: "no losers", stats: TradeStats{Trades: 5, WinRate: 1, AvgWinR: 2}, want: 0},
+		{name: "no winners", stats: TradeStats{Trades: 5, AvgLossR: 1}, want: 0},
+		{name: "from R-multiples", stats: StatsFromR([]float64{2, -1, 3, -1, 0}), want: 0.4 - 0.6/(2.5/(2.0/3))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.stats.Kelly(); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Kelly = %g, want %g (%+v)", got, tt.want, tt.stats)
+			}
+		})
+	}
+}
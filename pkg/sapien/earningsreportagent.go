@@ -2,6 +2,7 @@ package sapien
 
 import (
 	"avantai/pkg/spec"
+	"context"
 	"fmt"
 	"io"
 	"log"
@@ -9,15 +10,11 @@ import (
 	"path/filepath"
 
 	"github.com/joho/godotenv"
-	"go.uber.org/zap"
 )
 
 func EarningsReportAgentReqInfo(stock string) {
-	const EpEarningsReportAgent = "ep-gemma-earnings-report-agent"
 	// const namespace = "avant"
 
-	logger := zap.Must(zap.NewProduction())
-
 	// Navigate to the directory and open the file
 	dirPath := fmt.Sprintf("data/%s", stock)
 
@@ -52,15 +49,7 @@ func EarningsReportAgentReqInfo(stock string) {
 
 	// apiKey := os.Getenv("SAPIEN_TOKEN")
 
-	jsonResp := false
-	agentRes, err := spec.Generate(EpEarningsReportAgent, &spec.ServeRequestSpecV3{
-		AgentNamespace: "avant",
-		AgentName:      EpEarningsReportAgent,
-		Input: []spec.NameValueTypeV3{
-			{Name: "ep_earnings", Value: string(earnings_report)},
-			{Name: "ep_past_earnings", Value: string(historical_earnings_report)},
-		},
-	}, jsonResp, logger)
+	agentRes, err := EarningsReport(context.Background(), "", string(earnings_report), string(historical_earnings_report))
 
 	// sapienApi := NewSapienApi("http://localhost:4081", apiKey, zap.Must(zap.NewProduction()))
 
@@ -105,3 +94,20 @@ func EarningsReportAgentReqInfo(stock string) {
 		os.Exit(1)
 	}
 }
+
+// EpEarningsReportAgent is the Sapien agent that writes earnings_report.txt.
+const EpEarningsReportAgent = "ep-gemma-earnings-report-agent"
+
+// EarningsReport asks the earnings agent to report on earnings against
+// past_earnings.  version "" is the version Sapien serves by default.
+func EarningsReport(ctx context.Context, version string, earnings string, past_earnings string) (string, error) {
+	return spec.GenerateContext(ctx, EpEarningsReportAgent, &spec.ServeRequestSpecV3{
+		AgentNamespace: "avant",
+		AgentName:      EpEarningsReportAgent,
+		AgentVersion:   version,
+		Input: []spec.NameValueTypeV3{
+			{Name: "ep_earnings", Value: earnings},
+			{Name: "ep_past_earnings", Value: past_earnings},
+		},
+	}, false)
+}
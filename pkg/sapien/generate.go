@@ -1,6 +1,7 @@
 package sapien
 
 import (
+	"avantai/pkg/spec"
 	"bytes"
 	"encoding/json"
 	"fmt"
@@ -114,7 +115,7 @@ func (s *SapienApi) GenerateCompletion(agentNamespace string, agentName string,
 	req.Header.Set("Authorization", "Bearer "+s.ApiKey)
 
 	fmt.Println("POST", apiUrl)
-	fmt.Println("Bearer " + s.ApiKey)
+	fmt.Println("Bearer " + spec.RedactToken(s.ApiKey))
 
 	client := http.Client{Timeout: 300 * time.Second}
 
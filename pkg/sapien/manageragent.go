@@ -2,9 +2,8 @@ package sapien
 
 import (
 	"avantai/pkg/spec"
+	"context"
 	"fmt"
-
-	"go.uber.org/zap"
 )
 
 // StockData struct to hold the OCHLV stock data
@@ -17,11 +16,28 @@ type StockData struct {
 	Volume float64 `json:"volume,string"`
 }
 
+// ManagerInput is one manager-agent request as the live worker records it
+// (responses/<date>/<symbol>/minute_N_input.json), so it can be replayed
+// against other agent versions.
+type ManagerInput struct {
+	Symbol         string  `json:"symbol"`
+	Date           string  `json:"date"`     // session date, 2006-01-02
+	BarTime        string  `json:"bar_time"` // latest bar the agent saw
+	LastPrice      float64 `json:"last_price"`
+	StockData      string  `json:"stock_data"`
+	News           string  `json:"news"`
+	EarningsReport string  `json:"earnings_report"`
+	Sentiment      string  `json:"stock_sentiment"`
+}
+
 func ManagerAgentReqInfo(stock_data string, news string, earnings_report string, sentiment string) (string, error) {
-	const EpCerebrasManagerAgent = "ep-cerebras-manager-v3-agent"
-	// const namespace = "avant"
+	return ManagerAgentReqInfoContext(context.Background(), stock_data, news, earnings_report, sentiment)
+}
 
-	logger := zap.Must(zap.NewProduction())
+// ManagerAgentReqInfoContext asks the manager agent for an entry decision on
+// the shared Sapien client; ctx cancels the request and any retries.
+func ManagerAgentReqInfoContext(ctx context.Context, stock_data string, news string, earnings_report string, sentiment string) (string, error) {
+	// const namespace = "avant"
 
 	// err := godotenv.Load()
 	// if err != nil {
@@ -33,16 +49,8 @@ func ManagerAgentReqInfo(stock_data string, news string, earnings_report string,
 	// sapienApi := NewSapienApi("http://localhost:4081", apiKey, zap.Must(zap.NewProduction()))
 
 	jsonResp := false
-	agentRes, err := spec.Generate(EpCerebrasManagerAgent, &spec.ServeRequestSpecV3{
-		AgentNamespace: "avant",
-		AgentName:      EpCerebrasManagerAgent,
-		Input: []spec.NameValueTypeV3{
-			{Name: "stock_data", Value: stock_data},
-			{Name: "news", Value: news},
-			{Name: "earnings_report", Value: earnings_report},
-			{Name: "stock_sentiment", Value: sentiment},
-		},
-	}, jsonResp, logger)
+	agentRes, err := spec.GenerateContext(ctx, EpCerebrasManagerAgent,
+		managerAgentRequest(stock_data, news, earnings_report, sentiment), jsonResp)
 
 	// statusCode, status, agentRes, err := sapienApi.GenerateCompletion(
 	// 	namespace,
@@ -69,3 +77,19 @@ func ManagerAgentReqInfo(stock_data string, news string, earnings_report string,
 
 	return agentRes, nil
 }
+
+// EpCerebrasManagerAgent is the Sapien agent that makes entry decisions.
+const EpCerebrasManagerAgent = "ep-cerebras-manager-v3-agent"
+
+func managerAgentRequest(stock_data string, news string, earnings_report string, sentiment string) *spec.ServeRequestSpecV3 {
+	return &spec.ServeRequestSpecV3{
+		AgentNamespace: "avant",
+		AgentName:      EpCerebrasManagerAgent,
+		Input: []spec.NameValueTypeV3{
+			{Name: "stock_data", Value: stock_data},
+			{Name: "news", Value: news},
+			{Name: "earnings_report", Value: earnings_report},
+			{Name: "stock_sentiment", Value: sentiment},
+		},
+	}
+}
@@ -0,0 +1,248 @@
+package sapien
+
+// Typed manager-agent decisions
+//
+// The manager agent is sent ManagerDecisionSchema as the request's declared
+// output and must answer with one JSON object matching it: an action from a
+// fixed set, numeric prices and a risk fraction, a confidence and its
+// reasons.  ParseManagerDecision decodes strictly (unknown fields and
+// strings where numbers belong are violations), falls back to jsonrepair
+// only for broken syntax, and then checks the rules the schema cannot
+// express.  ManagerAgentDecision re-asks with the violations a few times
+// and otherwise returns an error — malformed output never becomes a BUY.
+//
+// Usage:
+//   d, err := sapien.ManagerAgentDecision(ctx, bars, news, earnings, sentiment)
+//   if err == nil && d.Action == sapien.ActionBuy { ... d.EntryPrice, d.StopLoss ... }
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"avantai/pkg/spec"
+
+	"github.com/kaptinlin/jsonrepair"
+)
+
+// Action is what the manager agent wants done with the candidate.
+type Action string
+
+const (
+	ActionBuy  Action = "BUY"  // enter now at EntryPrice
+	ActionWait Action = "WAIT" // no entry yet; ask again next minute
+	ActionPass Action = "PASS" // no trade in this name today
+)
+
+// MaxRiskFraction is the most of the account a decision may propose to risk.
+const MaxRiskFraction = 0.05
+
+// ManagerDecisionAttempts is how many times ManagerAgentDecision asks before
+// giving up on a response that does not validate.
+const ManagerDecisionAttempts = 3
+
+// ManagerDecisionSchema is the JSON Schema sent to the agent.  Validate
+// enforces the same rules plus the ones between fields.
+const ManagerDecisionSchema = `{
+  "type": "object",
+  "additionalProperties": false,
+  "required": ["action", "confidence", "reasons"],
+  "properties": {
+    "action": {"type": "string", "enum": ["BUY", "WAIT", "PASS"]},
+    "entry_price": {"type": "number", "exclusiveMinimum": 0},
+    "stop_loss": {"type": "number", "exclusiveMinimum": 0, "description": "below entry_price"},
+    "targets": {"type": "array", "items": {"type": "number", "exclusiveMinimum": 0}, "description": "ascending, above entry_price"},
+    "risk_fraction": {"type": "number", "exclusiveMinimum": 0, "maximum": 0.05, "description": "fraction of the account risked to the stop, e.g. 0.01"},
+    "confidence": {"type": "number", "minimum": 0, "maximum": 1},
+    "reasons": {"type": "array", "items": {"type": "string", "minLength": 1}, "minItems": 1}
+  },
+  "if": {"properties": {"action": {"const": "BUY"}}},
+  "then": {"required": ["entry_price", "stop_loss", "risk_fraction"]}
+}`
+
+// ManagerDecision is the manager agent's answer for one minute.
+type ManagerDecision struct {
+	Action       Action    `json:"action"`
+	EntryPrice   float64   `json:"entry_price,omitempty"`
+	StopLoss     float64   `json:"stop_loss,omitempty"`
+	Targets      []float64 `json:"targets,omitempty"`
+	RiskFraction float64   `json:"risk_fraction,omitempty"`
+	Confidence   float64   `json:"confidence"`
+	Reasons      []string  `json:"reasons"`
+}
+
+// DecisionError is a response that does not satisfy ManagerDecisionSchema.
+type DecisionError struct {
+	Violations []string
+	Raw        string
+}
+
+func (e *DecisionError) Error() string {
+	return "invalid manager decision: " + strings.Join(e.Violations, "; ")
+}
+
+// Validate checks d against ManagerDecisionSchema and the rules between its
+// fields, returning a *DecisionError listing every violation.
+func (d *ManagerDecision) Validate() error {
+	var v []string
+	bad := func(format string, args ...interface{}) {
+		v = append(v, fmt.Sprintf(format, args...))
+	}
+	nonNegative := func(name string, x float64) {
+		if math.IsNaN(x) || math.IsInf(x, 0) || x < 0 {
+			bad("%s must not be negative, got %g", name, x)
+		}
+	}
+
+	switch d.Action {
+	case ActionBuy, ActionWait, ActionPass:
+	case "":
+		bad("action is required")
+	default:
+		bad("action must be one of %s, %s or %s, got %q", ActionBuy, ActionWait, ActionPass, d.Action)
+	}
+	if math.IsNaN(d.Confidence) || d.Confidence < 0 || d.Confidence > 1 {
+		bad("confidence must be between 0 and 1, got %g", d.Confidence)
+	}
+	if len(d.Reasons) == 0 {
+		bad("reasons must list at least one reason")
+	}
+	for i, r := range d.Reasons {
+		if strings.TrimSpace(r) == "" {
+			bad("reasons[%d] is empty", i)
+		}
+	}
+	nonNegative("entry_price", d.EntryPrice)
+	nonNegative("stop_loss", d.StopLoss)
+	for i, t := range d.Targets {
+		nonNegative(fmt.Sprintf("targets[%d]", i), t)
+	}
+	if math.IsNaN(d.RiskFraction) || d.RiskFraction < 0 || d.RiskFraction > MaxRiskFraction {
+		bad("risk_fraction must be between 0 and %g, got %g", MaxRiskFraction, d.RiskFraction)
+	}
+
+	if d.Action == ActionBuy {
+		if d.EntryPrice <= 0 {
+			bad("BUY requires entry_price")
+		}
+		if d.StopLoss <= 0 {
+			bad("BUY requires stop_loss")
+		}
+		if d.RiskFraction <= 0 {
+			bad("BUY requires risk_fraction")
+		}
+		if d.EntryPrice > 0 && d.StopLoss >= d.EntryPrice {
+			bad("stop_loss %.2f must be below entry_price %.2f", d.StopLoss, d.EntryPrice)
+		}
+		for i, t := range d.Targets {
+			if t <= d.EntryPrice {
+				bad("targets[%d] %.2f must be above entry_price %.2f", i, t, d.EntryPrice)
+			}
+			if i > 0 && t <= d.Targets[i-1] {
+				bad("targets must be ascending")
+				break
+			}
+		}
+	}
+
+	if len(v) > 0 {
+		return &DecisionError{Violations: v}
+	}
+	return nil
+}
+
+// ParseManagerDecision decodes and validates an agent response.  Text or
+// code fences around the object are ignored.  Broken JSON syntax is repaired
+// with jsonrepair; wrong types, unknown fields and rule violations are not,
+// and come back as a *DecisionError.
+func ParseManagerDecision(response string) (*ManagerDecision, error) {
+	raw := strings.TrimSpace(response)
+	if start, end := strings.Index(raw, "{"), strings.LastIndex(raw, "}"); start >= 0 && end > start {
+		raw = raw[start : end+1]
+	}
+	if raw == "" {
+		return nil, &DecisionError{Violations: []string{"empty response"}, Raw: response}
+	}
+
+	d, err := decodeDecision(raw)
+	var syntaxErr *json.SyntaxError
+	if err != nil && (errors.As(err, &syntaxErr) || errors.Is(err, errTrailingData) || errors.Is(err, io.ErrUnexpectedEOF)) {
+		if repaired, rerr := jsonrepair.JSONRepair(raw); rerr == nil {
+			d, err = decodeDecision(repaired)
+		}
+	}
+	if err != nil {
+		return nil, &DecisionError{Violations: []string{err.Error()}, Raw: response}
+	}
+	if err := d.Validate(); err != nil {
+		err.(*DecisionError).Raw = response
+		return nil, err
+	}
+	return d, nil
+}
+
+var errTrailingData = errors.New("unexpected data after the decision object")
+
+func decodeDecision(raw string) (*ManagerDecision, error) {
+	dec := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	dec.DisallowUnknownFields()
+	var d ManagerDecision
+	if err := dec.Decode(&d); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errTrailingData
+	}
+	return &d, nil
+}
+
+// ManagerAgentDecision asks the manager agent for a typed decision, sending
+// ManagerDecisionSchema as the declared output.  A response that does not
+// validate is asked again, with the violations and the previous answer as
+// extra inputs, up to ManagerDecisionAttempts times; after that the last
+// *DecisionError is returned.  Request errors are returned at once — the
+// client has already retried them.
+func ManagerAgentDecision(ctx context.Context, stock_data string, news string, earnings_report string, sentiment string) (*ManagerDecision, error) {
+	return ManagerAgentDecisionVersion(ctx, "", stock_data, news, earnings_report, sentiment)
+}
+
+// ManagerAgentDecisionVersion is ManagerAgentDecision against one version of
+// the agent; "" is the version Sapien serves by default.
+func ManagerAgentDecisionVersion(ctx context.Context, version string, stock_data string, news string, earnings_report string, sentiment string) (*ManagerDecision, error) {
+	req := managerAgentRequest(stock_data, news, earnings_report, sentiment)
+	req.AgentVersion = version
+	req.Output = []spec.NameTypeV3{{
+		Name:     "decision",
+		Type:     "json",
+		Format:   "application/json",
+		Schema:   ManagerDecisionSchema,
+		Required: true,
+	}}
+	input := req.Input
+
+	var lastErr error
+	for attempt := 1; attempt <= ManagerDecisionAttempts; attempt++ {
+		resp, err := spec.GenerateContext(ctx, req.AgentName, req, false)
+		if err != nil {
+			return nil, err
+		}
+		d, err := ParseManagerDecision(resp)
+		if err == nil {
+			return d, nil
+		}
+		lastErr = err
+		fmt.Printf("⚠️  manager decision attempt %d/%d rejected: %v\n", attempt, ManagerDecisionAttempts, err)
+
+		req.Input = append(append([]spec.NameValueTypeV3{}, input...),
+			spec.NameValueTypeV3{Name: "previous_response", Value: resp},
+			spec.NameValueTypeV3{Name: "validation_errors", Value: err.Error() +
+				". Answer again with only a JSON object that matches the output schema."},
+		)
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,135 @@
+package sapien
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+const validBuy = `{"action":"BUY","entry_price":10.5,"stop_loss":9.8,"targets":[11.5,12.5],"risk_fraction":0.01,"confidence":0.7,"reasons":["gap held the open"]}`
+
+func TestParseManagerDecision(t *testing.T) {
+	// wantErr is a substring of one violation; empty means the response
+	// parses and validates.
+	tests := []struct {
+		name       string
+		response   string
+		wantAction Action
+		wantErr    string
+	}{
+		{name: "bare object", response: validBuy, wantAction: ActionBuy},
+		{name: "fenced", response: "```json\n" + validBuy + "\n```", wantAction: ActionBuy},
+		{name: "wrapped in prose", response: "Here is my decision:\n" + validBuy + "\nGood luck.", wantAction: ActionBuy},
+		{
+			name:       "trailing comma repaired",
+			response:   `{"action":"WAIT","confidence":0.4,"reasons":["no volume yet"],}`,
+			wantAction: ActionWait,
+		},
+		{
+			name:       "unquoted key repaired",
+			response:   `{action:"PASS","confidence":0.9,"reasons":["too extended"]}`,
+			wantAction: ActionPass,
+		},
+		{
+			name:     "unknown field",
+			response: `{"action":"WAIT","confidence":0.4,"reasons":["x"],"size":100}`,
+			wantErr:  "unknown field",
+		},
+		{
+			name:     "string where a number belongs",
+			response: `{"action":"BUY","entry_price":"10.5","stop_loss":9.8,"risk_fraction":0.01,"confidence":0.7,"reasons":["x"]}`,
+			wantErr:  "entry_price",
+		},
+		{
+			name:     "buy without a stop",
+			response: `{"action":"BUY","entry_price":10.5,"risk_fraction":0.01,"confidence":0.7,"reasons":["x"]}`,
+			wantErr:  "BUY requires stop_loss",
+		},
+		{
+			name:     "stop at entry",
+			response: `{"action":"BUY","entry_price":10.5,"stop_loss":10.5,"risk_fraction":0.01,"confidence":0.7,"reasons":["x"]}`,
+			wantErr:  "must be below entry_price",
+		},
+		{
+			name:     "descending targets",
+			response: `{"action":"BUY","entry_price":10.5,"stop_loss":9.8,"targets":[12.5,11.5],"risk_fraction":0.01,"confidence":0.7,"reasons":["x"]}`,
+			wantErr:  "targets must be ascending",
+		},
+		{
+			name:     "negative risk",
+			response: `{"action":"BUY","entry_price":10.5,"stop_loss":9.8,"risk_fraction":-0.01,"confidence":0.7,"reasons":["x"]}`,
+			wantErr:  "risk_fraction must be between",
+		},
+		{name: "unknown action", response: `{"action":"SELL","confidence":0.5,"reasons":["x"]}`, wantErr: "action must be one of"},
+		{name: "empty", response: "  ", wantErr: "empty response"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := ParseManagerDecision(tt.response)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ParseManagerDecision: %v", err)
+				}
+				if d.Action != tt.wantAction {
+					t.Errorf("action = %s, want %s", d.Action, tt.wantAction)
+				}
+				return
+			}
+			var de *DecisionError
+			if !errors.As(err, &de) {
+				t.Fatalf("error = %v (%+v), want a *DecisionError", err, d)
+			}
+			if !strings.Contains(de.Error(), tt.wantErr) {
+				t.Errorf("error = %q, want it to mention %q", de.Error(), tt.wantErr)
+			}
+			if de.Raw != tt.response {
+				t.Errorf("Raw = %q, want the response", de.Raw)
+			}
+		})
+	}
+}
+
+func TestManagerDecisionValidate(t *testing.T) {
+	buy := func(edit func(*ManagerDecision)) ManagerDecision {
+		d := ManagerDecision{Action: ActionBuy, EntryPrice: 10, StopLoss: 9, Targets: []float64{11, 12},
+			RiskFraction: 0.01, Confidence: 0.6, Reasons: []string{"ok"}}
+		edit(&d)
+		return d
+	}
+
+	tests := []struct {
+		name    string
+		d       ManagerDecision
+		wantErr string
+	}{
+		{name: "valid buy", d: buy(func(*ManagerDecision) {})},
+		{name: "wait needs no prices", d: ManagerDecision{Action: ActionWait, Confidence: 0.2, Reasons: []string{"ok"}}},
+		{name: "NaN risk", d: buy(func(d *ManagerDecision) { d.RiskFraction = math.NaN() }), wantErr: "risk_fraction must be between"},
+		{name: "risk above the cap", d: buy(func(d *ManagerDecision) { d.RiskFraction = 0.06 }), wantErr: "risk_fraction must be between"},
+		{name: "buy without risk", d: buy(func(d *ManagerDecision) { d.RiskFraction = 0 }), wantErr: "BUY requires risk_fraction"},
+		{name: "stop above entry", d: buy(func(d *ManagerDecision) { d.StopLoss = 10.5 }), wantErr: "must be below entry_price"},
+		{name: "target below entry", d: buy(func(d *ManagerDecision) { d.Targets = []float64{9.5} }), wantErr: "must be above entry_price"},
+		{name: "negative entry", d: buy(func(d *ManagerDecision) { d.EntryPrice = -1 }), wantErr: "entry_price must not be negative"},
+		{name: "infinite target", d: buy(func(d *ManagerDecision) { d.Targets = []float64{math.Inf(-1)} }), wantErr: "targets[0] must not be negative"},
+		{name: "NaN confidence", d: buy(func(d *ManagerDecision) { d.Confidence = math.NaN() }), wantErr: "confidence must be between"},
+		{name: "blank reason", d: buy(func(d *ManagerDecision) { d.Reasons = []string{" "} }), wantErr: "reasons[0] is empty"},
+		{name: "no action", d: buy(func(d *ManagerDecision) { d.Action = "" }), wantErr: "action is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.d.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
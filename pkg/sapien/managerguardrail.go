@@ -0,0 +1,152 @@
+package sapien
+
+// Guardrail on manager-agent decisions
+//
+// Before a BUY is acted on, ManagerGuardrail runs two checks on the order
+// that will actually be placed: the agent's entry with the worker's own stop
+// and size (PlannedEntry), not the agent's stop_loss and risk_fraction.  The
+// local check blocks an entry price far from the last bar, a stop at or
+// above the market or oversized risk without calling out.  Sapien's
+// guardrail then judges the whole run — the inputs the agent saw and the
+// order being traded — for oversized risk or reasoning the data does not
+// support.  ALLOW trades, BLOCK skips the trade and HUMAN_REVIEW parks it for
+// an operator.  If the guardrail cannot be reached the verdict is
+// HUMAN_REVIEW: nothing trades unchecked.
+//
+// Usage:
+//   plan := sapien.PlannedEntry{StopLoss: stop, Shares: shares, RiskFraction: sizing.RiskFraction()}
+//   v := sapien.ManagerGuardrail(ctx, d, plan, last, bars, news, earnings, sentiment)
+//   switch v.Decision { case spec.DecisionAllow: ... }
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"avantai/pkg/spec"
+)
+
+// MaxEntryDeviationPct is how far, in percent of the last close, a proposed
+// entry may be before the local check blocks it.
+const MaxEntryDeviationPct = 2.0
+
+// Where a verdict came from.
+const (
+	GuardrailLocal       = "local"
+	GuardrailSapien      = "sapien"
+	GuardrailUnavailable = "unavailable"
+)
+
+// PlannedEntry is the stop and size the worker will trade a BUY with.  They
+// replace the decision's stop_loss and risk_fraction before it is checked.
+type PlannedEntry struct {
+	StopLoss     float64 `json:"stop_loss"`
+	Shares       float64 `json:"shares"`
+	RiskFraction float64 `json:"risk_fraction"` // shares × (entry − stop) / equity
+}
+
+// Traded returns d as it will be ordered under p.
+func (p PlannedEntry) Traded(d *ManagerDecision) *ManagerDecision {
+	traded := *d
+	traded.StopLoss = p.StopLoss
+	traded.RiskFraction = p.RiskFraction
+	return &traded
+}
+
+// GuardrailVerdict is a guardrail response plus where and when it was made.
+type GuardrailVerdict struct {
+	spec.ServeGuardrailResponseSpecV3
+	Source    string    `json:"source"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+func (v *GuardrailVerdict) String() string {
+	return fmt.Sprintf("%s (%s risk, %s): %s", v.Decision, v.RiskLevel, v.Source, v.Reason)
+}
+
+// CheckDecisionAgainstBar is the local half of ManagerGuardrail.  d is the
+// decision as traded (PlannedEntry.Traded).  It returns a BLOCK verdict, or
+// nil when the decision is consistent with last and within MaxRiskFraction.
+func CheckDecisionAgainstBar(d *ManagerDecision, last StockData) *GuardrailVerdict {
+	block := func(format string, args ...interface{}) *GuardrailVerdict {
+		return &GuardrailVerdict{
+			ServeGuardrailResponseSpecV3: spec.ServeGuardrailResponseSpecV3{
+				Decision:  spec.DecisionBlock,
+				Reason:    fmt.Sprintf(format, args...),
+				RiskLevel: spec.RiskHigh,
+			},
+			Source:    GuardrailLocal,
+			CheckedAt: time.Now(),
+		}
+	}
+	if last.Price <= 0 {
+		return block("no last price to check the entry against")
+	}
+	if dev := math.Abs(d.EntryPrice-last.Price) / last.Price * 100; dev > MaxEntryDeviationPct {
+		return block("entry $%.2f is %.2f%% from the last close $%.2f (limit %.2f%%)",
+			d.EntryPrice, dev, last.Price, MaxEntryDeviationPct)
+	}
+	if d.StopLoss >= last.Price {
+		return block("stop $%.2f is at or above the last close $%.2f", d.StopLoss, last.Price)
+	}
+	if d.RiskFraction > MaxRiskFraction {
+		return block("sized risk %.2f%% of equity is above the %.2f%% limit", d.RiskFraction*100, MaxRiskFraction*100)
+	}
+	return nil
+}
+
+// ManagerGuardrail checks a BUY from ManagerAgentDecision, as plan will
+// trade it, against the last bar and then with Sapien.  stock_data, news,
+// earnings_report and sentiment are what the agent was asked with.  It
+// always returns a verdict.
+func ManagerGuardrail(ctx context.Context, d *ManagerDecision, plan PlannedEntry, last StockData, stock_data string, news string, earnings_report string, sentiment string) *GuardrailVerdict {
+	traded := plan.Traded(d)
+	if v := CheckDecisionAgainstBar(traded, last); v != nil {
+		return v
+	}
+
+	output, err := json.Marshal(traded)
+	if err != nil {
+		return unavailable(fmt.Errorf("failed to marshal decision: %w", err))
+	}
+	order, err := json.Marshal(plan)
+	if err != nil {
+		return unavailable(fmt.Errorf("failed to marshal planned entry: %w", err))
+	}
+	req := managerAgentRequest(stock_data, news, earnings_report, sentiment)
+	resp, err := spec.GuardrailContext(ctx, &spec.ServeGuardrailRequestSpecV3{
+		AgentName:      req.AgentName,
+		AgentNamespace: req.AgentNamespace,
+		Input:          req.Input,
+		Output: []spec.NameValueTypeV3{{
+			Name:   "decision",
+			Type:   "json",
+			Format: "application/json",
+			Schema: ManagerDecisionSchema,
+			Value:  string(output),
+		}, {
+			Name:   "order",
+			Type:   "json",
+			Format: "application/json",
+			Value:  string(order),
+		}},
+	})
+	if err != nil {
+		return unavailable(err)
+	}
+	return &GuardrailVerdict{ServeGuardrailResponseSpecV3: *resp, Source: GuardrailSapien, CheckedAt: time.Now()}
+}
+
+func unavailable(err error) *GuardrailVerdict {
+	return &GuardrailVerdict{
+		ServeGuardrailResponseSpecV3: spec.ServeGuardrailResponseSpecV3{
+			Decision:  spec.DecisionHumanReview,
+			Reason:    "guardrail unavailable: " + err.Error(),
+			RiskLevel: spec.RiskMedium,
+		},
+		Source:    GuardrailUnavailable,
+		CheckedAt: time.Now(),
+	}
+}
@@ -2,6 +2,7 @@ package sapien
 
 import (
 	"avantai/pkg/spec"
+	"context"
 	"fmt"
 	"io"
 	"log"
@@ -9,15 +10,11 @@ import (
 	"path/filepath"
 
 	"github.com/joho/godotenv"
-	"go.uber.org/zap"
 )
 
 func NewsAgentReqInfo(stock string) {
-	const EpNewsAgent = "ep-gemma-news-agent"
 	// const namespace = "avant"
 
-	logger := zap.Must(zap.NewProduction())
-
 	// Navigate to the directory and open the file
 	dirPath := fmt.Sprintf("data/%s", stock)
 
@@ -54,15 +51,7 @@ func NewsAgentReqInfo(stock string) {
 
 	// sapienApi := NewSapienApi("http://localhost:4081", apiKey, zap.Must(zap.NewProduction()))
 
-	jsonResp := false
-	agentRes, err := spec.Generate(EpNewsAgent, &spec.ServeRequestSpecV3{
-		AgentNamespace: "avant",
-		AgentName:      EpNewsAgent,
-		Input: []spec.NameValueTypeV3{
-			{Name: "ep_news", Value: string(news)},
-			{Name: "ep_past_news", Value: string(past_news)},
-		},
-	}, jsonResp, logger)
+	agentRes, err := NewsReport(context.Background(), "", string(news), string(past_news))
 
 	// statusCode, status, agentRes, err := sapienApi.GenerateCompletion(
 	// 	namespace,
@@ -105,3 +94,20 @@ func NewsAgentReqInfo(stock string) {
 		os.Exit(1)
 	}
 }
+
+// EpNewsAgent is the Sapien agent that writes news_report.txt.
+const EpNewsAgent = "ep-gemma-news-agent"
+
+// NewsReport asks the news agent to report on news against past_news.
+// version "" is the version Sapien serves by default.
+func NewsReport(ctx context.Context, version string, news string, past_news string) (string, error) {
+	return spec.GenerateContext(ctx, EpNewsAgent, &spec.ServeRequestSpecV3{
+		AgentNamespace: "avant",
+		AgentName:      EpNewsAgent,
+		AgentVersion:   version,
+		Input: []spec.NameValueTypeV3{
+			{Name: "ep_news", Value: news},
+			{Name: "ep_past_news", Value: past_news},
+		},
+	}, false)
+}
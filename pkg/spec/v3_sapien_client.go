@@ -2,10 +2,18 @@ package spec
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/kaptinlin/jsonrepair"
@@ -15,6 +23,15 @@ import (
 const DefaultNamespace string = "avant"
 const DefaultSapienUrl string = "http://localhost:4081"
 
+// Client defaults, overridden by SapienConfigFromEnv.
+const (
+	DefaultSapienTimeout       = 300 * time.Second
+	DefaultSapienMaxRetries    = 3
+	DefaultSapienRetryBackoff  = time.Second
+	DefaultSapienMaxBackoff    = 30 * time.Second
+	DefaultSapienMaxConcurrent = 4
+)
+
 type HTTPError struct {
 	StatusCode int
 	Status     string
@@ -40,116 +57,443 @@ func (e *HTTPError) Unwrap() error {
 	return e.Err
 }
 
+// retryable reports whether the request is safe to send again: the server
+// turned it away with 429 or 503, or it never left this process.  Any other
+// failure may have started an agent run, and a second POST would start
+// another.
+func (e *HTTPError) retryable() bool {
+	if errors.Is(e.Err, context.Canceled) || errors.Is(e.Err, context.DeadlineExceeded) {
+		return false
+	}
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusServiceUnavailable
+}
+
+// notSent reports whether a transport error happened before the request
+// was written: the host could not be resolved or the connection refused.
+func notSent(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
 type SapienConfig struct {
-	ApiUrl    string
-	ApiKey    string
-	Namespace string
-	Timeout   time.Duration
+	ApiUrl        string
+	ApiKey        string
+	Namespace     string
+	Timeout       time.Duration // per attempt
+	MaxRetries    int           // attempts after the first, on 429, 503 or an unsent request
+	RetryBackoff  time.Duration // first wait, doubled per retry up to MaxBackoff
+	MaxBackoff    time.Duration
+	MaxConcurrent int // requests in flight at once; 0 means unlimited
+}
+
+// SapienConfigFromEnv reads SAPIEN_URL, SAPIEN_TOKEN, SAPIEN_NAMESPACE,
+// SAPIEN_TIMEOUT, SAPIEN_MAX_RETRIES, SAPIEN_RETRY_BACKOFF and
+// SAPIEN_MAX_CONCURRENT, with the defaults above for anything unset.
+func SapienConfigFromEnv() (*SapienConfig, error) {
+	c := &SapienConfig{
+		ApiUrl:        strings.TrimRight(os.Getenv("SAPIEN_URL"), "/"),
+		ApiKey:        os.Getenv("SAPIEN_TOKEN"),
+		Namespace:     os.Getenv("SAPIEN_NAMESPACE"),
+		Timeout:       DefaultSapienTimeout,
+		MaxRetries:    DefaultSapienMaxRetries,
+		RetryBackoff:  DefaultSapienRetryBackoff,
+		MaxBackoff:    DefaultSapienMaxBackoff,
+		MaxConcurrent: DefaultSapienMaxConcurrent,
+	}
+	if c.ApiUrl == "" {
+		c.ApiUrl = DefaultSapienUrl
+	}
+	if c.Namespace == "" {
+		c.Namespace = DefaultNamespace
+	}
+	for name, dst := range map[string]*time.Duration{
+		"SAPIEN_TIMEOUT":       &c.Timeout,
+		"SAPIEN_RETRY_BACKOFF": &c.RetryBackoff,
+	} {
+		if v := strings.TrimSpace(os.Getenv(name)); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q: %w", name, v, err)
+			}
+			*dst = d
+		}
+	}
+	for name, dst := range map[string]*int{
+		"SAPIEN_MAX_RETRIES":    &c.MaxRetries,
+		"SAPIEN_MAX_CONCURRENT": &c.MaxConcurrent,
+	} {
+		if v := strings.TrimSpace(os.Getenv(name)); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q: %w", name, v, err)
+			}
+			*dst = n
+		}
+	}
+	if c.ApiKey == "" {
+		return nil, fmt.Errorf("missing api key (set SAPIEN_TOKEN)")
+	}
+	return c, nil
 }
 
+// SapienClient is safe for concurrent use; one client should serve the
+// whole process (see DefaultClient).
 type SapienClient struct {
 	Config *SapienConfig
 	Client *http.Client
 	Logger *zap.Logger
+
+	slots chan struct{} // MaxConcurrent semaphore, nil if unlimited
 }
 
 func NewSapienClient(config *SapienConfig, logger *zap.Logger) *SapienClient {
-	client := &http.Client{Timeout: 300 * time.Second}
-	return &SapienClient{
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultSapienTimeout
+	}
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = DefaultSapienRetryBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = DefaultSapienMaxBackoff
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	s := &SapienClient{
 		Config: config,
-		Client: client,
+		Client: &http.Client{Timeout: config.Timeout},
 		Logger: logger,
 	}
+	if config.MaxConcurrent > 0 {
+		s.slots = make(chan struct{}, config.MaxConcurrent)
+	}
+	return s
+}
+
+var (
+	defaultClientOnce sync.Once
+	defaultClient     *SapienClient
+	defaultClientErr  error
+)
+
+// DefaultClient returns the process-wide client, built from
+// SapienConfigFromEnv on first use.
+func DefaultClient() (*SapienClient, error) {
+	defaultClientOnce.Do(func() {
+		config, err := SapienConfigFromEnv()
+		if err != nil {
+			defaultClientErr = err
+			return
+		}
+		logger, err := zap.NewProduction()
+		if err != nil {
+			logger = zap.NewNop()
+		}
+		defaultClient = NewSapienClient(config, logger)
+		logger.Info("sapien client ready",
+			zap.String("url", config.ApiUrl),
+			zap.String("namespace", config.Namespace),
+			zap.String("token", RedactToken(config.ApiKey)),
+			zap.Duration("timeout", config.Timeout),
+			zap.Int("max_retries", config.MaxRetries),
+			zap.Int("max_concurrent", config.MaxConcurrent))
+	})
+	return defaultClient, defaultClientErr
+}
+
+// RedactToken keeps the last four characters of a credential for logs.
+func RedactToken(token string) string {
+	if len(token) <= 8 {
+		return "****"
+	}
+	return "****" + token[len(token)-4:]
+}
+
+// redactURL drops any user info and query string from a URL for logs.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "<invalid url>"
+	}
+	u.User = nil
+	u.RawQuery = ""
+	return u.String()
 }
 
 func (s *SapienClient) Generate(agentName string, agentNamespace string, serverReq *ServeRequestSpecV3) (*ServeResponseSpecV3, *HTTPError) {
+	return s.GenerateContext(context.Background(), agentName, agentNamespace, serverReq)
+}
+
+// GenerateContext runs the agent, retrying with exponential backoff on 429,
+// 503 and unsent requests until MaxRetries is spent or ctx is done.
+func (s *SapienClient) GenerateContext(ctx context.Context, agentName string, agentNamespace string, serverReq *ServeRequestSpecV3) (*ServeResponseSpecV3, *HTTPError) {
 
 	if agentNamespace == "" {
 		agentNamespace = s.Config.Namespace
 	}
+	if serverReq.AgentNamespace == "" {
+		serverReq.AgentNamespace = agentNamespace
+	}
 
 	//serveUrl := s.Config.ApiUrl + "/serve/v3/agents/generate/" + url.PathEscape(agentNamespace) + "/" + url.PathEscape(agentName)
 	serveUrl := s.Config.ApiUrl + "/serve/v3/runs/agents"
-	fmt.Println("s.Generate serveUrl=", serveUrl)
 	reqBody, err := json.Marshal(serverReq)
 	if err != nil {
-		fmt.Printf("Could not read the response body %s\n", err.Error())
-		return nil, NewHTTPError(http.StatusInternalServerError, err)
+		return nil, NewHTTPError(http.StatusInternalServerError, fmt.Errorf("failed to marshal request: %w", err))
+	}
+
+	body, httpErr := s.send(ctx, "generate", agentNamespace+"/"+agentName, serveUrl, reqBody)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	resp := []ServeResponseSpecV3{}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, NewHTTPError(http.StatusInternalServerError, fmt.Errorf("failed to decode response: %w", err))
+	}
+	if len(resp) == 0 {
+		return nil, NewHTTPError(http.StatusInternalServerError, fmt.Errorf("empty response"))
+	}
+	return &resp[0], nil
+}
+
+// Guardrail asks Sapien to judge an agent run — the inputs the agent saw
+// and the output it gave — with the same retries as GenerateContext.  A
+// verdict other than ALLOW, BLOCK or HUMAN_REVIEW is an error.
+func (s *SapienClient) Guardrail(ctx context.Context, guardReq *ServeGuardrailRequestSpecV3) (*ServeGuardrailResponseSpecV3, *HTTPError) {
+	if guardReq.AgentNamespace == "" {
+		guardReq.AgentNamespace = s.Config.Namespace
 	}
 
-	req, err := http.NewRequest("POST", serveUrl, bytes.NewReader(reqBody))
+	guardUrl := s.Config.ApiUrl + "/serve/v3/runs/guardrails"
+	reqBody, err := json.Marshal(guardReq)
 	if err != nil {
-		fmt.Println(err.Error())
+		return nil, NewHTTPError(http.StatusInternalServerError, fmt.Errorf("failed to marshal request: %w", err))
+	}
+
+	body, httpErr := s.send(ctx, "guardrail", guardReq.AgentNamespace+"/"+guardReq.AgentName, guardUrl, reqBody)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	resp, err := decodeVerdict[ServeGuardrailResponseSpecV3](body)
+	if err != nil {
+		return nil, NewHTTPError(http.StatusInternalServerError, fmt.Errorf("failed to decode guardrail response: %w", err))
+	}
+	if err := checkDecision(resp.Decision); err != nil {
 		return nil, NewHTTPError(http.StatusInternalServerError, err)
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+s.Config.ApiKey)
+	return resp, nil
+}
 
-	fmt.Println("Authorization:", "Bearer "+s.Config.ApiKey)
+// Eval asks Sapien to grade an agent run — the inputs and the output of
+// AgentVersion — with the same retries as GenerateContext.  A verdict other
+// than ALLOW, BLOCK or HUMAN_REVIEW is an error.
+func (s *SapienClient) Eval(ctx context.Context, evalReq *ServeEvalRequestSpecV3) (*ServeEvalResponseSpecV3, *HTTPError) {
+	if evalReq.AgentNamespace == "" {
+		evalReq.AgentNamespace = s.Config.Namespace
+	}
 
-	//client := http.Client{Timeout: 300 * time.Second}
+	evalUrl := s.Config.ApiUrl + "/serve/v3/runs/evals"
+	reqBody, err := json.Marshal(evalReq)
+	if err != nil {
+		return nil, NewHTTPError(http.StatusInternalServerError, fmt.Errorf("failed to marshal request: %w", err))
+	}
 
-	res, err := s.Client.Do(req)
+	body, httpErr := s.send(ctx, "eval", evalReq.AgentNamespace+"/"+evalReq.AgentName, evalUrl, reqBody)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	resp, err := decodeVerdict[ServeEvalResponseSpecV3](body)
 	if err != nil {
-		fmt.Println(err.Error())
+		return nil, NewHTTPError(http.StatusInternalServerError, fmt.Errorf("failed to decode eval response: %w", err))
+	}
+	if err := checkDecision(resp.Decision); err != nil {
 		return nil, NewHTTPError(http.StatusInternalServerError, err)
 	}
-	fmt.Printf("%s\n---\n", res.Status)
-
-	defer res.Body.Close()
-	if res.StatusCode == 200 {
-		resp := []ServeResponseSpecV3{}
+	return resp, nil
+}
 
-		err = json.NewDecoder(res.Body).Decode(&resp)
-		if err != nil {
-			fmt.Println(err.Error())
-			return nil, NewHTTPError(http.StatusInternalServerError, err)
+// decodeVerdict decodes one verdict, possibly wrapped in a list like
+// generate's responses.
+func decodeVerdict[T any](body []byte) (*T, error) {
+	var resp T
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		list := []T{}
+		if err := json.Unmarshal(trimmed, &list); err != nil {
+			return nil, err
 		}
-
-		return &resp[0], nil
+		if len(list) == 0 {
+			return nil, fmt.Errorf("empty response")
+		}
+		return &list[0], nil
+	}
+	if err := json.Unmarshal(trimmed, &resp); err != nil {
+		return nil, err
 	}
-	return nil, NewHTTPError(res.StatusCode, err)
+	return &resp, nil
 }
 
-func Generate(agentName string, serverReq *ServeRequestSpecV3, jsonResp bool, logger *zap.Logger) (string, error) {
+func checkDecision(d Decision) error {
+	switch d {
+	case DecisionAllow, DecisionBlock, DecisionHumanReview:
+		return nil
+	}
+	return fmt.Errorf("unknown decision %q", d)
+}
 
-	sapienConfig := &SapienConfig{
-		ApiKey:    os.Getenv("SAPIEN_TOKEN"),
-		ApiUrl:    "http://192.168.68.108:8080",
-		Namespace: "avant",
+// send posts body to serveUrl, retrying with exponential backoff on 429,
+// 503 and unsent requests until MaxRetries is spent or ctx is done.  op and
+// agent only label the logs.
+func (s *SapienClient) send(ctx context.Context, op string, agent string, serveUrl string, reqBody []byte) ([]byte, *HTTPError) {
+	if s.slots != nil {
+		select {
+		case s.slots <- struct{}{}:
+			defer func() { <-s.slots }()
+		case <-ctx.Done():
+			return nil, NewHTTPError(http.StatusServiceUnavailable, ctx.Err())
+		}
 	}
-	//fmt.Println("Generate=", sapienConfig.ApiUrl, sapienConfig.Namespace, sapienConfig.ApiKey)
 
-	if sapienConfig.ApiKey == "" {
-		return "", fmt.Errorf("missing api key")
+	backoff := s.Config.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		body, retryAfter, httpErr := s.post(ctx, serveUrl, reqBody)
+		fields := []zap.Field{
+			zap.String("url", redactURL(serveUrl)),
+			zap.String("agent", agent),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("elapsed", time.Since(start)),
+		}
+		if httpErr == nil {
+			s.Logger.Info("sapien "+op, fields...)
+			return body, nil
+		}
+		fields = append(fields, zap.Int("status", httpErr.StatusCode), zap.Error(httpErr))
+		if !httpErr.retryable() || attempt >= s.Config.MaxRetries {
+			s.Logger.Error("sapien "+op+" failed", fields...)
+			return nil, httpErr
+		}
+
+		wait := backoff
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		if wait > s.Config.MaxBackoff {
+			wait = s.Config.MaxBackoff
+		}
+		s.Logger.Warn("sapien "+op+" retrying", append(fields, zap.Duration("wait", wait))...)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, NewHTTPError(http.StatusServiceUnavailable, ctx.Err())
+		}
+		backoff *= 2
 	}
+}
 
-	if sapienConfig.ApiUrl == "" {
-		sapienConfig.ApiUrl = DefaultSapienUrl
+// post sends one attempt and returns the response body.  retryAfter is the
+// server's Retry-After, if any.
+func (s *SapienClient) post(ctx context.Context, serveUrl string, body []byte) ([]byte, time.Duration, *HTTPError) {
+	req, err := http.NewRequestWithContext(ctx, "POST", serveUrl, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, NewHTTPError(http.StatusInternalServerError, err)
 	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.Config.ApiKey)
 
-	if sapienConfig.Namespace == "" {
-		sapienConfig.Namespace = DefaultNamespace
+	res, err := s.Client.Do(req)
+	if err != nil {
+		if notSent(err) {
+			// Never reached the server: safe to retry.
+			return nil, 0, NewHTTPError(http.StatusServiceUnavailable, err)
+		}
+		// The request may have been received; not retried.
+		return nil, 0, NewHTTPError(http.StatusBadGateway, err)
 	}
+	defer res.Body.Close()
 
-	sapienClient := NewSapienClient(sapienConfig, logger)
+	if res.StatusCode != http.StatusOK {
+		var retryAfter time.Duration
+		if secs, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil {
+			retryAfter = time.Duration(secs) * time.Second
+		}
+		snippet, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return nil, retryAfter, NewHTTPError(res.StatusCode,
+			fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(snippet))))
+	}
 
-	resp, httpErr := sapienClient.Generate(agentName, "", serverReq)
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		// Cut off mid-body: the run happened, so it is not retried.
+		return nil, 0, NewHTTPError(http.StatusBadGateway, fmt.Errorf("failed to read response: %w", err))
+	}
+	return data, 0, nil
+}
 
+// GenerateText runs the agent and returns its first output as text,
+// repaired into valid JSON when jsonResp is set.
+func (s *SapienClient) GenerateText(ctx context.Context, agentName string, serverReq *ServeRequestSpecV3, jsonResp bool) (string, error) {
+	resp, httpErr := s.GenerateContext(ctx, agentName, "", serverReq)
 	if httpErr != nil {
-		fmt.Printf("StatusCode: %d status: %s err: %s", httpErr.StatusCode, httpErr.Status, httpErr.Err)
-		return "", fmt.Errorf("%s", httpErr.Status)
+		return "", fmt.Errorf("agent %s failed (%d): %w", agentName, httpErr.StatusCode, httpErr)
+	}
+	if len(resp.Output) == 0 {
+		return "", fmt.Errorf("agent %s returned no output", agentName)
+	}
+	response, ok := resp.Output[0].Value.(string)
+	if !ok {
+		return "", fmt.Errorf("agent %s returned %T, want text", agentName, resp.Output[0].Value)
 	}
-
-	var err error
-	response := resp.Output[0].Value.(string)
 	if jsonResp {
-		response, err = jsonrepair.JSONRepair(response)
+		repaired, err := jsonrepair.JSONRepair(response)
 		if err != nil {
-			fmt.Println("Error repairing JSON:", err)
-			return "", err
+			return "", fmt.Errorf("failed to repair JSON from agent %s: %w", agentName, err)
 		}
+		response = repaired
 	}
-
 	return response, nil
 }
+
+// Generate runs agentName on the shared DefaultClient.
+func Generate(agentName string, serverReq *ServeRequestSpecV3, jsonResp bool) (string, error) {
+	return GenerateContext(context.Background(), agentName, serverReq, jsonResp)
+}
+
+// GenerateContext is Generate with cancellation.
+func GenerateContext(ctx context.Context, agentName string, serverReq *ServeRequestSpecV3, jsonResp bool) (string, error) {
+	client, err := DefaultClient()
+	if err != nil {
+		return "", err
+	}
+	return client.GenerateText(ctx, agentName, serverReq, jsonResp)
+}
+
+// GuardrailContext runs Guardrail on the shared DefaultClient.
+func GuardrailContext(ctx context.Context, guardReq *ServeGuardrailRequestSpecV3) (*ServeGuardrailResponseSpecV3, error) {
+	client, err := DefaultClient()
+	if err != nil {
+		return nil, err
+	}
+	resp, httpErr := client.Guardrail(ctx, guardReq)
+	if httpErr != nil {
+		return nil, fmt.Errorf("guardrail for %s failed (%d): %w", guardReq.AgentName, httpErr.StatusCode, httpErr)
+	}
+	return resp, nil
+}
+
+// EvalContext runs Eval on the shared DefaultClient.
+func EvalContext(ctx context.Context, evalReq *ServeEvalRequestSpecV3) (*ServeEvalResponseSpecV3, error) {
+	client, err := DefaultClient()
+	if err != nil {
+		return nil, err
+	}
+	resp, httpErr := client.Eval(ctx, evalReq)
+	if httpErr != nil {
+		return nil, fmt.Errorf("eval of %s failed (%d): %w", evalReq.AgentName, httpErr.StatusCode, httpErr)
+	}
+	return resp, nil
+}
@@ -61,6 +61,9 @@ type ServeRequestSpecV3 struct {
 	AgentVersion   string            `json:"agent_version,omitempty" yaml:"agent_version,omitempty"`
 	Model          ServeModelSpecV3  `json:"model,omitempty" yaml:"model,omitempty"`
 	Input          []NameValueTypeV3 `json:"input" yaml:"input"`
+	// Output declares the response the agent must produce; Schema holds a
+	// JSON Schema when Format is application/json.
+	Output []NameTypeV3 `json:"output,omitempty" yaml:"output,omitempty"`
 }
 
 type ServeDebugSpecV3 struct {
@@ -1,10 +1,10 @@
 package superperformance
 
 import (
+	"avantai/pkg/marketdata"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
 	"sort"
@@ -110,99 +110,72 @@ type Result struct {
 }
 
 // API Client
+//
+// MarketStackClient keeps its historical name but fetches through a
+// marketdata.Provider.  When Provider is nil a Marketstack provider is built
+// from APIKey/HTTPClient, so existing callers need no changes.
 type MarketStackClient struct {
 	APIKey     string
 	HTTPClient *http.Client
 	RateLimit  chan struct{}
+	Provider   marketdata.Provider
 }
 
-func (c *MarketStackClient) GetStockData(symbol string, dateFrom, dateTo string, exchange string) ([]StockData, error) {
-	fmt.Printf("[DEBUG] Starting API request for %s from %s to %s on exchange %s\n", symbol, dateFrom, dateTo, exchange)
-
-	var allData []StockData
-	offset := 0
-	limit := 1000
-
-	for {
-		// Rate limiting: acquire token
-		<-c.RateLimit
-		fmt.Printf("[DEBUG] Rate limit token acquired for %s (offset: %d)\n", symbol, offset)
-
-		url := fmt.Sprintf("%s/eod?access_key=%s&symbols=%s&date_from=%s&date_to=%s&limit=%d&offset=%d",
-				MARKETSTACK_API_URL, c.APIKey, symbol, dateFrom, dateTo, limit, offset)
-
-		// Build API URL with pagination
-		if exchange != "" {
-			url = fmt.Sprintf("%s/eod?access_key=%s&symbols=%s&date_from=%s&date_to=%s&limit=%d&offset=%d&exchange=%s",
-				MARKETSTACK_API_URL, c.APIKey, symbol, dateFrom, dateTo, limit, offset, exchange)
-		}
-
-		fmt.Printf("[DEBUG] API URL constructed: %s\n", strings.Replace(url, c.APIKey, "***", -1))
-
-		// Make HTTP request
-		resp, err := c.HTTPClient.Get(url)
-		if err != nil {
-			// Release rate limit token
-			c.RateLimit <- struct{}{}
-			fmt.Printf("[ERROR] HTTP request failed for %s: %v\n", symbol, err)
-			return nil, fmt.Errorf("API request failed: %v", err)
-		}
-
-		fmt.Printf("[DEBUG] HTTP response received for %s with status: %d\n", symbol, resp.StatusCode)
-
-		// Check HTTP status
-		if resp.StatusCode != 200 {
-			body, _ := io.ReadAll(resp.Body)
-			resp.Body.Close()
-			c.RateLimit <- struct{}{} // Release rate limit token
-
-			fmt.Printf("[ERROR] API returned non-200 status for %s: %d, body: %s\n", symbol, resp.StatusCode, string(body))
-
-			// Handle specific error cases
-			if resp.StatusCode == 429 {
-				return nil, fmt.Errorf("API rate limit exceeded for %s", symbol)
-			}
-			if resp.StatusCode == 404 {
-				return nil, fmt.Errorf("symbol %s not found", symbol)
-			}
-
-			return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
-		}
-
-		// Decode JSON response
-		var apiResp MarketStackResponse
-		if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
-			resp.Body.Close()
-			c.RateLimit <- struct{}{} // Release rate limit token
-			fmt.Printf("[ERROR] Failed to decode JSON response for %s: %v\n", symbol, err)
-			return nil, fmt.Errorf("failed to decode response: %v", err)
+// provider returns the configured provider, scoped to exchange when the
+// underlying vendor supports exchange filtering.
+func (c *MarketStackClient) provider(exchange string) marketdata.Provider {
+	p := c.Provider
+	if p == nil {
+		ms := marketdata.NewMarketstackProvider(c.APIKey)
+		if c.HTTPClient != nil {
+			ms.HTTPClient = c.HTTPClient
 		}
-		resp.Body.Close()
-
-		// Release rate limit token after successful request
-		c.RateLimit <- struct{}{}
-		fmt.Printf("[DEBUG] Rate limit token released for %s\n", symbol)
-
-		fmt.Printf("[DEBUG] Successfully decoded %d data points for %s (offset: %d)\n", len(apiResp.Data), symbol, offset)
-
-		// Add data to our collection
-		allData = append(allData, apiResp.Data...)
+		p = ms
+	}
+	if ms, ok := p.(*marketdata.MarketstackProvider); ok && exchange != "" {
+		scoped := *ms
+		scoped.Exchange = exchange
+		return &scoped
+	}
+	return p
+}
 
-		// Check if we have more data to fetch
-		if len(apiResp.Data) < limit {
-			fmt.Printf("[DEBUG] Reached end of data for %s (got %d records, expected %d)\n", symbol, len(apiResp.Data), limit)
-			break
-		}
+func (c *MarketStackClient) GetStockData(symbol string, dateFrom, dateTo string, exchange string) ([]StockData, error) {
+	fmt.Printf("[DEBUG] Starting API request for %s from %s to %s on exchange %s\n", symbol, dateFrom, dateTo, exchange)
 
-		// Check pagination info
-		if apiResp.Pagination.Total > 0 && len(allData) >= apiResp.Pagination.Total {
-			fmt.Printf("[DEBUG] Fetched all available data for %s (%d records)\n", symbol, len(allData))
-			break
-		}
+	from, err := time.Parse("2006-01-02", dateFrom)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date_from %q: %v", dateFrom, err)
+	}
+	to, err := time.Parse("2006-01-02", dateTo)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date_to %q: %v", dateTo, err)
+	}
 
-		offset += limit
-		fmt.Printf("[DEBUG] Fetching next batch for %s (new offset: %d)\n", symbol, offset)
+	// Rate limiting: acquire token
+	<-c.RateLimit
+	p := c.provider(exchange)
+	bars, err := p.DailyBars(symbol, from, to, marketdata.AdjustmentRaw)
+	c.RateLimit <- struct{}{} // Release rate limit token
+	if err != nil {
+		fmt.Printf("[ERROR] %s request failed for %s: %v\n", p.Name(), symbol, err)
+		return nil, fmt.Errorf("API request failed: %v", err)
+	}
+
+	allData := make([]StockData, 0, len(bars))
+	for _, bar := range bars {
+		allData = append(allData, StockData{
+			Open:     bar.Open,
+			High:     bar.High,
+			Low:      bar.Low,
+			Close:    bar.Close,
+			Volume:   bar.Volume,
+			Date:     bar.Time.Format("2006-01-02T15:04:05-0700"),
+			Symbol:   symbol,
+			Exchange: exchange,
+		})
 	}
+	fmt.Printf("[DEBUG] Received %d data points for %s from %s\n", len(allData), symbol, p.Name())
 
 	// Validate data exists
 	if len(allData) == 0 {